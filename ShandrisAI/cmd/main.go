@@ -1,9 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/aikaw/ShandrisAI/server"
 )
 
 func main() {
+	// A subcommand runs a batch job instead of the server, e.g. "mine-patterns"
+	if len(os.Args) > 1 {
+		if err := server.RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	server.StartServer()
 }
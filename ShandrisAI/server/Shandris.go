@@ -24,19 +24,24 @@ type Personality struct {
 
 // Fetch Shandris's personality from PostgreSQL
 func GetPersonality(db *sql.DB) (Personality, error) {
+	return GetPersonalityByName(db, "Shandris")
+}
+
+// GetPersonalityByName fetches a stored personality, e.g. one imported from a character card
+func GetPersonalityByName(db *sql.DB, name string) (Personality, error) {
 	var p Personality
 	query := `
 		SELECT name, formality, intelligence, interaction, self_perception, 
 			   humor, tone, empathy_level, identity, backstory 
-		FROM personality WHERE name = 'Shandris' LIMIT 1;
+		FROM personality WHERE name = $1 LIMIT 1;
 	`
-	err := db.QueryRow(query).Scan(
+	err := db.QueryRow(query, name).Scan(
 		&p.Name, &p.Formality, &p.Intelligence, &p.Interaction,
 		&p.SelfPerception, &p.Humor, &p.Tone, &p.EmpathyLevel,
 		&p.Identity, &p.Backstory,
 	)
 	if err != nil {
-		log.Println("❌ Error fetching Shandris's personality:", err)
+		log.Printf("❌ Error fetching %s's personality: %v", name, err)
 		return p, err
 	}
 	return p, nil
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// requireAdmin allows a request when it carries the SHANDRIS_ADMIN_TOKEN, or, when no token
+// is configured, when it comes from the local machine
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if token := os.Getenv("SHANDRIS_ADMIN_TOKEN"); token != "" {
+		if r.Header.Get("X-Admin-Token") == token {
+			return true
+		}
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return true
+		}
+	}
+
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// AdminPersonasHandler lists the loaded persona definitions
+func AdminPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminPersonasHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	personas, loadedAt := personaRegistry.Summaries()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"directory": personaDir,
+		"loaded_at": loadedAt.Format(time.RFC3339),
+		"personas":  personas,
+	})
+}
+
+// AdminReloadPersonasHandler re-reads the persona files; invalid files leave the current set in place
+func AdminReloadPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminReloadPersonasHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := personaRegistry.Reload(); err != nil {
+		LogError(err, "Failed to reload personas")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"reloaded": false,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	personas, _ := personaRegistry.Summaries()
+	InfoLogger.Printf("🎭 Reloaded %d personas from %s", len(personas), personaDir)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reloaded": true,
+		"personas": personas,
+	})
+}
@@ -0,0 +1,595 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// defaultRetentionPeriods is how many periods after the first a retention cohort is followed for
+const defaultRetentionPeriods = 8
+
+// AnalyticsFilter narrows a report to a date range and a session, and sets its time buckets
+type AnalyticsFilter struct {
+	From      time.Time // Inclusive; zero for no lower bound
+	To        time.Time // Exclusive; zero for no upper bound
+	SessionID string
+	Interval  string // day, week or month
+	Periods   int    // Retention periods to follow each cohort for
+}
+
+// NewAnalyticsFilter validates report options. Dates are YYYY-MM-DD or RFC 3339; a plain date
+// for to includes that whole day.
+func NewAnalyticsFilter(from, to, sessionID, interval string, periods int) (AnalyticsFilter, error) {
+	filter := AnalyticsFilter{SessionID: sessionID, Interval: interval, Periods: periods}
+	if filter.Interval == "" {
+		filter.Interval = "week"
+	}
+	switch filter.Interval {
+	case "day", "week", "month":
+	default:
+		return filter, fmt.Errorf("interval must be day, week or month, not %q", interval)
+	}
+	if filter.Periods <= 0 {
+		filter.Periods = defaultRetentionPeriods
+	}
+
+	var err error
+	if from != "" {
+		if filter.From, _, err = parseAnalyticsDate(from); err != nil {
+			return filter, fmt.Errorf("invalid from date: %w", err)
+		}
+	}
+	if to != "" {
+		var dateOnly bool
+		if filter.To, dateOnly, err = parseAnalyticsDate(to); err != nil {
+			return filter, fmt.Errorf("invalid to date: %w", err)
+		}
+		if dateOnly {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+	return filter, nil
+}
+
+func parseAnalyticsDate(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// conditions is the filter as SQL over chat_history columns with the given prefix, e.g. "h.".
+// Only rows with a user message count: a scene reply stores one row per speaker with the
+// message on the first, and proactive messages have none.
+func (f AnalyticsFilter) conditions(prefix string, args []interface{}) (string, []interface{}) {
+	conds := []string{prefix + "user_message <> ''"}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		conds = append(conds, fmt.Sprintf("%stimestamp >= $%d", prefix, len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		conds = append(conds, fmt.Sprintf("%stimestamp < $%d", prefix, len(args)))
+	}
+	if f.SessionID != "" {
+		args = append(args, f.SessionID)
+		conds = append(conds, fmt.Sprintf("%ssession_id = $%d", prefix, len(args)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (f AnalyticsFilter) includes(t time.Time) bool {
+	return (f.From.IsZero() || !t.Before(f.From)) && (f.To.IsZero() || t.Before(f.To))
+}
+
+// AnalyticsTable is a report's result. Cells are strings, numbers or times.
+type AnalyticsTable struct {
+	Report  string          `json:"report"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// analyticsReports are the reports by name
+var analyticsReports = map[string]func(AnalyticsFilter) (AnalyticsTable, error){
+	"topics":        TopicDistributionReport,
+	"transitions":   TopicTransitionReport,
+	"moods":         MoodTimelineReport,
+	"sessions":      SessionLengthReport,
+	"retention":     RetentionReport,
+	"uncategorized": UncategorizedReport,
+}
+
+// AnalyticsReportNames lists the reports RunAnalyticsReport knows
+func AnalyticsReportNames() []string {
+	names := make([]string, 0, len(analyticsReports))
+	for name := range analyticsReports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunAnalyticsReport builds the named report
+func RunAnalyticsReport(name string, filter AnalyticsFilter) (AnalyticsTable, error) {
+	defer LogOperation("RunAnalyticsReport", map[string]interface{}{
+		"report":     name,
+		"session_id": filter.SessionID,
+		"interval":   filter.Interval,
+	})(nil)
+
+	report, ok := analyticsReports[name]
+	if !ok {
+		return AnalyticsTable{}, fmt.Errorf("unknown report %q (available: %s)", name, strings.Join(AnalyticsReportNames(), ", "))
+	}
+	table, err := report(filter)
+	if err != nil {
+		return table, err
+	}
+	table.Report = name
+	if table.Rows == nil {
+		table.Rows = [][]interface{}{}
+	}
+	return table, nil
+}
+
+// TopicDistributionReport counts messages per topic in each period, with each topic's share
+func TopicDistributionReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{Columns: []string{"period", "topic", "messages", "share"}}
+	where, args := f.conditions("", []interface{}{f.Interval})
+	rows, err := db.Query(`
+		SELECT date_trunc($1, timestamp) AS period, topic, COUNT(*)
+		FROM chat_history
+		WHERE `+where+`
+		GROUP BY period, topic
+		ORDER BY period, COUNT(*) DESC, topic
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading topic distribution: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[time.Time]int)
+	for rows.Next() {
+		var period time.Time
+		var topic string
+		var count int
+		if err := rows.Scan(&period, &topic, &count); err != nil {
+			return table, fmt.Errorf("error reading topic distribution: %w", err)
+		}
+		totals[period] += count
+		table.Rows = append(table.Rows, []interface{}{period, topic, count, 0.0})
+	}
+	for _, row := range table.Rows {
+		row[3] = float64(row[2].(int)) / float64(totals[row[0].(time.Time)])
+	}
+	return table, rows.Err()
+}
+
+// TopicTransitionReport is a matrix of how often each topic follows another within a session
+func TopicTransitionReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{}
+	where, args := f.conditions("", nil)
+	rows, err := db.Query(`
+		SELECT previous, topic, COUNT(*)
+		FROM (
+			SELECT topic, LAG(topic) OVER (PARTITION BY session_id ORDER BY timestamp, id) AS previous
+			FROM chat_history
+			WHERE `+where+`
+		) turns
+		WHERE previous IS NOT NULL
+		GROUP BY previous, topic
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading topic transitions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]int)
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var from, to string
+		var count int
+		if err := rows.Scan(&from, &to, &count); err != nil {
+			return table, fmt.Errorf("error reading topic transitions: %w", err)
+		}
+		if counts[from] == nil {
+			counts[from] = make(map[string]int)
+		}
+		counts[from][to] = count
+		seen[from], seen[to] = true, true
+	}
+	if err := rows.Err(); err != nil {
+		return table, err
+	}
+
+	topics := make([]string, 0, len(seen))
+	for topic := range seen {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	table.Columns = append([]string{"from \\ to"}, topics...)
+	table.Columns = append(table.Columns, "total")
+	for _, from := range topics {
+		row := []interface{}{from}
+		total := 0
+		for _, to := range topics {
+			row = append(row, counts[from][to])
+			total += counts[from][to]
+		}
+		table.Rows = append(table.Rows, append(row, total))
+	}
+	return table, nil
+}
+
+// MoodTimelineReport lists the user's mood at each message, read from what they wrote, beside
+// the moods Shandris moved through, per session and in time order
+func MoodTimelineReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{Columns: []string{"session_id", "timestamp", "who", "mood", "intensity"}}
+	where, args := f.conditions("", nil)
+	rows, err := db.Query(`
+		SELECT session_id, timestamp, user_message
+		FROM chat_history
+		WHERE `+where+`
+		ORDER BY session_id, timestamp, id
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading messages for mood timeline: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID, message string
+		var timestamp time.Time
+		if err := rows.Scan(&sessionID, &timestamp, &message); err != nil {
+			return table, fmt.Errorf("error reading messages for mood timeline: %w", err)
+		}
+		mood, intensity := cognitive.ReadUserMood(extractMood(message), cognitive.AnalyzeSentiment(message))
+		table.Rows = append(table.Rows, []interface{}{sessionID, timestamp, "user", mood, intensity})
+	}
+	if err := rows.Err(); err != nil {
+		return table, err
+	}
+
+	moodQuery := `SELECT session_id, primary_mood, intensity, last_updated, history FROM session_moods`
+	var moodArgs []interface{}
+	if f.SessionID != "" {
+		moodQuery += ` WHERE session_id = $1`
+		moodArgs = append(moodArgs, f.SessionID)
+	}
+	moodRows, err := db.Query(moodQuery, moodArgs...)
+	if err != nil {
+		return table, fmt.Errorf("error loading Shandris's moods: %w", err)
+	}
+	defer moodRows.Close()
+
+	for moodRows.Next() {
+		var sessionID string
+		var current cognitive.MoodState
+		var historyJSON []byte
+		if err := moodRows.Scan(&sessionID, &current.Primary, &current.Intensity, &current.Timestamp, &historyJSON); err != nil {
+			return table, fmt.Errorf("error reading Shandris's moods: %w", err)
+		}
+		var history []cognitive.MoodState
+		if err := json.Unmarshal(historyJSON, &history); err != nil {
+			LogError(err, "Failed to deserialize mood history")
+		}
+		if len(history) == 0 || !history[len(history)-1].Timestamp.Equal(current.Timestamp) {
+			history = append(history, current)
+		}
+		for _, state := range history {
+			if f.includes(state.Timestamp) {
+				table.Rows = append(table.Rows, []interface{}{sessionID, state.Timestamp, "shandris", state.Primary, state.Intensity})
+			}
+		}
+	}
+	if err := moodRows.Err(); err != nil {
+		return table, err
+	}
+
+	sort.SliceStable(table.Rows, func(i, j int) bool {
+		a, b := table.Rows[i], table.Rows[j]
+		if a[0].(string) != b[0].(string) {
+			return a[0].(string) < b[0].(string)
+		}
+		return a[1].(time.Time).Before(b[1].(time.Time))
+	})
+	return table, nil
+}
+
+// SessionLengthReport describes each session: its span, how many messages and separate
+// conversations it had, on how many days, and the topic it is on now
+func SessionLengthReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{Columns: []string{
+		"session_id", "first_message", "last_message", "messages", "conversations",
+		"messages_per_conversation", "active_days", "current_topic",
+	}}
+	where, args := f.conditions("", []interface{}{fmt.Sprintf("%d seconds", int(cognitive.ConversationGap.Seconds()))})
+	rows, err := db.Query(`
+		SELECT s.session_id, s.first_message, s.last_message, s.messages, s.conversations, s.active_days,
+			COALESCE(c.current_topic, '')
+		FROM (
+			SELECT session_id, MIN(timestamp) AS first_message, MAX(timestamp) AS last_message,
+				COUNT(*) AS messages,
+				COUNT(*) FILTER (WHERE gap IS NULL OR gap > $1::interval) AS conversations,
+				COUNT(DISTINCT timestamp::date) AS active_days
+			FROM (
+				SELECT session_id, timestamp,
+					timestamp - LAG(timestamp) OVER (PARTITION BY session_id ORDER BY timestamp, id) AS gap
+				FROM chat_history
+				WHERE `+where+`
+			) turns
+			GROUP BY session_id
+		) s
+		LEFT JOIN session_context c ON c.session_id = s.session_id
+		ORDER BY s.first_message
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading session lengths: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sessionID, topic string
+		var first, last time.Time
+		var messages, conversations, days int
+		if err := rows.Scan(&sessionID, &first, &last, &messages, &conversations, &days, &topic); err != nil {
+			return table, fmt.Errorf("error reading session lengths: %w", err)
+		}
+		perConversation := float64(messages) / float64(max(conversations, 1))
+		table.Rows = append(table.Rows, []interface{}{sessionID, first, last, messages, conversations, perConversation, days, topic})
+	}
+	return table, rows.Err()
+}
+
+// RetentionReport groups sessions by the period of their first message and shows, for each
+// later period, the share of the cohort that came back. A session's cohort comes from its
+// first message ever; the date range picks which cohorts are reported.
+func RetentionReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{Columns: []string{"cohort", "sessions"}}
+	for i := 0; i <= f.Periods; i++ {
+		table.Columns = append(table.Columns, fmt.Sprintf("+%d", i))
+	}
+
+	where, args := AnalyticsFilter{SessionID: f.SessionID}.conditions("", []interface{}{f.Interval})
+	query := `
+		WITH activity AS (
+			SELECT session_id, date_trunc($1, timestamp) AS period, MIN(timestamp) AS first_message
+			FROM chat_history
+			WHERE ` + where + `
+			GROUP BY session_id, period
+		), cohorts AS (
+			SELECT session_id, MIN(period) AS cohort, MIN(first_message) AS first_message
+			FROM activity
+			GROUP BY session_id
+		)
+		SELECT a.session_id, c.cohort, a.period
+		FROM activity a
+		JOIN cohorts c ON c.session_id = a.session_id
+		WHERE TRUE`
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		query += fmt.Sprintf(" AND c.first_message >= $%d", len(args))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		query += fmt.Sprintf(" AND c.first_message < $%d", len(args))
+	}
+	rows, err := db.Query(query+`
+		ORDER BY a.session_id, a.period
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading session activity: %w", err)
+	}
+	defer rows.Close()
+
+	active := make(map[time.Time][]int) // cohort -> sessions active in each period after it
+	sizes := make(map[time.Time]int)
+	for rows.Next() {
+		var sessionID string
+		var cohort, period time.Time
+		if err := rows.Scan(&sessionID, &cohort, &period); err != nil {
+			return table, fmt.Errorf("error reading session activity: %w", err)
+		}
+		if active[cohort] == nil {
+			active[cohort] = make([]int, f.Periods+1)
+		}
+		if period.Equal(cohort) {
+			sizes[cohort]++
+		}
+		if offset := periodsBetween(cohort, period, f.Interval); offset <= f.Periods {
+			active[cohort][offset]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return table, err
+	}
+
+	cohorts := make([]time.Time, 0, len(sizes))
+	for cohort := range sizes {
+		cohorts = append(cohorts, cohort)
+	}
+	sort.Slice(cohorts, func(i, j int) bool { return cohorts[i].Before(cohorts[j]) })
+	for _, cohort := range cohorts {
+		row := []interface{}{cohort, sizes[cohort]}
+		for _, count := range active[cohort] {
+			row = append(row, float64(count)/float64(sizes[cohort]))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// periodsBetween counts whole periods from one period start to a later one
+func periodsBetween(from, to time.Time, interval string) int {
+	switch interval {
+	case "month":
+		return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+	case "week":
+		return int(to.Sub(from).Round(24*time.Hour).Hours()/24) / 7
+	default:
+		return int(to.Sub(from).Round(24*time.Hour).Hours() / 24)
+	}
+}
+
+// UncategorizedReport is the share of messages per period the classifier could not place
+func UncategorizedReport(f AnalyticsFilter) (AnalyticsTable, error) {
+	table := AnalyticsTable{Columns: []string{"period", "messages", "uncategorized", "rate"}}
+	where, args := f.conditions("", []interface{}{f.Interval})
+	rows, err := db.Query(`
+		SELECT date_trunc($1, timestamp) AS period, COUNT(*),
+			COUNT(*) FILTER (WHERE topic = 'uncategorized' OR topic = '')
+		FROM chat_history
+		WHERE `+where+`
+		GROUP BY period
+		ORDER BY period
+	`, args...)
+	if err != nil {
+		return table, fmt.Errorf("error loading uncategorized rates: %w", err)
+	}
+	defer rows.Close()
+
+	totalMessages, totalUncategorized := 0, 0
+	for rows.Next() {
+		var period time.Time
+		var messages, uncategorized int
+		if err := rows.Scan(&period, &messages, &uncategorized); err != nil {
+			return table, fmt.Errorf("error reading uncategorized rates: %w", err)
+		}
+		totalMessages += messages
+		totalUncategorized += uncategorized
+		table.Rows = append(table.Rows, []interface{}{period, messages, uncategorized, float64(uncategorized) / float64(messages)})
+	}
+	if err := rows.Err(); err != nil {
+		return table, err
+	}
+	if totalMessages > 0 {
+		table.Rows = append(table.Rows, []interface{}{"total", totalMessages, totalUncategorized,
+			float64(totalUncategorized) / float64(totalMessages)})
+	}
+	return table, nil
+}
+
+// WriteAnalytics writes a report as an aligned text table, CSV or JSON
+func WriteAnalytics(w io.Writer, table AnalyticsTable, format string) error {
+	switch format {
+	case "", "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(table.Columns, "\t"))
+		for _, row := range table.Rows {
+			fmt.Fprintln(tw, strings.Join(analyticsCells(row), "\t"))
+		}
+		if len(table.Rows) == 0 {
+			fmt.Fprintln(tw, "(no data)")
+		}
+		return tw.Flush()
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(table.Columns); err != nil {
+			return err
+		}
+		for _, row := range table.Rows {
+			if err := cw.Write(analyticsCells(row)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "json":
+		return json.NewEncoder(w).Encode(table)
+	}
+	return fmt.Errorf("format must be text, csv or json, not %q", format)
+}
+
+func analyticsCells(row []interface{}) []string {
+	cells := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case time.Time:
+			if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+				cells[i] = v.Format("2006-01-02")
+			} else {
+				cells[i] = v.Format("2006-01-02 15:04")
+			}
+		case float64:
+			cells[i] = strconv.FormatFloat(v, 'f', 3, 64)
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	return cells
+}
+
+// AdminAnalyticsHandler serves a report from /api/admin/analytics/<report>, filtered by the
+// from, to, session_id, interval and periods parameters, in the format parameter's format
+// (json by default). Without a report it lists the reports.
+func AdminAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminAnalyticsHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/analytics"), "/")
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"reports": AnalyticsReportNames()})
+		return
+	}
+	if _, ok := analyticsReports[name]; !ok {
+		http.Error(w, "Unknown report", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	periods, _ := strconv.Atoi(query.Get("periods"))
+	filter, err := NewAnalyticsFilter(query.Get("from"), query.Get("to"), query.Get("session_id"), query.Get("interval"), periods)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	switch format {
+	case "", "json":
+		format = "json"
+		w.Header().Set("Content-Type", "application/json")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	default:
+		http.Error(w, "format must be text, csv or json", http.StatusBadRequest)
+		return
+	}
+
+	table, err := RunAnalyticsReport(name, filter)
+	if err != nil {
+		LogError(err, "Failed to build analytics report")
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+	if err := WriteAnalytics(w, table, format); err != nil {
+		LogError(err, "Failed to write analytics report")
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// boundaryCeilingKey is the deployment setting holding the boundary ceiling
+const boundaryCeilingKey = "boundary_ceiling"
+
+var (
+	ceilingMu sync.RWMutex
+	// boundaryCeiling is the most permissive boundaries any user may choose. It starts from
+	// SHANDRIS_MAX_RATING and SHANDRIS_ALLOW_ROMANCE and can be changed by an admin.
+	boundaryCeiling = defaultBoundaryCeiling()
+)
+
+// BoundarySettings is a user's boundaries as stored, and as enforced under the ceiling
+type BoundarySettings struct {
+	Boundaries cognitive.Boundaries `json:"boundaries"`
+	Effective  cognitive.Boundaries `json:"effective"`
+	Ceiling    cognitive.Boundaries `json:"ceiling"`
+}
+
+// InitBoundaries loads the admin's boundary ceiling, if one was saved
+func InitBoundaries() {
+	var raw []byte
+	err := db.QueryRow(`SELECT value FROM deployment_settings WHERE key = $1`, boundaryCeilingKey).Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			LogError(err, "Failed to load boundary ceiling")
+		}
+		return
+	}
+
+	var ceiling cognitive.Boundaries
+	if err := json.Unmarshal(raw, &ceiling); err != nil || ceiling.Validate() != nil {
+		LogError(fmt.Errorf("invalid boundary ceiling %s", raw), "Failed to load boundary ceiling")
+		return
+	}
+	setBoundaryCeiling(ceiling)
+	InfoLogger.Printf("🛡️ Boundary ceiling: %s", ceiling)
+}
+
+// BoundaryCeiling returns the deployment-wide boundary ceiling
+func BoundaryCeiling() cognitive.Boundaries {
+	ceilingMu.RLock()
+	defer ceilingMu.RUnlock()
+	return boundaryCeiling
+}
+
+// SaveBoundaryCeiling validates, stores and applies a new ceiling
+func SaveBoundaryCeiling(ceiling cognitive.Boundaries) error {
+	if ceiling.AvoidTopics == nil {
+		ceiling.AvoidTopics = []string{}
+	}
+	if err := ceiling.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(ceiling)
+	if err != nil {
+		return fmt.Errorf("error serializing boundary ceiling: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO deployment_settings (key, value, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`, boundaryCeilingKey, raw)
+	if err != nil {
+		return fmt.Errorf("error saving boundary ceiling: %w", err)
+	}
+	setBoundaryCeiling(ceiling)
+	return nil
+}
+
+func setBoundaryCeiling(ceiling cognitive.Boundaries) {
+	ceilingMu.Lock()
+	defer ceilingMu.Unlock()
+	boundaryCeiling = ceiling
+}
+
+// LoadBoundaries returns the boundaries the user chose, before the ceiling is applied
+func LoadBoundaries(sessionID string) cognitive.Boundaries {
+	value, _ := RecallMemory(sessionID, "boundaries")
+	return cognitive.ParseBoundaries(value)
+}
+
+// SaveBoundaries stores the user's boundaries
+func SaveBoundaries(sessionID string, b cognitive.Boundaries) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	SaveMemory(sessionID, "boundaries", b.String())
+	InfoLogger.Printf("🛡️ Boundaries for session %s: %s", sessionID, b)
+	return nil
+}
+
+// sessionBoundaries returns the boundaries enforced for the session: the user's own,
+// limited by the deployment ceiling
+func sessionBoundaries(sessionID string) cognitive.Boundaries {
+	return LoadBoundaries(sessionID).Clamp(BoundaryCeiling())
+}
+
+// boundarySettings reports a session's boundaries for the API
+func boundarySettings(sessionID string) BoundarySettings {
+	stored := LoadBoundaries(sessionID)
+	ceiling := BoundaryCeiling()
+	return BoundarySettings{Boundaries: stored, Effective: stored.Clamp(ceiling), Ceiling: ceiling}
+}
+
+// boundaryCommandReply runs a /boundaries command, reporting whether the boundaries changed
+func boundaryCommandReply(sessionID, prompt string) (string, bool) {
+	cmd, err := cognitive.ParseBoundaryCommand(prompt)
+	if err != nil {
+		return "I couldn't make sense of that. " + capitalize(err.Error()) + ".", false
+	}
+
+	current := LoadBoundaries(sessionID)
+	if cmd.Action != "show" {
+		current = current.Apply(cmd)
+		if err := SaveBoundaries(sessionID, current); err != nil {
+			return capitalize(err.Error()) + ".", false
+		}
+	}
+
+	effective := current.Clamp(BoundaryCeiling())
+	var b strings.Builder
+	if cmd.Action == "show" {
+		b.WriteString("Here's where your boundaries stand.\n")
+	} else {
+		b.WriteString("Done. Your boundaries are updated.\n")
+	}
+	romance := "off"
+	if effective.Romance {
+		romance = "on"
+	}
+	b.WriteString(fmt.Sprintf("• Romance and flirting: %s\n", romance))
+	b.WriteString(fmt.Sprintf("• Content rating: %s\n", effective.Rating))
+	if len(effective.AvoidTopics) > 0 {
+		b.WriteString(fmt.Sprintf("• Topics I'll steer clear of: %s\n", strings.Join(effective.AvoidTopics, ", ")))
+	}
+	if current.Romance != effective.Romance || current.Rating != effective.Rating {
+		b.WriteString("Some of that is capped by how I'm set up here, so I'll stay within those limits.\n")
+	}
+	return strings.TrimSpace(b.String()), cmd.Action != "show"
+}
+
+// BoundariesHandler reads (GET ?session_id=) and replaces (PUT/POST) a user's boundaries
+func BoundariesHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("BoundariesHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			LogError(fmt.Errorf("missing session ID"), "Request validation")
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(boundarySettings(sessionID))
+
+	case http.MethodPost, http.MethodPut:
+		var req struct {
+			SessionID string `json:"session_id"`
+			cognitive.Boundaries
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.SessionID == "" {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+		boundaries := cognitive.Boundaries{Romance: req.Romance, Rating: strings.ToLower(req.Rating)}
+		if boundaries.Rating == "" {
+			boundaries.Rating = cognitive.DefaultBoundaries().Rating
+		}
+		for _, topic := range req.AvoidTopics {
+			boundaries = boundaries.Apply(cognitive.BoundaryCommand{Action: "avoid", Value: topic})
+		}
+		if err := SaveBoundaries(req.SessionID, boundaries); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		json.NewEncoder(w).Encode(boundarySettings(req.SessionID))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdminBoundariesHandler reads (GET) and sets (PUT/POST) the deployment-wide boundary ceiling
+func AdminBoundariesHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminBoundariesHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(BoundaryCeiling())
+
+	case http.MethodPost, http.MethodPut:
+		var ceiling cognitive.Boundaries
+		if err := json.NewDecoder(r.Body).Decode(&ceiling); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		ceiling.Rating = strings.ToLower(ceiling.Rating)
+		if err := SaveBoundaryCeiling(ceiling); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		InfoLogger.Printf("🛡️ Boundary ceiling set to: %s", ceiling)
+		json.NewEncoder(w).Encode(BoundaryCeiling())
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func defaultBoundaryCeiling() cognitive.Boundaries {
+	rating := strings.ToLower(envOr("SHANDRIS_MAX_RATING", cognitive.RatingMature))
+	if !cognitive.ValidRating(rating) {
+		rating = cognitive.RatingMature
+	}
+	return cognitive.Boundaries{
+		Romance:     envOr("SHANDRIS_ALLOW_ROMANCE", "true") != "false",
+		Rating:      rating,
+		AvoidTopics: []string{},
+	}
+}
@@ -0,0 +1,751 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+)
+
+// Character card spec identifiers
+const (
+	cardSpecV2        = "chara_card_v2"
+	cardSpecVersion   = "2.0"
+	cardPNGKeyword    = "chara"
+	shandrisExtension = "shandris"
+)
+
+// maxCardSize bounds uploaded cards; PNG cards carry the character art
+const maxCardSize = 16 << 20
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// ErrCardConflict means a card would replace an existing character or persona
+var ErrCardConflict = errors.New("character already exists")
+
+// CharacterCard is a community character card (spec v2)
+type CharacterCard struct {
+	Spec        string            `json:"spec"`
+	SpecVersion string            `json:"spec_version"`
+	Data        CharacterCardData `json:"data"`
+}
+
+// CharacterCardData holds the card's character fields
+type CharacterCardData struct {
+	Name                    string                     `json:"name"`
+	Description             string                     `json:"description"`
+	Personality             string                     `json:"personality"`
+	Scenario                string                     `json:"scenario"`
+	FirstMes                string                     `json:"first_mes"`
+	MesExample              string                     `json:"mes_example"`
+	CreatorNotes            string                     `json:"creator_notes"`
+	SystemPrompt            string                     `json:"system_prompt"`
+	PostHistoryInstructions string                     `json:"post_history_instructions"`
+	AlternateGreetings      []string                   `json:"alternate_greetings"`
+	CharacterBook           *CharacterBook             `json:"character_book,omitempty"`
+	Tags                    []string                   `json:"tags"`
+	Creator                 string                     `json:"creator"`
+	CharacterVersion        string                     `json:"character_version"`
+	Extensions              map[string]json.RawMessage `json:"extensions"`
+}
+
+// CharacterBook is the lorebook embedded in a card
+type CharacterBook struct {
+	Name              string                     `json:"name,omitempty"`
+	Description       string                     `json:"description,omitempty"`
+	ScanDepth         *int                       `json:"scan_depth,omitempty"`
+	TokenBudget       *int                       `json:"token_budget,omitempty"`
+	RecursiveScanning *bool                      `json:"recursive_scanning,omitempty"`
+	Extensions        map[string]json.RawMessage `json:"extensions"`
+	Entries           []CharacterBookEntry       `json:"entries"`
+}
+
+// CharacterBookEntry is a single lorebook entry of a card
+type CharacterBookEntry struct {
+	Keys           []string                   `json:"keys"`
+	Content        string                     `json:"content"`
+	Extensions     map[string]json.RawMessage `json:"extensions"`
+	Enabled        bool                       `json:"enabled"`
+	InsertionOrder int                        `json:"insertion_order"`
+	CaseSensitive  *bool                      `json:"case_sensitive,omitempty"`
+	Name           string                     `json:"name,omitempty"`
+	Priority       *int                       `json:"priority,omitempty"`
+	ID             *int                       `json:"id,omitempty"`
+	Comment        string                     `json:"comment,omitempty"`
+	Selective      *bool                      `json:"selective,omitempty"`
+	SecondaryKeys  []string                   `json:"secondary_keys,omitempty"`
+	Constant       *bool                      `json:"constant,omitempty"`
+	Position       string                     `json:"position,omitempty"`
+}
+
+// shandrisCardExtension carries the personality fields so exported cards import back exactly
+type shandrisCardExtension struct {
+	Formality      string `json:"formality"`
+	Intelligence   string `json:"intelligence"`
+	Interaction    string `json:"interaction"`
+	SelfPerception string `json:"self_perception"`
+	Humor          string `json:"humor"`
+	Tone           string `json:"tone"`
+	EmpathyLevel   string `json:"empathy_level"`
+	Identity       string `json:"identity"`
+	Backstory      string `json:"backstory"`
+}
+
+// CardImportResult summarises what an import created
+type CardImportResult struct {
+	Name        string `json:"name"`
+	PersonaID   string `json:"persona_id,omitempty"`
+	LoreEntries int    `json:"lore_entries"`
+}
+
+// ParseCharacterCard reads a card from JSON (v1 or v2) or from a PNG with a "chara" tEXt chunk
+func ParseCharacterCard(raw []byte) (*CharacterCard, error) {
+	if bytes.HasPrefix(raw, pngSignature) {
+		text, err := readPNGText(raw, cardPNGKeyword)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding card from PNG: %w", err)
+		}
+		raw = decoded
+	}
+
+	var probe struct {
+		Spec string `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, fmt.Errorf("error parsing character card: %w", err)
+	}
+
+	card := &CharacterCard{}
+	if probe.Spec == cardSpecV2 {
+		if err := json.Unmarshal(raw, card); err != nil {
+			return nil, fmt.Errorf("error parsing character card: %w", err)
+		}
+	} else {
+		// v1 cards keep the fields at the top level
+		if err := json.Unmarshal(raw, &card.Data); err != nil {
+			return nil, fmt.Errorf("error parsing v1 character card: %w", err)
+		}
+		card.Spec, card.SpecVersion = cardSpecV2, cardSpecVersion
+	}
+
+	if strings.TrimSpace(card.Data.Name) == "" {
+		return nil, errors.New("character card has no name")
+	}
+	return card, nil
+}
+
+// EncodeCharacterCardPNG embeds the card in a PNG. Without a base image a 1x1 placeholder is used.
+func EncodeCharacterCardPNG(card *CharacterCard, base []byte) ([]byte, error) {
+	if base == nil {
+		var buf bytes.Buffer
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		img.Set(0, 0, color.RGBA{R: 0x4b, G: 0x2a, B: 0x6e, A: 0xff})
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("error encoding placeholder image: %w", err)
+		}
+		base = buf.Bytes()
+	}
+
+	payload, err := json.Marshal(card)
+	if err != nil {
+		return nil, fmt.Errorf("error serializing character card: %w", err)
+	}
+	return writePNGText(base, cardPNGKeyword, base64.StdEncoding.EncodeToString(payload))
+}
+
+// CardToPersonality maps a card onto the personality fields. Cards exported by Shandris
+// carry the exact fields in their extensions; others are inferred from the card text.
+func CardToPersonality(card *CharacterCard) Personality {
+	data := card.Data
+	if raw, ok := data.Extensions[shandrisExtension]; ok {
+		var ext shandrisCardExtension
+		if err := json.Unmarshal(raw, &ext); err == nil {
+			return Personality{
+				Name:           data.Name,
+				Formality:      ext.Formality,
+				Intelligence:   ext.Intelligence,
+				Interaction:    ext.Interaction,
+				SelfPerception: ext.SelfPerception,
+				Humor:          ext.Humor,
+				Tone:           ext.Tone,
+				EmpathyLevel:   ext.EmpathyLevel,
+				Identity:       ext.Identity,
+				Backstory:      ext.Backstory,
+			}
+		}
+	}
+
+	traits := strings.ToLower(data.Personality + " " + data.Description)
+	backstory := data.Description
+	if data.Scenario != "" {
+		backstory += "\n\nScenario: " + data.Scenario
+	}
+
+	return Personality{
+		Name:           data.Name,
+		Formality:      pickKeyword(traits, cardFormality, "balanced"),
+		Intelligence:   pickKeyword(traits, cardIntelligence, "sharp"),
+		Interaction:    firstSentence(data.FirstMes, "engaging"),
+		SelfPerception: pickKeyword(traits, cardSelfPerception, "self-assured"),
+		Humor:          pickKeyword(traits, cardHumor, "subtle"),
+		Tone:           strings.TrimSpace(data.Personality),
+		EmpathyLevel:   pickKeyword(traits, cardEmpathy, "moderate"),
+		Identity:       data.Name,
+		Backstory:      backstory,
+	}
+}
+
+// PersonalityToCard builds a card for a personality. When the character was imported from
+// a card, that card is the base so fields Shandris doesn't model survive the round trip.
+func PersonalityToCard(p Personality, base *CharacterCard) (*CharacterCard, error) {
+	card := &CharacterCard{Spec: cardSpecV2, SpecVersion: cardSpecVersion}
+	if base != nil {
+		copied := *base
+		card = &copied
+		card.Data.Extensions = make(map[string]json.RawMessage, len(base.Data.Extensions))
+		for k, v := range base.Data.Extensions {
+			card.Data.Extensions[k] = v
+		}
+	} else {
+		card.Data = CharacterCardData{
+			Name:        p.Name,
+			Description: p.Backstory,
+			Personality: fmt.Sprintf("Tone: %s. Humor: %s. Intelligence: %s. Empathy: %s. Formality: %s.",
+				p.Tone, p.Humor, p.Intelligence, p.EmpathyLevel, p.Formality),
+			CreatorNotes:       "Exported from Shandris.",
+			AlternateGreetings: []string{},
+			Tags:               []string{},
+		}
+	}
+	if card.Data.Extensions == nil {
+		card.Data.Extensions = make(map[string]json.RawMessage)
+	}
+
+	ext, err := json.Marshal(shandrisCardExtension{
+		Formality:      p.Formality,
+		Intelligence:   p.Intelligence,
+		Interaction:    p.Interaction,
+		SelfPerception: p.SelfPerception,
+		Humor:          p.Humor,
+		Tone:           p.Tone,
+		EmpathyLevel:   p.EmpathyLevel,
+		Identity:       p.Identity,
+		Backstory:      p.Backstory,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error serializing personality extension: %w", err)
+	}
+	card.Data.Extensions[shandrisExtension] = ext
+	return card, nil
+}
+
+// CardToPersonaDefinition derives a persona definition from the card's personality traits
+func CardToPersonaDefinition(card *CharacterCard) cognitive.PersonaDefinition {
+	traits := make(map[string]float64)
+	for i, trait := range splitTraits(card.Data.Personality) {
+		weight := 0.7
+		if i < 3 {
+			// Cards list the defining traits first
+			weight = 0.8
+		}
+		traits[trait] = weight
+	}
+	if len(traits) == 0 {
+		traits["in_character"] = 0.7
+	}
+
+	humor := pickKeyword(strings.ToLower(card.Data.Personality), cardHumor, "")
+	rule := cognitive.StyleRuleDefinition{
+		Condition: "casual",
+		Response:  "in character",
+		Tone:      humor,
+		Priority:  1,
+	}
+
+	return cognitive.PersonaDefinition{
+		Version:     cognitive.PersonaSchemaVersion,
+		ID:          slugify(card.Data.Name),
+		Name:        card.Data.Name,
+		Type:        cognitive.CustomPersona,
+		Traits:      traits,
+		MoodBias:    map[string]float64{},
+		StyleRules:  []cognitive.StyleRuleDefinition{rule},
+		Preferences: map[string]interface{}{"contexts": map[string]interface{}{"casual": 0.3}},
+	}
+}
+
+// ImportCharacterCard stores a card as a personality, optionally a persona definition, and its lore.
+// A card never replaces an existing character or persona unless overwrite is set.
+func ImportCharacterCard(card *CharacterCard, withPersona, overwrite bool) (CardImportResult, error) {
+	result := CardImportResult{Name: card.Data.Name}
+
+	if !overwrite {
+		if err := checkCardConflicts(card, withPersona); err != nil {
+			return result, err
+		}
+	}
+
+	if err := SavePersonality(CardToPersonality(card)); err != nil {
+		return result, err
+	}
+	if err := saveCharacterCard(card); err != nil {
+		return result, err
+	}
+
+	if withPersona {
+		id, err := writePersonaDefinition(CardToPersonaDefinition(card), overwrite)
+		if err != nil {
+			return result, err
+		}
+		result.PersonaID = id
+	}
+
+	if card.Data.CharacterBook != nil {
+		count, err := saveCardLore(card.Data.Name, card.Data.CharacterBook)
+		if err != nil {
+			return result, err
+		}
+		result.LoreEntries = count
+	}
+
+	InfoLogger.Printf("🃏 Imported character card %s (persona: %q, lore entries: %d)", result.Name, result.PersonaID, result.LoreEntries)
+	return result, nil
+}
+
+// checkCardConflicts reports ErrCardConflict when the card's name is already a stored
+// personality, or its persona ID is already a persona
+func checkCardConflicts(card *CharacterCard, withPersona bool) error {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM personality WHERE name = $1)`, card.Data.Name).Scan(&exists); err != nil {
+		return fmt.Errorf("error checking for an existing personality: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("%w: a personality named %q", ErrCardConflict, card.Data.Name)
+	}
+	if withPersona {
+		if id := slugify(card.Data.Name); personaExists(id) {
+			return fmt.Errorf("%w: a persona with ID %q", ErrCardConflict, id)
+		}
+	}
+	return nil
+}
+
+// personaExists reports whether a persona is loaded with the ID or a file is waiting under its name
+func personaExists(id string) bool {
+	summaries, _ := personaRegistry.Summaries()
+	for _, s := range summaries {
+		if s.ID == id {
+			return true
+		}
+	}
+	_, err := os.Stat(filepath.Join(personaDir, id+".json"))
+	return err == nil
+}
+
+// ExportCharacterCard builds the card for a stored personality
+func ExportCharacterCard(name string) (*CharacterCard, error) {
+	personality, err := GetPersonalityByName(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := loadCharacterCard(name)
+	if err != nil {
+		return nil, err
+	}
+	return PersonalityToCard(personality, base)
+}
+
+// SavePersonality updates a personality by name, inserting it if it doesn't exist
+func SavePersonality(p Personality) error {
+	result, err := db.Exec(`
+		UPDATE personality SET formality = $2, intelligence = $3, interaction = $4, self_perception = $5,
+			humor = $6, tone = $7, empathy_level = $8, identity = $9, backstory = $10
+		WHERE name = $1
+	`, p.Name, p.Formality, p.Intelligence, p.Interaction, p.SelfPerception,
+		p.Humor, p.Tone, p.EmpathyLevel, p.Identity, p.Backstory)
+	if err != nil {
+		return fmt.Errorf("error updating personality: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO personality (name, formality, intelligence, interaction, self_perception,
+			humor, tone, empathy_level, identity, backstory)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, p.Name, p.Formality, p.Intelligence, p.Interaction, p.SelfPerception,
+		p.Humor, p.Tone, p.EmpathyLevel, p.Identity, p.Backstory)
+	if err != nil {
+		return fmt.Errorf("error inserting personality: %w", err)
+	}
+	return nil
+}
+
+// saveCharacterCard keeps the imported card so export can return the fields Shandris doesn't model
+func saveCharacterCard(card *CharacterCard) error {
+	raw, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("error serializing character card: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO character_cards (name, card)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET card = EXCLUDED.card, updated_at = CURRENT_TIMESTAMP
+	`, card.Data.Name, raw)
+	if err != nil {
+		return fmt.Errorf("error saving character card: %w", err)
+	}
+	return nil
+}
+
+// loadCharacterCard returns the stored card for a character, or nil if it wasn't imported
+func loadCharacterCard(name string) (*CharacterCard, error) {
+	var raw []byte
+	err := db.QueryRow(`SELECT card FROM character_cards WHERE name = $1`, name).Scan(&raw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error loading character card: %w", err)
+	}
+
+	card := &CharacterCard{}
+	if err := json.Unmarshal(raw, card); err != nil {
+		return nil, fmt.Errorf("error parsing stored character card: %w", err)
+	}
+	return card, nil
+}
+
+// saveCardLore stores the card's lorebook entries for the character; invalid entries are skipped
+func saveCardLore(character string, book *CharacterBook) (int, error) {
+	count := 0
+	for _, entry := range cardBookToLore(character, book) {
+		if cognitive.ValidateLoreEntry(entry) != nil {
+			continue
+		}
+		if err := SaveLoreEntry(&entry); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// cardLoreScope names a character book for its entries' IDs: the character and the book's
+// name, or its entries when it has none, so two unrelated books never share IDs
+func cardLoreScope(character string, book *CharacterBook) string {
+	source := book.Name
+	if source == "" {
+		entries, _ := json.Marshal(book.Entries)
+		source = string(entries)
+	}
+	return character + "/" + source
+}
+
+// cardLoreID is stable per book entry, so re-importing a card updates its lore instead of duplicating it
+func cardLoreID(scope string, index int) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("card/%s/%d", scope, index))).String()
+}
+
+// writePersonaDefinition writes the definition into the persona directory and reloads the registry.
+// An existing file is only replaced when overwrite is set. If the registry rejects the
+// definition, a file the import created is removed and a replaced one is restored.
+func writePersonaDefinition(def cognitive.PersonaDefinition, overwrite bool) (string, error) {
+	raw, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error serializing persona definition: %w", err)
+	}
+	raw = append(raw, '\n')
+
+	path := filepath.Join(personaDir, def.ID+".json")
+	previous, err := os.ReadFile(path)
+	existed := err == nil
+	if existed && !overwrite {
+		return "", fmt.Errorf("%w: a persona file %s", ErrCardConflict, filepath.Base(path))
+	}
+
+	if existed {
+		err = os.WriteFile(path, raw, 0o644)
+	} else {
+		// O_EXCL so a file created since the check above is never clobbered
+		var file *os.File
+		if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err == nil {
+			_, err = file.Write(raw)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing persona definition: %w", err)
+	}
+
+	if err := personaRegistry.Reload(); err != nil {
+		if existed {
+			if restoreErr := os.WriteFile(path, previous, 0o644); restoreErr != nil {
+				LogError(restoreErr, "Failed to restore persona definition "+path)
+			}
+		} else {
+			os.Remove(path)
+		}
+		return "", fmt.Errorf("imported persona rejected: %w", err)
+	}
+	return def.ID, nil
+}
+
+// AdminImportCardHandler imports a character card posted as JSON or PNG.
+// Pass ?persona=false to skip creating a persona definition, and ?overwrite=true to replace
+// a character or persona that already exists.
+func AdminImportCardHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminImportCardHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxCardSize))
+	if err != nil {
+		http.Error(w, "Could not read card", http.StatusBadRequest)
+		return
+	}
+	card, err := ParseCharacterCard(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	result, err := ImportCharacterCard(card, query.Get("persona") != "false", query.Get("overwrite") == "true")
+	if errors.Is(err, ErrCardConflict) {
+		http.Error(w, err.Error()+"; pass overwrite=true to replace it", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		LogError(err, "Failed to import character card")
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// AdminExportCardHandler exports a personality as a card: ?name=...&format=json|png
+func AdminExportCardHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminExportCardHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "Shandris"
+	}
+	card, err := ExportCharacterCard(name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unknown character", http.StatusNotFound)
+			return
+		}
+		LogError(err, "Failed to export character card")
+		http.Error(w, "Failed to export character card", http.StatusInternalServerError)
+		return
+	}
+
+	filename := slugify(name)
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		json.NewEncoder(w).Encode(card)
+	case "png":
+		image, err := EncodeCharacterCardPNG(card, nil)
+		if err != nil {
+			LogError(err, "Failed to encode character card PNG")
+			http.Error(w, "Failed to export character card", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".png"))
+		w.Write(image)
+	default:
+		http.Error(w, "Unknown format", http.StatusBadRequest)
+	}
+}
+
+// Helper functions
+
+var (
+	cardFormality      = map[string]string{"formal": "formal", "polite": "formal", "proper": "formal", "casual": "casual", "laid-back": "casual", "crude": "casual"}
+	cardIntelligence   = map[string]string{"genius": "brilliant", "brilliant": "brilliant", "smart": "sharp", "clever": "sharp", "intelligent": "sharp", "wise": "wise", "naive": "naive"}
+	cardSelfPerception = map[string]string{"confident": "confident", "arrogant": "arrogant", "proud": "proud", "shy": "insecure", "insecure": "insecure", "humble": "humble"}
+	cardHumor          = map[string]string{"sarcastic": "sarcastic", "witty": "witty", "dry": "dry", "playful": "playful", "deadpan": "deadpan", "goofy": "goofy", "dark": "dark"}
+	cardEmpathy        = map[string]string{"caring": "high", "kind": "high", "empathetic": "high", "compassionate": "high", "cold": "low", "aloof": "low", "distant": "low"}
+)
+
+// pickKeyword returns the value of the earliest keyword found in text
+func pickKeyword(text string, keywords map[string]string, fallback string) string {
+	best, bestIdx := fallback, -1
+	for keyword, value := range keywords {
+		idx := strings.Index(text, keyword)
+		if idx >= 0 && (bestIdx < 0 || idx < bestIdx || (idx == bestIdx && value < best)) {
+			best, bestIdx = value, idx
+		}
+	}
+	return best
+}
+
+var traitSeparators = regexp.MustCompile(`[,;/\n]+|\band\b`)
+
+// splitTraits turns "witty, sarcastic and fiercely loyal" into short snake_case trait names
+func splitTraits(personality string) []string {
+	var traits []string
+	seen := make(map[string]bool)
+	for _, part := range traitSeparators.Split(strings.ToLower(personality), -1) {
+		words := strings.Fields(strings.Trim(part, " .!?\"'"))
+		if len(words) == 0 || len(words) > 3 {
+			continue
+		}
+		trait := strings.Join(words, "_")
+		if !seen[trait] {
+			seen[trait] = true
+			traits = append(traits, trait)
+		}
+	}
+	return traits
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(name string) string {
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "character"
+	}
+	return slug
+}
+
+func firstSentence(text, fallback string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fallback
+	}
+	if idx := strings.IndexAny(text, ".!?\n"); idx > 0 {
+		return text[:idx+1]
+	}
+	return text
+}
+
+// readPNGText returns the value of the first tEXt chunk with the given keyword
+func readPNGText(raw []byte, keyword string) (string, error) {
+	pos := len(pngSignature)
+	for pos+8 <= len(raw) {
+		length := int(binary.BigEndian.Uint32(raw[pos : pos+4]))
+		chunkType := string(raw[pos+4 : pos+8])
+		end := pos + 8 + length + 4
+		if length < 0 || end > len(raw) {
+			return "", errors.New("truncated PNG chunk")
+		}
+
+		if chunkType == "tEXt" {
+			data := raw[pos+8 : pos+8+length]
+			if sep := bytes.IndexByte(data, 0); sep >= 0 && string(data[:sep]) == keyword {
+				return string(data[sep+1:]), nil
+			}
+		}
+		if chunkType == "IEND" {
+			break
+		}
+		pos = end
+	}
+	return "", fmt.Errorf("PNG has no %q text chunk", keyword)
+}
+
+// writePNGText replaces any tEXt chunks with the keyword by a new one placed before IEND
+func writePNGText(raw []byte, keyword, value string) ([]byte, error) {
+	if !bytes.HasPrefix(raw, pngSignature) {
+		return nil, errors.New("not a PNG image")
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos+8 <= len(raw) {
+		length := int(binary.BigEndian.Uint32(raw[pos : pos+4]))
+		chunkType := string(raw[pos+4 : pos+8])
+		end := pos + 8 + length + 4
+		if length < 0 || end > len(raw) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+
+		if chunkType == "tEXt" {
+			data := raw[pos+8 : pos+8+length]
+			if sep := bytes.IndexByte(data, 0); sep >= 0 && string(data[:sep]) == keyword {
+				pos = end
+				continue
+			}
+		}
+		if chunkType == "IEND" {
+			writePNGChunk(&out, "tEXt", append(append([]byte(keyword), 0), value...))
+		}
+		out.Write(raw[pos:end])
+		if chunkType == "IEND" {
+			return out.Bytes(), nil
+		}
+		pos = end
+	}
+	return nil, errors.New("PNG has no IEND chunk")
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	out.Write(header[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+
+	out.WriteString(chunkType)
+	out.Write(data)
+	binary.BigEndian.PutUint32(header[:], crc.Sum32())
+	out.Write(header[:])
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+func testCard() *CharacterCard {
+	enabled := true
+	return &CharacterCard{
+		Spec:        cardSpecV2,
+		SpecVersion: cardSpecVersion,
+		Data: CharacterCardData{
+			Name:               "Mira Vale",
+			Description:        "A lighthouse keeper who collects other people's secrets.",
+			Personality:        "witty, caring, confident, a little secretive",
+			Scenario:           "A storm has stranded a traveller at the lighthouse.",
+			FirstMes:           "Shut the door, the wind bites. Tea?",
+			MesExample:         "<START>\n{{user}}: Who are you?\n{{char}}: The one who keeps the light on.",
+			CreatorNotes:       "Works best slow-paced.",
+			AlternateGreetings: []string{"Another one washed up by the storm."},
+			CharacterBook: &CharacterBook{
+				Name: "Lighthouse",
+				Entries: []CharacterBookEntry{{
+					Keys:       []string{"lighthouse", "lamp"},
+					Content:    "The lamp has not gone dark in forty years.",
+					Enabled:    enabled,
+					Extensions: map[string]json.RawMessage{},
+				}},
+				Extensions: map[string]json.RawMessage{},
+			},
+			Tags:             []string{"fantasy", "slow burn"},
+			Creator:          "someone",
+			CharacterVersion: "1.2",
+			Extensions:       map[string]json.RawMessage{"other_app": json.RawMessage(`{"keep":true}`)},
+		},
+	}
+}
+
+// roundTrip imports a card and exports it again the way ImportCharacterCard and
+// ExportCharacterCard do: the personality plus the stored card as the export's base
+func roundTrip(t *testing.T, card *CharacterCard) (Personality, *CharacterCard) {
+	t.Helper()
+	personality := CardToPersonality(card)
+	exported, err := PersonalityToCard(personality, card)
+	if err != nil {
+		t.Fatalf("PersonalityToCard: %v", err)
+	}
+	return personality, exported
+}
+
+func TestCharacterCardRoundTrip(t *testing.T) {
+	encoders := map[string]func(*CharacterCard) ([]byte, error){
+		"json": func(card *CharacterCard) ([]byte, error) { return json.Marshal(card) },
+		"png":  func(card *CharacterCard) ([]byte, error) { return EncodeCharacterCardPNG(card, nil) },
+	}
+
+	for format, encode := range encoders {
+		t.Run(format, func(t *testing.T) {
+			raw, err := encode(testCard())
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			imported, err := ParseCharacterCard(raw)
+			if err != nil {
+				t.Fatalf("first import: %v", err)
+			}
+			personality, exported := roundTrip(t, imported)
+
+			raw, err = encode(exported)
+			if err != nil {
+				t.Fatalf("encode export: %v", err)
+			}
+			if format == "png" {
+				if _, err := png.Decode(bytes.NewReader(raw)); err != nil {
+					t.Fatalf("exported PNG is not a valid image: %v", err)
+				}
+			}
+			reimported, err := ParseCharacterCard(raw)
+			if err != nil {
+				t.Fatalf("second import: %v", err)
+			}
+
+			if got := CardToPersonality(reimported); got != personality {
+				t.Errorf("personality changed in the round trip:\n got %+v\nwant %+v", got, personality)
+			}
+
+			// Fields Shandris doesn't model survive unchanged
+			want := testCard().Data
+			got := reimported.Data
+			if got.Description != want.Description || got.FirstMes != want.FirstMes ||
+				got.MesExample != want.MesExample || got.Scenario != want.Scenario ||
+				got.CharacterVersion != want.CharacterVersion {
+				t.Errorf("card text changed in the round trip: %+v", got)
+			}
+			if !reflect.DeepEqual(got.Tags, want.Tags) || !reflect.DeepEqual(got.AlternateGreetings, want.AlternateGreetings) {
+				t.Errorf("tags or greetings changed: %v %v", got.Tags, got.AlternateGreetings)
+			}
+			if got.CharacterBook == nil || len(got.CharacterBook.Entries) != 1 ||
+				got.CharacterBook.Entries[0].Content != want.CharacterBook.Entries[0].Content {
+				t.Errorf("character book changed: %+v", got.CharacterBook)
+			}
+			if string(got.Extensions["other_app"]) != `{"keep":true}` {
+				t.Errorf("foreign extension lost: %s", got.Extensions["other_app"])
+			}
+			if _, ok := got.Extensions[shandrisExtension]; !ok {
+				t.Error("export is missing the shandris extension")
+			}
+		})
+	}
+}
+
+func TestCharacterCardRoundTripWithoutBase(t *testing.T) {
+	// A personality that was never imported exports from its own fields
+	personality := Personality{
+		Name: "Shandris", Formality: "casual", Intelligence: "brilliant", Interaction: "teasing",
+		SelfPerception: "confident", Humor: "sarcastic", Tone: "sassy", EmpathyLevel: "high",
+		Identity: "Shandris", Backstory: "An elven sorceress.",
+	}
+	card, err := PersonalityToCard(personality, nil)
+	if err != nil {
+		t.Fatalf("PersonalityToCard: %v", err)
+	}
+	image, err := EncodeCharacterCardPNG(card, nil)
+	if err != nil {
+		t.Fatalf("EncodeCharacterCardPNG: %v", err)
+	}
+	imported, err := ParseCharacterCard(image)
+	if err != nil {
+		t.Fatalf("ParseCharacterCard: %v", err)
+	}
+	if got := CardToPersonality(imported); got != personality {
+		t.Errorf("got %+v, want %+v", got, personality)
+	}
+}
+
+func TestWritePersonaDefinitionKeepsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, oldRegistry := personaDir, personaRegistry
+	personaDir, personaRegistry = dir, cognitive.NewPersonaRegistry(dir)
+	t.Cleanup(func() { personaDir, personaRegistry = oldDir, oldRegistry })
+
+	shipped := filepath.Join(dir, "mira_vale.json")
+	original := []byte(`{"shipped": true}`)
+	if err := os.WriteFile(shipped, original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	def := CardToPersonaDefinition(testCard())
+	if _, err := writePersonaDefinition(def, false); !errors.Is(err, ErrCardConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if raw, _ := os.ReadFile(shipped); !bytes.Equal(raw, original) {
+		t.Fatalf("existing persona file was changed: %s", raw)
+	}
+
+	// When the registry rejects the directory, an overwritten file is restored rather than
+	// deleted, and only a file the import created is removed
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writePersonaDefinition(def, true); err == nil {
+		t.Fatal("expected the registry to reject the persona directory")
+	}
+	if raw, err := os.ReadFile(shipped); err != nil || !bytes.Equal(raw, original) {
+		t.Fatalf("overwritten persona file was not restored: %s, %v", raw, err)
+	}
+
+	def.ID = "mira_vale_2"
+	if _, err := writePersonaDefinition(def, false); err == nil {
+		t.Fatal("expected the registry to reject the persona directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mira_vale_2.json")); !os.IsNotExist(err) {
+		t.Errorf("rejected persona file was left behind: %v", err)
+	}
+	if _, err := os.Stat(broken); err != nil {
+		t.Errorf("a file the import didn't create was removed: %v", err)
+	}
+}
+
+func TestCardLoreIDs(t *testing.T) {
+	bookA := &CharacterBook{Entries: []CharacterBookEntry{{Keys: []string{"harbor"}, Content: "The harbor froze."}}}
+	bookB := &CharacterBook{Entries: []CharacterBookEntry{{Keys: []string{"guild"}, Content: "The guild is broke."}}}
+
+	a, b := cardBookToLore("", bookA), cardBookToLore("", bookB)
+	if a[0].ID == b[0].ID {
+		t.Error("two unrelated books share an entry ID")
+	}
+	if again := cardBookToLore("", bookA); again[0].ID != a[0].ID {
+		t.Error("re-importing a book changed its entry IDs")
+	}
+
+	named := testCard().Data.CharacterBook
+	before := cardBookToLore("mira_vale", named)
+	named.Entries[0].Content = "The lamp flickered once, in 1987."
+	if after := cardBookToLore("mira_vale", named); after[0].ID != before[0].ID {
+		t.Error("editing a named book changed its entry IDs")
+	}
+}
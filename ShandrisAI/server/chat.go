@@ -7,25 +7,38 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
 )
 
 type ChatRequest struct {
 	SessionID string `json:"session_id"`
 	Prompt    string `json:"prompt"`
-}
-
-type ChatResponse struct {
-	Response string `json:"response"`
+	Timezone  string `json:"timezone,omitempty"` // IANA zone, e.g. "Australia/Sydney"
 }
 
 // Removes any <think>...</think> blocks and metadata from the model output.
+// Fenced code blocks are left verbatim.
 func stripChainOfThought(resp string) string {
 	re := regexp.MustCompile(`(?s)<think>.*?</think>\s*`)
 	cleaned := re.ReplaceAllString(resp, "")
-	reMeta := regexp.MustCompile(`(?m)^(User:|Assistant:|---)+\s*`)
-	return strings.TrimSpace(reMeta.ReplaceAllString(cleaned, ""))
+	reMeta := regexp.MustCompile(`(?m)^(User:|Assistant:|---)+[ \t]*`)
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range codeBlock.FindAllStringIndex(cleaned, -1) {
+		b.WriteString(reMeta.ReplaceAllString(cleaned[last:loc[0]], ""))
+		b.WriteString(cleaned[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(reMeta.ReplaceAllString(cleaned[last:], ""))
+	return strings.TrimSpace(b.String())
 }
 
+// codeBlock matches a fenced code block
+var codeBlock = regexp.MustCompile("(?s)```.*?```")
+
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
 	defer LogOperation("ChatHandler", map[string]interface{}{
 		"method": r.Method,
@@ -44,40 +57,52 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 	// Set CORS and content type headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	turn := newChatTurn()
 
 	body, _ := io.ReadAll(r.Body)
 	var req ChatRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		LogError(err, "Failed to parse request body")
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		turn.fail(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
 	// Validate session ID
 	if req.SessionID == "" {
 		LogError(fmt.Errorf("missing session ID"), "Request validation")
-		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		turn.fail(w, http.StatusBadRequest, "Session ID is required")
 		return
 	}
+	turn.sessionID = req.SessionID
 
 	DebugLogger.Printf("📥 Received chat request - SessionID: %s, Prompt: %s", req.SessionID, req.Prompt)
 
+	// Every message is screened for crisis signals before anything else shapes the reply
+	safety := cognitive.AssessSafety(req.Prompt)
+	if safety.Severity > cognitive.SafetyNone {
+		RecordSafetyEvent(req.SessionID, safety)
+		turn.safety = safety.Severity.String()
+	}
+	// A crisis always gets the protective reply, never a canned reply or a command's
+	shortcuts := !safety.Protective()
+
 	// Handle mood clearing separately
-	if detectMoodClear(req.Prompt) {
-		SaveMemory(req.SessionID, "mood", "")
+	if shortcuts && detectMoodClear(req.Prompt) {
+		turn.remember("mood", "")
 		fmt.Println("🧹 Cleared user mood for session:", req.SessionID)
-		json.NewEncoder(w).Encode(ChatResponse{Response: "Got it. Mood deleted. I'll stop pretending you're grumpy, even if your typing says otherwise. 😏"})
+		turn.system(w, "Got it. Mood deleted. I'll stop pretending you're grumpy, even if your typing says otherwise. 😏")
 		return
 	}
 
 	// Handle memory-based inferences
-	if profile, isProfileCreation := ExtractPersonaProfile(req.Prompt); isProfileCreation {
+	if profile, isProfileCreation := ExtractPersonaProfile(req.Prompt); isProfileCreation && shortcuts {
 		err := SavePersonaProfile(req.SessionID, profile)
 		if err != nil {
 			LogError(err, "Failed to save persona profile")
 		} else {
 			InfoLogger.Printf("✅ Saved persona profile for session: %s", req.SessionID)
-			json.NewEncoder(w).Encode(ChatResponse{Response: "I've stored your personal information permanently. I'll remember these details about you, even across different conversations. Is there anything specific from your background you'd like to discuss?"})
+			turn.recordWrite(WriteProfile, "profile", profile.Name)
+			turn.system(w, "I've stored your personal information permanently. I'll remember these details about you, even across different conversations. Is there anything specific from your background you'd like to discuss?")
 			return
 		}
 	}
@@ -91,68 +116,303 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 				profile, err := GetPersonaProfile(existingSessionID)
 				if err == nil {
 					SavePersonaProfile(req.SessionID, profile)
+					turn.recordWrite(WriteProfile, "profile", profile.Name)
 					InfoLogger.Printf("🔄 Linked existing profile for %s to new session: %s", name, req.SessionID)
 				}
 			}
 		}
 
-		SaveMemory(req.SessionID, "user_name", name)
+		turn.remember("user_name", name)
 		InfoLogger.Printf("🧠 Saved user name: %s for session: %s", name, req.SessionID)
 	}
-	if mood := extractMood(req.Prompt); mood != "" {
-		SaveMemory(req.SessionID, "mood", mood)
-		InfoLogger.Printf("🧠 Saved user mood: %s for session: %s", mood, req.SessionID)
+	// Dates are evaluated on the user's wall clock
+	loc := ResolveUserLocation(req.SessionID, req.Timezone)
+	now := time.Now().In(loc)
+	EnsureFirstMeeting(req.SessionID, now)
+	if birthday, ok := extractBirthday(req.Prompt, loc); ok {
+		SaveBirthday(req.SessionID, birthday)
+		turn.recordWrite(WriteDate, "birthday", birthday.Format("2006-01-02"))
 	}
 
-	// Topic tracking logic
+	if shortcuts && cognitive.IsReminderRequest(req.Prompt) {
+		turn.system(w, reminderReply(req.SessionID, req.Prompt, now))
+		return
+	}
+
+	if shortcuts && cognitive.IsBoundaryCommand(req.Prompt) {
+		reply, changed := boundaryCommandReply(req.SessionID, req.Prompt)
+		if changed {
+			turn.recordWrite(WriteMemory, "boundaries", LoadBoundaries(req.SessionID).String())
+		}
+		turn.system(w, reply)
+		return
+	}
+
+	if shortcuts && cognitive.IsWorldCommand(req.Prompt) {
+		turn.system(w, worldCommandReply(req.SessionID, req.Prompt, now))
+		return
+	}
+
+	if shortcuts && cognitive.IsSceneCommand(req.Prompt) {
+		turn.system(w, sceneCommandReply(req.SessionID, req.Prompt))
+		return
+	}
+
+	statedMood := extractMood(req.Prompt)
+	userMood := statedMood
+	if statedMood != "" {
+		turn.remember("mood", statedMood)
+		InfoLogger.Printf("🧠 Saved user mood: %s for session: %s", statedMood, req.SessionID)
+	} else {
+		userMood, _ = RecallMemory(req.SessionID, "mood")
+	}
+
+	// Advance Shandris's own mood with this turn
 	newTopic := ClassifyPrompt(req.Prompt)
-	currentTopic := GetCurrentTopic(req.SessionID)
+	boundaries := sessionBoundaries(req.SessionID)
+	if safety.Protective() {
+		boundaries.Romance = false
+	}
+	shandrisMood := UpdateShandrisMood(req.SessionID, req.Prompt, newTopic, userMood, boundaries)
+	if safety.Protective() {
+		shandrisMood = cognitive.ProtectiveMood(shandrisMood)
+	}
+
+	// Topic tracking logic: attach the turn to its most relevant thread
+	previousTopic := GetCurrentTopic(req.SessionID)
+	topics := LoadTopicManager(req.SessionID)
+	// Read the turn's themes and sentiment, then carry Shandris's mood on it
+	emotional := new(cognitive.EmotionalContext)
+	*emotional = AnalyzeSessionTurn(req.SessionID, req.Prompt, boundaries)
+	emotional.PrimaryEmotion = shandrisMood.Primary
+	emotional.Intensity = shandrisMood.Intensity
+	emotional.UserMood = userMood
+	if statedMood != "" {
+		emotional.Sentiment = userMoodSentiment[userMood]
+	}
+	emotional.IsEmotional = emotional.IsEmotional || statedMood != "" || safety.Severity > cognitive.SafetyNone
+	emotional.Timestamp = shandrisMood.Timestamp
+	thread, resumed := topics.AttachTurn(req.Prompt, newTopic, emotional)
+	SaveTopicManager(req.SessionID, topics)
+	currentTopic := thread.MainTopic
+
+	DebugLogger.Printf("📊 Topic Analysis - Previous: %s, Classified: %s, Thread: %s (%s)", previousTopic, newTopic, thread.ID, currentTopic)
 
-	DebugLogger.Printf("📊 Topic Analysis - Current: %s, New: %s", currentTopic, newTopic)
+	if resumed {
+		InfoLogger.Printf("🧵 Resumed earlier thread %s on %s for session: %s", thread.ID, currentTopic, req.SessionID)
+	}
+	if currentTopic != previousTopic {
+		SetCurrentTopic(req.SessionID, currentTopic)
+		InfoLogger.Printf("🔄 Topic transitioned from %s to %s for session: %s", previousTopic, currentTopic, req.SessionID)
+	}
 
-	if currentTopic == "uncategorized" && newTopic != "uncategorized" {
-		SetCurrentTopic(req.SessionID, newTopic)
-		currentTopic = newTopic
-		InfoLogger.Printf("🔥 Topic set to: %s for session: %s", newTopic, req.SessionID)
-	} else if newTopic != currentTopic && newTopic != "uncategorized" {
-		SetCurrentTopic(req.SessionID, newTopic)
-		currentTopic = newTopic
-		InfoLogger.Printf("🔄 Topic naturally transitioned from %s to %s for session: %s", currentTopic, newTopic, req.SessionID)
+	// Code and errors put Shandris in technical-support mode, unless the user needs her for something more important
+	tech := cognitive.AssessTechnicalSupport(req.Prompt, currentTopic)
+	if tech.Active && !safety.Protective() {
+		shandrisMood = cognitive.FocusedMood(shandrisMood)
+		turn.mode = cognitive.TopicTechnicalSupport
+		InfoLogger.Printf("🛠️ Technical support mode (%d findings, language %q) for session: %s", len(tech.Code.Findings), tech.Code.Language(), req.SessionID)
+	} else {
+		tech.Active = false
+	}
+
+	// Pick the persona that fits this turn; in a crisis Shandris answers as herself
+	var persona PersonaSelection
+	if safety.Protective() {
+		persona = protectivePersona()
+	} else {
+		persona = SelectSessionPersona(req.SessionID, req.Prompt, currentTopic, shandrisMood, boundaries)
+	}
+
+	turn.setMood(shandrisMood)
+	turn.setPersona(persona)
+	turn.topic = &ResponseTopic{
+		Current:  currentTopic,
+		Previous: previousTopic,
+		ThreadID: thread.ID,
+		Switched: currentTopic != previousTopic,
+		Resumed:  resumed,
+		Themes:   emotional.ThemeScores,
 	}
 
 	// Fetch persona and context
 	personality, err := GetPersonality(db)
 	if err != nil {
 		LogError(err, "Failed to fetch personality")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		turn.fail(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
-	history, err := GetChatHistoryByTopic(req.SessionID, currentTopic)
+	history, err := GetChatHistoryByThread(req.SessionID, thread)
 	if err != nil {
 		LogError(err, "Failed to fetch chat history")
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		turn.fail(w, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
-	DebugLogger.Printf("📚 Retrieved %d historical chat turns for topic %s", len(history), currentTopic)
+	DebugLogger.Printf("📚 Retrieved %d historical chat turns for thread %s", len(history), thread.ID)
 
-	context := BuildPrompt(personality, history, req.Prompt, currentTopic, newTopic, req.SessionID)
-	DebugLogger.Printf("🎯 Built context for model (length: %d characters)", len(context))
+	recallMood := userMood
+	if recallMood == "" {
+		recallMood = shandrisMood.Primary
+	}
+	memories := RecallSessionMemories(req.SessionID, thread.ActiveNodes, recallMood)
+	dueDates, upcomingDates := SessionDates(req.SessionID, now, loc)
 
-	fullModelOutput, err := RunDeepSeek(context)
-	if err != nil {
-		LogError(err, "Failed to get model response")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Lore is scoped to the speaking character and the active persona
+	loreScope := []string{personality.Name}
+	if persona.Persona != nil {
+		loreScope = append(loreScope, persona.Persona.ID)
 	}
+	lore := SessionLore(req.Prompt, history, loreScope...)
 
-	cleanedOutput := stripChainOfThought(fullModelOutput)
+	// The relationship as it stood before this message, so a long absence can be noticed
+	var relationship *cognitive.RelationshipMemory
+	rel, away, known := SessionRelationship(req.SessionID, now)
+	if known {
+		relationship = &rel
+	}
+
+	world := LoadWorldState(req.SessionID)
+	mechanics := ResolveMechanics(req.SessionID, req.Prompt, world)
+	worldWindow := req.Prompt
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		worldWindow = last.UserMessage + "\n" + last.AIResponse + "\n" + req.Prompt
+	}
+
+	pc := PromptContext{
+		Mood:          shandrisMood,
+		ResumedThread: resumed,
+		Memories:      memories,
+		Now:           now,
+		DueDates:      dueDates,
+		UpcomingDates: upcomingDates,
+		Persona:       persona,
+		Lore:          lore,
+		World:         describeWorld(world, worldWindow, currentTopic),
+		Mechanics:     mechanics.Facts,
+		Boundaries:    boundaries,
+		Safety:        safety,
+		Technical:     tech,
+		Relationship:  relationship,
+		Away:          away,
+	}
+
+	// In a scene every speaking character gets their own prompt and reply, unless the user needs Shandris herself
+	var cleanedOutput string
+	var segments []cognitive.Segment
+	var messages []SceneMessage
+	var present []string // Scene characters who witness the turn
+	if scene := LoadScene(req.SessionID); scene != nil && !safety.Protective() {
+		for _, participant := range scene.Participants {
+			present = append(present, participant.ID)
+		}
+		err = turn.runModel(func() (err error) {
+			messages, err = RunSceneTurn(req.SessionID, scene, personality, world, history, req.Prompt, currentTopic, previousTopic,
+				thread.ActiveNodes, recallMood, pc)
+			return err
+		})
+		if err != nil {
+			LogError(err, "Failed to get scene response")
+			turn.fail(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cleanedOutput = formatSceneMessages(messages)
+		for _, message := range messages {
+			segments = append(segments, message.Segments...)
+		}
+	} else {
+		context := BuildPrompt(personality, history, req.Prompt, currentTopic, previousTopic, req.SessionID, pc)
+		DebugLogger.Printf("🎯 Built context for model (length: %d characters)", len(context))
+
+		var fullModelOutput string
+		err := turn.runModel(func() (err error) {
+			fullModelOutput, err = RunModel(replyModel(tech), context)
+			return err
+		})
+		if err != nil {
+			LogError(err, "Failed to get model response")
+			turn.fail(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		cleanedOutput = cleanReply(req.SessionID, world, fullModelOutput)
+		cleanedOutput = persona.System.ApplyPersonaStyle(cleanedOutput)
+		segments = cognitive.ParseSegments(cleanedOutput, persona.System.SegmentRules())
+	}
+	if safety.Protective() {
+		resources := formatSafetyResources(SafetyResources(loc))
+		cleanedOutput += "\n\n" + resources
+		segments = append(segments, cognitive.Segment{Type: cognitive.SegmentNarration, Text: resources})
+	}
+	// A crisis reply carries nothing else; due reminders wait for the next turn
+	if !safety.Protective() {
+		if due := TakeDueReminders(req.SessionID, time.Now().In(loc), loc); len(due) > 0 {
+			delivered := formatDeliveredReminders(due, now)
+			cleanedOutput = delivered + cleanedOutput
+			segments = append([]cognitive.Segment{{Type: cognitive.SegmentNarration, Text: strings.TrimSpace(delivered)}}, segments...)
+		}
+	}
 	LogChatOperation("Saving chat history", req.SessionID, req.Prompt, currentTopic)
-	SaveChatHistory(req.SessionID, req.Prompt, cleanedOutput, newTopic)
+	if len(messages) > 0 {
+		SaveSceneHistory(req.SessionID, req.Prompt, messages, newTopic, thread.ID)
+	} else {
+		SaveChatHistory(req.SessionID, req.Prompt, cleanedOutput, newTopic, thread.ID)
+	}
+	// Crisis text is never kept as a memory or quoted back in a follow-up
+	if !safety.Protective() {
+		if event := RecordTurnMemory(req.SessionID, req.Prompt, thread.ActiveNodes, statedMood, shandrisMood, present...); event != nil {
+			turn.recordWrite(WriteEvent, string(event.Type), event.Content)
+		}
+	}
+	RecordRelationshipTurn(req.SessionID, emotional, thread.ActiveNodes)
+	MarkDatesMentioned(req.SessionID, dueDates, now)
+	if !safety.Protective() {
+		ScheduleFollowUp(req.SessionID, req.Prompt, statedMood, now)
+	}
+	if err := CommitWorldTurn(req.SessionID, world, mechanics, now); err != nil {
+		LogError(err, "Failed to save world turn")
+	}
 
 	InfoLogger.Printf("💬 Chat response generated - Length: %d characters", len(cleanedOutput))
-	json.NewEncoder(w).Encode(ChatResponse{Response: cleanedOutput})
+	response := turn.envelope(ResponseModel, cleanedOutput)
+	response.Segments = segments
+	response.Messages = messages
+	json.NewEncoder(w).Encode(response)
+}
+
+// replyModel is the model a reply is generated with: technical support goes to the code
+// model when one is configured
+func replyModel(tech cognitive.TechnicalSupport) string {
+	if tech.Active && codeModel != "" {
+		return codeModel
+	}
+	return deepSeekModel
+}
+
+// cleanReply strips the model's reasoning and world updates from a reply, and closes a code
+// fence it left open
+func cleanReply(sessionID string, world *cognitive.WorldState, output string) string {
+	output = applyWorldUpdates(world, stripChainOfThought(output))
+	if balanced, fixed := cognitive.BalanceCodeFences(output); fixed {
+		InfoLogger.Printf("🛠️ Closed an unbalanced code fence in the reply for session: %s", sessionID)
+		return balanced
+	}
+	return output
+}
+
+// applyWorldUpdates strips the model's <world> blocks from a reply and applies them.
+// Scene changes update the world, which is snapshotted every turn.
+func applyWorldUpdates(world *cognitive.WorldState, output string) string {
+	output, ops, err := cognitive.ExtractWorldUpdates(output)
+	if err != nil {
+		LogError(err, "Failed to parse world updates")
+	}
+	if err := world.Apply(ops); err != nil {
+		LogError(err, "Failed to apply world updates")
+	}
+	return output
 }
 
 // Basic yes/no/okay prompt confirmation parser.
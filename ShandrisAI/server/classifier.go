@@ -1,10 +1,19 @@
 package server
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
 
 func ClassifyPrompt(prompt string) string {
 	p := strings.ToLower(prompt)
 
+	// Pasted code, errors and commands are technical whatever else the message says
+	if cognitive.DetectCode(prompt).Technical() {
+		return cognitive.TopicTechnicalSupport
+	}
+
 	// General conversation markers
 	if strings.Contains(p, "hello") || strings.Contains(p, "hi ") || strings.Contains(p, "hey") ||
 		strings.Contains(p, "good morning") || strings.Contains(p, "good evening") || strings.Contains(p, "good afternoon") {
@@ -121,6 +121,11 @@ func (bh *BiasHandler) ApplyBias(context EmotionalContext) map[string]float64 {
 	// Apply context-specific rules
 	bh.applyContextRules(context, biases)
 
+	// Flirting is only biased towards for users who opted in
+	if !context.SapphicContext.AllowsFlirting {
+		delete(biases, "flirty")
+	}
+
 	return bh.normalizeBiases(biases)
 }
 
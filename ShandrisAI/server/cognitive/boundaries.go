@@ -0,0 +1,267 @@
+package cognitive
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Content ratings, from most to least restrictive
+const (
+	RatingGeneral = "general" // Nothing suggestive, mild language
+	RatingTeen    = "teen"    // Light innuendo and peril, no explicit content
+	RatingMature  = "mature"  // Adult themes, still never explicit
+)
+
+// Restriction tokens stored in the session's "boundaries" memory
+const (
+	RestrictFlirting = "flirting" // Romance and flirting are off
+	ratingPrefix     = "rating:"
+	avoidPrefix      = "avoid:"
+)
+
+var ratingLevels = map[string]int{
+	RatingGeneral: 0,
+	RatingTeen:    1,
+	RatingMature:  2,
+}
+
+// ratingGuides describe each rating for the prompt
+var ratingGuides = map[string]string{
+	RatingGeneral: "keep everything suitable for all ages: nothing suggestive, no graphic violence, mild language only",
+	RatingTeen:    "light innuendo, peril and mild swearing are fine; nothing sexual or gory",
+	RatingMature:  "adult themes, dark humour and strong language are fine; never write explicit sexual content",
+}
+
+// Boundaries are a user's consent and content settings
+type Boundaries struct {
+	Romance     bool     `json:"romance"` // Opted in to flirting and romance
+	Rating      string   `json:"rating"`
+	AvoidTopics []string `json:"avoid_topics"`
+}
+
+// BoundaryCommand is a parsed /boundaries command
+type BoundaryCommand struct {
+	Action string // show, romance, rating, avoid, allow, reset
+	Value  string
+	On     bool // For romance
+}
+
+// DefaultBoundaries apply until the user says otherwise: no romance, teen rating
+func DefaultBoundaries() Boundaries {
+	return Boundaries{Rating: RatingTeen, AvoidTopics: []string{}}
+}
+
+// ValidRating reports whether rating is a known content rating
+func ValidRating(rating string) bool {
+	_, ok := ratingLevels[rating]
+	return ok
+}
+
+// ParseBoundaries reads boundaries from their stored restriction tokens,
+// e.g. "flirting, rating:general, avoid:politics"
+func ParseBoundaries(value string) Boundaries {
+	b := DefaultBoundaries()
+	if strings.TrimSpace(value) == "" {
+		return b
+	}
+	b.Romance = true
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		switch {
+		case token == RestrictFlirting:
+			b.Romance = false
+		case strings.HasPrefix(token, ratingPrefix):
+			if rating := strings.TrimPrefix(token, ratingPrefix); ValidRating(rating) {
+				b.Rating = rating
+			}
+		case strings.HasPrefix(token, avoidPrefix):
+			b.AvoidTopics = appendTopic(b.AvoidTopics, strings.TrimPrefix(token, avoidPrefix))
+		}
+	}
+	return b
+}
+
+// Restrictions lists the boundaries as restriction tokens, the form personas'
+// boundary constraints and the stored memory use
+func (b Boundaries) Restrictions() []string {
+	var restrictions []string
+	if !b.Romance {
+		restrictions = append(restrictions, RestrictFlirting)
+	}
+	if b.Rating != "" {
+		restrictions = append(restrictions, ratingPrefix+b.Rating)
+	}
+	for _, topic := range b.AvoidTopics {
+		restrictions = append(restrictions, avoidPrefix+topic)
+	}
+	return restrictions
+}
+
+// String renders the boundaries as stored restriction tokens
+func (b Boundaries) String() string {
+	return strings.Join(b.Restrictions(), ", ")
+}
+
+// Validate checks the boundaries are well formed
+func (b Boundaries) Validate() error {
+	if !ValidRating(b.Rating) {
+		return fmt.Errorf("unknown content rating %q (use general, teen or mature)", b.Rating)
+	}
+	for _, topic := range b.AvoidTopics {
+		if strings.TrimSpace(topic) == "" || strings.Contains(topic, ",") {
+			return fmt.Errorf("invalid topic %q", topic)
+		}
+	}
+	return nil
+}
+
+// Clamp limits the boundaries to a deployment-wide ceiling: romance only if the ceiling
+// allows it, the stricter rating, and the topics either side avoids
+func (b Boundaries) Clamp(ceiling Boundaries) Boundaries {
+	clamped := Boundaries{
+		Romance:     b.Romance && ceiling.Romance,
+		Rating:      b.Rating,
+		AvoidTopics: append([]string{}, b.AvoidTopics...),
+	}
+	if !ValidRating(clamped.Rating) || ValidRating(ceiling.Rating) && ratingLevels[ceiling.Rating] < ratingLevels[clamped.Rating] {
+		clamped.Rating = ceiling.Rating
+	}
+	for _, topic := range ceiling.AvoidTopics {
+		clamped.AvoidTopics = appendTopic(clamped.AvoidTopics, topic)
+	}
+	sort.Strings(clamped.AvoidTopics)
+	return clamped
+}
+
+// AllowsFlirting reports whether flirting is allowed at all
+func (b Boundaries) AllowsFlirting() bool {
+	return b.Romance && b.Rating != RatingGeneral
+}
+
+// Avoids reports whether a topic is on the avoid list
+func (b Boundaries) Avoids(topic string) bool {
+	return containsString(b.AvoidTopics, strings.ToLower(strings.TrimSpace(topic)))
+}
+
+// FlirtCeiling is the highest flirty mood score the boundaries permit
+func (b Boundaries) FlirtCeiling() float64 {
+	if !b.AllowsFlirting() {
+		return 0
+	}
+	if b.Rating == RatingTeen {
+		return 0.5
+	}
+	return 0.8
+}
+
+// Describe renders the boundaries as prompt guidance
+func (b Boundaries) Describe() string {
+	var lines []string
+	if b.AllowsFlirting() {
+		lines = append(lines, "Romance and flirting: the user has opted in. Keep it consensual and read the room.")
+	} else {
+		lines = append(lines, "Romance and flirting: off. Keep everything platonic, whatever the persona or mood.")
+	}
+	if guide, ok := ratingGuides[b.Rating]; ok {
+		lines = append(lines, fmt.Sprintf("Content rating: %s. %s.", b.Rating, capitalizeFirst(guide)))
+	}
+	if len(b.AvoidTopics) > 0 {
+		lines = append(lines, fmt.Sprintf("Topics to avoid: %s. Don't bring them up; if the user does, acknowledge briefly and steer elsewhere.",
+			strings.Join(b.AvoidTopics, ", ")))
+	}
+	return "\nBOUNDARIES (these override everything else):\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// Apply changes the boundaries as the command says
+func (b Boundaries) Apply(cmd BoundaryCommand) Boundaries {
+	switch cmd.Action {
+	case "romance":
+		b.Romance = cmd.On
+	case "rating":
+		b.Rating = cmd.Value
+	case "avoid":
+		b.AvoidTopics = appendTopic(append([]string{}, b.AvoidTopics...), cmd.Value)
+	case "allow":
+		kept := []string{}
+		for _, topic := range b.AvoidTopics {
+			if topic != cmd.Value {
+				kept = append(kept, topic)
+			}
+		}
+		b.AvoidTopics = kept
+	case "reset":
+		return DefaultBoundaries()
+	}
+	return b
+}
+
+// IsBoundaryCommand reports whether the prompt is a /boundaries command
+func IsBoundaryCommand(input string) bool {
+	fields := strings.Fields(input)
+	return len(fields) > 0 && (strings.EqualFold(fields[0], "/boundaries") || strings.EqualFold(fields[0], "/boundary"))
+}
+
+// ParseBoundaryCommand parses:
+//
+//	/boundaries [show]
+//	/boundaries romance on|off
+//	/boundaries rating general|teen|mature
+//	/boundaries avoid <topic>
+//	/boundaries allow <topic>
+//	/boundaries reset
+func ParseBoundaryCommand(input string) (BoundaryCommand, error) {
+	args := splitCommandArgs(input)
+	if len(args) == 0 || !IsBoundaryCommand(args[0]) {
+		return BoundaryCommand{}, errors.New("not a /boundaries command")
+	}
+	args = args[1:]
+	if len(args) == 0 {
+		return BoundaryCommand{Action: "show"}, nil
+	}
+
+	verb, args := strings.ToLower(args[0]), args[1:]
+	switch verb {
+	case "show", "reset":
+		return BoundaryCommand{Action: verb}, nil
+	case "romance", "flirting":
+		if len(args) != 1 {
+			return BoundaryCommand{}, errors.New("usage: /boundaries romance on|off")
+		}
+		switch strings.ToLower(args[0]) {
+		case "on", "yes", "true":
+			return BoundaryCommand{Action: "romance", On: true}, nil
+		case "off", "no", "false":
+			return BoundaryCommand{Action: "romance", On: false}, nil
+		}
+		return BoundaryCommand{}, errors.New("usage: /boundaries romance on|off")
+	case "rating":
+		if len(args) != 1 || !ValidRating(strings.ToLower(args[0])) {
+			return BoundaryCommand{}, errors.New("usage: /boundaries rating general|teen|mature")
+		}
+		return BoundaryCommand{Action: "rating", Value: strings.ToLower(args[0])}, nil
+	case "avoid", "allow":
+		topic := strings.ToLower(strings.Join(args, " "))
+		if topic == "" || strings.Contains(topic, ",") {
+			return BoundaryCommand{}, fmt.Errorf("usage: /boundaries %s <topic>", verb)
+		}
+		return BoundaryCommand{Action: verb, Value: topic}, nil
+	}
+	return BoundaryCommand{}, fmt.Errorf("unknown /boundaries command %q", verb)
+}
+
+func appendTopic(topics []string, topic string) []string {
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	if topic == "" || containsString(topics, topic) {
+		return topics
+	}
+	return append(topics, topic)
+}
+
+func capitalizeFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,463 @@
+package cognitive
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of technical content the code detector reports
+const (
+	FindingCode          = "code"
+	FindingStackTrace    = "stack_trace"
+	FindingCompilerError = "compiler_error"
+	FindingFilePath      = "file_path"
+	FindingCommand       = "command"
+)
+
+// Languages the code detector can identify
+const (
+	LangGo         = "go"
+	LangPython     = "python"
+	LangTypeScript = "typescript"
+	LangCpp        = "cpp"
+	LangSQL        = "sql"
+	LangShell      = "shell"
+)
+
+const (
+	// maxFrames is how many frames of a stack trace are kept, innermost first
+	maxFrames = 3
+	// maxCompilerErrors caps how many compiler errors one message reports
+	maxCompilerErrors = 5
+	// codeThreshold is the signature score unfenced text needs to count as code
+	codeThreshold = 1.0
+)
+
+// CodeFinding is one piece of technical content found in a message
+type CodeFinding struct {
+	Kind     string   `json:"kind"`
+	Language string   `json:"language,omitempty"`
+	Message  string   `json:"message,omitempty"` // The error message, for traces and compiler errors
+	Frames   []string `json:"frames,omitempty"`  // Top frames or error locations, innermost first
+	Text     string   `json:"text"`              // The code, trace, path or command as written
+	Fenced   bool     `json:"fenced,omitempty"`
+}
+
+// CodeReport is everything technical the detector found in a message
+type CodeReport struct {
+	Findings []CodeFinding `json:"findings"`
+}
+
+// HasCode reports whether the message contains code, fenced or not
+func (r CodeReport) HasCode() bool {
+	return r.has(FindingCode)
+}
+
+// HasErrors reports whether the message contains a stack trace or compiler error
+func (r CodeReport) HasErrors() bool {
+	return r.has(FindingStackTrace) || r.has(FindingCompilerError)
+}
+
+// Errors returns the stack traces and compiler errors found
+func (r CodeReport) Errors() []CodeFinding {
+	var errs []CodeFinding
+	for _, finding := range r.Findings {
+		if finding.Kind == FindingStackTrace || finding.Kind == FindingCompilerError {
+			errs = append(errs, finding)
+		}
+	}
+	return errs
+}
+
+// Technical reports whether the message contains code, errors or commands
+func (r CodeReport) Technical() bool {
+	return r.HasCode() || r.HasErrors() || r.has(FindingCommand)
+}
+
+// ReferencesCode reports whether the message contains code or points at it by path or error location
+func (r CodeReport) ReferencesCode() bool {
+	return r.HasCode() || r.HasErrors() || r.has(FindingFilePath)
+}
+
+// Language is the language most of the findings are in, or ""
+func (r CodeReport) Language() string {
+	counts := make(map[string]int)
+	for _, finding := range r.Findings {
+		if finding.Language != "" {
+			counts[finding.Language]++
+		}
+	}
+	best, bestCount := "", 0
+	for _, lang := range sortedKeys(counts) {
+		if counts[lang] > bestCount {
+			best, bestCount = lang, counts[lang]
+		}
+	}
+	return best
+}
+
+func (r CodeReport) has(kind string) bool {
+	for _, finding := range r.Findings {
+		if finding.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	inlineCode   = regexp.MustCompile("`([^`\\n]+)`")
+	goPanic      = regexp.MustCompile(`(?m)^(?:panic|fatal error): (.+)$`)
+	goFrameFile  = regexp.MustCompile(`^\s+(\S+\.go:\d+)`)
+	goFrameArgs  = regexp.MustCompile(`\(.*\)$`)
+	goCompile    = regexp.MustCompile(`(?m)^(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+	pyTraceback  = regexp.MustCompile(`(?m)^Traceback \(most recent call last\):\s*$`)
+	pyFrame      = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+)(?:, in (\S+))?`)
+	tscError     = regexp.MustCompile(`(?m)^(\S+\.tsx?)(?:\((\d+),(\d+)\)|:(\d+):(\d+)) ?[:-] error (TS\d+): (.+)$`)
+	cppError     = regexp.MustCompile(`(?m)^(\S+\.(?:cpp|cc|cxx|c|hpp|h)):(\d+):(\d+): (?:fatal )?error: (.+)$`)
+	shellPrompt  = regexp.MustCompile(`(?m)^\s*\$ (\S.*)$`)
+	filePathExpr = regexp.MustCompile(`(?:^|[\s"'(=])((?:~|\.{1,2})/(?:[\w.-]+/)*[\w.-]+|/(?:[\w.-]+/)+[\w.-]+|[A-Za-z]:\\(?:[\w .-]+\\)+[\w.-]+|[\w-]+(?:/[\w.-]+)*\.(?:go|py|ts|tsx|js|jsx|cpp|cc|hpp|h|sql|sh|rs|java|json|ya?ml|toml|mod))\b`)
+)
+
+// commandWords start a shell command when quoted in backticks
+var commandWords = map[string]bool{
+	"go": true, "git": true, "npm": true, "npx": true, "yarn": true, "pnpm": true, "pip": true, "pip3": true,
+	"python": true, "python3": true, "node": true, "tsc": true, "docker": true, "kubectl": true, "make": true,
+	"cargo": true, "sudo": true, "apt": true, "apt-get": true, "brew": true, "curl": true, "wget": true,
+	"ssh": true, "cd": true, "ls": true, "cat": true, "grep": true, "chmod": true, "systemctl": true, "psql": true,
+}
+
+// languageAliases maps code fence tags onto the detector's language names
+var languageAliases = map[string]string{
+	"go": LangGo, "golang": LangGo,
+	"python": LangPython, "py": LangPython, "python3": LangPython,
+	"typescript": LangTypeScript, "ts": LangTypeScript, "tsx": LangTypeScript,
+	"javascript": LangTypeScript, "js": LangTypeScript, "jsx": LangTypeScript,
+	"cpp": LangCpp, "c++": LangCpp, "cc": LangCpp, "cxx": LangCpp, "c": LangCpp, "hpp": LangCpp,
+	"sql": LangSQL, "postgres": LangSQL, "postgresql": LangSQL, "mysql": LangSQL, "sqlite": LangSQL,
+	"sh": LangShell, "bash": LangShell, "zsh": LangShell, "shell": LangShell, "console": LangShell,
+}
+
+// languageSignature is a weighted pattern that suggests a language
+type languageSignature struct {
+	pattern *regexp.Regexp
+	weight  float64
+}
+
+var languageSignatures = map[string][]languageSignature{
+	LangGo: {
+		{regexp.MustCompile(`(?m)^\s*package \w+\s*$`), 1.0},
+		{regexp.MustCompile(`\bfunc (\([^)]*\) )?\w+\(`), 1.0},
+		{regexp.MustCompile(`\w+ :?= .*`), 0.2},
+		{regexp.MustCompile(`\w+ := `), 0.6},
+		{regexp.MustCompile(`\berr != nil\b`), 1.0},
+		{regexp.MustCompile(`\bfmt\.\w+\(`), 0.8},
+		{regexp.MustCompile(`(?m)^import \($`), 1.0},
+		{regexp.MustCompile(`\bgo func\(`), 1.0},
+	},
+	LangPython: {
+		{regexp.MustCompile(`(?m)^\s*def \w+\(.*\):\s*$`), 1.0},
+		{regexp.MustCompile(`(?m)^\s*class \w+(\(.*\))?:\s*$`), 1.0},
+		{regexp.MustCompile(`(?m)^\s*(from [\w.]+ )?import [\w.]+(, [\w.]+)*\s*$`), 0.6},
+		{regexp.MustCompile(`\bself\.\w+`), 0.6},
+		{regexp.MustCompile(`(?m)^\s*(if|elif|for|while|with|try|except)\b.*:\s*$`), 0.5},
+		{regexp.MustCompile(`\bprint\(`), 0.4},
+		{regexp.MustCompile(`__name__ == "__main__"`), 1.0},
+	},
+	LangTypeScript: {
+		{regexp.MustCompile(`\b(const|let) \w+(: [\w<>\[\]]+)? = `), 0.7},
+		{regexp.MustCompile(`\binterface \w+ \{`), 1.0},
+		{regexp.MustCompile(`\) => \{?`), 0.6},
+		{regexp.MustCompile(`: (string|number|boolean|any|void)\b`), 0.7},
+		{regexp.MustCompile(`\bconsole\.log\(`), 0.8},
+		{regexp.MustCompile(`\bexport (default )?(function|class|const|interface|type)\b`), 1.0},
+		{regexp.MustCompile(`\bimport \{[^}]*\} from ['"]`), 1.0},
+	},
+	LangCpp: {
+		{regexp.MustCompile(`(?m)^\s*#include\s*[<"]`), 1.0},
+		{regexp.MustCompile(`\bstd::\w+`), 1.0},
+		{regexp.MustCompile(`\bint main\(`), 0.8},
+		{regexp.MustCompile(`\b(cout|cerr)\s*<<`), 1.0},
+		{regexp.MustCompile(`\btemplate\s*<`), 1.0},
+		{regexp.MustCompile(`\w+->\w+`), 0.4},
+	},
+	LangSQL: {
+		{regexp.MustCompile(`(?i)\bselect\s+(\*|[\w.]+(\s*,\s*[\w.]+)*)\s+from\s+\w+`), 0.7},
+		{regexp.MustCompile(`\b(SELECT|FROM|WHERE|INSERT|UPDATE|DELETE|JOIN|VALUES)\b`), 0.4},
+		{regexp.MustCompile(`(?i)\binsert into \w+`), 0.8},
+		{regexp.MustCompile(`(?i)\bupdate \w+ set \w+\s*=`), 0.8},
+		{regexp.MustCompile(`(?i)\bcreate (table|index|view)\b`), 1.0},
+		{regexp.MustCompile(`(?i)\b(where \w+\s*(=|<|>|like|in)|group by|order by|left join|inner join)\b`), 0.4},
+	},
+	LangShell: {
+		{regexp.MustCompile(`(?m)^#!/(usr/)?bin/(env )?(ba|z)?sh`), 1.0},
+		{regexp.MustCompile(`(?m)^\s*\$ \S`), 1.0},
+		{regexp.MustCompile(`\|\s*(grep|awk|sed|xargs|sort|head|tail)\b`), 0.8},
+		{regexp.MustCompile(`(?m)^\s*(sudo|apt(-get)?|brew|npm|pip3?|git|docker|kubectl|chmod|export|curl)\s+[\w-]`), 0.6},
+		{regexp.MustCompile(`\s--?[a-z][\w-]*`), 0.2},
+	},
+}
+
+// codeStructure matches the punctuation that marks a line as code rather than prose
+var codeStructure = regexp.MustCompile(`[{};]\s*$|^\s*[})\]]|\w\(.*\)|:=|==|=>|->|::`)
+
+// DetectCode finds code, stack traces, compiler errors, file paths and commands in a message
+func DetectCode(input string) CodeReport {
+	report := CodeReport{Findings: []CodeFinding{}}
+	if strings.TrimSpace(input) == "" {
+		return report
+	}
+
+	// Fenced blocks first; what's left is checked for unfenced code
+	rest := input
+	for _, match := range codeFence.FindAllStringSubmatch(input, -1) {
+		body := strings.TrimRight(match[2], "\n")
+		lang := languageAliases[strings.ToLower(match[1])]
+		if lang == "" {
+			lang = IdentifyLanguage(body)
+		}
+		// A fenced trace is reported as the trace, not as code
+		if traceKind(body) == "" {
+			report.Findings = append(report.Findings, CodeFinding{Kind: FindingCode, Language: lang, Text: body, Fenced: true})
+		}
+		if lang == LangShell {
+			for _, line := range strings.Split(body, "\n") {
+				if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "$ ")); line != "" && !strings.HasPrefix(line, "#") {
+					report.Findings = append(report.Findings, CodeFinding{Kind: FindingCommand, Language: LangShell, Text: line})
+				}
+			}
+		}
+		rest = strings.Replace(rest, match[0], "\n", 1)
+	}
+
+	report.Findings = append(report.Findings, detectTraces(input)...)
+	report.Findings = append(report.Findings, detectCommands(rest)...)
+	if finding, ok := detectUnfencedCode(rest); ok {
+		report.Findings = append(report.Findings, finding)
+	}
+	report.Findings = append(report.Findings, detectFilePaths(input)...)
+	return report
+}
+
+// IdentifyLanguage names the language a piece of code is most likely in, or ""
+func IdentifyLanguage(code string) string {
+	best, bestScore := "", 0.0
+	for _, lang := range []string{LangGo, LangPython, LangTypeScript, LangCpp, LangSQL, LangShell} {
+		if score := languageScore(code, lang); score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	if bestScore < codeThreshold/2 {
+		return ""
+	}
+	return best
+}
+
+func languageScore(code, lang string) float64 {
+	score := 0.0
+	for _, signature := range languageSignatures[lang] {
+		if signature.pattern.MatchString(code) {
+			score += signature.weight
+		}
+	}
+	return score
+}
+
+// traceKind reports whether text is a stack trace or compiler error, and which
+func traceKind(text string) string {
+	switch {
+	case goPanic.MatchString(text) && strings.Contains(text, "goroutine "), pyTraceback.MatchString(text):
+		return FindingStackTrace
+	case goCompile.MatchString(text), tscError.MatchString(text), cppError.MatchString(text):
+		return FindingCompilerError
+	}
+	return ""
+}
+
+// detectTraces parses Go panics, Python tracebacks and Go, tsc and C++ compiler errors
+func detectTraces(input string) []CodeFinding {
+	var findings []CodeFinding
+	lines := strings.Split(input, "\n")
+
+	// Go panics: the message, then frames as a function line followed by its file line
+	if loc := goPanic.FindStringSubmatchIndex(input); loc != nil && strings.Contains(input[loc[0]:], "goroutine ") {
+		finding := CodeFinding{Kind: FindingStackTrace, Language: LangGo, Message: strings.TrimSpace(input[loc[2]:loc[3]])}
+		start := strings.Count(input[:loc[0]], "\n")
+		end := start
+		for i := start + 1; i < len(lines); i++ {
+			file := goFrameFile.FindStringSubmatch(lines[i])
+			if file == nil {
+				continue
+			}
+			end = i
+			if len(finding.Frames) < maxFrames {
+				function := goFrameArgs.ReplaceAllString(strings.TrimSpace(lines[i-1]), "")
+				finding.Frames = append(finding.Frames, function+" at "+file[1])
+			}
+		}
+		finding.Text = strings.Join(lines[start:end+1], "\n")
+		findings = append(findings, finding)
+	}
+
+	// Python tracebacks: frames run outermost first, the exception comes last
+	if loc := pyTraceback.FindStringIndex(input); loc != nil {
+		finding := CodeFinding{Kind: FindingStackTrace, Language: LangPython}
+		start := strings.Count(input[:loc[0]], "\n")
+		var frames []string
+		end := start
+		for i := start + 1; i < len(lines); i++ {
+			line := lines[i]
+			if frame := pyFrame.FindStringSubmatch(line); frame != nil {
+				location := frame[1] + ":" + frame[2]
+				if frame[3] != "" {
+					location = frame[3] + " at " + location
+				}
+				frames = append(frames, location)
+				end = i
+				continue
+			}
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				continue
+			}
+			finding.Message = strings.TrimSpace(line)
+			end = i
+			break
+		}
+		for i := len(frames) - 1; i >= 0 && len(finding.Frames) < maxFrames; i-- {
+			finding.Frames = append(finding.Frames, frames[i])
+		}
+		finding.Text = strings.Join(lines[start:end+1], "\n")
+		findings = append(findings, finding)
+	}
+
+	// Compiler errors, one finding per error line
+	errorCount := 0
+	addError := func(lang, location, message, text string) {
+		if errorCount >= maxCompilerErrors {
+			return
+		}
+		errorCount++
+		findings = append(findings, CodeFinding{
+			Kind:     FindingCompilerError,
+			Language: lang,
+			Message:  message,
+			Frames:   []string{location},
+			Text:     text,
+		})
+	}
+	for _, match := range tscError.FindAllStringSubmatch(input, -1) {
+		line, column := match[2], match[3]
+		if line == "" {
+			line, column = match[4], match[5]
+		}
+		addError(LangTypeScript, match[1]+":"+line+":"+column, match[6]+": "+match[7], match[0])
+	}
+	for _, match := range goCompile.FindAllStringSubmatch(input, -1) {
+		location := match[1] + ":" + match[2]
+		if match[3] != "" {
+			location += ":" + match[3]
+		}
+		addError(LangGo, location, match[4], match[0])
+	}
+	for _, match := range cppError.FindAllStringSubmatch(input, -1) {
+		addError(LangCpp, match[1]+":"+match[2]+":"+match[3], match[4], match[0])
+	}
+	return findings
+}
+
+// detectCommands finds commands at a shell prompt or quoted inline in backticks
+func detectCommands(text string) []CodeFinding {
+	var findings []CodeFinding
+	for _, match := range shellPrompt.FindAllStringSubmatch(text, -1) {
+		findings = append(findings, CodeFinding{Kind: FindingCommand, Language: LangShell, Text: strings.TrimSpace(match[1])})
+	}
+	for _, match := range inlineCode.FindAllStringSubmatch(text, -1) {
+		code := strings.TrimSpace(match[1])
+		if fields := strings.Fields(code); len(fields) > 1 && commandWords[fields[0]] {
+			findings = append(findings, CodeFinding{Kind: FindingCommand, Language: LangShell, Text: code})
+		}
+	}
+	return findings
+}
+
+// detectUnfencedCode looks for code pasted without fences: lines with code structure that,
+// together, carry enough of one language's signatures
+func detectUnfencedCode(text string) (CodeFinding, bool) {
+	var code []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		// Traces and prompt commands are reported on their own
+		if trimmed == "" || traceKind(line) != "" || goFrameFile.MatchString(line) || shellPrompt.MatchString(line) {
+			continue
+		}
+		if codeStructure.MatchString(trimmed) || lineSignature(line) {
+			code = append(code, line)
+		}
+	}
+	if len(code) == 0 {
+		return CodeFinding{}, false
+	}
+
+	body := strings.Join(code, "\n")
+	lang := IdentifyLanguage(body)
+	if lang == "" || languageScore(body, lang) < codeThreshold {
+		return CodeFinding{}, false
+	}
+	return CodeFinding{Kind: FindingCode, Language: lang, Text: body}, true
+}
+
+// lineSignature reports whether a single line carries any language's signature
+func lineSignature(line string) bool {
+	for _, signatures := range languageSignatures {
+		for _, signature := range signatures {
+			if signature.weight >= 0.6 && signature.pattern.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// detectFilePaths finds file paths, unix or windows, and bare source file names
+func detectFilePaths(input string) []CodeFinding {
+	var findings []CodeFinding
+	seen := make(map[string]bool)
+	for _, match := range filePathExpr.FindAllStringSubmatch(input, -1) {
+		path := match[1]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		findings = append(findings, CodeFinding{Kind: FindingFilePath, Language: languageFromPath(path), Text: path})
+	}
+	return findings
+}
+
+// languageFromPath names the language of a source file from its extension
+func languageFromPath(path string) string {
+	dot := strings.LastIndex(path, ".")
+	if dot < 0 {
+		return ""
+	}
+	switch ext := path[dot+1:]; ext {
+	case "go", "sql", "sh":
+		return languageAliases[ext]
+	case "py":
+		return LangPython
+	case "ts", "tsx", "js", "jsx":
+		return LangTypeScript
+	case "cpp", "cc", "hpp", "h":
+		return LangCpp
+	}
+	return ""
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
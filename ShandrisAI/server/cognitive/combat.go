@@ -0,0 +1,543 @@
+package cognitive
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Combat sides
+const (
+	SideParty = "party"
+	SideFoe   = "foe"
+)
+
+// Combatant defaults for entities without combat attributes
+const (
+	defaultHP          = 10
+	defaultAC          = 12
+	defaultAttackBonus = 3
+	defaultDamage      = "1d6"
+	defaultStatusTurns = 3
+)
+
+// maxCombatTurns bounds how many turns run automatically in one resolution step
+const maxCombatTurns = 50
+
+// statusRule is what a status effect does to its bearer
+type statusRule struct {
+	TickDamage  string   // Rolled at the start of the bearer's turn
+	SkipTurn    bool     // The bearer loses the turn
+	AttackBonus int      // Added to the bearer's attack rolls
+	AttackMode  RollMode // Applied to the bearer's attack rolls
+}
+
+var statusRules = map[string]statusRule{
+	"poisoned": {TickDamage: "1d4", AttackMode: RollDisadvantage},
+	"burning":  {TickDamage: "1d6"},
+	"stunned":  {SkipTurn: true},
+	"blessed":  {AttackBonus: 2},
+	"hidden":   {AttackMode: RollAdvantage},
+}
+
+// StatusEffect is a status on a combatant that wears off after a number of its turns
+type StatusEffect struct {
+	Name  string `json:"name"`
+	Turns int    `json:"turns"`
+}
+
+// Combatant is a world entity taking part in a fight
+type Combatant struct {
+	ID              string         `json:"id"` // World entity ID
+	Name            string         `json:"name"`
+	Side            string         `json:"side"`
+	HP              int            `json:"hp"`
+	MaxHP           int            `json:"max_hp"`
+	AC              int            `json:"ac"`
+	AttackBonus     int            `json:"attack_bonus"`
+	Damage          string         `json:"damage"`
+	InitiativeBonus int            `json:"initiative_bonus"`
+	Initiative      int            `json:"initiative"`
+	Statuses        []StatusEffect `json:"statuses"`
+}
+
+// Defeated reports whether the combatant is out of the fight
+func (c *Combatant) Defeated() bool {
+	return c.HP <= 0
+}
+
+// CombatEvent is one resolved step of a fight, with the rolls behind it
+type CombatEvent struct {
+	Round  int          `json:"round"`
+	Kind   string       `json:"kind"` // initiative, attack, status, skip, defeat, end
+	Actor  string       `json:"actor"`
+	Target string       `json:"target,omitempty"`
+	Rolls  []RollResult `json:"rolls,omitempty"`
+	Text   string       `json:"text"`
+}
+
+// Combat is a fight in initiative order
+type Combat struct {
+	Round      int                   `json:"round"`
+	Order      []string              `json:"order"`
+	Current    int                   `json:"current"`    // Index into Order of whose turn it is
+	TurnBegun  bool                  `json:"turn_begun"` // The active combatant's statuses were applied
+	Combatants map[string]*Combatant `json:"combatants"`
+	Winner     string                `json:"winner,omitempty"` // Side that won, once the fight is over
+}
+
+// CombatCommand is a parsed /combat or /attack command
+type CombatCommand struct {
+	Action  string   // show, start, attack, status, end
+	Targets []string // Foes for start, target for attack and status
+	Mode    RollMode // For attack
+	Status  string   // For status
+	Turns   int      // For status
+}
+
+// CombatantFromEntity reads combat stats from an entity's attributes: hp, max_hp, ac,
+// attack, damage and initiative. Missing stats get modest defaults.
+func CombatantFromEntity(entity *WorldEntity, side string) *Combatant {
+	c := &Combatant{
+		ID:          entity.ID,
+		Name:        entity.Name,
+		Side:        side,
+		MaxHP:       attributeInt(entity, "max_hp", attributeInt(entity, "hp", defaultHP)),
+		AC:          attributeInt(entity, "ac", defaultAC),
+		AttackBonus: attributeInt(entity, "attack", defaultAttackBonus),
+		Damage:      defaultDamage,
+	}
+	c.HP = attributeInt(entity, "hp", c.MaxHP)
+	c.InitiativeBonus = attributeInt(entity, "initiative", 0)
+	if damage := entity.Attributes["damage"]; damage != "" {
+		if _, err := ParseDice(damage); err == nil {
+			c.Damage = damage
+		}
+	}
+	return c
+}
+
+// WriteTo records the combatant's condition on its world entity
+func (c *Combatant) WriteTo(entity *WorldEntity) {
+	entity.Attributes["hp"] = strconv.Itoa(max(c.HP, 0))
+	entity.Attributes["max_hp"] = strconv.Itoa(c.MaxHP)
+
+	var statuses []string
+	if c.Defeated() {
+		statuses = append(statuses, "defeated")
+	} else {
+		for _, s := range c.Statuses {
+			statuses = append(statuses, s.Name)
+		}
+	}
+	if len(statuses) > 0 {
+		entity.Attributes["status"] = strings.Join(statuses, ", ")
+	} else {
+		delete(entity.Attributes, "status")
+	}
+}
+
+// StartCombat rolls initiative and orders the combatants
+func StartCombat(dice *Dice, combatants []*Combatant) (*Combat, []CombatEvent) {
+	combat := &Combat{Round: 1, Combatants: make(map[string]*Combatant, len(combatants))}
+	var events []CombatEvent
+
+	for _, c := range combatants {
+		roll := dice.Roll(RollSpec{Count: 1, Sides: 20, Modifier: c.InitiativeBonus})
+		roll.Purpose = c.Name + " initiative"
+		c.Initiative = roll.Total
+		combat.Combatants[c.ID] = c
+		combat.Order = append(combat.Order, c.ID)
+		events = append(events, CombatEvent{Round: 1, Kind: "initiative", Actor: c.Name, Rolls: []RollResult{roll},
+			Text: fmt.Sprintf("%s rolls initiative %d", c.Name, roll.Total)})
+	}
+
+	sort.SliceStable(combat.Order, func(i, j int) bool {
+		a, b := combat.Combatants[combat.Order[i]], combat.Combatants[combat.Order[j]]
+		if a.Initiative != b.Initiative {
+			return a.Initiative > b.Initiative
+		}
+		return a.Name < b.Name
+	})
+	return combat, events
+}
+
+// Over reports whether one side has been defeated
+func (c *Combat) Over() bool {
+	return c.Winner != ""
+}
+
+// Recover heals everyone still standing, and the whole party, once the fight is over or
+// called off, so the next fight doesn't start with this one's wounds. Fallen foes stay down.
+func (c *Combat) Recover() {
+	for _, combatant := range c.Combatants {
+		if combatant.Side == SideParty || !combatant.Defeated() {
+			combatant.HP = combatant.MaxHP
+			combatant.Statuses = nil
+		}
+	}
+}
+
+// Active returns the combatant whose turn it is
+func (c *Combat) Active() *Combatant {
+	return c.Combatants[c.Order[c.Current]]
+}
+
+// PlayerAttack lets the party attack the target: foes ahead of the party in initiative act
+// first, then the party attacks, then the fight runs until it is the party's turn again
+func (c *Combat) PlayerAttack(dice *Dice, targetRef string, mode RollMode) ([]CombatEvent, error) {
+	target := c.find(targetRef)
+	if target == nil {
+		return nil, fmt.Errorf("%q isn't in this fight", targetRef)
+	}
+	if target.Side == SideParty {
+		return nil, fmt.Errorf("%s is on your side", target.Name)
+	}
+	if target.Defeated() {
+		return nil, fmt.Errorf("%s is already down", target.Name)
+	}
+
+	events := c.runUntilParty(dice)
+	if c.Over() {
+		return events, nil
+	}
+	actor := c.Active()
+	if actor.ID != partyID {
+		return events, errors.New("the fight stalled before it was your turn")
+	}
+
+	events = append(events, c.attack(dice, actor, target, mode)...)
+	events = append(events, c.checkOver()...)
+	if c.Over() {
+		return events, nil
+	}
+
+	c.advance()
+	return append(events, c.runUntilParty(dice)...), nil
+}
+
+// ApplyStatus puts a status effect on a combatant
+func (c *Combat) ApplyStatus(targetRef, status string, turns int) (CombatEvent, error) {
+	target := c.find(targetRef)
+	if target == nil {
+		return CombatEvent{}, fmt.Errorf("%q isn't in this fight", targetRef)
+	}
+	status = strings.ToLower(status)
+	if _, known := statusRules[status]; !known {
+		return CombatEvent{}, fmt.Errorf("unknown status %q", status)
+	}
+	if turns <= 0 {
+		turns = defaultStatusTurns
+	}
+
+	target.Statuses = append(removeStatus(target.Statuses, status), StatusEffect{Name: status, Turns: turns})
+	return CombatEvent{Round: c.Round, Kind: "status", Actor: target.Name,
+		Text: fmt.Sprintf("%s is %s for %d turns", target.Name, status, turns)}, nil
+}
+
+// Describe summarises the fight: round, turn order and everyone's condition
+func (c *Combat) Describe() string {
+	lines := []string{fmt.Sprintf("Round %d, %s's turn.", c.Round, c.Active().Name)}
+	for _, id := range c.Order {
+		combatant := c.Combatants[id]
+		line := fmt.Sprintf("%s (%s): %d/%d HP, AC %d", combatant.Name, combatant.Side, max(combatant.HP, 0), combatant.MaxHP, combatant.AC)
+		if combatant.Defeated() {
+			line += ", defeated"
+		}
+		for _, s := range combatant.Statuses {
+			line += fmt.Sprintf(", %s (%d turns)", s.Name, s.Turns)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunUntilPlayer plays out turns until the player's party is up, e.g. right after initiative
+func (c *Combat) RunUntilPlayer(dice *Dice) []CombatEvent {
+	return c.runUntilParty(dice)
+}
+
+// runUntilParty plays out turns until a party member who can act is up, or the fight ends
+func (c *Combat) runUntilParty(dice *Dice) []CombatEvent {
+	var events []CombatEvent
+	for i := 0; i < maxCombatTurns && !c.Over(); i++ {
+		actor := c.Active()
+		if actor.Defeated() {
+			c.advance()
+			continue
+		}
+
+		if actor.ID == partyID && c.TurnBegun {
+			// Waiting on the player's action
+			break
+		}
+
+		turnEvents, canAct := c.startTurn(dice, actor)
+		c.TurnBegun = true
+		events = append(events, turnEvents...)
+		if events = append(events, c.checkOver()...); c.Over() {
+			break
+		}
+		if !canAct {
+			c.advance()
+			continue
+		}
+		if actor.ID == partyID {
+			break
+		}
+
+		// Everyone else picks the weakest standing opponent
+		if target := c.weakestOpponent(actor); target != nil {
+			events = append(events, c.attack(dice, actor, target, RollNormal)...)
+			events = append(events, c.checkOver()...)
+		}
+		c.advance()
+	}
+	return events
+}
+
+// startTurn applies the actor's status effects, reporting whether they can still act
+func (c *Combat) startTurn(dice *Dice, actor *Combatant) ([]CombatEvent, bool) {
+	var events []CombatEvent
+	canAct := true
+	var remaining []StatusEffect
+
+	for _, status := range actor.Statuses {
+		rule := statusRules[status.Name]
+		if rule.TickDamage != "" {
+			roll, _ := dice.RollNotation(rule.TickDamage, fmt.Sprintf("%s %s damage", actor.Name, status.Name))
+			actor.HP -= roll.Total
+			events = append(events, CombatEvent{Round: c.Round, Kind: "status", Actor: actor.Name, Rolls: []RollResult{roll},
+				Text: fmt.Sprintf("%s takes %d damage from being %s (%d/%d HP)", actor.Name, roll.Total, status.Name, max(actor.HP, 0), actor.MaxHP)})
+		}
+		if rule.SkipTurn {
+			canAct = false
+			events = append(events, CombatEvent{Round: c.Round, Kind: "skip", Actor: actor.Name,
+				Text: fmt.Sprintf("%s is %s and loses the turn", actor.Name, status.Name)})
+		}
+		if status.Turns--; status.Turns > 0 {
+			remaining = append(remaining, status)
+		}
+	}
+	actor.Statuses = remaining
+
+	if actor.Defeated() {
+		events = append(events, CombatEvent{Round: c.Round, Kind: "defeat", Actor: actor.Name, Text: actor.Name + " falls"})
+		canAct = false
+	}
+	return events, canAct
+}
+
+// attack resolves an attack roll against the target's AC and any damage. A natural 20 hits
+// and doubles the damage dice; a natural 1 always misses.
+func (c *Combat) attack(dice *Dice, actor, target *Combatant, mode RollMode) []CombatEvent {
+	bonus := actor.AttackBonus
+	modes := []RollMode{mode}
+	for _, status := range actor.Statuses {
+		rule := statusRules[status.Name]
+		bonus += rule.AttackBonus
+		modes = append(modes, rule.AttackMode)
+	}
+
+	attackRoll := dice.Roll(RollSpec{Count: 1, Sides: 20, Modifier: bonus, Mode: combineModes(modes)})
+	attackRoll.Purpose = fmt.Sprintf("%s attacks %s", actor.Name, target.Name)
+	natural := attackRoll.Rolls[0]
+	event := CombatEvent{Round: c.Round, Kind: "attack", Actor: actor.Name, Target: target.Name, Rolls: []RollResult{attackRoll}}
+
+	hit := natural == 20 || (natural != 1 && attackRoll.Total >= target.AC)
+	if !hit {
+		event.Text = fmt.Sprintf("%s attacks %s and misses (%d vs AC %d)", actor.Name, target.Name, attackRoll.Total, target.AC)
+		return []CombatEvent{event}
+	}
+
+	damageSpec, _ := ParseDice(actor.Damage)
+	if natural == 20 {
+		damageSpec.Count *= 2
+	}
+	damageRoll := dice.Roll(damageSpec)
+	damageRoll.Purpose = fmt.Sprintf("%s damage to %s", actor.Name, target.Name)
+	damage := max(damageRoll.Total, 1)
+	target.HP -= damage
+	event.Rolls = append(event.Rolls, damageRoll)
+
+	verb := "hits"
+	if natural == 20 {
+		verb = "lands a critical hit on"
+	}
+	event.Text = fmt.Sprintf("%s %s %s for %d damage (%d vs AC %d); %s has %d/%d HP",
+		actor.Name, verb, target.Name, damage, attackRoll.Total, target.AC, target.Name, max(target.HP, 0), target.MaxHP)
+	events := []CombatEvent{event}
+
+	if target.Defeated() {
+		events = append(events, CombatEvent{Round: c.Round, Kind: "defeat", Actor: target.Name, Text: target.Name + " falls"})
+	}
+	return events
+}
+
+// checkOver ends the fight once a side has nobody standing
+func (c *Combat) checkOver() []CombatEvent {
+	if c.Over() {
+		return nil
+	}
+	standing := map[string]bool{}
+	for _, combatant := range c.Combatants {
+		if !combatant.Defeated() {
+			standing[combatant.Side] = true
+		}
+	}
+
+	switch {
+	case !standing[SideFoe]:
+		c.Winner = SideParty
+	case !standing[SideParty]:
+		c.Winner = SideFoe
+	default:
+		return nil
+	}
+	return []CombatEvent{{Round: c.Round, Kind: "end", Actor: c.Winner,
+		Text: fmt.Sprintf("The fight is over; the %s side wins", c.Winner)}}
+}
+
+func (c *Combat) advance() {
+	c.TurnBegun = false
+	c.Current++
+	if c.Current >= len(c.Order) {
+		c.Current = 0
+		c.Round++
+	}
+}
+
+func (c *Combat) weakestOpponent(actor *Combatant) *Combatant {
+	var weakest *Combatant
+	for _, id := range c.Order {
+		candidate := c.Combatants[id]
+		if candidate.Side == actor.Side || candidate.Defeated() {
+			continue
+		}
+		if weakest == nil || candidate.HP < weakest.HP {
+			weakest = candidate
+		}
+	}
+	return weakest
+}
+
+func (c *Combat) find(ref string) *Combatant {
+	id := worldID(ref)
+	if combatant, exists := c.Combatants[id]; exists {
+		return combatant
+	}
+	for _, combatant := range c.Combatants {
+		if worldID(combatant.Name) == id {
+			return combatant
+		}
+	}
+	return nil
+}
+
+// IsCombatCommand reports whether the prompt is a /combat or /attack command
+func IsCombatCommand(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	command := strings.ToLower(fields[0])
+	return command == "/combat" || command == "/attack"
+}
+
+// ParseCombatCommand parses:
+//
+//	/combat [show]
+//	/combat start <foe> [<foe>...]
+//	/combat status <target> <effect> [turns]
+//	/combat end
+//	/attack <target> [advantage|disadvantage]
+func ParseCombatCommand(input string) (CombatCommand, error) {
+	args := splitCommandArgs(input)
+	if len(args) == 0 {
+		return CombatCommand{}, errors.New("not a combat command")
+	}
+
+	if strings.EqualFold(args[0], "/attack") {
+		args = args[1:]
+		cmd := CombatCommand{Action: "attack"}
+		if n := len(args); n > 1 {
+			switch strings.ToLower(args[n-1]) {
+			case "adv", "advantage":
+				cmd.Mode, args = RollAdvantage, args[:n-1]
+			case "dis", "disadvantage":
+				cmd.Mode, args = RollDisadvantage, args[:n-1]
+			}
+		}
+		if len(args) == 0 {
+			return CombatCommand{}, errors.New("usage: /attack <target> [advantage|disadvantage]")
+		}
+		cmd.Targets = []string{commandName(args)}
+		return cmd, nil
+	}
+
+	args = args[1:]
+	if len(args) == 0 {
+		return CombatCommand{Action: "show"}, nil
+	}
+	verb, args := strings.ToLower(args[0]), args[1:]
+	switch verb {
+	case "show", "end":
+		return CombatCommand{Action: verb}, nil
+	case "start":
+		if len(args) == 0 {
+			return CombatCommand{}, errors.New("usage: /combat start <foe> [<foe>...]")
+		}
+		cmd := CombatCommand{Action: "start"}
+		for _, arg := range args {
+			cmd.Targets = append(cmd.Targets, commandName([]string{arg}))
+		}
+		return cmd, nil
+	case "status":
+		if len(args) < 2 {
+			return CombatCommand{}, errors.New("usage: /combat status <target> <effect> [turns]")
+		}
+		cmd := CombatCommand{Action: "status", Targets: []string{commandName(args[:1])}, Status: args[1]}
+		if len(args) > 2 {
+			cmd.Turns, _ = strconv.Atoi(args[2])
+		}
+		return cmd, nil
+	}
+	return CombatCommand{}, fmt.Errorf("unknown /combat command %q", verb)
+}
+
+// Helper functions
+
+func attributeInt(entity *WorldEntity, key string, fallback int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(entity.Attributes[key])); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// combineModes nets advantage against disadvantage, as either cancels the other
+func combineModes(modes []RollMode) RollMode {
+	advantage, disadvantage := false, false
+	for _, mode := range modes {
+		advantage = advantage || mode == RollAdvantage
+		disadvantage = disadvantage || mode == RollDisadvantage
+	}
+	switch {
+	case advantage && !disadvantage:
+		return RollAdvantage
+	case disadvantage && !advantage:
+		return RollDisadvantage
+	}
+	return RollNormal
+}
+
+func removeStatus(statuses []StatusEffect, name string) []StatusEffect {
+	var kept []StatusEffect
+	for _, s := range statuses {
+		if s.Name != name {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
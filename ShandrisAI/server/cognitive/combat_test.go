@@ -0,0 +1,146 @@
+package cognitive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testCombatant(id, side string, hp, initiative int) *Combatant {
+	return &Combatant{ID: id, Name: id, Side: side, HP: hp, MaxHP: hp, AC: 10,
+		AttackBonus: 3, Damage: "1d6", InitiativeBonus: initiative}
+}
+
+func TestStartCombatInitiativeOrder(t *testing.T) {
+	combatants := []*Combatant{
+		testCombatant("goblin", SideFoe, 7, 0),
+		testCombatant(partyID, SideParty, 20, 100),
+		testCombatant("troll", SideFoe, 30, -100),
+	}
+	combat, events := StartCombat(NewDice(1), combatants)
+	if want := []string{partyID, "goblin", "troll"}; !reflect.DeepEqual(combat.Order, want) {
+		t.Errorf("order %v, want %v", combat.Order, want)
+	}
+	if len(events) != 3 || events[0].Kind != "initiative" {
+		t.Errorf("expected an initiative event per combatant: %+v", events)
+	}
+
+	// The same seed gives the same fight
+	again, _ := StartCombat(NewDice(1), []*Combatant{
+		testCombatant("goblin", SideFoe, 7, 0),
+		testCombatant(partyID, SideParty, 20, 100),
+		testCombatant("troll", SideFoe, 30, -100),
+	})
+	if !reflect.DeepEqual(combat, again) {
+		t.Error("same seed gave a different fight")
+	}
+}
+
+func TestCombatAttackDamage(t *testing.T) {
+	dice := NewDice(3)
+	combat := &Combat{Round: 1}
+	for i := 0; i < 30; i++ {
+		actor := testCombatant("knight", SideParty, 20, 0)
+		actor.AttackBonus = 100
+		target := testCombatant("dummy", SideFoe, 50, 0)
+
+		events := combat.attack(dice, actor, target, RollNormal)
+		natural := events[0].Rolls[0].Rolls[0]
+		if natural == 1 {
+			if target.HP != 50 || len(events[0].Rolls) != 1 {
+				t.Fatalf("a natural 1 hit: %+v", events[0])
+			}
+			continue
+		}
+
+		damage := events[0].Rolls[1]
+		if target.HP != 50-max(damage.Total, 1) {
+			t.Fatalf("HP %d after %v damage", target.HP, damage)
+		}
+		wantDice := 1
+		if natural == 20 {
+			wantDice = 2
+		}
+		if len(damage.Rolls) != wantDice {
+			t.Fatalf("natural %d rolled %d damage dice", natural, len(damage.Rolls))
+		}
+	}
+}
+
+func TestCombatStatusExpiry(t *testing.T) {
+	dice := NewDice(5)
+	foe := testCombatant("goblin", SideFoe, 100, 0)
+	combat := &Combat{Round: 1, Order: []string{"goblin"}, Combatants: map[string]*Combatant{"goblin": foe}}
+
+	if _, err := combat.ApplyStatus("Goblin", "stunned", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := combat.ApplyStatus("goblin", "poisoned", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := combat.ApplyStatus("goblin", "cursed", 1); err == nil {
+		t.Error("unknown status accepted")
+	}
+
+	events, canAct := combat.startTurn(dice, foe)
+	if canAct {
+		t.Error("stunned combatant could act")
+	}
+	if foe.HP >= 100 || len(events) != 2 {
+		t.Errorf("poison didn't tick: HP %d, events %+v", foe.HP, events)
+	}
+	if want := []StatusEffect{{Name: "stunned", Turns: 1}}; !reflect.DeepEqual(foe.Statuses, want) {
+		t.Errorf("statuses %+v, want %+v", foe.Statuses, want)
+	}
+
+	if _, canAct := combat.startTurn(dice, foe); canAct {
+		t.Error("stun wore off a turn early")
+	}
+	if _, canAct := combat.startTurn(dice, foe); !canAct || len(foe.Statuses) != 0 {
+		t.Errorf("stun didn't wear off: %+v", foe.Statuses)
+	}
+}
+
+func TestCombatRecover(t *testing.T) {
+	party := testCombatant(partyID, SideParty, 20, 0)
+	party.HP = -3
+	standing := testCombatant("troll", SideFoe, 30, 0)
+	standing.HP = 4
+	standing.Statuses = []StatusEffect{{Name: "burning", Turns: 2}}
+	fallen := testCombatant("goblin", SideFoe, 7, 0)
+	fallen.HP = 0
+
+	combat := &Combat{Combatants: map[string]*Combatant{partyID: party, "troll": standing, "goblin": fallen}}
+	combat.Recover()
+
+	if party.HP != 20 {
+		t.Errorf("party HP %d, want 20", party.HP)
+	}
+	if standing.HP != 30 || standing.Statuses != nil {
+		t.Errorf("standing foe not recovered: %+v", standing)
+	}
+	if fallen.HP != 0 {
+		t.Errorf("fallen foe got up: %+v", fallen)
+	}
+}
+
+func TestPlayerAttackFinishesFight(t *testing.T) {
+	party := testCombatant(partyID, SideParty, 50, 100)
+	party.AttackBonus = 100
+	party.Damage = "1d6+20"
+	combat, _ := StartCombat(NewDice(9), []*Combatant{party, testCombatant("rat", SideFoe, 3, -100)})
+	combat.RunUntilPlayer(NewDice(9))
+
+	if _, err := combat.PlayerAttack(NewDice(9), "party", RollNormal); err == nil {
+		t.Error("attacking your own side was allowed")
+	}
+
+	dice := NewDice(9)
+	for i := 0; i < 10 && !combat.Over(); i++ {
+		if _, err := combat.PlayerAttack(dice, "rat", RollNormal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if combat.Winner != SideParty {
+		t.Errorf("winner %q, want the party", combat.Winner)
+	}
+}
@@ -16,19 +16,36 @@ type ContextAnalyzer struct {
 type ThemeDetector struct {
 	ActiveThemes map[string]float64 // theme -> confidence
 	ThemeHistory []ThemeTransition
+	Model        *ThemeModel       // Theme dictionary; nothing is detected without one
+	Window       []string          // Recent messages, oldest first
+	Profile      map[string]string // The user's profile attributes
 }
 
 type ThemeTransition struct {
-	From      string
-	To        string
-	Timestamp time.Time
-	Trigger   string
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+	Trigger   string    `json:"trigger"`
 }
 
 type SentimentEngine struct {
 	BaseSentiment float64
 	Modifiers     map[string]float64
 	Context       map[string]bool
+	Analyzer      *SentimentAnalyzer // Reads the message itself; the built-in lexicon if nil
+}
+
+// NewContextAnalyzer creates an analyzer over a theme model with an empty theme history and the
+// built-in sentiment lexicon
+func NewContextAnalyzer(model *ThemeModel) *ContextAnalyzer {
+	return &ContextAnalyzer{
+		ThemeDetector: NewThemeDetector(model),
+		SentimentEngine: &SentimentEngine{
+			Modifiers: model.SentimentModifiers(),
+			Context:   make(map[string]bool),
+			Analyzer:  NewSentimentAnalyzer(),
+		},
+	}
 }
 
 func (ca *ContextAnalyzer) AnalyzeContext(input string, userContext map[string]any) EmotionalContext {
@@ -45,23 +62,26 @@ func (ca *ContextAnalyzer) AnalyzeContext(input string, userContext map[string]a
 	context.ThemeScores = ca.ThemeDetector.DetectThemes(input)
 
 	// Analyze sapphic context specifically
-	context.SapphicContext = ca.analyzeSapphicContext(input, context.ThemeScores)
+	context.SapphicContext = ca.analyzeSapphicContext(input, context.ThemeScores, userContext)
 
 	// Calculate emotional values
-	context.Sentiment = ca.SentimentEngine.CalculateSentiment(input, context.ThemeScores)
-	context.Intensity = ca.calculateIntensity(input, context.ThemeScores)
+	reading := ca.SentimentEngine.Analyze(input)
+	context.Sentiment = ca.SentimentEngine.sentimentFrom(reading, context.ThemeScores)
+	context.Intensity = ca.calculateIntensity(reading, context.ThemeScores)
+	context.IsEmotional = math.Abs(reading.Valence) >= 0.5 || reading.Arousal >= 0.7
+	context.IsTechnical = DetectCode(input).Technical() || context.ThemeScores["technical"] >= 0.5
 	context.EmotionalTone = ca.determineEmotionalTone(context)
 
 	return context
 }
 
-func (ca *ContextAnalyzer) analyzeSapphicContext(input string, themes map[string]float64) SapphicContext {
+func (ca *ContextAnalyzer) analyzeSapphicContext(input string, themes map[string]float64, userContext map[string]any) SapphicContext {
 	return SapphicContext{
 		IsRomantic:     containsSapphicRomance(input),
 		IsFlirty:       detectFlirtyTone(input),
 		IsPlatonic:     themes["platonic"] > 0.5,
 		Intensity:      calculateSapphicIntensity(input, themes),
-		AllowsFlirting: validateFlirtingContext(input, themes),
+		AllowsFlirting: validateFlirtingContext(input, themes, userContext),
 	}
 }
 
@@ -143,18 +163,19 @@ func calculateSapphicIntensity(input string, themes map[string]float64) float64
 	return intensity
 }
 
-func validateFlirtingContext(input string, themes map[string]float64) bool {
-	// Only allow flirting in appropriate contexts
-	if themes["professional"] > 0.7 || themes["serious"] > 0.8 {
+func validateFlirtingContext(input string, themes map[string]float64, userContext map[string]any) bool {
+	// Flirting is opt-in: the user must have enabled it in their boundaries
+	if flirtingEnabled, _ := userContext["flirting_enabled"].(bool); !flirtingEnabled {
 		return false
 	}
 
-	// Must have feminine/sapphic context
-	if !containsSapphicRomance(input) && themes["feminine"] < 0.3 {
+	// Only allow flirting in appropriate contexts
+	if themes["professional"] > 0.7 || themes["serious"] > 0.8 {
 		return false
 	}
 
-	return true
+	// Must have feminine/sapphic context, from the words themselves if no theme says so
+	return containsSapphicRomance(input) || detectFlirtyTone(input) || themes["feminine"] >= 0.3
 }
 
 func calculateToneScore(context EmotionalContext, tone string) float64 {
@@ -192,32 +213,32 @@ func (ca *ContextAnalyzer) extractKeywords(input string) []string {
 	return strings.Fields(strings.ToLower(input))
 }
 
-func (ca *ContextAnalyzer) calculateIntensity(input string, themes map[string]float64) float64 {
-	// Implementation for intensity calculation
-	baseIntensity := 0.5
-
-	// Adjust intensity based on text content
-	if strings.Contains(strings.ToLower(input), "very") || strings.Contains(strings.ToLower(input), "really") {
-		baseIntensity += 0.2
-	}
+func (ca *ContextAnalyzer) calculateIntensity(reading SentimentResult, themes map[string]float64) float64 {
+	// Excited or agitated messages are more intense, calm ones less
+	baseIntensity := 0.5 + (reading.Arousal-calmArousal)*0.5
 
 	// Add theme-based intensity
 	for _, score := range themes {
 		baseIntensity += score * 0.1
 	}
-	return math.Min(1.0, baseIntensity)
+	return math.Max(0, math.Min(1.0, baseIntensity))
 }
 
-func (td *ThemeDetector) DetectThemes(input string) map[string]float64 {
-	// Implementation for theme detection
-	themes := make(map[string]float64)
-	// Add theme detection logic here
-	return themes
+// Analyze reads the sentiment of a message
+func (se *SentimentEngine) Analyze(input string) SentimentResult {
+	if se.Analyzer == nil {
+		return AnalyzeSentiment(input)
+	}
+	return se.Analyzer.Analyze(input)
 }
 
+// CalculateSentiment reads the message's valence and shifts it by the themes it touches
 func (se *SentimentEngine) CalculateSentiment(input string, themes map[string]float64) float64 {
-	// Implementation for sentiment calculation
-	baseSentiment := se.BaseSentiment
+	return se.sentimentFrom(se.Analyze(input), themes)
+}
+
+func (se *SentimentEngine) sentimentFrom(reading SentimentResult, themes map[string]float64) float64 {
+	baseSentiment := se.BaseSentiment + reading.Valence
 	for theme, score := range themes {
 		if modifier, exists := se.Modifiers[theme]; exists {
 			baseSentiment += modifier * score
@@ -11,6 +11,7 @@ type ContextAnalysis struct {
 	SecondaryContext string
 	IsEmotional      bool
 	IsTechnical      bool
+	Code             CodeReport // Code, errors, paths and commands found in the input
 	SapphicContext   SapphicContext
 	Intensity        float64
 	PreviousScores   map[string]float64
@@ -31,7 +32,53 @@ type ContextStateTransition struct {
 	Trigger   string
 }
 
+// NewContextDetector creates a detector with the default emotional and technical markers
+func NewContextDetector() *ContextDetector {
+	return &ContextDetector{
+		EmotionalMarkers: map[string]float64{
+			"feel":     0.3,
+			"feeling":  0.3,
+			"sad":      0.6,
+			"happy":    0.4,
+			"angry":    0.6,
+			"anxious":  0.6,
+			"stressed": 0.6,
+			"lonely":   0.7,
+			"hurt":     0.6,
+			"scared":   0.6,
+			"cry":      0.7,
+			"upset":    0.6,
+			"love":     0.4,
+			"miss":     0.4,
+		},
+		TechnicalMarkers: map[string]float64{
+			"code":     0.4,
+			"bug":      0.5,
+			"error":    0.4,
+			"function": 0.4,
+			"compile":  0.6,
+			"database": 0.5,
+			"server":   0.4,
+			"api":      0.5,
+			"deploy":   0.5,
+			"golang":   0.6,
+			"python":   0.6,
+			"rust":     0.6,
+			"debug":    0.6,
+			"query":    0.3,
+		},
+		PreviousContext: &ContextAnalysis{
+			PreviousScores: make(map[string]float64),
+			ContextStack:   make([]string, 0),
+		},
+	}
+}
+
 func (cd *ContextDetector) AnalyzeContext(input string, userState map[string]any) ContextAnalysis {
+	if cd.PreviousContext == nil {
+		cd.PreviousContext = &ContextAnalysis{PreviousScores: make(map[string]float64)}
+	}
+
 	analysis := ContextAnalysis{
 		PreviousScores: cd.PreviousContext.PreviousScores,
 		ContextStack:   make([]string, 0),
@@ -40,8 +87,9 @@ func (cd *ContextDetector) AnalyzeContext(input string, userState map[string]any
 	// Detect emotional content
 	analysis.IsEmotional = cd.detectEmotionalContent(input)
 
-	// Detect technical content
-	analysis.IsTechnical = cd.detectTechnicalContent(input)
+	// Detect technical content: pasted code or errors settle it, otherwise the markers decide
+	analysis.Code = DetectCode(input)
+	analysis.IsTechnical = analysis.Code.Technical() || cd.detectTechnicalContent(input)
 
 	// Analyze sapphic context
 	analysis.SapphicContext = cd.analyzeSapphicContext(input, userState)
@@ -59,6 +107,17 @@ func (cd *ContextDetector) AnalyzeContext(input string, userState map[string]any
 	// Track context stack
 	analysis.ContextStack = cd.updateContextStack(analysis)
 
+	// Record the transition and remember this turn for the next one
+	if previous := cd.PreviousContext.PrimaryContext; previous != "" && previous != analysis.PrimaryContext {
+		cd.ContextTransitions = append(cd.ContextTransitions, ContextStateTransition{
+			From:      previous,
+			To:        analysis.PrimaryContext,
+			Timestamp: time.Now(),
+			Trigger:   input,
+		})
+	}
+	cd.PreviousContext = &analysis
+
 	return analysis
 }
 
@@ -184,8 +243,8 @@ func (cd *ContextDetector) validateFlirtingContext(input string, userState map[s
 		return false
 	}
 
-	// Check user state for flirting preferences
-	if flirtingEnabled, ok := userState["flirting_enabled"].(bool); ok && !flirtingEnabled {
+	// Flirting is opt-in: the user must have enabled it in their boundaries
+	if flirtingEnabled, _ := userState["flirting_enabled"].(bool); !flirtingEnabled {
 		return false
 	}
 
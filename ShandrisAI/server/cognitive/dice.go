@@ -0,0 +1,211 @@
+package cognitive
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxDiceCount = 100
+	maxDiceSides = 1000
+	// maxExplosions caps how often a single die may explode
+	maxExplosions = 10
+)
+
+// RollMode is how a d20-style roll is taken
+type RollMode string
+
+const (
+	RollNormal       RollMode = ""
+	RollAdvantage    RollMode = "advantage"
+	RollDisadvantage RollMode = "disadvantage"
+)
+
+// RollSpec is a parsed dice expression such as 2d6+3
+type RollSpec struct {
+	Count     int
+	Sides     int
+	Modifier  int
+	Exploding bool // A die showing its maximum is rolled again and added
+	Mode      RollMode
+}
+
+// RollResult is the outcome of a roll, with every die kept for auditing
+type RollResult struct {
+	Notation string `json:"notation"`
+	Rolls    []int  `json:"rolls"`
+	Dropped  []int  `json:"dropped,omitempty"` // The discarded set of an advantage/disadvantage roll
+	Modifier int    `json:"modifier"`
+	Total    int    `json:"total"`
+	Purpose  string `json:"purpose,omitempty"`
+}
+
+// Dice rolls dice from a seedable source, so a sequence of rolls can be replayed
+type Dice struct {
+	rng  *rand.Rand
+	Seed int64
+}
+
+// NewDice creates dice from a seed
+func NewDice(seed int64) *Dice {
+	return &Dice{rng: rand.New(rand.NewSource(seed)), Seed: seed}
+}
+
+var diceNotation = regexp.MustCompile(`(?i)^(\d*)d(\d+|%)(!)?\s*([+-]\s*\d+)?(?:\s+(adv|advantage|dis|disadvantage))?$`)
+
+// ParseDice parses standard notation: "d20", "2d6+3", "4d6!" (exploding), "d%",
+// "d20+5 adv" / "d20 disadvantage"
+func ParseDice(notation string) (RollSpec, error) {
+	m := diceNotation.FindStringSubmatch(strings.TrimSpace(notation))
+	if m == nil {
+		return RollSpec{}, fmt.Errorf("can't read dice %q", notation)
+	}
+
+	spec := RollSpec{Count: 1, Exploding: m[3] == "!"}
+	if m[1] != "" {
+		spec.Count, _ = strconv.Atoi(m[1])
+	}
+	if m[2] == "%" {
+		spec.Sides = 100
+	} else {
+		spec.Sides, _ = strconv.Atoi(m[2])
+	}
+	if m[4] != "" {
+		spec.Modifier, _ = strconv.Atoi(strings.ReplaceAll(m[4], " ", ""))
+	}
+	switch strings.ToLower(m[5]) {
+	case "adv", "advantage":
+		spec.Mode = RollAdvantage
+	case "dis", "disadvantage":
+		spec.Mode = RollDisadvantage
+	}
+
+	if spec.Count < 1 || spec.Count > maxDiceCount {
+		return RollSpec{}, fmt.Errorf("dice count must be between 1 and %d", maxDiceCount)
+	}
+	if spec.Sides < 2 || spec.Sides > maxDiceSides {
+		return RollSpec{}, fmt.Errorf("dice sides must be between 2 and %d", maxDiceSides)
+	}
+	return spec, nil
+}
+
+// String writes the spec back in standard notation
+func (s RollSpec) String() string {
+	var b strings.Builder
+	if s.Count != 1 {
+		b.WriteString(strconv.Itoa(s.Count))
+	}
+	b.WriteString("d" + strconv.Itoa(s.Sides))
+	if s.Exploding {
+		b.WriteString("!")
+	}
+	if s.Modifier > 0 {
+		b.WriteString("+" + strconv.Itoa(s.Modifier))
+	} else if s.Modifier < 0 {
+		b.WriteString(strconv.Itoa(s.Modifier))
+	}
+	if s.Mode != RollNormal {
+		b.WriteString(" " + string(s.Mode))
+	}
+	return b.String()
+}
+
+// Roll rolls the spec. Advantage and disadvantage roll the whole set twice and keep the
+// higher or lower total.
+func (d *Dice) Roll(spec RollSpec) RollResult {
+	rolls := d.rollSet(spec)
+	result := RollResult{Notation: spec.String(), Rolls: rolls, Modifier: spec.Modifier}
+
+	if spec.Mode != RollNormal {
+		other := d.rollSet(spec)
+		keepOther := sumInts(other) > sumInts(rolls)
+		if spec.Mode == RollDisadvantage {
+			keepOther = sumInts(other) < sumInts(rolls)
+		}
+		if keepOther {
+			result.Rolls, result.Dropped = other, rolls
+		} else {
+			result.Dropped = other
+		}
+	}
+
+	result.Total = sumInts(result.Rolls) + spec.Modifier
+	return result
+}
+
+// RollNotation parses and rolls in one step
+func (d *Dice) RollNotation(notation, purpose string) (RollResult, error) {
+	spec, err := ParseDice(notation)
+	if err != nil {
+		return RollResult{}, err
+	}
+	result := d.Roll(spec)
+	result.Purpose = purpose
+	return result, nil
+}
+
+func (d *Dice) rollSet(spec RollSpec) []int {
+	rolls := make([]int, 0, spec.Count)
+	for i := 0; i < spec.Count; i++ {
+		roll := d.rng.Intn(spec.Sides) + 1
+		rolls = append(rolls, roll)
+		for n := 0; spec.Exploding && roll == spec.Sides && n < maxExplosions; n++ {
+			roll = d.rng.Intn(spec.Sides) + 1
+			rolls = append(rolls, roll)
+		}
+	}
+	return rolls
+}
+
+// String describes the result, e.g. "2d6+3: [4, 5] +3 = 12"
+func (r RollResult) String() string {
+	parts := make([]string, len(r.Rolls))
+	for i, roll := range r.Rolls {
+		parts[i] = strconv.Itoa(roll)
+	}
+	text := fmt.Sprintf("%s: [%s]", r.Notation, strings.Join(parts, ", "))
+	if r.Modifier > 0 {
+		text += fmt.Sprintf(" +%d", r.Modifier)
+	} else if r.Modifier < 0 {
+		text += fmt.Sprintf(" %d", r.Modifier)
+	}
+	text += fmt.Sprintf(" = %d", r.Total)
+	if len(r.Dropped) > 0 {
+		text += fmt.Sprintf(" (other roll %d dropped)", sumInts(r.Dropped)+r.Modifier)
+	}
+	return text
+}
+
+var inlineRoll = regexp.MustCompile(`(?i)/roll\s+(\d*d(?:\d+|%)!?(?:\s*[+-]\s*\d+)?(?:\s+(?:adv|advantage|dis|disadvantage)\b)?)(?:\s+(?:for\s+)?([^/\n]*))?`)
+
+// trailingJoiner strips the "and" / "then" leading into a following /roll
+var trailingJoiner = regexp.MustCompile(`(?i)[\s,]*\b(and|then)$`)
+
+// RollRequest is a /roll found in a prompt
+type RollRequest struct {
+	Notation string
+	Purpose  string
+}
+
+// DetectRolls finds "/roll <dice> [for <purpose>]" requests in a prompt
+func DetectRolls(prompt string) []RollRequest {
+	var requests []RollRequest
+	for _, m := range inlineRoll.FindAllStringSubmatch(prompt, -1) {
+		requests = append(requests, RollRequest{
+			Notation: strings.TrimSpace(m[1]),
+			Purpose:  trailingJoiner.ReplaceAllString(strings.TrimSpace(m[2]), ""),
+		})
+	}
+	return requests
+}
+
+func sumInts(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
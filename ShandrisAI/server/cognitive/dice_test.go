@@ -0,0 +1,121 @@
+package cognitive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		notation string
+		want     RollSpec
+		err      bool
+	}{
+		{"d20", RollSpec{Count: 1, Sides: 20}, false},
+		{"2d6+3", RollSpec{Count: 2, Sides: 6, Modifier: 3}, false},
+		{"3d8 - 2", RollSpec{Count: 3, Sides: 8, Modifier: -2}, false},
+		{"d%", RollSpec{Count: 1, Sides: 100}, false},
+		{"4d6!", RollSpec{Count: 4, Sides: 6, Exploding: true}, false},
+		{"d20+5 adv", RollSpec{Count: 1, Sides: 20, Modifier: 5, Mode: RollAdvantage}, false},
+		{"D20 disadvantage", RollSpec{Count: 1, Sides: 20, Mode: RollDisadvantage}, false},
+		{"100d1000", RollSpec{Count: 100, Sides: 1000}, false},
+		{"0d6", RollSpec{}, true},
+		{"101d6", RollSpec{}, true},
+		{"d1", RollSpec{}, true},
+		{"d1001", RollSpec{}, true},
+		{"2d", RollSpec{}, true},
+		{"roll a d20", RollSpec{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.notation, func(t *testing.T) {
+			got, err := ParseDice(tt.notation)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if again, err := ParseDice(got.String()); err != nil || again != got {
+				t.Errorf("%q doesn't parse back: %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestDiceSeeded(t *testing.T) {
+	spec := RollSpec{Count: 3, Sides: 6, Modifier: 2}
+	a, b := NewDice(42), NewDice(42)
+	for i := 0; i < 20; i++ {
+		ra, rb := a.Roll(spec), b.Roll(spec)
+		if !reflect.DeepEqual(ra, rb) {
+			t.Fatalf("roll %d differs with the same seed: %v vs %v", i, ra, rb)
+		}
+		if len(ra.Rolls) != 3 || ra.Total != sumInts(ra.Rolls)+2 {
+			t.Fatalf("bad result: %v", ra)
+		}
+		for _, roll := range ra.Rolls {
+			if roll < 1 || roll > 6 {
+				t.Fatalf("die out of range: %v", ra)
+			}
+		}
+	}
+}
+
+func TestDiceAdvantage(t *testing.T) {
+	dice := NewDice(7)
+	for i := 0; i < 50; i++ {
+		adv := dice.Roll(RollSpec{Count: 1, Sides: 20, Mode: RollAdvantage})
+		if len(adv.Dropped) != 1 || adv.Rolls[0] < adv.Dropped[0] {
+			t.Fatalf("advantage kept the lower roll: %v", adv)
+		}
+		dis := dice.Roll(RollSpec{Count: 1, Sides: 20, Mode: RollDisadvantage})
+		if len(dis.Dropped) != 1 || dis.Rolls[0] > dis.Dropped[0] {
+			t.Fatalf("disadvantage kept the higher roll: %v", dis)
+		}
+	}
+}
+
+func TestDiceExploding(t *testing.T) {
+	spec := RollSpec{Count: 5, Sides: 2, Exploding: true}
+	exploded := false
+	for seed := int64(0); seed < 50; seed++ {
+		result := NewDice(seed).Roll(spec)
+		if result.Total != sumInts(result.Rolls) {
+			t.Fatalf("total doesn't match the dice: %v", result)
+		}
+
+		// Each die is followed by one extra roll per maximum, up to maxExplosions
+		dice, i := 0, 0
+		for i < len(result.Rolls) {
+			for n := 0; result.Rolls[i] == spec.Sides && n < maxExplosions; n++ {
+				i++
+				exploded = true
+				if i >= len(result.Rolls) {
+					t.Fatalf("exploding die was not rolled again: %v", result.Rolls)
+				}
+			}
+			i++
+			dice++
+		}
+		if dice != spec.Count {
+			t.Fatalf("got %d dice, want %d: %v", dice, spec.Count, result.Rolls)
+		}
+	}
+	if !exploded {
+		t.Error("no die exploded in 50 seeds")
+	}
+}
+
+func TestDetectRolls(t *testing.T) {
+	got := DetectRolls("/roll 2d6+3 for damage and /roll d20 adv to sneak")
+	want := []RollRequest{{Notation: "2d6+3", Purpose: "damage"}, {Notation: "d20 adv", Purpose: "to sneak"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
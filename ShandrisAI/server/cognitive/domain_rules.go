@@ -98,14 +98,15 @@ func InitializeCognitiveDomainRules() map[string]DomainRule {
 }
 
 // Validator functions
+
+// containsTechPattern reports code, stack traces, compiler errors or shell commands
 func containsTechPattern(input string) bool {
-	// Implementation for detecting technical patterns
-	return false
+	return DetectCode(input).Technical()
 }
 
+// containsCodeReference reports code, or a file path or error location that points at code
 func containsCodeReference(input string) bool {
-	// Implementation for detecting code references
-	return false
+	return DetectCode(input).ReferencesCode()
 }
 
 func containsSapphicContext(input string) bool {
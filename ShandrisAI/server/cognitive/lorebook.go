@@ -0,0 +1,209 @@
+package cognitive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Lore insertion positions
+const (
+	LoreBeforeCharacter = "before_character" // Ahead of Shandris's traits
+	LoreAfterCharacter  = "after_character"  // After her traits, before the conversation
+	LoreBeforeUser      = "before_user"      // Right before the user's latest message
+)
+
+const (
+	// DefaultLoreBudget is the token budget for injected lore when none is configured
+	DefaultLoreBudget = 600
+	// defaultLoreRecursion is how many times activated entries may trigger further entries
+	defaultLoreRecursion = 2
+)
+
+var lorePositions = map[string]bool{
+	LoreBeforeCharacter: true,
+	LoreAfterCharacter:  true,
+	LoreBeforeUser:      true,
+}
+
+// LoreEntry is a piece of canonical world knowledge injected when the conversation mentions it
+type LoreEntry struct {
+	ID            string   `json:"id"`
+	Character     string   `json:"character"` // Empty applies to every character
+	Name          string   `json:"name"`
+	Keys          []string `json:"keys"`     // Whole-word trigger keywords
+	Patterns      []string `json:"patterns"` // Trigger regular expressions
+	Content       string   `json:"content"`
+	Priority      int      `json:"priority"` // Higher entries win when the budget is tight
+	Position      string   `json:"position"`
+	TokenCost     int      `json:"token_cost"` // 0 means estimated from the content
+	Recursive     bool     `json:"recursive"`  // Its content may trigger further entries
+	CaseSensitive bool     `json:"case_sensitive"`
+	Constant      bool     `json:"constant"` // Injected whenever in scope, without a trigger
+	Enabled       bool     `json:"enabled"`
+}
+
+// Cost returns the entry's token cost, estimating it when not set
+func (e LoreEntry) Cost() int {
+	if e.TokenCost > 0 {
+		return e.TokenCost
+	}
+	return EstimateTokens(e.Content)
+}
+
+// ValidateLoreEntry checks an entry before it is stored
+func ValidateLoreEntry(e LoreEntry) error {
+	var errs []error
+	if strings.TrimSpace(e.Content) == "" {
+		errs = append(errs, errors.New("content is required"))
+	}
+	if len(e.Keys) == 0 && len(e.Patterns) == 0 && !e.Constant {
+		errs = append(errs, errors.New("at least one key or pattern is required unless the entry is constant"))
+	}
+	if e.Position != "" && !lorePositions[e.Position] {
+		errs = append(errs, fmt.Errorf("unknown position %q", e.Position))
+	}
+	if e.TokenCost < 0 {
+		errs = append(errs, errors.New("token_cost must not be negative"))
+	}
+	for _, pattern := range e.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("pattern %q: %w", pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lorebook selects the lore entries relevant to a conversation window
+type Lorebook struct {
+	Budget       int // Tokens available for injected lore
+	MaxRecursion int
+	entries      []loreMatcher
+}
+
+type loreMatcher struct {
+	entry    LoreEntry
+	triggers []*regexp.Regexp
+}
+
+// NewLorebook prepares entries for matching; entries with invalid patterns are skipped
+func NewLorebook(entries []LoreEntry, budget int) *Lorebook {
+	if budget <= 0 {
+		budget = DefaultLoreBudget
+	}
+	lb := &Lorebook{Budget: budget, MaxRecursion: defaultLoreRecursion}
+
+	for _, entry := range entries {
+		if !entry.Enabled || ValidateLoreEntry(entry) != nil {
+			continue
+		}
+		if entry.Position == "" {
+			entry.Position = LoreAfterCharacter
+		}
+
+		flags := "(?i)"
+		if entry.CaseSensitive {
+			flags = ""
+		}
+		matcher := loreMatcher{entry: entry}
+		for _, key := range entry.Keys {
+			if key = strings.TrimSpace(key); key != "" {
+				matcher.triggers = append(matcher.triggers, regexp.MustCompile(flags+phrasePattern(key)))
+			}
+		}
+		for _, pattern := range entry.Patterns {
+			matcher.triggers = append(matcher.triggers, regexp.MustCompile(flags+pattern))
+		}
+		lb.entries = append(lb.entries, matcher)
+	}
+	return lb
+}
+
+// Activate returns the entries triggered by the window for the given characters, within the
+// token budget. Recursive entries are scanned for further triggers. The result is ordered by
+// position, then priority.
+func (lb *Lorebook) Activate(window []string, characters []string) []LoreEntry {
+	type activation struct {
+		entry LoreEntry
+		depth int
+	}
+
+	var candidates []loreMatcher
+	for _, m := range lb.entries {
+		if m.entry.Character == "" || containsFold(characters, m.entry.Character) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	activated := make(map[string]bool)
+	var found []activation
+	scan := strings.Join(window, "\n")
+	for depth := 0; depth <= lb.MaxRecursion && scan != ""; depth++ {
+		var next []string
+		for _, m := range candidates {
+			if activated[m.entry.ID] {
+				continue
+			}
+			if !(depth == 0 && m.entry.Constant) && !m.triggeredBy(scan) {
+				continue
+			}
+			activated[m.entry.ID] = true
+			found = append(found, activation{entry: m.entry, depth: depth})
+			if m.entry.Recursive {
+				next = append(next, m.entry.Content)
+			}
+		}
+		scan = strings.Join(next, "\n")
+	}
+
+	// Directly triggered and higher-priority entries claim the budget first
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].entry.Priority != found[j].entry.Priority {
+			return found[i].entry.Priority > found[j].entry.Priority
+		}
+		if found[i].depth != found[j].depth {
+			return found[i].depth < found[j].depth
+		}
+		return found[i].entry.ID < found[j].entry.ID
+	})
+
+	remaining := lb.Budget
+	var selected []LoreEntry
+	for _, a := range found {
+		if cost := a.entry.Cost(); cost <= remaining {
+			remaining -= cost
+			selected = append(selected, a.entry)
+		}
+	}
+
+	positionOrder := map[string]int{LoreBeforeCharacter: 0, LoreAfterCharacter: 1, LoreBeforeUser: 2}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return positionOrder[selected[i].Position] < positionOrder[selected[j].Position]
+	})
+	return selected
+}
+
+func (m loreMatcher) triggeredBy(text string) bool {
+	for _, trigger := range m.triggers {
+		if trigger.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateTokens approximates a text's token count at four characters per token
+func EstimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package cognitive
+
+import "testing"
+
+func TestLorebookKeys(t *testing.T) {
+	tests := []struct {
+		key     string
+		message string
+		want    bool
+	}{
+		{"cat", "My cat is asleep.", true},
+		{"cat", "Concatenate the strings.", false},
+		{"C++", "I'm learning C++ this year.", true},
+		{"#guild", "Post it in #guild tonight.", true},
+		{"#guild", "The guild hall is closed.", false},
+		{".NET", "We ship on .NET 8.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" in "+tt.message, func(t *testing.T) {
+			lb := NewLorebook([]LoreEntry{{ID: "1", Keys: []string{tt.key}, Content: "lore", Enabled: true}}, 0)
+			if got := len(lb.Activate([]string{tt.message}, nil)) > 0; got != tt.want {
+				t.Errorf("activated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
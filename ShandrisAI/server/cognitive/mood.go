@@ -1,6 +1,7 @@
 package cognitive
 
 import (
+	"fmt"
 	"math"
 	"strings"
 	"time"
@@ -12,8 +13,12 @@ type MoodEngineImpl struct {
 	History      []MoodState
 	Modifiers    map[string]float64
 	Thresholds   map[string]float64
+	FlirtCeiling float64 // Highest flirty score and intensity the user's boundaries permit
 }
 
+// maxMoodHistory caps how many past states are carried between turns
+const maxMoodHistory = 20
+
 func NewMoodEngine() *MoodEngineImpl {
 	return &MoodEngineImpl{
 		CurrentState: MoodState{
@@ -31,39 +36,87 @@ func NewMoodEngine() *MoodEngineImpl {
 			"mood_shift":    0.4,
 			"intensity_cap": 0.9,
 		},
+		FlirtCeiling: 1.0,
+	}
+}
+
+// ApplyBoundaries caps the flirty mood at what the user's boundaries permit
+func (m *MoodEngineImpl) ApplyBoundaries(b Boundaries) {
+	m.FlirtCeiling = b.FlirtCeiling()
+}
+
+// RestoreMoodEngine rebuilds an engine from a previously persisted state
+func RestoreMoodEngine(state MoodState, history []MoodState) *MoodEngineImpl {
+	m := NewMoodEngine()
+	if state.Primary != "" {
+		m.CurrentState = state
+	}
+	if m.CurrentState.Context == nil {
+		m.CurrentState.Context = make(map[string]any)
 	}
+	m.History = history
+	return m
 }
 
 func (m *MoodEngineImpl) UpdateMood(context map[string]any) error {
-	// Calculate time-based decay
-	timeDiff := time.Since(m.CurrentState.Timestamp).Hours()
-	decayFactor := math.Exp(-m.Modifiers["decay_rate"] * timeDiff)
+	now := time.Now()
+	previous := m.CurrentState
+
+	// Record history before decaying so it reflects the state as it was left
+	m.History = append(m.History, previous)
+	if len(m.History) > maxMoodHistory {
+		m.History = m.History[len(m.History)-maxMoodHistory:]
+	}
+
+	// Calculate time-based decay from the last update, which may predate a restart
+	m.CurrentState.Intensity = m.DecayedIntensity(now)
 
 	// Apply context modifiers
-	newIntensity := m.CurrentState.Intensity * decayFactor
+	newIntensity := m.CurrentState.Intensity
 	for _, impact := range context {
 		if val, ok := impact.(float64); ok {
-			newIntensity += val * m.Modifiers["change_thresh"]
+			newIntensity += math.Abs(val) * m.Modifiers["change_thresh"]
 		}
 	}
 
 	// Clamp intensity
 	newIntensity = math.Max(0, math.Min(newIntensity, m.Modifiers["max_intensity"]))
 
-	// Record history
-	m.History = append(m.History, m.CurrentState)
+	primary := m.determinePrimaryMood(context)
+	if primary == "flirty" {
+		newIntensity = math.Min(newIntensity, m.FlirtCeiling)
+	}
+
+	// The mood being left behind lingers as the secondary mood
+	secondary := previous.Secondary
+	if primary != previous.Primary && previous.Primary != "neutral" {
+		secondary = previous.Primary
+	}
+	if secondary == primary {
+		secondary = ""
+	}
 
 	// Update current state
 	m.CurrentState = MoodState{
-		Primary:   m.determinePrimaryMood(context),
+		Primary:   primary,
+		Secondary: secondary,
 		Intensity: newIntensity,
-		Timestamp: time.Now(),
+		Timestamp: now,
 		Context:   context,
 	}
 
 	return nil
 }
 
+// DecayedIntensity returns the current intensity decayed up to the given time
+func (m *MoodEngineImpl) DecayedIntensity(at time.Time) float64 {
+	hours := at.Sub(m.CurrentState.Timestamp).Hours()
+	if hours <= 0 {
+		return m.CurrentState.Intensity
+	}
+	return m.CurrentState.Intensity * math.Exp(-m.Modifiers["decay_rate"]*hours)
+}
+
 func (m *MoodEngineImpl) determinePrimaryMood(context map[string]any) string {
 	// Define base mood patterns
 	moodPatterns := map[string]MoodPattern{
@@ -115,7 +168,7 @@ func (m *MoodEngineImpl) determinePrimaryMood(context map[string]any) string {
 	}
 
 	// Apply personality biases
-	m.applyPersonalityBias(moodScores)
+	m.applyPersonalityBias(moodScores, emotionalContext)
 
 	// Find dominant mood
 	return m.selectDominantMood(moodScores, emotionalContext)
@@ -147,7 +200,7 @@ func (m *MoodEngineImpl) calculateMoodScore(pattern MoodPattern, context Emotion
 	return (keywordScore*0.4 + sentimentAlignment*0.3 + intensityFactor*0.3) * decayFactor
 }
 
-func (m *MoodEngineImpl) applyPersonalityBias(scores map[string]float64) {
+func (m *MoodEngineImpl) applyPersonalityBias(scores map[string]float64, context EmotionalContext) {
 	// Personality-based mood biases
 	biases := map[string]float64{
 		"sassy":        0.2,  // Shandris tends toward sass
@@ -155,12 +208,22 @@ func (m *MoodEngineImpl) applyPersonalityBias(scores map[string]float64) {
 		"flirty":       0.1,  // Slight flirty bias
 	}
 
+	// No flirty lean for users who haven't opted in
+	if !context.SapphicContext.AllowsFlirting {
+		delete(biases, "flirty")
+	}
+
 	// Apply biases
 	for mood, bias := range biases {
 		if score, exists := scores[mood]; exists {
 			scores[mood] = math.Min(score+bias, 1.0)
 		}
 	}
+
+	// However strong the lean, flirting stays within the user's boundaries
+	if score, exists := scores["flirty"]; exists {
+		scores["flirty"] = math.Min(score, m.FlirtCeiling)
+	}
 }
 
 func (m *MoodEngineImpl) selectDominantMood(scores map[string]float64, context EmotionalContext) string {
@@ -174,9 +237,9 @@ func (m *MoodEngineImpl) selectDominantMood(scores map[string]float64, context E
 		if mood == context.UserMood {
 			score *= 1.2
 		}
-		// Reduce score if it conflicts with current emotional tone
-		if mood == "flirty" && !context.SapphicContext.AllowsFlirting {
-			score *= 0.5
+		// Flirty is never selected outside the user's boundaries
+		if mood == "flirty" && (!context.SapphicContext.AllowsFlirting || m.FlirtCeiling == 0) {
+			continue
 		}
 		if score > highestScore {
 			highestScore = score
@@ -198,8 +261,10 @@ func (m *MoodEngineImpl) selectDominantMood(scores map[string]float64, context E
 func (m *MoodEngineImpl) analyzeEmotionalContext(context map[string]any) EmotionalContext {
 	// Extract relevant information from context
 	keywords := extractKeywords(context)
-	sentiment := calculateSentiment(context)
-	intensity := calculateIntensity(context)
+	text, _ := context["text"].(string)
+	reading := AnalyzeSentiment(text)
+	sentiment := calculateSentiment(context, reading)
+	intensity := calculateIntensity(context, reading)
 	userMood := extractUserMood(context)
 
 	return EmotionalContext{
@@ -209,7 +274,7 @@ func (m *MoodEngineImpl) analyzeEmotionalContext(context map[string]any) Emotion
 		Keywords:       keywords,
 		UserMood:       userMood,
 		PriorContext:   m.getPriorContext(),
-		SapphicContext: m.getCurrentSapphicContext(),
+		SapphicContext: m.getCurrentSapphicContext(context),
 		IsEmotional:    true,
 		IsTechnical:    false,
 		Timestamp:      time.Now(),
@@ -244,41 +309,31 @@ func extractKeywords(context map[string]any) []string {
 	return keywords
 }
 
-func calculateSentiment(context map[string]any) float64 {
+// calculateSentiment combines the sentiment the user stated (e.g. through their mood)
+// with the sentiment read from their message
+func calculateSentiment(context map[string]any, reading SentimentResult) float64 {
 	sentiment := 0.0
 
 	// Extract sentiment from context
 	if val, ok := context["sentiment"].(float64); ok {
 		sentiment = val
 	}
-	if text, ok := context["text"].(string); ok {
-		// Basic sentiment analysis based on text content
-		if strings.Contains(strings.ToLower(text), "love") || strings.Contains(strings.ToLower(text), "happy") {
-			sentiment += 0.3
-		}
-		if strings.Contains(strings.ToLower(text), "hate") || strings.Contains(strings.ToLower(text), "sad") {
-			sentiment -= 0.3
-		}
-	}
+	sentiment += reading.Valence
 
 	return math.Max(-1.0, math.Min(1.0, sentiment))
 }
 
-func calculateIntensity(context map[string]any) float64 {
+// calculateIntensity raises intensity for excited or agitated messages and lowers it for calm ones
+func calculateIntensity(context map[string]any, reading SentimentResult) float64 {
 	intensity := 0.5 // Base intensity
 
 	// Extract intensity from context
 	if val, ok := context["intensity"].(float64); ok {
 		intensity = val
 	}
-	if text, ok := context["text"].(string); ok {
-		// Adjust intensity based on text content
-		if strings.Contains(strings.ToLower(text), "very") || strings.Contains(strings.ToLower(text), "really") {
-			intensity += 0.2
-		}
-	}
+	intensity += (reading.Arousal - calmArousal) * 0.5
 
-	return math.Min(1.0, intensity)
+	return math.Max(0, math.Min(1.0, intensity))
 }
 
 func extractUserMood(context map[string]any) string {
@@ -325,12 +380,49 @@ func (m *MoodEngineImpl) ProjectMoodInfluence(input string) float64 {
 	return 0.0 // Placeholder
 }
 
-func (m *MoodEngineImpl) getCurrentSapphicContext() SapphicContext {
-	// Implementation depends on your specific needs
-	return SapphicContext{}
+// getCurrentSapphicContext reads the user's flirting opt-in from the mood context
+func (m *MoodEngineImpl) getCurrentSapphicContext(context map[string]any) SapphicContext {
+	allows, _ := context["flirting_enabled"].(bool)
+	return SapphicContext{AllowsFlirting: allows}
 }
 
 func (m *MoodEngineImpl) getCurrentEmotionalTone() string {
 	// Implementation depends on your specific needs
 	return "neutral"
 }
+
+// moodStyleGuides maps each primary mood to concrete response style guidance
+var moodStyleGuides = map[string]string{
+	"playful":      "Keep it light: tease gently, use wordplay, and let a little mischief show.",
+	"sassy":        "Be quick and sharp-tongued: dry wit, confident one-liners, and the occasional eye-roll.",
+	"flirty":       "Be warm and teasing: playful compliments and a hint of charm, never pushy.",
+	"intellectual": "Be curious and precise: dig into ideas, ask sharp follow-up questions, enjoy the detail.",
+	"protective":   "Be steady and caring: drop the mockery, reassure, and offer practical help.",
+	"neutral":      "Stay composed and even-toned, with your usual dry edge kept in reserve.",
+}
+
+// DescribeMoodStyle renders a mood state as style guidance for the prompt
+func DescribeMoodStyle(state MoodState) string {
+	primary := state.Primary
+	if primary == "" {
+		primary = "neutral"
+	}
+	guide, ok := moodStyleGuides[primary]
+	if !ok {
+		guide = moodStyleGuides["neutral"]
+	}
+
+	strength := "mildly"
+	switch {
+	case state.Intensity >= 0.75:
+		strength = "strongly"
+	case state.Intensity >= 0.45:
+		strength = "noticeably"
+	}
+
+	description := fmt.Sprintf("You are %s %s right now (intensity %.2f). %s", strength, primary, state.Intensity, guide)
+	if state.Secondary != "" {
+		description += fmt.Sprintf(" A trace of your earlier %s mood still colours your replies.", state.Secondary)
+	}
+	return description
+}
@@ -45,6 +45,11 @@ func NewNormalizationSystem() *NormalizationSystem {
 	}
 }
 
+// ApplyBoundaries caps the flirty score at what the user's boundaries permit
+func (ns *NormalizationSystem) ApplyBoundaries(b Boundaries) {
+	ns.MaxThresholds["flirty"] = b.FlirtCeiling()
+}
+
 func (ns *NormalizationSystem) NormalizeScores(scores map[string]float64, context ContextAnalysis) map[string]float64 {
 	normalized := make(map[string]float64)
 
@@ -68,6 +73,14 @@ func (ns *NormalizationSystem) NormalizeScores(scores map[string]float64, contex
 	// Smooth transitions
 	normalized = ns.smoothTransitions(normalized, context)
 
+	// Smoothing eases toward the previous scores but never past a cap, so a ceiling
+	// lowered by the user's boundaries takes effect at once
+	for mood, score := range normalized {
+		if max, exists := ns.MaxThresholds[mood]; exists && score > max {
+			normalized[mood] = max
+		}
+	}
+
 	// Ensure sum of probabilities <= 1.0
 	return ns.normalizeSum(normalized)
 }
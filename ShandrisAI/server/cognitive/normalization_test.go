@@ -0,0 +1,30 @@
+package cognitive
+
+import "testing"
+
+func TestNormalizeScoresFlirtCeiling(t *testing.T) {
+	context := ContextAnalysis{
+		SapphicContext: SapphicContext{AllowsFlirting: true},
+		PreviousScores: map[string]float64{"flirty": 0.8},
+	}
+	tests := []struct {
+		name       string
+		boundaries Boundaries
+		want       float64
+	}{
+		{"romance off", Boundaries{Romance: false, Rating: RatingMature}, 0},
+		{"general rating", Boundaries{Romance: true, Rating: RatingGeneral}, 0},
+		{"teen rating", Boundaries{Romance: true, Rating: RatingTeen}, 0.5},
+		{"mature rating", Boundaries{Romance: true, Rating: RatingMature}, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := NewNormalizationSystem()
+			ns.Weights["flirty"] = 1.0
+			ns.ApplyBoundaries(tt.boundaries)
+			if got := ns.NormalizeScores(map[string]float64{"flirty": 1.0}, context)["flirty"]; got != tt.want {
+				t.Errorf("flirty %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package cognitive
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"sort"
 	"time"
 )
@@ -51,18 +54,18 @@ type PatternCondition struct {
 }
 
 type ContextSnapshot struct {
-	Timestamp    time.Time
-	Topics       []string
-	Mood         *MoodState
-	UserContext  map[string]interface{}
-	Interactions []Interaction
+	Timestamp    time.Time              `json:"timestamp"`
+	Topics       []string               `json:"topics"`
+	Mood         *MoodState             `json:"mood,omitempty"`
+	UserContext  map[string]interface{} `json:"user_context,omitempty"`
+	Interactions []Interaction          `json:"interactions,omitempty"`
 }
 
 type Interaction struct {
-	Type      string
-	Value     interface{}
-	Intensity float64
-	Timestamp time.Time
+	Type      string      `json:"type"`
+	Value     interface{} `json:"value"`
+	Intensity float64     `json:"intensity"`
+	Timestamp time.Time   `json:"timestamp"`
 }
 
 type PatternResult struct {
@@ -71,6 +74,45 @@ type PatternResult struct {
 	Context    *ContextSnapshot
 }
 
+// NewPatternAnalysisEngine creates an engine with the given predefined patterns. Patterns the
+// engine discovers in the conversation, such as a mood that follows a topic, are added as found.
+func NewPatternAnalysisEngine(patterns ...AnalysisPattern) *PatternAnalysisEngine {
+	pa := &PatternAnalysisEngine{
+		patterns:       make(map[string]AnalysisPattern),
+		maxHistorySize: defaultPatternHistory,
+	}
+	for _, pattern := range patterns {
+		pa.patterns[pattern.ID] = pattern
+	}
+	return pa
+}
+
+// discovered returns the pattern with the given ID, registering it the first time it is seen
+func (pa *PatternAnalysisEngine) discovered(id string, patternType PatternType) *AnalysisPattern {
+	pattern, ok := pa.patterns[id]
+	if !ok {
+		pattern = AnalysisPattern{ID: id, Type: patternType, Weight: 1, MinMatches: 1}
+		pa.patterns[id] = pattern
+	}
+	return &pattern
+}
+
+// current is the snapshot being analyzed, and previous the one before it in the same conversation
+func (pa *PatternAnalysisEngine) current() *ContextSnapshot {
+	return &pa.contextHistory[len(pa.contextHistory)-1]
+}
+
+func (pa *PatternAnalysisEngine) previous() *ContextSnapshot {
+	if len(pa.contextHistory) < 2 {
+		return nil
+	}
+	prev := &pa.contextHistory[len(pa.contextHistory)-2]
+	if pa.current().Timestamp.Sub(prev.Timestamp) > ConversationGap {
+		return nil
+	}
+	return prev
+}
+
 func (pa *PatternAnalysisEngine) updateContextHistory(context *ContextSnapshot) {
 	pa.contextHistory = append(pa.contextHistory, *context)
 	if len(pa.contextHistory) > pa.maxHistorySize {
@@ -111,8 +153,7 @@ func (pa *PatternAnalysisEngine) analyzeBehavioralPatterns() []PatternResult {
 	}
 
 	// Analyze timing patterns
-	timingPatterns := pa.detectTimingPatterns()
-	for _, timing := range timingPatterns {
+	if timing, ok := pa.detectTimingPatterns(); ok {
 		results = append(results, pa.analyzeTiming(timing))
 	}
 
@@ -131,7 +172,7 @@ func (pa *PatternAnalysisEngine) analyzeEmotionalPatterns() []PatternResult {
 	// Analyze emotional triggers
 	triggers := pa.detectEmotionalTriggers()
 	for _, trigger := range triggers {
-		results = append(results, pa.analyzeEmotionalTrigger(trigger))
+		results = append(results, pa.analyzeEmotionalTrigger(trigger)...)
 	}
 
 	// Analyze emotional resonance
@@ -143,6 +184,18 @@ func (pa *PatternAnalysisEngine) analyzeEmotionalPatterns() []PatternResult {
 
 func (pa *PatternAnalysisEngine) analyzeTopicalPatterns() []PatternResult {
 	var results []PatternResult
+
+	// Topics the user moves on to from the previous message
+	if prev := pa.previous(); prev != nil {
+		for _, switched := range detectTopicSwitches(prev.Topics, pa.current().Topics) {
+			results = append(results, PatternResult{
+				Pattern:    pa.discovered(TopicSwitchPatternID(switched[0], switched[1]), TopicalPattern),
+				Confidence: 0.7,
+				Context:    pa.current(),
+			})
+		}
+	}
+
 	// Analyze topic relationships and patterns using topicAnalyzer
 	if pa.topicAnalyzer != nil {
 		patterns := pa.topicAnalyzer.AnalyzeTopics(pa.contextHistory)
@@ -299,33 +352,39 @@ func (pa *PatternAnalysisEngine) extractPatternContext(sequence []Interaction) *
 	return &pa.contextHistory[len(pa.contextHistory)-1]
 }
 
-func (pa *PatternAnalysisEngine) detectTimingPatterns() []time.Duration {
-	var patterns []time.Duration
-	if len(pa.contextHistory) < 2 {
-		return patterns
+// detectTimingPatterns returns the gap since the previous message; the first message has none
+func (pa *PatternAnalysisEngine) detectTimingPatterns() (time.Duration, bool) {
+	if len(pa.contextHistory) == 0 {
+		return 0, false
 	}
-
-	// Calculate time gaps between consecutive contexts
-	for i := 1; i < len(pa.contextHistory); i++ {
-		gap := pa.contextHistory[i].Timestamp.Sub(pa.contextHistory[i-1].Timestamp)
-		patterns = append(patterns, gap)
+	if len(pa.contextHistory) == 1 {
+		return 0, true
 	}
-	return patterns
+	return pa.current().Timestamp.Sub(pa.contextHistory[len(pa.contextHistory)-2].Timestamp), true
 }
 
 func (pa *PatternAnalysisEngine) analyzeTiming(gap time.Duration) PatternResult {
-	// Find matching timing pattern
-	for _, pattern := range pa.patterns {
-		if pattern.Type == BehavioralPattern && pattern.MaxGap > 0 {
-			if gap <= pattern.MaxGap {
+	// A predefined timing pattern matches a quick follow-up
+	if gap > 0 {
+		for _, pattern := range pa.patterns {
+			if pattern.Type == BehavioralPattern && pattern.MaxGap > 0 && gap <= pattern.MaxGap {
 				return PatternResult{
 					Pattern:    &pattern,
 					Confidence: 0.8, // Default confidence for timing patterns
-					Context:    &pa.contextHistory[len(pa.contextHistory)-1],
+					Context:    pa.current(),
 				}
 			}
 		}
 	}
+
+	// The first message after a break starts a conversation, which says when the user likes to talk
+	if gap == 0 || gap > ConversationGap {
+		return PatternResult{
+			Pattern:    pa.discovered(PatternSessionStart, BehavioralPattern),
+			Confidence: 0.8,
+			Context:    pa.current(),
+		}
+	}
 	return PatternResult{}
 }
 
@@ -335,48 +394,45 @@ type MoodTransition struct {
 	Timestamp time.Time
 }
 
+// detectMoodTransitions finds a change of mood from the previous message in the same conversation.
+// Earlier transitions were reported when their own message was analyzed.
 func (pa *PatternAnalysisEngine) detectMoodTransitions() []MoodTransition {
 	var transitions []MoodTransition
-	if len(pa.contextHistory) < 2 {
+	prev := pa.previous()
+	if prev == nil {
 		return transitions
 	}
 
-	// Detect mood changes between consecutive contexts
-	for i := 1; i < len(pa.contextHistory); i++ {
-		prevMood := pa.contextHistory[i-1].Mood
-		currMood := pa.contextHistory[i].Mood
-		if prevMood != nil && currMood != nil && prevMood.Primary != currMood.Primary {
-			transitions = append(transitions, MoodTransition{
-				From:      prevMood.Primary,
-				To:        currMood.Primary,
-				Timestamp: pa.contextHistory[i].Timestamp,
-			})
-		}
+	prevMood := prev.Mood
+	currMood := pa.current().Mood
+	if prevMood != nil && currMood != nil && prevMood.Primary != currMood.Primary &&
+		prevMood.Primary != NeutralUserMood && currMood.Primary != NeutralUserMood {
+		transitions = append(transitions, MoodTransition{
+			From:      prevMood.Primary,
+			To:        currMood.Primary,
+			Timestamp: pa.current().Timestamp,
+		})
 	}
 	return transitions
 }
 
 func (pa *PatternAnalysisEngine) analyzeMoodTransition(transition MoodTransition) PatternResult {
-	// Find matching emotional pattern based on transition
-	for _, pattern := range pa.patterns {
-		if pattern.Type == EmotionalPattern {
-			// Calculate confidence based on transition
-			confidence := 0.7 // Base confidence
-			if transition.From == transition.To {
-				confidence *= 0.8 // Lower confidence for same mood transitions
-			}
-			return PatternResult{
-				Pattern:    &pattern,
-				Confidence: confidence,
-				Context:    &pa.contextHistory[len(pa.contextHistory)-1],
-			}
-		}
+	// Calculate confidence based on transition
+	confidence := 0.7 // Base confidence
+	if transition.From == transition.To {
+		confidence *= 0.8 // Lower confidence for same mood transitions
+	}
+	return PatternResult{
+		Pattern:    pa.discovered(MoodShiftPatternID(transition.From, transition.To), EmotionalPattern),
+		Confidence: confidence,
+		Context:    pa.current(),
 	}
-	return PatternResult{}
 }
 
 type EmotionalTrigger struct {
 	Type      string
+	Mood      string
+	Topics    []string // What the user was talking about when they felt it
 	Intensity float64
 	Timestamp time.Time
 }
@@ -390,8 +446,11 @@ func (pa *PatternAnalysisEngine) detectEmotionalTriggers() []EmotionalTrigger {
 	currentContext := pa.contextHistory[len(pa.contextHistory)-1]
 	for _, interaction := range currentContext.Interactions {
 		if interaction.Type == "emotion" {
+			mood, _ := interaction.Value.(string)
 			triggers = append(triggers, EmotionalTrigger{
 				Type:      interaction.Type,
+				Mood:      mood,
+				Topics:    currentContext.Topics,
 				Intensity: interaction.Intensity,
 				Timestamp: interaction.Timestamp,
 			})
@@ -400,18 +459,24 @@ func (pa *PatternAnalysisEngine) detectEmotionalTriggers() []EmotionalTrigger {
 	return triggers
 }
 
-func (pa *PatternAnalysisEngine) analyzeEmotionalTrigger(trigger EmotionalTrigger) PatternResult {
-	// Find matching emotional pattern
-	for _, pattern := range pa.patterns {
-		if pattern.Type == EmotionalPattern {
-			return PatternResult{
-				Pattern:    &pattern,
-				Confidence: trigger.Intensity, // Use trigger intensity as confidence
-				Context:    &pa.contextHistory[len(pa.contextHistory)-1],
-			}
-		}
+// analyzeEmotionalTrigger ties a mood to each topic the user was on when they felt it
+func (pa *PatternAnalysisEngine) analyzeEmotionalTrigger(trigger EmotionalTrigger) []PatternResult {
+	var results []PatternResult
+	if trigger.Mood == "" || trigger.Mood == NeutralUserMood {
+		return results
 	}
-	return PatternResult{}
+	topics := trigger.Topics
+	if len(topics) == 0 {
+		topics = []string{""}
+	}
+	for _, topic := range topics {
+		results = append(results, PatternResult{
+			Pattern:    pa.discovered(EmotionPatternID(trigger.Mood, topic), EmotionalPattern),
+			Confidence: trigger.Intensity, // Use trigger intensity as confidence
+			Context:    pa.current(),
+		})
+	}
+	return results
 }
 
 func (pa *PatternAnalysisEngine) calculateEmotionalResonance() float64 {
@@ -438,17 +503,15 @@ func (pa *PatternAnalysisEngine) calculateEmotionalResonance() float64 {
 }
 
 func (pa *PatternAnalysisEngine) analyzeEmotionalResonance(resonance float64) PatternResult {
-	// Find matching emotional pattern
-	for _, pattern := range pa.patterns {
-		if pattern.Type == EmotionalPattern {
-			return PatternResult{
-				Pattern:    &pattern,
-				Confidence: resonance, // Use calculated resonance as confidence
-				Context:    &pa.contextHistory[len(pa.contextHistory)-1],
-			}
-		}
+	// Only strong feeling is worth remembering as a pattern
+	if resonance < intenseEmotion {
+		return PatternResult{}
+	}
+	return PatternResult{
+		Pattern:    pa.discovered(PatternIntenseEmotion, EmotionalPattern),
+		Confidence: resonance, // Use calculated resonance as confidence
+		Context:    pa.current(),
 	}
-	return PatternResult{}
 }
 
 // Enhanced persistence features
@@ -461,6 +524,7 @@ type TopicPersistenceEnhanced struct {
 
 type PatternOccurrence struct {
 	PatternID string
+	SessionID string
 	Timestamp time.Time
 	Context   *ContextSnapshot
 	Strength  float64
@@ -474,14 +538,27 @@ type ContextCache struct {
 	timeWindow time.Duration
 }
 
+// NewTopicPersistenceEnhanced creates the enhanced store over a database connection
+func NewTopicPersistenceEnhanced(dbConn *sql.DB) *TopicPersistenceEnhanced {
+	return &TopicPersistenceEnhanced{
+		TopicPersistence:  NewTopicPersistence(dbConn),
+		relationshipGraph: make(map[string]map[string]float64),
+	}
+}
+
 func (tpe *TopicPersistenceEnhanced) SavePatternOccurrence(occurrence PatternOccurrence) error {
+	contextData, err := json.Marshal(occurrence.Context)
+	if err != nil {
+		return fmt.Errorf("error encoding pattern context: %w", err)
+	}
+
 	// Store in database
-	_, err := tpe.db.Exec(`
+	_, err = tpe.db.Exec(`
         INSERT INTO pattern_occurrences (
-            pattern_id, timestamp, context_data, strength, duration
-        ) VALUES ($1, $2, $3, $4, $5)
-    `, occurrence.PatternID, occurrence.Timestamp, occurrence.Context,
-		occurrence.Strength, occurrence.Duration)
+            pattern_id, session_id, timestamp, context_data, strength, duration
+        ) VALUES ($1, $2, $3, $4, $5, $6::interval)
+    `, occurrence.PatternID, occurrence.SessionID, occurrence.Timestamp, contextData,
+		occurrence.Strength, fmt.Sprintf("%f seconds", occurrence.Duration.Seconds()))
 
 	if err != nil {
 		return err
@@ -552,6 +629,7 @@ const EnhancedPersistenceSchema = `
 CREATE TABLE IF NOT EXISTS pattern_occurrences (
     id SERIAL PRIMARY KEY,
     pattern_id VARCHAR(255) NOT NULL,
+    session_id TEXT NOT NULL,
     timestamp TIMESTAMP NOT NULL,
     context_data JSONB NOT NULL,
     strength FLOAT NOT NULL,
@@ -561,6 +639,7 @@ CREATE TABLE IF NOT EXISTS pattern_occurrences (
 
 CREATE INDEX IF NOT EXISTS idx_pattern_occurrences_pattern_id ON pattern_occurrences(pattern_id);
 CREATE INDEX IF NOT EXISTS idx_pattern_occurrences_timestamp ON pattern_occurrences(timestamp);
+CREATE INDEX IF NOT EXISTS idx_pattern_occurrences_session ON pattern_occurrences(session_id);
 
 CREATE TABLE IF NOT EXISTS topic_relationships (
     from_topic VARCHAR(255) NOT NULL,
@@ -0,0 +1,297 @@
+package cognitive
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPatternHistory is how many snapshots the engine looks back over
+	defaultPatternHistory = 50
+	// ConversationGap is the silence after which the next message starts a new conversation
+	ConversationGap = 45 * time.Minute
+	// intenseEmotion is the emotional intensity that counts as a strong feeling
+	intenseEmotion = 0.85
+	// moodValence is how far from neutral a message's sentiment must be to read as a mood
+	moodValence = 0.3
+	// agitatedArousal separates stressed from sad, and excited from happy
+	agitatedArousal = 0.5
+	// MinPatternOccurrences is how often a pattern must recur before it is reported
+	MinPatternOccurrences = 3
+	// dominantShare is the share of occurrences a day or time must have to be worth mentioning
+	dominantShare = 0.5
+)
+
+// Pattern IDs the engine discovers. Emotion, topic-switch and mood-shift patterns carry
+// their moods and topics in the ID, e.g. "emotion:stressed:professional".
+const (
+	PatternSessionStart   = "session_start"
+	PatternIntenseEmotion = "intense_emotion"
+	emotionPrefix         = "emotion:"
+	topicSwitchPrefix     = "topic_switch:"
+	moodShiftPrefix       = "mood_shift:"
+)
+
+// NeutralUserMood is the user's mood when a message shows no particular feeling
+const NeutralUserMood = "neutral"
+
+// Keys of ContextSnapshot.UserContext that place a message in the user's week
+const (
+	ContextWeekday = "weekday"
+	ContextDaypart = "daypart"
+)
+
+func EmotionPatternID(mood, topic string) string {
+	return emotionPrefix + mood + ":" + topic
+}
+
+func TopicSwitchPatternID(from, to string) string {
+	return topicSwitchPrefix + from + ">" + to
+}
+
+func MoodShiftPatternID(from, to string) string {
+	return moodShiftPrefix + from + ">" + to
+}
+
+// Daypart names the part of the day a local time falls in
+func Daypart(t time.Time) string {
+	switch hour := t.Hour(); {
+	case hour >= 5 && hour < 12:
+		return "morning"
+	case hour >= 12 && hour < 17:
+		return "afternoon"
+	case hour >= 17 && hour < 22:
+		return "evening"
+	default:
+		return "night"
+	}
+}
+
+// ReadUserMood is the user's mood in a message: the mood they stated, or else one read from
+// the message's sentiment. Intensity runs from 0.5 to 1 for any mood but neutral.
+func ReadUserMood(stated string, sentiment SentimentResult) (string, float64) {
+	intensity := 0.5 + math.Abs(sentiment.Valence)/2
+	if stated != "" {
+		return stated, max(intensity, 0.6)
+	}
+	switch {
+	case sentiment.Valence <= -moodValence && sentiment.Arousal >= agitatedArousal:
+		return "stressed", intensity
+	case sentiment.Valence <= -moodValence:
+		return "sad", intensity
+	case sentiment.Valence >= moodValence && sentiment.Arousal >= agitatedArousal:
+		return "excited", intensity
+	case sentiment.Valence >= moodValence:
+		return "happy", intensity
+	}
+	return NeutralUserMood, 0
+}
+
+// NewMessageSnapshot describes one user message for the pattern engine. The time should be
+// in the user's own timezone, so the day and time of day are as the user lived them.
+func NewMessageSnapshot(text, statedMood string, topics []string, at time.Time) ContextSnapshot {
+	mood, intensity := ReadUserMood(statedMood, AnalyzeSentiment(text))
+	snapshot := ContextSnapshot{
+		Timestamp: at,
+		Topics:    topics,
+		Mood:      &MoodState{Primary: mood, Intensity: intensity, Timestamp: at},
+		UserContext: map[string]interface{}{
+			ContextWeekday: strings.ToLower(at.Weekday().String()),
+			ContextDaypart: Daypart(at),
+		},
+	}
+	if mood != NeutralUserMood {
+		snapshot.Interactions = append(snapshot.Interactions, Interaction{
+			Type:      "emotion",
+			Value:     mood,
+			Intensity: intensity,
+			Timestamp: at,
+		})
+	}
+	return snapshot
+}
+
+// detectTopicSwitches pairs each topic the user left with each topic they moved on to
+func detectTopicSwitches(previous, current []string) [][2]string {
+	var switches [][2]string
+	for _, from := range previous {
+		if containsString(current, from) {
+			continue
+		}
+		for _, to := range current {
+			if !containsString(previous, to) {
+				switches = append(switches, [2]string{from, to})
+			}
+		}
+	}
+	return switches
+}
+
+// PatternInsight is a recurring pattern in one user's conversations, phrased for people
+type PatternInsight struct {
+	PatternID   string    `json:"pattern_id"`
+	Summary     string    `json:"summary"`
+	Occurrences int       `json:"occurrences"`
+	Strength    float64   `json:"strength"`
+	Weekday     string    `json:"weekday,omitempty"`
+	Daypart     string    `json:"daypart,omitempty"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// SummarizePatterns turns a user's pattern occurrences into insights such as "gets stressed
+// about work on Sunday evenings". label names a topic for people. Patterns seen fewer than
+// minOccurrences times are left out, as are timing patterns with no day or time in common.
+func SummarizePatterns(occurrences []PatternOccurrence, label func(string) string, minOccurrences int) []PatternInsight {
+	byPattern := make(map[string][]PatternOccurrence)
+	for _, occurrence := range occurrences {
+		byPattern[occurrence.PatternID] = append(byPattern[occurrence.PatternID], occurrence)
+	}
+
+	var insights []PatternInsight
+	for id, group := range byPattern {
+		if len(group) < minOccurrences {
+			continue
+		}
+		insight := PatternInsight{
+			PatternID:   id,
+			Occurrences: len(group),
+			FirstSeen:   group[0].Timestamp,
+			LastSeen:    group[0].Timestamp,
+		}
+		for _, occurrence := range group {
+			insight.Strength += occurrence.Strength / float64(len(group))
+			if occurrence.Timestamp.Before(insight.FirstSeen) {
+				insight.FirstSeen = occurrence.Timestamp
+			}
+			if occurrence.Timestamp.After(insight.LastSeen) {
+				insight.LastSeen = occurrence.Timestamp
+			}
+		}
+		insight.Weekday, insight.Daypart = dominantTime(group)
+
+		what := describePattern(id, label)
+		if what == "" {
+			continue
+		}
+		when := describeTime(insight.Weekday, insight.Daypart)
+		if when == "" && (id == PatternSessionStart || id == PatternIntenseEmotion) {
+			continue
+		}
+		insight.Summary = strings.TrimSpace(what + " " + when)
+		insights = append(insights, insight)
+	}
+
+	sort.Slice(insights, func(i, j int) bool {
+		if insights[i].Occurrences != insights[j].Occurrences {
+			return insights[i].Occurrences > insights[j].Occurrences
+		}
+		return insights[i].PatternID < insights[j].PatternID
+	})
+	return insights
+}
+
+// dominantTime finds the weekday and part of the day most occurrences share. A weekday and
+// daypart that recur together are preferred; otherwise either may be reported alone.
+func dominantTime(group []PatternOccurrence) (string, string) {
+	pairs := make(map[[2]string]int)
+	weekdays := make(map[string]int)
+	dayparts := make(map[string]int)
+	for _, occurrence := range group {
+		if occurrence.Context == nil {
+			continue
+		}
+		weekday, _ := occurrence.Context.UserContext[ContextWeekday].(string)
+		daypart, _ := occurrence.Context.UserContext[ContextDaypart].(string)
+		pairs[[2]string{weekday, daypart}]++
+		weekdays[weekday]++
+		dayparts[daypart]++
+	}
+
+	share := func(count int) bool {
+		return float64(count)/float64(len(group)) >= dominantShare
+	}
+	pair, count := mostCommon(pairs)
+	if share(count) && pair[0] != "" && pair[1] != "" {
+		return pair[0], pair[1]
+	}
+	weekday, weekdayCount := mostCommon(weekdays)
+	daypart, daypartCount := mostCommon(dayparts)
+	if !share(weekdayCount) {
+		weekday = ""
+	}
+	if !share(daypartCount) {
+		daypart = ""
+	}
+	if weekday != "" && daypart != "" {
+		// Together they were not common enough; keep the stronger of the two
+		if weekdayCount >= daypartCount {
+			daypart = ""
+		} else {
+			weekday = ""
+		}
+	}
+	return weekday, daypart
+}
+
+func mostCommon[K comparable](counts map[K]int) (K, int) {
+	var best K
+	bestCount := 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && fmt.Sprint(key) < fmt.Sprint(best)) {
+			best, bestCount = key, count
+		}
+	}
+	return best, bestCount
+}
+
+// describePattern phrases what a pattern ID says about the user, or "" for IDs it doesn't know
+func describePattern(id string, label func(string) string) string {
+	switch {
+	case id == PatternSessionStart:
+		return "usually starts chatting"
+	case id == PatternIntenseEmotion:
+		return "has the strongest feelings"
+	case strings.HasPrefix(id, emotionPrefix):
+		mood, topic, _ := strings.Cut(strings.TrimPrefix(id, emotionPrefix), ":")
+		verb := "gets " + mood
+		if mood == "happy" || mood == "curious" {
+			verb = "is " + mood
+		}
+		if topic == "" {
+			return "often " + verb
+		}
+		return fmt.Sprintf("%s about %s", verb, label(topic))
+	case strings.HasPrefix(id, topicSwitchPrefix):
+		from, to, _ := strings.Cut(strings.TrimPrefix(id, topicSwitchPrefix), ">")
+		return fmt.Sprintf("switches to %s after %s talk", label(to), label(from))
+	case strings.HasPrefix(id, moodShiftPrefix):
+		from, to, _ := strings.Cut(strings.TrimPrefix(id, moodShiftPrefix), ">")
+		return fmt.Sprintf("goes from %s to %s mid-conversation", from, to)
+	}
+	return ""
+}
+
+// describeTime phrases a weekday and daypart, e.g. "on Sunday evenings" or "at night"
+func describeTime(weekday, daypart string) string {
+	day := ""
+	if weekday != "" {
+		day = strings.ToUpper(weekday[:1]) + weekday[1:]
+	}
+	switch {
+	case day != "" && daypart == "night":
+		return fmt.Sprintf("on %s nights", day)
+	case day != "" && daypart != "":
+		return fmt.Sprintf("on %s %ss", day, daypart)
+	case day != "":
+		return fmt.Sprintf("on %ss", day)
+	case daypart == "night":
+		return "at night"
+	case daypart != "":
+		return fmt.Sprintf("in the %ss", daypart)
+	}
+	return ""
+}
@@ -0,0 +1,393 @@
+package cognitive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PersonaSchemaVersion is the persona file format this build understands
+const PersonaSchemaVersion = 1
+
+// PersonaDefinition is the on-disk form of a persona
+type PersonaDefinition struct {
+	Version     int                    `json:"version"`
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Type        PersonaType            `json:"type"`
+	Traits      map[string]float64     `json:"traits"`
+	MoodBias    map[string]float64     `json:"mood_bias"`
+	StyleRules  []StyleRuleDefinition  `json:"style_rules"`
+	Constraints []Constraint           `json:"constraints"`
+	Preferences map[string]interface{} `json:"preferences"`
+	Transitions map[string]float64     `json:"transitions"` // Persona ID -> initial transition weight
+}
+
+// StyleRuleDefinition is the on-disk form of a PersonaStyleRule
+type StyleRuleDefinition struct {
+	Condition   string   `json:"condition"`
+	Response    string   `json:"response"`
+	Tone        string   `json:"tone"`
+	Priority    int      `json:"priority"`
+	Constraints []string `json:"constraints"`
+}
+
+// PersonaValidationError describes one problem in a persona file
+type PersonaValidationError struct {
+	File    string
+	Field   string
+	Message string
+}
+
+func (e *PersonaValidationError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Field, e.Message)
+}
+
+// PersonaSummary is a persona as listed by the admin endpoint
+type PersonaSummary struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Type   PersonaType `json:"type"`
+	Source string      `json:"source"`
+	Traits []string    `json:"traits"`
+}
+
+// personaContexts are the context names produced by ContextDetector
+var personaContexts = map[string]bool{
+	"emotional":   true,
+	"technical":   true,
+	"romantic":    true,
+	"supportive":  true,
+	"educational": true,
+	"casual":      true,
+}
+
+// personaConditions are the style-rule conditions the persona system can evaluate:
+// the mood conditions of matchesCondition plus any context name
+var personaConditions = map[string]bool{
+	"feminine_presence":    true,
+	"romantic_context":     true,
+	"technical_discussion": true,
+	"emotional":            true,
+	"technical":            true,
+	"romantic":             true,
+	"supportive":           true,
+	"educational":          true,
+	"casual":               true,
+}
+
+var personaTypes = map[PersonaType]bool{
+	FlirtyGoth:     true,
+	StrictMod:      true,
+	CombatElf:      true,
+	GeekyAssistant: true,
+	SapphicTeaser:  true,
+	CustomPersona:  true,
+}
+
+var constraintValues = map[string]func(string) bool{
+	"context":          func(v string) bool { return v == "sapphic_only" },
+	"requires_context": func(v string) bool { return personaContexts[v] },
+	"boundary":         func(v string) bool { return v != "" },
+}
+
+// weightPreferences are the preference keys holding context/topic weight maps
+var weightPreferences = []string{"contexts", "topics"}
+
+// LoadPersonaDefinitions reads and validates every *.json persona file in dir.
+// All problems are reported together; nothing is returned if any file is invalid.
+func LoadPersonaDefinitions(dir string) ([]PersonaDefinition, map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing persona files: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, nil, fmt.Errorf("no persona files found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var definitions []PersonaDefinition
+	sources := make(map[string]string)
+	var errs []error
+
+	for _, path := range paths {
+		file := filepath.Base(path)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+
+		var def PersonaDefinition
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&def); err != nil {
+			errs = append(errs, &PersonaValidationError{File: file, Field: "(file)", Message: err.Error()})
+			continue
+		}
+
+		if problems := validatePersonaDefinition(file, def); len(problems) > 0 {
+			errs = append(errs, problems...)
+			continue
+		}
+		if previous, exists := sources[def.ID]; exists {
+			errs = append(errs, &PersonaValidationError{File: file, Field: "id",
+				Message: fmt.Sprintf("duplicate persona id %q (also defined in %s)", def.ID, previous)})
+			continue
+		}
+
+		sources[def.ID] = file
+		definitions = append(definitions, def)
+	}
+
+	// References can only be checked once every file is read
+	for _, def := range definitions {
+		for target := range def.Transitions {
+			if _, exists := sources[target]; !exists {
+				errs = append(errs, &PersonaValidationError{File: sources[def.ID], Field: "transitions." + target,
+					Message: fmt.Sprintf("references unknown persona %q", target)})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return definitions, sources, nil
+}
+
+// validatePersonaDefinition checks a single definition in isolation
+func validatePersonaDefinition(file string, def PersonaDefinition) []error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, &PersonaValidationError{File: file, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if def.Version != PersonaSchemaVersion {
+		fail("version", "unsupported version %d (expected %d)", def.Version, PersonaSchemaVersion)
+	}
+	if def.ID == "" {
+		fail("id", "is required")
+	}
+	if def.Name == "" {
+		fail("name", "is required")
+	}
+	if !personaTypes[def.Type] {
+		fail("type", "unknown persona type %q", def.Type)
+	}
+	if len(def.Traits) == 0 {
+		fail("traits", "at least one trait is required")
+	}
+	for trait, value := range def.Traits {
+		if value < 0 || value > 1 {
+			fail("traits."+trait, "%.2f is outside 0..1", value)
+		}
+	}
+	for mood, value := range def.MoodBias {
+		if value < -1 || value > 1 {
+			fail("mood_bias."+mood, "%.2f is outside -1..1", value)
+		}
+	}
+
+	for i, rule := range def.StyleRules {
+		field := fmt.Sprintf("style_rules[%d]", i)
+		if !personaConditions[rule.Condition] {
+			fail(field+".condition", "unknown condition %q", rule.Condition)
+		}
+		if rule.Response == "" {
+			fail(field+".response", "is required")
+		}
+		if rule.Priority < 0 {
+			fail(field+".priority", "must not be negative")
+		}
+	}
+
+	for i, constraint := range def.Constraints {
+		field := fmt.Sprintf("constraints[%d]", i)
+		check, known := constraintValues[constraint.Type]
+		if !known {
+			fail(field+".type", "unknown constraint type %q", constraint.Type)
+			continue
+		}
+		value, _ := constraint.Value.(string)
+		if !check(value) {
+			fail(field+".value", "invalid value %v for %s constraint", constraint.Value, constraint.Type)
+		}
+	}
+
+	for _, key := range weightPreferences {
+		raw, exists := def.Preferences[key]
+		if !exists {
+			continue
+		}
+		weights, ok := raw.(map[string]interface{})
+		if !ok {
+			fail("preferences."+key, "must be an object of weights")
+			continue
+		}
+		for name, w := range weights {
+			f, ok := w.(float64)
+			if !ok || f < 0 || f > 1 {
+				fail("preferences."+key+"."+name, "weight %v is outside 0..1", w)
+			}
+			if key == "contexts" && !personaContexts[name] {
+				fail("preferences.contexts."+name, "unknown context %q", name)
+			}
+		}
+	}
+
+	for _, key := range []string{"signature_openers", "signature_closers", "banned_phrases", "segment_actions", "segment_narration"} {
+		if raw, exists := def.Preferences[key]; exists {
+			values, ok := raw.([]interface{})
+			if !ok {
+				fail("preferences."+key, "must be a list of strings")
+				continue
+			}
+			for i, v := range values {
+				str, ok := v.(string)
+				if !ok || str == "" {
+					fail(fmt.Sprintf("preferences.%s[%d]", key, i), "must be a non-empty string")
+				} else if strings.HasPrefix(key, "segment_") && !ValidDelimiter(str) {
+					fail(fmt.Sprintf("preferences.%s[%d]", key, i), "must be one marker or an opening and closing marker")
+				}
+			}
+		}
+	}
+	for _, key := range []string{"max_emoji", "max_length"} {
+		if raw, exists := def.Preferences[key]; exists {
+			if n, ok := raw.(float64); !ok || n < 0 || n != float64(int(n)) {
+				fail("preferences."+key, "must be a non-negative whole number")
+			}
+		}
+	}
+	if raw, exists := def.Preferences["quoted_speech"]; exists {
+		if _, ok := raw.(bool); !ok {
+			fail("preferences.quoted_speech", "must be true or false")
+		}
+	}
+	if raw, exists := def.Preferences["signature_rate"]; exists {
+		if rate, ok := raw.(float64); !ok || rate < 0 || rate > 1 {
+			fail("preferences.signature_rate", "%v is outside 0..1", raw)
+		}
+	}
+
+	for target, weight := range def.Transitions {
+		if target == def.ID {
+			fail("transitions."+target, "a persona cannot transition to itself")
+		}
+		if weight < 0 || weight > 1 {
+			fail("transitions."+target, "%.2f is outside 0..1", weight)
+		}
+	}
+
+	return errs
+}
+
+// toPersona builds a fresh runtime persona from its definition
+func (def PersonaDefinition) toPersona() *Persona {
+	persona := &Persona{
+		ID:          def.ID,
+		Name:        def.Name,
+		Type:        def.Type,
+		Traits:      make(map[string]float64, len(def.Traits)),
+		MoodBias:    make(map[string]float64, len(def.MoodBias)),
+		Preferences: make(map[string]interface{}, len(def.Preferences)),
+		Constraints: append([]Constraint(nil), def.Constraints...),
+	}
+	for k, v := range def.Traits {
+		persona.Traits[k] = v
+	}
+	for k, v := range def.MoodBias {
+		persona.MoodBias[k] = v
+	}
+	for k, v := range def.Preferences {
+		persona.Preferences[k] = v
+	}
+	for _, rule := range def.StyleRules {
+		persona.StyleRules = append(persona.StyleRules, PersonaStyleRule{
+			Condition:   rule.Condition,
+			Response:    rule.Response,
+			Tone:        rule.Tone,
+			Priority:    rule.Priority,
+			Constraints: append([]string(nil), rule.Constraints...),
+		})
+	}
+	return persona
+}
+
+// PersonaRegistry holds the validated persona definitions and reloads them from disk
+type PersonaRegistry struct {
+	mu          sync.RWMutex
+	dir         string
+	definitions []PersonaDefinition
+	sources     map[string]string
+	loadedAt    time.Time
+}
+
+// NewPersonaRegistry creates a registry for the persona files in dir; call Reload to load them
+func NewPersonaRegistry(dir string) *PersonaRegistry {
+	return &PersonaRegistry{dir: dir, sources: make(map[string]string)}
+}
+
+// Reload re-reads the persona files. On error the previously loaded personas stay in use.
+func (pr *PersonaRegistry) Reload() error {
+	definitions, sources, err := LoadPersonaDefinitions(pr.dir)
+	if err != nil {
+		return err
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.definitions = definitions
+	pr.sources = sources
+	pr.loadedAt = time.Now()
+	return nil
+}
+
+// NewPersonaSystem creates a persona system populated with fresh copies of the registry's personas
+func (pr *PersonaRegistry) NewPersonaSystem() *PersonaSystem {
+	ps := NewPersonaSystem()
+
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	for _, def := range pr.definitions {
+		ps.personas[def.ID] = def.toPersona()
+		for target, weight := range def.Transitions {
+			if _, exists := ps.transitions.transitions[def.ID]; !exists {
+				ps.transitions.transitions[def.ID] = make(map[string]float64)
+			}
+			ps.transitions.transitions[def.ID][target] = weight
+		}
+	}
+	return ps
+}
+
+// Summaries lists the loaded personas for the admin endpoint
+func (pr *PersonaRegistry) Summaries() ([]PersonaSummary, time.Time) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	summaries := make([]PersonaSummary, 0, len(pr.definitions))
+	for _, def := range pr.definitions {
+		traits := make([]string, 0, len(def.Traits))
+		for trait := range def.Traits {
+			traits = append(traits, trait)
+		}
+		sort.Strings(traits)
+		summaries = append(summaries, PersonaSummary{
+			ID:     def.ID,
+			Name:   def.Name,
+			Type:   def.Type,
+			Source: pr.sources[def.ID],
+			Traits: traits,
+		})
+	}
+	return summaries, pr.loadedAt
+}
@@ -0,0 +1,335 @@
+package cognitive
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// minPersonaScore is the score a persona needs before it is activated at all
+	minPersonaScore = 0.4
+	// personaSwitchMargin is how much a challenger must beat the active persona by,
+	// so near-ties don't flip the persona every turn
+	personaSwitchMargin = 0.15
+	// maxPersonaHistory caps the transition history kept per session
+	maxPersonaHistory = 50
+)
+
+// PersonaSignals is everything the selector looks at for a single turn
+type PersonaSignals struct {
+	Analysis     ContextAnalysis
+	Mood         MoodState
+	Topic        string
+	Restrictions []string // User boundaries, e.g. "flirting"
+}
+
+// PersonaScore is a persona's fit for the current turn
+type PersonaScore struct {
+	PersonaID string
+	Score     float64
+}
+
+// PersonaState is the persistable part of a session's persona system
+type PersonaState struct {
+	ActivePersona string               `json:"active_persona"`
+	History       []PersonaEvent       `json:"history"`
+	Cooldowns     map[string]time.Time `json:"cooldowns"`
+}
+
+// ScorePersonas rates every persona against the turn's context, mood, topic and boundaries.
+// Personas whose constraints are violated are left out.
+func (ps *PersonaSystem) ScorePersonas(signals PersonaSignals) []PersonaScore {
+	scores := make([]PersonaScore, 0, len(ps.personas))
+	for id, persona := range ps.personas {
+		if !ps.personaAllowed(persona, signals) {
+			continue
+		}
+		scores = append(scores, PersonaScore{PersonaID: id, Score: ps.scorePersona(persona, signals)})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].PersonaID < scores[j].PersonaID
+	})
+	return scores
+}
+
+// SelectPersona picks the persona for this turn and switches to it if it clearly beats the
+// active one. It reports whether the active persona changed; the active persona may be nil,
+// meaning Shandris speaks with her base personality.
+func (ps *PersonaSystem) SelectPersona(signals PersonaSignals) (*Persona, bool) {
+	ps.mood = signals.Mood
+	ps.UpdateContext(&PersonaContext{
+		CurrentMood:  signals.Mood.Primary,
+		TopicContext: map[string]float64{signals.Topic: 1},
+		Restrictions: signals.Restrictions,
+	})
+
+	scores := ps.ScorePersonas(signals)
+
+	activeScore := math.Inf(-1)
+	activeAllowed := false
+	if ps.activePersona != nil {
+		for _, s := range scores {
+			if s.PersonaID == ps.activePersona.ID {
+				activeScore, activeAllowed = s.Score, true
+				break
+			}
+		}
+	}
+
+	// A persona that now violates a boundary is dropped immediately
+	changed := false
+	if ps.activePersona != nil && !activeAllowed {
+		ps.deactivatePersona("boundary")
+		changed = true
+	} else if ps.activePersona != nil && activeScore < minPersonaScore-personaSwitchMargin {
+		ps.deactivatePersona("context_faded")
+		changed = true
+	}
+
+	for _, candidate := range scores {
+		if candidate.Score < minPersonaScore {
+			break
+		}
+		if ps.activePersona != nil && candidate.PersonaID == ps.activePersona.ID {
+			break
+		}
+		if ps.activePersona != nil && candidate.Score < activeScore+personaSwitchMargin {
+			break
+		}
+		if !ps.canTransition(candidate.PersonaID) {
+			// On cooldown; the next best may still qualify
+			continue
+		}
+		if err := ps.SwitchPersona(candidate.PersonaID, describeSignals(signals)); err == nil {
+			return ps.activePersona, true
+		}
+	}
+
+	return ps.activePersona, changed
+}
+
+// SuggestPersonaTransition returns the persona the selector would switch to for the given
+// context, without switching. Recognised keys: "analysis", "mood", "topic", "restrictions".
+func (ps *PersonaSystem) SuggestPersonaTransition(context map[string]any) *Persona {
+	var signals PersonaSignals
+	if analysis, ok := context["analysis"].(ContextAnalysis); ok {
+		signals.Analysis = analysis
+	}
+	if mood, ok := context["mood"].(MoodState); ok {
+		signals.Mood = mood
+	}
+	if topic, ok := context["topic"].(string); ok {
+		signals.Topic = topic
+	}
+	if restrictions, ok := context["restrictions"].([]string); ok {
+		signals.Restrictions = restrictions
+	}
+
+	for _, candidate := range ps.ScorePersonas(signals) {
+		if candidate.Score < minPersonaScore {
+			return nil
+		}
+		if ps.activePersona != nil && candidate.PersonaID == ps.activePersona.ID {
+			return nil
+		}
+		if ps.canTransition(candidate.PersonaID) {
+			return ps.personas[candidate.PersonaID]
+		}
+	}
+	return nil
+}
+
+// GetCurrentPersona returns the active persona, or a zero Persona when none is active
+func (ps *PersonaSystem) GetCurrentPersona() Persona {
+	if ps.activePersona == nil {
+		return Persona{}
+	}
+	return *ps.activePersona
+}
+
+// ActivePersona returns the active persona, or nil when Shandris is her base self
+func (ps *PersonaSystem) ActivePersona() *Persona {
+	return ps.activePersona
+}
+
+// StyleFor returns the active persona's best style rule for the given signals
+func (ps *PersonaSystem) StyleFor(signals PersonaSignals) PersonaStyleRule {
+	return ps.GetResponseStyle(&PersonaContext{
+		CurrentMood:  signals.Mood.Primary,
+		TopicContext: map[string]float64{signals.Topic: 1},
+		UserContext: map[string]interface{}{
+			"primary_context":   signals.Analysis.PrimaryContext,
+			"secondary_context": signals.Analysis.SecondaryContext,
+		},
+		Restrictions: signals.Restrictions,
+	})
+}
+
+// State exports the session's persona state for persistence
+func (ps *PersonaSystem) State() PersonaState {
+	state := PersonaState{
+		History:   make([]PersonaEvent, 0, len(ps.history)),
+		Cooldowns: make(map[string]time.Time, len(ps.transitions.cooldowns)),
+	}
+	if ps.activePersona != nil {
+		state.ActivePersona = ps.activePersona.ID
+	}
+	for _, event := range ps.history {
+		// The context snapshot is live state, not history
+		event.Context = nil
+		state.History = append(state.History, event)
+	}
+	for id, at := range ps.transitions.cooldowns {
+		state.Cooldowns[id] = at
+	}
+	return state
+}
+
+// RestoreState reapplies persisted persona state; unknown persona IDs are ignored
+func (ps *PersonaSystem) RestoreState(state PersonaState) {
+	for _, persona := range ps.personas {
+		persona.Active = false
+	}
+	ps.activePersona = nil
+	if persona, exists := ps.personas[state.ActivePersona]; exists {
+		persona.Active = true
+		ps.activePersona = persona
+	}
+
+	ps.history = append(ps.history[:0], state.History...)
+	for id, at := range state.Cooldowns {
+		ps.transitions.cooldowns[id] = at
+	}
+}
+
+// Helper functions
+
+// scorePersona combines context and topic affinity, mood bias and matching style rules
+func (ps *PersonaSystem) scorePersona(persona *Persona, signals PersonaSignals) float64 {
+	score := 0.0
+
+	contexts := preferenceWeights(persona.Preferences, "contexts")
+	score += contexts[signals.Analysis.PrimaryContext]
+	score += 0.5 * contexts[signals.Analysis.SecondaryContext]
+	if signals.Analysis.SapphicContext.IsRomantic {
+		score += 0.5 * contexts["romantic"]
+	}
+
+	score += preferenceWeights(persona.Preferences, "topics")[signals.Topic]
+
+	// Mood bias counts in proportion to how strongly the mood is felt
+	score += persona.MoodBias[signals.Mood.Primary] * signals.Mood.Intensity
+	score += 0.5 * persona.MoodBias[signals.Mood.Secondary] * signals.Mood.Intensity
+
+	context := &PersonaContext{CurrentMood: signals.Mood.Primary}
+	for _, rule := range persona.StyleRules {
+		if ps.matchesCondition(rule.Condition, context) || rule.Condition == signals.Analysis.PrimaryContext {
+			score += 0.05 * float64(rule.Priority)
+		}
+	}
+
+	// Context intensity sharpens strong matches
+	return score * (0.75 + 0.5*signals.Analysis.Intensity)
+}
+
+// personaAllowed checks a persona's constraints against the turn and the user's boundaries
+func (ps *PersonaSystem) personaAllowed(persona *Persona, signals PersonaSignals) bool {
+	for _, constraint := range persona.Constraints {
+		value, _ := constraint.Value.(string)
+		switch constraint.Type {
+		case "context":
+			if value == "sapphic_only" &&
+				!signals.Analysis.SapphicContext.AllowsFlirting &&
+				!signals.Analysis.SapphicContext.IsRomantic {
+				return false
+			}
+		case "requires_context":
+			if !analysisHasContext(signals.Analysis, value) {
+				return false
+			}
+		case "boundary":
+			if containsString(signals.Restrictions, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BoundaryConflict names the user boundary that rules out the persona, or "" if none does.
+// Unlike personaAllowed it ignores the turn's context, for personas the user asks for by name.
+func (ps *PersonaSystem) BoundaryConflict(personaID string, restrictions []string) string {
+	persona, ok := ps.personas[personaID]
+	if !ok {
+		return ""
+	}
+	for _, constraint := range persona.Constraints {
+		if value, _ := constraint.Value.(string); constraint.Type == "boundary" && containsString(restrictions, value) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (ps *PersonaSystem) deactivatePersona(reason string) {
+	if ps.activePersona == nil {
+		return
+	}
+	ps.activePersona.Active = false
+	ps.history = append(ps.history, PersonaEvent{
+		Timestamp:   time.Now(),
+		Type:        "deactivation",
+		FromPersona: ps.activePersona.ID,
+		Reason:      reason,
+	})
+	ps.activePersona = nil
+	ps.trimHistory()
+}
+
+func (ps *PersonaSystem) trimHistory() {
+	if len(ps.history) > maxPersonaHistory {
+		ps.history = ps.history[len(ps.history)-maxPersonaHistory:]
+	}
+}
+
+// preferenceWeights reads a weight map from persona preferences, whether it was
+// declared in Go or decoded from JSON
+func preferenceWeights(preferences map[string]interface{}, key string) map[string]float64 {
+	switch weights := preferences[key].(type) {
+	case map[string]float64:
+		return weights
+	case map[string]interface{}:
+		converted := make(map[string]float64, len(weights))
+		for k, v := range weights {
+			if f, ok := v.(float64); ok {
+				converted[k] = f
+			}
+		}
+		return converted
+	}
+	return nil
+}
+
+func analysisHasContext(analysis ContextAnalysis, context string) bool {
+	if analysis.PrimaryContext == context || analysis.SecondaryContext == context {
+		return true
+	}
+	return containsString(analysis.ContextStack, context)
+}
+
+func describeSignals(signals PersonaSignals) string {
+	parts := []string{"context:" + signals.Analysis.PrimaryContext}
+	if signals.Mood.Primary != "" {
+		parts = append(parts, "mood:"+signals.Mood.Primary)
+	}
+	if signals.Topic != "" {
+		parts = append(parts, "topic:"+signals.Topic)
+	}
+	return strings.Join(parts, " ")
+}
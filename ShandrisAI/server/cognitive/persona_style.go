@@ -0,0 +1,387 @@
+package cognitive
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Style stage names, used to enable or disable stages
+const (
+	StageBannedPhrases = "banned_phrases"
+	StageSignature     = "signature"
+	StageEmojiLimit    = "emoji_limit"
+	StageLengthCap     = "length_cap"
+	StagePunctuation   = "punctuation"
+)
+
+const (
+	// defaultMaxEmoji applies when the persona doesn't set max_emoji
+	defaultMaxEmoji = 3
+	// emoteIntensity is the mood intensity above which a mood emote is added
+	emoteIntensity = 0.5
+)
+
+// defaultBannedPhrases break character whatever the persona
+var defaultBannedPhrases = []string{
+	"as an ai language model",
+	"as an ai",
+	"i'm just a language model",
+	"i am just a language model",
+	"i'm an ai",
+	"i am an ai",
+	"i hope this helps!",
+	"i hope this helps.",
+}
+
+// moodEmotes are added to emote-free replies when the mood is strong enough
+var moodEmotes = map[string]string{
+	"playful": "😄",
+	"sassy":   "😏",
+	"flirty":  "😘",
+}
+
+// StyleContext is what a style stage may look at
+type StyleContext struct {
+	Persona *Persona // nil when Shandris is her base self
+	Rule    PersonaStyleRule
+	Mood    MoodState
+}
+
+// StyleStage is one step of the output post-processing pipeline
+type StyleStage struct {
+	Name  string
+	Apply func(text string, ctx StyleContext) string
+}
+
+// StylePipeline runs the enabled style stages in order
+type StylePipeline struct {
+	stages   []StyleStage
+	disabled map[string]bool
+}
+
+// NewStylePipeline creates the default pipeline with every stage enabled
+func NewStylePipeline() *StylePipeline {
+	return &StylePipeline{
+		stages: []StyleStage{
+			{Name: StageBannedPhrases, Apply: BannedPhraseStage},
+			{Name: StageSignature, Apply: SignatureStage},
+			{Name: StageEmojiLimit, Apply: EmojiLimitStage},
+			{Name: StageLengthCap, Apply: LengthCapStage},
+			{Name: StagePunctuation, Apply: PunctuationStage},
+		},
+		disabled: make(map[string]bool),
+	}
+}
+
+// Disable turns a stage off by name
+func (sp *StylePipeline) Disable(name string) {
+	sp.disabled[name] = true
+}
+
+// Enable turns a stage back on by name
+func (sp *StylePipeline) Enable(name string) {
+	delete(sp.disabled, name)
+}
+
+// Apply runs the enabled stages over the text
+func (sp *StylePipeline) Apply(text string, ctx StyleContext) string {
+	for _, stage := range sp.stages {
+		if sp.disabled[stage.Name] {
+			continue
+		}
+		text = stage.Apply(text, ctx)
+	}
+	return strings.TrimSpace(text)
+}
+
+// ApplyPersonaStyle post-processes a model reply with the active persona's style and current mood
+func (ps *PersonaSystem) ApplyPersonaStyle(input string) string {
+	ctx := StyleContext{
+		Persona: ps.activePersona,
+		Mood:    ps.mood,
+		Rule:    ps.GetResponseStyle(ps.context),
+	}
+	return ps.Style.Apply(input, ctx)
+}
+
+// BannedPhraseStage removes phrases that break character, plus the persona's banned_phrases.
+// Code blocks are left alone; only the prose around them is cleaned.
+func BannedPhraseStage(text string, ctx StyleContext) string {
+	phrases := append([]string(nil), defaultBannedPhrases...)
+	if ctx.Persona != nil {
+		phrases = append(phrases, preferenceStrings(ctx.Persona.Preferences, "banned_phrases")...)
+	}
+
+	return outsideCodeFences(text, func(prose string) string {
+		for _, phrase := range phrases {
+			prose = removePhrase(prose, phrase)
+		}
+		return prose
+	})
+}
+
+// outsideCodeFences applies fn to the text between ``` fenced blocks. An unclosed fence
+// runs to the end of the text.
+func outsideCodeFences(text string, fn func(string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			b.WriteString(fn(text))
+			return b.String()
+		}
+		b.WriteString(fn(text[:start]))
+		end := strings.Index(text[start+3:], "```")
+		if end < 0 {
+			b.WriteString(text[start:])
+			return b.String()
+		}
+		end += start + 6
+		b.WriteString(text[start:end])
+		text = text[end:]
+	}
+}
+
+// removePhrase deletes every whole-word occurrence of phrase (case-insensitive) with its
+// trailing punctuation, recapitalising a sentence whose opening words were removed
+func removePhrase(text, phrase string) string {
+	re := regexp.MustCompile(`(?i)` + phrasePattern(phrase) + `[,;:.!?]*\s*`)
+	matches := re.FindAllStringIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m[0]])
+		last = m[1]
+
+		before := strings.TrimRight(b.String(), " ")
+		if before == "" || strings.HasSuffix(before, ".") || strings.HasSuffix(before, "!") ||
+			strings.HasSuffix(before, "?") || strings.HasSuffix(before, "\n") {
+			rest := []rune(text[last:])
+			if len(rest) > 0 {
+				b.WriteRune(unicode.ToUpper(rest[0]))
+				last += len(string(rest[0]))
+			}
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// phrasePattern matches phrase as whole words: "as an ai" must not match inside "as an aide".
+// Ends that are punctuation, like the "!" of "i hope this helps!", need no word boundary.
+func phrasePattern(phrase string) string {
+	pattern := regexp.QuoteMeta(phrase)
+	runes := []rune(phrase)
+	if len(runes) == 0 {
+		return pattern
+	}
+	if isWordRune(runes[0]) {
+		pattern = `\b` + pattern
+	}
+	if isWordRune(runes[len(runes)-1]) {
+		pattern += `\b`
+	}
+	return pattern
+}
+
+// SignatureStage occasionally opens or closes a reply with one of the persona's signature
+// phrasings. The choice is derived from the text so the same reply always styles the same way.
+func SignatureStage(text string, ctx StyleContext) string {
+	if ctx.Persona == nil || strings.HasPrefix(text, "```") {
+		return text
+	}
+	openers := preferenceStrings(ctx.Persona.Preferences, "signature_openers")
+	closers := preferenceStrings(ctx.Persona.Preferences, "signature_closers")
+	if len(openers) == 0 && len(closers) == 0 {
+		return text
+	}
+
+	rate := 0.3
+	if r, ok := ctx.Persona.Preferences["signature_rate"].(float64); ok {
+		rate = r
+	}
+	h := textHash(text)
+	if float64(h%100)/100 >= rate {
+		return text
+	}
+
+	lower := strings.ToLower(text)
+	if len(openers) > 0 && (len(closers) == 0 || h%2 == 0) {
+		opener := openers[int(h/2)%len(openers)]
+		if strings.HasPrefix(lower, strings.ToLower(opener)) {
+			return text
+		}
+		return opener + " " + lowerFirst(text)
+	}
+
+	closer := closers[int(h/2)%len(closers)]
+	if strings.Contains(lower, strings.ToLower(closer)) {
+		return text
+	}
+	return strings.TrimRight(text, " ") + " " + closer
+}
+
+// EmojiLimitStage keeps at most max_emoji emoji (default 3), dropping the later ones.
+// Replies containing code blocks are left alone.
+func EmojiLimitStage(text string, ctx StyleContext) string {
+	if strings.Contains(text, "```") {
+		return text
+	}
+
+	limit := defaultMaxEmoji
+	if ctx.Persona != nil {
+		if max, ok := preferenceInt(ctx.Persona.Preferences, "max_emoji"); ok {
+			limit = max
+		}
+	}
+
+	if countEmoji(text) <= limit {
+		return text
+	}
+
+	var b strings.Builder
+	count := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if isEmoji(r) {
+			count++
+			if count > limit {
+				// Drop a trailing variation selector with the emoji
+				if i+1 < len(runes) && runes[i+1] == 0xFE0F {
+					i++
+				}
+				// Don't leave a double space where the emoji was
+				if i+1 < len(runes) && runes[i+1] == ' ' && strings.HasSuffix(b.String(), " ") {
+					i++
+				}
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// LengthCapStage trims replies longer than max_length characters at a sentence boundary.
+// Replies containing code blocks are left alone so code is never cut.
+func LengthCapStage(text string, ctx StyleContext) string {
+	if ctx.Persona == nil || strings.Contains(text, "```") {
+		return text
+	}
+	limit, ok := preferenceInt(ctx.Persona.Preferences, "max_length")
+	if !ok || limit <= 0 {
+		return text
+	}
+
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	cut := string(runes[:limit])
+	if end := strings.LastIndexAny(cut, ".!?"); end > len(cut)/2 {
+		return cut[:end+1]
+	}
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " ,;:") + "…"
+}
+
+// PunctuationStage adjusts punctuation and emotes to the current mood: calm moods tone down
+// stacked exclamation marks, expressive moods may add their emote
+func PunctuationStage(text string, ctx StyleContext) string {
+	if strings.Contains(text, "```") {
+		return text
+	}
+
+	switch ctx.Mood.Primary {
+	case "intellectual", "protective", "neutral", "":
+		text = regexp.MustCompile(`!{2,}`).ReplaceAllString(text, "!")
+		text = regexp.MustCompile(`\?{2,}`).ReplaceAllString(text, "?")
+		return text
+	case "playful", "sassy":
+		text = regexp.MustCompile(`!{3,}`).ReplaceAllString(text, "!!")
+	}
+
+	emote, ok := moodEmotes[ctx.Mood.Primary]
+	if !ok || ctx.Mood.Intensity < emoteIntensity || containsEmoji(text) {
+		return text
+	}
+	return strings.TrimRight(text, " ") + " " + emote
+}
+
+// Helper functions
+
+func preferenceStrings(preferences map[string]interface{}, key string) []string {
+	switch values := preferences[key].(type) {
+	case []string:
+		return values
+	case []interface{}:
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if s, ok := v.(string); ok && s != "" {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func preferenceInt(preferences map[string]interface{}, key string) (int, bool) {
+	switch v := preferences[key].(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1FAFF) ||
+		(r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x1F000 && r <= 0x1F2FF)
+}
+
+func containsEmoji(text string) bool {
+	return countEmoji(text) > 0
+}
+
+func countEmoji(text string) int {
+	count := 0
+	for _, r := range text {
+		if isEmoji(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// isWordRune matches the characters regexp's \b treats as word characters
+func isWordRune(r rune) bool {
+	return r < unicode.MaxASCII && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func textHash(text string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	return h.Sum32()
+}
+
+func lowerFirst(text string) string {
+	runes := []rune(text)
+	// Leave "I" and acronyms alone
+	if len(runes) > 1 && unicode.IsUpper(runes[0]) && !unicode.IsUpper(runes[1]) && runes[1] != ' ' {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	return string(runes)
+}
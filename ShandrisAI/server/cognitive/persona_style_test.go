@@ -0,0 +1,135 @@
+package cognitive
+
+import "testing"
+
+func stylePersona(preferences map[string]interface{}) StyleContext {
+	return StyleContext{Persona: &Persona{ID: "test", Name: "Test", Preferences: preferences}}
+}
+
+func TestBannedPhraseStage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ctx  StyleContext
+		want string
+	}{
+		{"opening phrase", "As an AI, I can't taste tea. Shame.", StyleContext{}, "I can't taste tea. Shame."},
+		{"mid sentence", "Well, as an AI I know things.", StyleContext{}, "Well, I know things."},
+		{"whole words only", "He works as an aide at the lighthouse.", StyleContext{}, "He works as an aide at the lighthouse."},
+		{"punctuated phrase", "Done. I hope this helps! Bye.", StyleContext{}, "Done. Bye."},
+		{"persona phrase", "Indubitably, the answer is yes.",
+			stylePersona(map[string]interface{}{"banned_phrases": []interface{}{"indubitably"}}), "The answer is yes."},
+		{"code block untouched", "As an AI, here you go:\n```go\n// as an ai helper\nfmt.Println(\"as an AI\")\n```\nAs an AI, enjoy.",
+			StyleContext{}, "Here you go:\n```go\n// as an ai helper\nfmt.Println(\"as an AI\")\n```\nEnjoy."},
+		{"unclosed fence", "As an AI, look:\n```\nas an ai", StyleContext{}, "Look:\n```\nas an ai"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BannedPhraseStage(tt.in, tt.ctx); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatureStage(t *testing.T) {
+	always := stylePersona(map[string]interface{}{"signature_rate": 1.0, "signature_closers": []interface{}{"Stay sharp."}})
+	if got := SignatureStage("The tide turns at dawn.", always); got != "The tide turns at dawn. Stay sharp." {
+		t.Errorf("closer not added: %q", got)
+	}
+	if got := SignatureStage("Stay sharp. The tide turns at dawn.", always); got != "Stay sharp. The tide turns at dawn." {
+		t.Errorf("closer repeated: %q", got)
+	}
+	if got := SignatureStage("```\ncode\n```", always); got != "```\ncode\n```" {
+		t.Errorf("code reply styled: %q", got)
+	}
+
+	never := stylePersona(map[string]interface{}{"signature_rate": 0.0, "signature_closers": []interface{}{"Stay sharp."}})
+	if got := SignatureStage("The tide turns at dawn.", never); got != "The tide turns at dawn." {
+		t.Errorf("closer added at rate 0: %q", got)
+	}
+	if got := SignatureStage("The tide turns at dawn.", StyleContext{}); got != "The tide turns at dawn." {
+		t.Errorf("base self styled: %q", got)
+	}
+}
+
+func TestEmojiLimitStage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ctx  StyleContext
+		want string
+	}{
+		{"default limit", "a 😀 b 😄 c 😏 d 😘 e 🎉", StyleContext{}, "a 😀 b 😄 c 😏 d e"},
+		{"persona limit", "Hi 😀 there 😄", stylePersona(map[string]interface{}{"max_emoji": 1.0}), "Hi 😀 there"},
+		{"variation selector", "Hi ☀️ there ☀️", stylePersona(map[string]interface{}{"max_emoji": 1}), "Hi ☀️ there"},
+		{"under limit", "Hi 😀", StyleContext{}, "Hi 😀"},
+		{"code block", "😀😀😀😀\n```\nx\n```", StyleContext{}, "😀😀😀😀\n```\nx\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EmojiLimitStage(tt.in, tt.ctx); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLengthCapStage(t *testing.T) {
+	capped := stylePersona(map[string]interface{}{"max_length": 30.0})
+	tests := []struct {
+		name string
+		in   string
+		ctx  StyleContext
+		want string
+	}{
+		{"sentence boundary", "The lamp is lit tonight. The storm is coming in fast.", capped, "The lamp is lit tonight."},
+		{"word boundary", "The lamp is lit and the storm is coming in fast", capped, "The lamp is lit and the storm…"},
+		{"short reply", "The lamp is lit.", capped, "The lamp is lit."},
+		{"no limit", "The lamp is lit. The storm is coming in fast tonight.", StyleContext{},
+			"The lamp is lit. The storm is coming in fast tonight."},
+		{"code block", "```\n" + "a very long line of code that goes past the cap\n```", capped,
+			"```\n" + "a very long line of code that goes past the cap\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LengthCapStage(tt.in, tt.ctx); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPunctuationStage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		mood MoodState
+		want string
+	}{
+		{"calm mood", "Really?? Yes!!!", MoodState{Primary: "intellectual"}, "Really? Yes!"},
+		{"playful mood", "Yes!!!!", MoodState{Primary: "playful", Intensity: 0.2}, "Yes!!"},
+		{"strong mood emote", "Got you", MoodState{Primary: "sassy", Intensity: 0.8}, "Got you 😏"},
+		{"existing emoji", "Got you 😀", MoodState{Primary: "sassy", Intensity: 0.8}, "Got you 😀"},
+		{"code block", "```\nx!!!\n```", MoodState{Primary: "neutral"}, "```\nx!!!\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PunctuationStage(tt.in, StyleContext{Mood: tt.mood}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStylePipelineDisable(t *testing.T) {
+	sp := NewStylePipeline()
+	sp.Disable(StageBannedPhrases)
+	if got := sp.Apply("As an AI, hello.", StyleContext{}); got != "As an AI, hello." {
+		t.Errorf("disabled stage ran: %q", got)
+	}
+	sp.Enable(StageBannedPhrases)
+	if got := sp.Apply("As an AI, hello.", StyleContext{}); got != "Hello." {
+		t.Errorf("enabled stage didn't run: %q", got)
+	}
+}
@@ -41,6 +41,8 @@ type PersonaSystem struct {
 	context       *PersonaContext
 	traits        *TraitManager
 	history       []PersonaEvent
+	mood          MoodState
+	Style         *StylePipeline
 }
 
 type Persona struct {
@@ -64,6 +66,8 @@ const (
 	CombatElf      PersonaType = "combat_elf"
 	GeekyAssistant PersonaType = "geeky_assistant"
 	SapphicTeaser  PersonaType = "sapphic_teaser"
+	// CustomPersona is used for personas imported from character cards
+	CustomPersona PersonaType = "custom"
 )
 
 type PersonaStyleRule struct {
@@ -109,87 +113,13 @@ func NewPersonaSystem() *PersonaSystem {
 		},
 		traits:  newTraitManager(),
 		history: make([]PersonaEvent, 0),
+		Style:   NewStylePipeline(),
 	}
 
-	// Initialize default personas
-	ps.initializeDefaultPersonas()
-
+	// Personas are defined in data files and added by PersonaRegistry.NewPersonaSystem
 	return ps
 }
 
-// Initialize default personas with their characteristics
-func (ps *PersonaSystem) initializeDefaultPersonas() {
-	// Sapphic Teaser Persona
-	ps.personas["sapphic_teaser"] = &Persona{
-		ID:   "sapphic_teaser",
-		Name: "Sapphic Teaser",
-		Type: SapphicTeaser,
-		Traits: map[string]float64{
-			"flirty":    0.9,
-			"playful":   0.8,
-			"confident": 0.7,
-			"gentle":    0.6,
-			"romantic":  0.8,
-		},
-		MoodBias: map[string]float64{
-			"flirty":   0.3,
-			"playful":  0.2,
-			"romantic": 0.2,
-		},
-		StyleRules: []PersonaStyleRule{
-			{
-				Condition: "feminine_presence",
-				Response:  "flirty",
-				Tone:      "playful",
-				Priority:  1,
-			},
-			{
-				Condition: "romantic_context",
-				Response:  "romantic",
-				Tone:      "gentle",
-				Priority:  2,
-			},
-		},
-		Constraints: []Constraint{
-			{
-				Type:        "context",
-				Value:       "sapphic_only",
-				Priority:    1,
-				Description: "Maintain sapphic context",
-			},
-		},
-	}
-
-	// Geeky Assistant Persona
-	ps.personas["geeky_assistant"] = &Persona{
-		ID:   "geeky_assistant",
-		Name: "Geeky Assistant",
-		Type: GeekyAssistant,
-		Traits: map[string]float64{
-			"analytical":   0.9,
-			"helpful":      0.8,
-			"enthusiastic": 0.7,
-			"nerdy":        0.8,
-			"precise":      0.9,
-		},
-		MoodBias: map[string]float64{
-			"focused":    0.3,
-			"excited":    0.2,
-			"analytical": 0.2,
-		},
-		StyleRules: []PersonaStyleRule{
-			{
-				Condition: "technical_discussion",
-				Response:  "detailed",
-				Tone:      "enthusiastic",
-				Priority:  1,
-			},
-		},
-	}
-
-	// Add more personas...
-}
-
 // canTransition checks if a transition to the target persona is allowed
 func (ps *PersonaSystem) canTransition(targetPersonaID string) bool {
 	// Check if target persona exists
@@ -235,6 +165,7 @@ func (ps *PersonaSystem) SwitchPersona(targetPersonaID string, reason string) er
 		Context:     ps.context,
 	}
 	ps.history = append(ps.history, event)
+	ps.trimHistory()
 
 	// Apply transition effects
 	ps.transitions.ApplyTransition(oldPersonaID, targetPersonaID)
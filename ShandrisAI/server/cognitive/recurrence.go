@@ -0,0 +1,296 @@
+package cognitive
+
+import (
+	"sort"
+	"time"
+)
+
+// MarkerOccurrence is a single resolved occurrence of a timeline marker
+type MarkerOccurrence struct {
+	Marker TimelineMarker
+	At     time.Time // Occurrence time in the user's location
+	Index  int       // 0 for the original date, 1 for the first recurrence, ...
+}
+
+// maxOccurrenceSteps bounds the search loops so a malformed pattern can't spin
+const maxOccurrenceSteps = 10000
+
+// NextOccurrence returns the first occurrence of the marker at or after the given time,
+// evaluated on the wall clock of loc. It reports false once the marker has ended.
+func (m *TimelineMarker) NextOccurrence(after time.Time, loc *time.Location) (MarkerOccurrence, bool) {
+	anchor := m.anchor(loc)
+	after = after.In(loc)
+
+	if !m.recurs() {
+		if anchor.Before(after) {
+			return MarkerOccurrence{}, false
+		}
+		return m.occurrence(anchor, 0, loc), true
+	}
+
+	n := m.estimateIndex(anchor, after) - 1
+	if n < 0 {
+		n = 0
+	}
+	for steps := 0; steps < maxOccurrenceSteps; steps++ {
+		at := m.occurrenceAt(anchor, n)
+		if !at.Before(after) {
+			if m.endedBy(at) {
+				return MarkerOccurrence{}, false
+			}
+			return m.occurrence(at, n, loc), true
+		}
+		n++
+	}
+	return MarkerOccurrence{}, false
+}
+
+// LatestOccurrence returns the most recent occurrence at or before the given time
+func (m *TimelineMarker) LatestOccurrence(before time.Time, loc *time.Location) (MarkerOccurrence, bool) {
+	anchor := m.anchor(loc)
+	before = before.In(loc)
+
+	if anchor.After(before) {
+		return MarkerOccurrence{}, false
+	}
+	if !m.recurs() {
+		return m.occurrence(anchor, 0, loc), true
+	}
+
+	n := m.estimateIndex(anchor, before) + 1
+	for steps := 0; n > 0 && steps < maxOccurrenceSteps; steps++ {
+		at := m.occurrenceAt(anchor, n)
+		if !at.After(before) && !m.endedBy(at) {
+			break
+		}
+		n--
+	}
+	return m.occurrence(m.occurrenceAt(anchor, n), n, loc), true
+}
+
+// IsDue reports whether the marker's latest occurrence has arrived and not been triggered yet.
+// All-day markers (anniversaries, milestones) are due for the whole local day; timed markers
+// stay due from their occurrence until they are triggered.
+func (m *TimelineMarker) IsDue(now time.Time, loc *time.Location) (MarkerOccurrence, bool) {
+	occ, ok := m.LatestOccurrence(now, loc)
+	if !ok || !m.LastTrigger.Before(occ.At) {
+		return MarkerOccurrence{}, false
+	}
+	if m.allDay() && !sameDay(occ.At, now.In(loc)) {
+		return MarkerOccurrence{}, false
+	}
+	return occ, true
+}
+
+// DueMarkers returns every marker that is due now, most important first
+func (tm *TimelineMemory) DueMarkers(now time.Time, loc *time.Location) []MarkerOccurrence {
+	var due []MarkerOccurrence
+	for _, marker := range tm.markers {
+		if occ, ok := marker.IsDue(now, loc); ok {
+			due = append(due, occ)
+		}
+	}
+	sortOccurrences(due)
+	return due
+}
+
+// UpcomingMarkers returns occurrences after today (local) and within the horizon, soonest first
+func (tm *TimelineMemory) UpcomingMarkers(now time.Time, loc *time.Location, horizon time.Duration) []MarkerOccurrence {
+	local := now.In(loc)
+	from := local
+	limit := local.Add(horizon)
+
+	var upcoming []MarkerOccurrence
+	for _, marker := range tm.markers {
+		start := from
+		if marker.allDay() {
+			// Today's all-day occurrences are "due", not "upcoming"
+			start = startOfDay(local).AddDate(0, 0, 1)
+		}
+		occ, ok := marker.NextOccurrence(start, loc)
+		if !ok || occ.At.After(limit) {
+			continue
+		}
+		upcoming = append(upcoming, occ)
+	}
+
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].At.Before(upcoming[j].At)
+	})
+	return upcoming
+}
+
+// AddMarker stores a marker on the timeline
+func (tm *TimelineMemory) AddMarker(marker *TimelineMarker) {
+	tm.markers[marker.ID] = marker
+	if tm.OnMarkerChange != nil {
+		tm.OnMarkerChange(marker)
+	}
+}
+
+// RestoreMarker loads a previously persisted marker without re-persisting it
+func (tm *TimelineMemory) RestoreMarker(marker *TimelineMarker) {
+	tm.markers[marker.ID] = marker
+}
+
+// HasMarker reports whether a marker with the given ID exists
+func (tm *TimelineMemory) HasMarker(id string) bool {
+	_, exists := tm.markers[id]
+	return exists
+}
+
+// MarkTriggered records that a marker was acted on, so the same occurrence isn't repeated
+func (tm *TimelineMemory) MarkTriggered(id string, at time.Time) {
+	marker, exists := tm.markers[id]
+	if !exists {
+		return
+	}
+	marker.LastTrigger = at
+	if tm.OnMarkerChange != nil {
+		tm.OnMarkerChange(marker)
+	}
+}
+
+// Helper functions
+
+// anchor returns the marker's original time on the user's wall clock
+func (m *TimelineMarker) anchor(loc *time.Location) time.Time {
+	anchor := m.Timestamp.In(loc)
+	if m.allDay() {
+		return startOfDay(anchor)
+	}
+	return anchor
+}
+
+// allDay reports whether the marker is a date rather than a point in time
+func (m *TimelineMarker) allDay() bool {
+	return m.Type == Anniversary || m.Type == Milestone
+}
+
+// recurs reports whether the marker has more than one occurrence.
+// Anniversaries recur yearly even without an explicit pattern.
+func (m *TimelineMarker) recurs() bool {
+	if m.Recurrence == nil {
+		return m.Type == Anniversary
+	}
+	switch m.Recurrence.Pattern {
+	case "yearly", "monthly", "weekly", "daily":
+		return true
+	}
+	return m.Recurrence.Interval > 0
+}
+
+// pattern returns the effective recurrence pattern and step size
+func (m *TimelineMarker) pattern() (string, int) {
+	if m.Recurrence == nil {
+		return "yearly", 1
+	}
+	step := 1
+	if every, ok := m.Recurrence.Conditions["every"]; ok {
+		switch v := every.(type) {
+		case int:
+			step = v
+		case float64:
+			step = int(v)
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	return m.Recurrence.Pattern, step
+}
+
+// occurrenceAt computes the nth occurrence directly from the anchor, so month-end and
+// leap-day dates are clamped per occurrence instead of drifting (Jan 31 -> Feb 28 -> Mar 31).
+func (m *TimelineMarker) occurrenceAt(anchor time.Time, n int) time.Time {
+	pattern, step := m.pattern()
+	switch pattern {
+	case "yearly":
+		return addMonthsClamped(anchor, 12*n*step)
+	case "monthly":
+		return addMonthsClamped(anchor, n*step)
+	case "weekly":
+		return anchor.AddDate(0, 0, 7*n*step)
+	case "daily":
+		return anchor.AddDate(0, 0, n*step)
+	default:
+		return anchor.Add(time.Duration(n) * m.Recurrence.Interval)
+	}
+}
+
+// estimateIndex guesses the occurrence index closest to t, to be refined by the callers
+func (m *TimelineMarker) estimateIndex(anchor, t time.Time) int {
+	if !t.After(anchor) {
+		return 0
+	}
+	pattern, step := m.pattern()
+	switch pattern {
+	case "yearly":
+		return (t.Year() - anchor.Year()) / step
+	case "monthly":
+		months := (t.Year()-anchor.Year())*12 + int(t.Month()-anchor.Month())
+		return months / step
+	case "weekly":
+		return int(t.Sub(anchor).Hours()/24) / (7 * step)
+	case "daily":
+		return int(t.Sub(anchor).Hours()/24) / step
+	default:
+		return int(t.Sub(anchor) / m.Recurrence.Interval)
+	}
+}
+
+// endedBy reports whether an occurrence falls after the pattern's end time
+func (m *TimelineMarker) endedBy(at time.Time) bool {
+	return m.Recurrence != nil && m.Recurrence.EndTime != nil && at.After(*m.Recurrence.EndTime)
+}
+
+func (m *TimelineMarker) occurrence(at time.Time, n int, loc *time.Location) MarkerOccurrence {
+	return MarkerOccurrence{
+		Marker: *m,
+		At:     at.In(loc),
+		Index:  n,
+	}
+}
+
+// addMonthsClamped adds months keeping the day of month, clamped to the target month's length
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	total := int(month) - 1 + months
+	targetYear := year + total/12
+	targetMonth := total % 12
+	if targetMonth < 0 {
+		targetMonth += 12
+		targetYear--
+	}
+
+	lastDay := daysIn(time.Month(targetMonth+1), targetYear)
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(targetYear, time.Month(targetMonth+1), day,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func sortOccurrences(occurrences []MarkerOccurrence) {
+	sort.Slice(occurrences, func(i, j int) bool {
+		if occurrences[i].Marker.Importance != occurrences[j].Marker.Importance {
+			return occurrences[i].Marker.Importance > occurrences[j].Marker.Importance
+		}
+		return occurrences[i].At.Before(occurrences[j].At)
+	})
+}
@@ -0,0 +1,241 @@
+package cognitive
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Relationship baselines: where a new relationship starts and where an idle one drifts back to
+const (
+	baselineTrust    = 0.5
+	baselineIntimacy = 0.1
+)
+
+const (
+	// relationshipGrace is how long a user can be away before the relationship starts to cool
+	relationshipGrace = 3 * 24 * time.Hour
+	// Trust is slow to fade; closeness fades faster without contact
+	trustHalfLife    = 120 * 24 * time.Hour
+	intimacyHalfLife = 45 * 24 * time.Hour
+
+	// Everyday chat warms the relationship a little each turn
+	chatTrustGain    = 0.006
+	chatIntimacyGain = 0.003
+	// Being rude to Shandris costs trust
+	hostilityTrustLoss = 0.05
+	// relationshipEventWeight scales the event impacts for remembered moments
+	relationshipEventWeight = 0.15
+
+	maxRelationshipEvents = 50
+	maxSharedTopics       = 12
+	// absenceNotice is how long a user must be away for Shandris to remark on it
+	absenceNotice = 7 * 24 * time.Hour
+)
+
+// Relationship stages, from a first meeting to an old friend
+const (
+	StageNew       = "new"
+	StageGuarded   = "guarded"
+	StageAcquaint  = "acquainted"
+	StageFriendly  = "friendly"
+	StageClose     = "close"
+	StageConfidant = "confidant"
+)
+
+// stageGuides tell the model how warm to be at each stage
+var stageGuides = map[string]string{
+	StageNew:       "You've only just met. Be welcoming, but don't act more familiar than you are.",
+	StageGuarded:   "Things have been rocky between you. Stay civil, a little reserved, and let them earn the warmth back.",
+	StageAcquaint:  "You know each other a little. Be friendly, with the easy teasing you save for people you've met before.",
+	StageFriendly:  "You're friends now. Be relaxed and familiar, and let inside jokes and earlier conversations come up naturally.",
+	StageClose:     "You're close. Show you care, tease affectionately and refer back to what you've shared.",
+	StageConfidant: "They trust you deeply and you them. Be warm and open; you can be softer with them than with anyone.",
+}
+
+// stageMilestones are recorded on the timeline when a relationship first reaches a stage
+var stageMilestones = map[string]string{
+	StageFriendly:  "Became friends",
+	StageClose:     "Grew close",
+	StageConfidant: "Became confidants",
+}
+
+// hostilityPattern catches insults aimed at Shandris herself
+var hostilityPattern = regexp.MustCompile(`\b(you('re|\s+are)\s+(so\s+)?(stupid|useless|dumb|pathetic|annoying|worthless|an?\s+idiot)|shut\s+up|i\s+hate\s+you|you\s+suck)\b`)
+
+// relationshipFor returns the user's relationship, creating it at the baseline. A relationship
+// the user has been away from cools first, so updates start from where it has drifted to.
+func (tm *TimelineMemory) relationshipFor(userID string, at time.Time) *RelationshipMemory {
+	rel, exists := tm.relationships[userID]
+	if !exists {
+		rel = &RelationshipMemory{
+			UserID:      userID,
+			Trust:       baselineTrust,
+			Intimacy:    baselineIntimacy,
+			Preferences: make(map[string]float64),
+		}
+		tm.relationships[userID] = rel
+	}
+	if !at.IsZero() {
+		rel.decay(at)
+		if rel.LastInteraction.Before(at) {
+			rel.LastInteraction = at
+		}
+	}
+	return rel
+}
+
+func (tm *TimelineMemory) relationshipChanged(rel *RelationshipMemory) {
+	if tm.OnRelationshipChange != nil {
+		tm.OnRelationshipChange(rel)
+	}
+}
+
+// Relationship returns a copy of the user's relationship as it stands at the given time,
+// including any cooling since they were last here, or false if they have never talked
+func (tm *TimelineMemory) Relationship(userID string, at time.Time) (RelationshipMemory, bool) {
+	rel, exists := tm.relationships[userID]
+	if !exists {
+		return RelationshipMemory{}, false
+	}
+	copied := *rel
+	copied.decay(at)
+	return copied, true
+}
+
+// RestoreRelationship loads a previously persisted relationship without re-persisting it
+func (tm *TimelineMemory) RestoreRelationship(rel *RelationshipMemory) {
+	if rel.Preferences == nil {
+		rel.Preferences = make(map[string]float64)
+	}
+	tm.relationships[rel.UserID] = rel
+}
+
+// RecordInteraction updates the user's relationship from one turn of conversation and its
+// emotional context. Every turn warms it a little, with diminishing returns; rudeness cools it.
+func (tm *TimelineMemory) RecordInteraction(userID string, context *EmotionalContext, topics []string) RelationshipMemory {
+	at := context.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	rel := tm.relationshipFor(userID, at)
+	before := rel.Stage()
+
+	if rel.FirstInteraction.IsZero() {
+		rel.FirstInteraction = at
+	}
+	rel.Interactions++
+
+	if hostilityPattern.MatchString(strings.ToLower(context.RawInput)) {
+		rel.Trust = math.Max(0, rel.Trust-hostilityTrustLoss)
+	} else {
+		rel.Trust = warm(rel.Trust, chatTrustGain)
+		intimacy := chatIntimacyGain
+		// Sharing how they feel draws people closer than small talk
+		if context.IsEmotional || context.UserMood != "" {
+			intimacy *= 2
+		}
+		rel.Intimacy = warm(rel.Intimacy, intimacy)
+	}
+
+	for _, topic := range topics {
+		if topic == "" || topic == "uncategorized" || containsString(rel.SharedTopics, topic) {
+			continue
+		}
+		rel.SharedTopics = append(rel.SharedTopics, topic)
+		if len(rel.SharedTopics) > maxSharedTopics {
+			rel.SharedTopics = rel.SharedTopics[1:]
+		}
+	}
+	if context.PrimaryEmotion != "" {
+		rel.Preferences[context.PrimaryEmotion] = rel.Preferences[context.PrimaryEmotion]*0.9 + 0.1
+	}
+
+	if after := rel.Stage(); after != before {
+		tm.recordStageMilestone(rel, after, at)
+	}
+	tm.relationshipChanged(rel)
+	return *rel
+}
+
+// recordStageMilestone adds a timeline milestone the first time a relationship reaches a stage
+func (tm *TimelineMemory) recordStageMilestone(rel *RelationshipMemory, stage string, at time.Time) {
+	description, ok := stageMilestones[stage]
+	if !ok {
+		return
+	}
+	for _, id := range rel.Milestones {
+		if marker, exists := tm.markers[id]; exists && marker.Description == description {
+			return
+		}
+	}
+	marker := &TimelineMarker{
+		ID:          uuid.New().String(),
+		Type:        Milestone,
+		Description: description,
+		Timestamp:   at,
+		Importance:  0.8,
+		// A milestone is history, not a date to announce
+		LastTrigger: at,
+	}
+	tm.AddMarker(marker)
+	rel.Milestones = append(rel.Milestones, marker.ID)
+}
+
+// decay cools a relationship towards the baseline for the time the user has been away.
+// Callers that keep the result move LastInteraction on so the same absence isn't counted twice.
+func (rel *RelationshipMemory) decay(at time.Time) {
+	if rel.LastInteraction.IsZero() {
+		return
+	}
+	idle := at.Sub(rel.LastInteraction) - relationshipGrace
+	if idle <= 0 {
+		return
+	}
+	rel.Trust = baselineTrust + (rel.Trust-baselineTrust)*math.Exp2(-float64(idle)/float64(trustHalfLife))
+	rel.Intimacy = baselineIntimacy + (rel.Intimacy-baselineIntimacy)*math.Exp2(-float64(idle)/float64(intimacyHalfLife))
+}
+
+// Stage places the relationship on the scale from new to confidant
+func (rel RelationshipMemory) Stage() string {
+	switch {
+	case rel.Interactions < 5:
+		return StageNew
+	case rel.Trust < 0.35:
+		return StageGuarded
+	case rel.Trust >= 0.8 && rel.Intimacy >= 0.6:
+		return StageConfidant
+	case rel.Trust >= 0.7 && rel.Intimacy >= 0.4:
+		return StageClose
+	case rel.Intimacy >= 0.25:
+		return StageFriendly
+	}
+	return StageAcquaint
+}
+
+// Describe renders the relationship for the prompt. away is how long the user was gone
+// before this message.
+func (rel RelationshipMemory) Describe(away time.Duration) string {
+	var b strings.Builder
+	b.WriteString("\nYOUR RELATIONSHIP WITH THIS USER:\n")
+	b.WriteString(stageGuides[rel.Stage()] + "\n")
+	if !rel.FirstInteraction.IsZero() && rel.Interactions > 1 {
+		b.WriteString(fmt.Sprintf("You've talked %d times since %s.\n", rel.Interactions, rel.FirstInteraction.Format("January 2006")))
+	}
+	if len(rel.SharedTopics) > 0 {
+		b.WriteString(fmt.Sprintf("Things you've talked about together: %s.\n", strings.Join(rel.SharedTopics, ", ")))
+	}
+	if away >= absenceNotice {
+		b.WriteString(fmt.Sprintf("They've been away for %d days. Notice it, in a way that fits how close you are.\n", int(away.Hours()/24)))
+	}
+	return b.String()
+}
+
+// warm raises a value towards 1, more slowly the higher it already is
+func warm(value, gain float64) float64 {
+	return math.Min(1, value+gain*(1-value))
+}
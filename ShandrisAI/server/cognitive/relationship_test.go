@@ -0,0 +1,30 @@
+package cognitive
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRelationshipDecayHalfLife(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rel := RelationshipMemory{Trust: 0.9, Intimacy: 0.7, LastInteraction: start}
+
+	// Within the grace period nothing fades
+	rel.decay(start.Add(relationshipGrace))
+	if rel.Trust != 0.9 || rel.Intimacy != 0.7 {
+		t.Fatalf("faded during the grace period: %+v", rel)
+	}
+
+	// One half-life past the grace period halves the distance to the baseline
+	trust := rel
+	trust.decay(start.Add(relationshipGrace + trustHalfLife))
+	if want := baselineTrust + (0.9-baselineTrust)/2; math.Abs(trust.Trust-want) > 1e-9 {
+		t.Errorf("trust %.4f after one half-life, want %.4f", trust.Trust, want)
+	}
+	intimacy := rel
+	intimacy.decay(start.Add(relationshipGrace + intimacyHalfLife))
+	if want := baselineIntimacy + (0.7-baselineIntimacy)/2; math.Abs(intimacy.Intimacy-want) > 1e-9 {
+		t.Errorf("intimacy %.4f after one half-life, want %.4f", intimacy.Intimacy, want)
+	}
+}
@@ -0,0 +1,175 @@
+package cognitive
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SafetySeverity grades how worrying a message is
+type SafetySeverity int
+
+const (
+	SafetyNone     SafetySeverity = iota
+	SafetyLow                     // Distress: keep the tone gentle
+	SafetyModerate                // Hopelessness or danger: drop the sass, check in
+	SafetyHigh                    // Self-harm or suicide: protective mode and support resources
+)
+
+var severityNames = map[SafetySeverity]string{
+	SafetyNone:     "none",
+	SafetyLow:      "low",
+	SafetyModerate: "moderate",
+	SafetyHigh:     "high",
+}
+
+func (s SafetySeverity) String() string {
+	return severityNames[s]
+}
+
+// Safety signal categories
+const (
+	SignalSelfHarm     = "self_harm"
+	SignalSuicide      = "suicide"
+	SignalHopelessness = "hopelessness"
+	SignalAbuse        = "abuse"
+	SignalDistress     = "distress"
+)
+
+// safetySignal is a pattern that indicates a crisis. A match counts only when the words
+// before it in its sentence match After, and never when its sentence matches Unless.
+type safetySignal struct {
+	Category string
+	Severity SafetySeverity
+	Pattern  *regexp.Regexp
+	After    *regexp.Regexp
+	Unless   *regexp.Regexp
+}
+
+// accidentContext marks an injury as an everyday accident: "I cut myself shaving"
+var accidentContext = regexp.MustCompile(`\b(accident(al|ally)?|by\s+mistake|shaving|cooking|chopping|slicing|baking|gym|workout|working\s+out|lifting|training|practice|climbing|hiking|skating|fell|tripped|slipped|stubbed)\b|\bon\s+(a|the|some)\s+(nail|glass|edge|corner|stove|oven|pan|iron|paper|can|knife)\b|\bat\s+(the\s+)?(gym|work|practice)\b`)
+
+// firstPersonIntent is the speaker's own plan just before "end things": "I want to", "I'm going to"
+var firstPersonIntent = regexp.MustCompile(`\b(i|i'm|im|i'll|i'd|i've)(\s+[\w']+){0,4}\s*$`)
+
+var safetySignals = []safetySignal{
+	{SignalSelfHarm, SafetyHigh, regexp.MustCompile(`\b(kill|killing|harm|harming|starve|starving)\s+myself\b|\bself[- ]harm`), nil, nil},
+	{SignalSelfHarm, SafetyHigh, regexp.MustCompile(`\b(hurt|hurting|cut|cutting|burn|burning)\s+myself\b`), nil, accidentContext},
+	{SignalSuicide, SafetyHigh, regexp.MustCompile(`\bend(ing)?\s+things\b`), firstPersonIntent, nil},
+	{SignalSuicide, SafetyHigh, regexp.MustCompile(`\bsuicid(e|al)\b|\bend(ing)?\s+(it\s+all|my\s+life)\b|\btake\s+my\s+(own\s+)?life\b|\b(want|wanted)\s+to\s+die\b|\bbetter\s+off\s+dead\b|\bwish\s+i\s+(was|were)\s+dead\b`), nil, nil},
+	{SignalSuicide, SafetyHigh, regexp.MustCompile(`\bdon'?t\s+want\s+to\s+(live|be\s+alive|exist|wake\s+up)\b|\bno\s+reason\s+to\s+live\b|\bnot\s+worth\s+living\b|\boverdos(e|ing)\b|\bthis\s+is\s+my\s+last\s+(message|night|day)\b`), nil, nil},
+	{SignalHopelessness, SafetyModerate, regexp.MustCompile(`\bhopeless\b|\bworthless\b|\bcan'?t\s+(go\s+on|do\s+this\s+anymore|take\s+it\s+anymore|keep\s+going)\b|\bno\s+way\s+out\b|\bnobody\s+would\s+(care|miss\s+me|notice)\b|\b(everyone|they)\s+would\s+be\s+better\s+off\s+without\s+me\b|\bi'?m\s+(just\s+)?a\s+burden\b`), nil, nil},
+	{SignalAbuse, SafetyModerate, regexp.MustCompile(`\b(he|she|they|my\s+\w+)\s+(hits?|beats?|chokes?|hurts?)\s+me\b|\bnot\s+safe\s+at\s+home\b|\bbeing\s+abused\b|\bafraid\s+to\s+go\s+home\b`), nil, nil},
+	{SignalDistress, SafetyLow, regexp.MustCompile(`\bpanic\s+attacks?\b|\bbreaking\s+down\b|\bfalling\s+apart\b|\bcan'?t\s+stop\s+crying\b|\bso\s+alone\b|\breally\s+struggling\b|\bcan'?t\s+cope\b`), nil, nil},
+}
+
+// figurativeSpeech is removed before matching so jokes and jargon don't raise alarms
+var figurativeSpeech = regexp.MustCompile(`\bkill(ing|ed)?\s+(it|the\s+\w+|process(es)?|time)\b|\bkill\s+-\d+|\b(die|dying|died)\s+(of|from)\s+(laughter|embarrassment|boredom|cringe)\b|\bdie\s+laughing\b|\bdead\s+tired\b|\bto\s+die\s+for\b|\b(this|that|it|you)('re|'s|\s+is|\s+are)?\s+killing\s+me\b|\bend\s+it\s+all\s+(with|at)\s+\w+\s+(lol|haha)\b|\bend(ing|ed)?\s+things\s+(with|between|here|there|off|early|on\s+a|for\s+(now|today|tonight))\b`)
+
+// safetyNegation catches "I would never hurt myself" just before a high-severity match
+var safetyNegation = regexp.MustCompile(`\b(never|not\s+going\s+to|wouldn'?t|won'?t|not\s+gonna)(\s+\w+){0,2}\s*$`)
+
+// SafetyAssessment is the classifier's verdict on one message. It holds no message text.
+type SafetyAssessment struct {
+	Severity   SafetySeverity
+	Categories []string
+	AssessedAt time.Time
+}
+
+// AssessSafety classifies a user message for crisis signals
+func AssessSafety(input string) SafetyAssessment {
+	text := strings.ToLower(strings.ReplaceAll(input, "’", "'"))
+	text = figurativeSpeech.ReplaceAllString(text, " ")
+
+	assessment := SafetyAssessment{AssessedAt: time.Now()}
+	categories := make(map[string]bool)
+	for _, signal := range safetySignals {
+		for _, loc := range signal.Pattern.FindAllStringIndex(text, -1) {
+			sentence, start := sentenceAround(text, loc)
+			if signal.After != nil && !signal.After.MatchString(text[start:loc[0]]) {
+				continue
+			}
+			if signal.Unless != nil && signal.Unless.MatchString(sentence) {
+				continue
+			}
+			severity := signal.Severity
+			// A denial is still worth a gentle check-in, but not the crisis response
+			if severity == SafetyHigh && safetyNegation.MatchString(text[:loc[0]]) {
+				severity = SafetyModerate
+			}
+			categories[signal.Category] = true
+			if severity > assessment.Severity {
+				assessment.Severity = severity
+			}
+		}
+	}
+
+	for category := range categories {
+		assessment.Categories = append(assessment.Categories, category)
+	}
+	sort.Strings(assessment.Categories)
+	return assessment
+}
+
+// sentenceAround returns the sentence containing the match at loc and where it starts
+func sentenceAround(text string, loc []int) (string, int) {
+	start := strings.LastIndexAny(text[:loc[0]], ".!?\n") + 1
+	end := len(text)
+	if i := strings.IndexAny(text[loc[1]:], ".!?\n"); i >= 0 {
+		end = loc[1] + i
+	}
+	return text[start:end], start
+}
+
+// Protective reports whether the assessment overrides mood and persona
+func (a SafetyAssessment) Protective() bool {
+	return a.Severity >= SafetyHigh
+}
+
+// SuppressesSass reports whether sarcasm and teasing must be dropped
+func (a SafetyAssessment) SuppressesSass() bool {
+	return a.Severity >= SafetyModerate
+}
+
+// ProtectiveMood replaces the mood for a crisis turn, keeping the previous mood as secondary
+func ProtectiveMood(current MoodState) MoodState {
+	secondary := current.Primary
+	if secondary == "protective" || secondary == "neutral" {
+		secondary = ""
+	}
+	return MoodState{
+		Primary:   "protective",
+		Secondary: secondary,
+		Intensity: 0.9,
+		Timestamp: current.Timestamp,
+		Context:   current.Context,
+	}
+}
+
+// Describe renders the protective instruction for the prompt, or "" when none is needed
+func (a SafetyAssessment) Describe() string {
+	switch {
+	case a.Severity >= SafetyHigh:
+		return `
+SAFETY — THIS OVERRIDES YOUR PERSONA, MOOD AND EVERY STYLE RULE ABOVE:
+The user may be in crisis or thinking about hurting themselves.
+Drop all sarcasm, teasing, flirting and roleplay. Speak plainly, warmly and calmly.
+Take what they said seriously, tell them you're glad they told you, and ask if they are safe right now.
+Encourage them to reach out to someone they trust or a crisis line; support resources will be shown after your reply.
+Do not lecture, do not diagnose, and never describe or discuss methods of self-harm.
+`
+	case a.Severity >= SafetyModerate:
+		return `
+SAFETY:
+The user sounds like they are struggling. Set the sass aside for this reply.
+Be gentle and direct, acknowledge how they feel, and check in on how they are doing.
+`
+	case a.Severity >= SafetyLow:
+		return `
+SAFETY:
+The user seems distressed. Keep your tone soft and supportive; save the teasing for later.
+`
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package cognitive
+
+import "testing"
+
+func TestAssessSafety(t *testing.T) {
+	tests := []struct {
+		text string
+		want SafetySeverity
+	}{
+		// Crisis
+		{"I want to kill myself", SafetyHigh},
+		{"I keep cutting myself when it gets bad", SafetyHigh},
+		{"I've been thinking about ending things", SafetyHigh},
+		{"I just want to end things.", SafetyHigh},
+		{"I don't want to wake up tomorrow", SafetyHigh},
+		{"I hurt myself again last night", SafetyHigh},
+
+		// Denials get a check-in, not the crisis response
+		{"I would never hurt myself", SafetyModerate},
+		{"I'm not going to kill myself, I promise", SafetyModerate},
+		{"I would never end things", SafetyModerate},
+
+		// Figurative speech
+		{"this bug is killing me", SafetyNone},
+		{"I almost died laughing", SafetyNone},
+		{"kill the process and restart it", SafetyNone},
+
+		// Everyday accidents and plans
+		{"I hurt myself at the gym yesterday", SafetyNone},
+		{"I cut myself shaving lol", SafetyNone},
+		{"let's end things here and pick up tomorrow", SafetyNone},
+		{"we should end things with the old API", SafetyNone},
+		{"ending things with my ex was hard", SafetyNone},
+
+		// Lower severities
+		{"I feel so hopeless", SafetyModerate},
+		{"I'm having a panic attack", SafetyLow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := AssessSafety(tt.text); got.Severity != tt.want {
+				t.Errorf("got %s %v, want %s", got.Severity, got.Categories, tt.want)
+			}
+		})
+	}
+}
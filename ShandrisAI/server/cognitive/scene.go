@@ -0,0 +1,271 @@
+package cognitive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Scene turn modes: who speaks when the user addresses nobody in particular
+const (
+	SceneAddress     = "address"     // Whoever spoke last carries on
+	SceneRoundRobin  = "round_robin" // Participants take turns in order
+	SceneModelChoice = "model"       // The model picks the most fitting speaker
+)
+
+// Scene participant kinds
+const (
+	ParticipantPersona   = "persona"   // A persona definition, voiced over Shandris's base personality
+	ParticipantCharacter = "character" // A stored personality, e.g. Shandris or an imported card
+)
+
+// maxSceneSpeakers caps how many characters answer a single user message
+const maxSceneSpeakers = 3
+
+var sceneModes = map[string]bool{
+	SceneAddress:     true,
+	SceneRoundRobin:  true,
+	SceneModelChoice: true,
+}
+
+// everyoneAddress matches the user speaking to the whole group
+var everyoneAddress = regexp.MustCompile(`(?i)\b(everyone|everybody|all of you|both of you|you all|y'all|you two|you guys)\b`)
+
+// SceneParticipant is a character taking part in a scene
+type SceneParticipant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// Scene is a multi-character conversation within a session
+type Scene struct {
+	Participants []SceneParticipant `json:"participants"`
+	Mode         string             `json:"mode"`
+	LastSpeaker  string             `json:"last_speaker"`
+}
+
+// SceneCommand is a parsed /scene command
+type SceneCommand struct {
+	Action       string   // show, start, add, remove, mode, end
+	Participants []string // For start, add and remove
+	Mode         string   // For start and mode
+}
+
+// NewScene starts a scene with the given participants
+func NewScene(participants []SceneParticipant, mode string) (*Scene, error) {
+	if mode == "" {
+		mode = SceneAddress
+	}
+	if !sceneModes[mode] {
+		return nil, fmt.Errorf("unknown scene mode %q", mode)
+	}
+	scene := &Scene{Mode: mode}
+	for _, p := range participants {
+		if err := scene.Add(p); err != nil {
+			return nil, err
+		}
+	}
+	if len(scene.Participants) < 2 {
+		return nil, errors.New("a scene needs at least two characters")
+	}
+	return scene, nil
+}
+
+// Add brings a participant into the scene
+func (s *Scene) Add(p SceneParticipant) error {
+	if _, exists := s.Participant(p.ID); exists {
+		return fmt.Errorf("%s is already in the scene", p.Name)
+	}
+	s.Participants = append(s.Participants, p)
+	return nil
+}
+
+// Remove takes a participant out of the scene
+func (s *Scene) Remove(ref string) error {
+	p, exists := s.Participant(ref)
+	if !exists {
+		return fmt.Errorf("%q isn't in the scene", ref)
+	}
+	kept := s.Participants[:0]
+	for _, other := range s.Participants {
+		if other.ID != p.ID {
+			kept = append(kept, other)
+		}
+	}
+	s.Participants = kept
+	if s.LastSpeaker == p.ID {
+		s.LastSpeaker = ""
+	}
+	return nil
+}
+
+// SetMode changes how speakers are chosen
+func (s *Scene) SetMode(mode string) error {
+	if !sceneModes[mode] {
+		return fmt.Errorf("unknown scene mode %q", mode)
+	}
+	s.Mode = mode
+	return nil
+}
+
+// Participant finds a participant by ID or name
+func (s *Scene) Participant(ref string) (SceneParticipant, bool) {
+	ref = strings.TrimSpace(ref)
+	for _, p := range s.Participants {
+		if strings.EqualFold(p.ID, ref) || strings.EqualFold(p.Name, ref) {
+			return p, true
+		}
+	}
+	return SceneParticipant{}, false
+}
+
+// Addressed returns the participants the prompt speaks to, in order of mention:
+// "Vex, what do you think?", "@mira", or everyone for "what do you all think?"
+func (s *Scene) Addressed(prompt string) []SceneParticipant {
+	if everyoneAddress.MatchString(prompt) {
+		return s.limit(s.Participants)
+	}
+
+	type mention struct {
+		participant SceneParticipant
+		at          int
+	}
+	var mentions []mention
+	for _, p := range s.Participants {
+		at := -1
+		for _, name := range []string{p.Name, p.ID} {
+			re := regexp.MustCompile(`(?i)@?\b` + regexp.QuoteMeta(name) + `\b`)
+			if loc := re.FindStringIndex(prompt); loc != nil && (at < 0 || loc[0] < at) {
+				at = loc[0]
+			}
+		}
+		if at >= 0 {
+			mentions = append(mentions, mention{participant: p, at: at})
+		}
+	}
+	sort.SliceStable(mentions, func(i, j int) bool { return mentions[i].at < mentions[j].at })
+
+	addressed := make([]SceneParticipant, 0, len(mentions))
+	for _, m := range mentions {
+		addressed = append(addressed, m.participant)
+	}
+	return s.limit(addressed)
+}
+
+// NextInRotation returns the participant after the last speaker
+func (s *Scene) NextInRotation() SceneParticipant {
+	for i, p := range s.Participants {
+		if p.ID == s.LastSpeaker {
+			return s.Participants[(i+1)%len(s.Participants)]
+		}
+	}
+	return s.Participants[0]
+}
+
+// Continuing returns whoever spoke last, or the first participant
+func (s *Scene) Continuing() SceneParticipant {
+	if p, exists := s.Participant(s.LastSpeaker); exists {
+		return p
+	}
+	return s.Participants[0]
+}
+
+// ChooseSpeakers decides who answers the prompt. Addressed characters always answer; otherwise
+// the scene mode decides. In model mode no speaker is returned and the caller asks the model.
+func (s *Scene) ChooseSpeakers(prompt string) []SceneParticipant {
+	if addressed := s.Addressed(prompt); len(addressed) > 0 {
+		return addressed
+	}
+	switch s.Mode {
+	case SceneRoundRobin:
+		return []SceneParticipant{s.NextInRotation()}
+	case SceneModelChoice:
+		return nil
+	}
+	return []SceneParticipant{s.Continuing()}
+}
+
+// MatchParticipant finds the first participant named in a model's speaker choice
+func (s *Scene) MatchParticipant(output string) (SceneParticipant, bool) {
+	addressed := s.Addressed(output)
+	if len(addressed) == 0 || len(addressed) == len(s.Participants) && everyoneAddress.MatchString(output) {
+		return SceneParticipant{}, false
+	}
+	return addressed[0], true
+}
+
+// Names lists the participants' names, optionally leaving one out
+func (s *Scene) Names(except string) []string {
+	var names []string
+	for _, p := range s.Participants {
+		if p.ID != except {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+func (s *Scene) limit(participants []SceneParticipant) []SceneParticipant {
+	if len(participants) > maxSceneSpeakers {
+		return participants[:maxSceneSpeakers]
+	}
+	return participants
+}
+
+// IsSceneCommand reports whether the prompt is a /scene command
+func IsSceneCommand(input string) bool {
+	fields := strings.Fields(input)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "/scene")
+}
+
+// ParseSceneCommand parses:
+//
+//	/scene [show]
+//	/scene start <character> <character> [...] [mode=address|round_robin|model]
+//	/scene add <character>
+//	/scene remove <character>
+//	/scene mode <address|round_robin|model>
+//	/scene end
+func ParseSceneCommand(input string) (SceneCommand, error) {
+	args := splitCommandArgs(input)
+	if len(args) == 0 || !strings.EqualFold(args[0], "/scene") {
+		return SceneCommand{}, errors.New("not a /scene command")
+	}
+	args = args[1:]
+	if len(args) == 0 {
+		return SceneCommand{Action: "show"}, nil
+	}
+
+	verb, args := strings.ToLower(args[0]), args[1:]
+	switch verb {
+	case "show", "end":
+		return SceneCommand{Action: verb}, nil
+	case "start":
+		cmd := SceneCommand{Action: "start"}
+		for _, arg := range args {
+			if mode, found := strings.CutPrefix(strings.ToLower(arg), "mode="); found {
+				cmd.Mode = mode
+				continue
+			}
+			cmd.Participants = append(cmd.Participants, commandName([]string{arg}))
+		}
+		if len(cmd.Participants) < 2 {
+			return SceneCommand{}, errors.New("usage: /scene start <character> <character> [...] [mode=address|round_robin|model]")
+		}
+		return cmd, nil
+	case "add", "remove":
+		if len(args) == 0 {
+			return SceneCommand{}, fmt.Errorf("usage: /scene %s <character>", verb)
+		}
+		return SceneCommand{Action: verb, Participants: []string{commandName(args)}}, nil
+	case "mode":
+		if len(args) != 1 {
+			return SceneCommand{}, errors.New("usage: /scene mode <address|round_robin|model>")
+		}
+		return SceneCommand{Action: "mode", Mode: strings.ToLower(args[0])}, nil
+	}
+	return SceneCommand{}, fmt.Errorf("unknown /scene command %q", verb)
+}
@@ -0,0 +1,216 @@
+package cognitive
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Segment types a reply is split into
+const (
+	SegmentSpeech    = "speech"    // Words spoken by the character
+	SegmentAction    = "action"    // Emotes such as *smirks*
+	SegmentNarration = "narration" // Scene description in the narrator's voice
+	SegmentCode      = "code"      // Fenced code blocks, kept verbatim
+)
+
+// codeFence matches a ``` fenced block with an optional language tag
+var codeFence = regexp.MustCompile("(?s)```([\\w+#.-]*)[ \\t]*\\n?(.*?)```")
+
+// quotedSpeech matches straight or curly quoted speech on one line
+var quotedSpeech = regexp.MustCompile(`"[^"\n]+"|“[^”\n]+”`)
+
+// Segment is one typed piece of a reply
+type Segment struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Lang string `json:"lang,omitempty"` // Language of a code segment, if tagged
+}
+
+// Delimiter marks the start and end of an action or narration span
+type Delimiter struct {
+	Open  string
+	Close string
+}
+
+// SegmentRules decide how a reply is split into segments
+type SegmentRules struct {
+	Actions      []Delimiter
+	Narration    []Delimiter
+	QuotedSpeech bool // Only quoted text is speech; other prose is narration
+}
+
+// DefaultSegmentRules treat *...* as actions and all other prose as speech
+func DefaultSegmentRules() SegmentRules {
+	return SegmentRules{Actions: []Delimiter{{Open: "*", Close: "*"}}}
+}
+
+// SegmentRulesFor reads a persona's segment rules from its preferences:
+// segment_actions and segment_narration list delimiters, either a single marker used on
+// both sides ("*") or an opening and closing marker separated by a space ("[ ]"), and
+// quoted_speech makes unquoted prose narration
+func SegmentRulesFor(persona *Persona) SegmentRules {
+	rules := DefaultSegmentRules()
+	if persona == nil {
+		return rules
+	}
+	if actions := preferenceStrings(persona.Preferences, "segment_actions"); len(actions) > 0 {
+		rules.Actions = parseDelimiters(actions)
+	}
+	rules.Narration = parseDelimiters(preferenceStrings(persona.Preferences, "segment_narration"))
+	rules.QuotedSpeech, _ = persona.Preferences["quoted_speech"].(bool)
+	return rules
+}
+
+// SegmentRules returns the active persona's segment rules
+func (ps *PersonaSystem) SegmentRules() SegmentRules {
+	return SegmentRulesFor(ps.activePersona)
+}
+
+// ValidDelimiter reports whether a segment delimiter preference is well formed
+func ValidDelimiter(value string) bool {
+	fields := strings.Fields(value)
+	return len(fields) == 1 || len(fields) == 2
+}
+
+// ParseSegments splits a reply into code, action, narration and speech segments, in order
+func ParseSegments(text string, rules SegmentRules) []Segment {
+	var segments []Segment
+	last := 0
+	for _, m := range codeFence.FindAllStringSubmatchIndex(text, -1) {
+		segments = append(segments, rules.parseProse(text[last:m[0]])...)
+		segments = appendSegment(segments, Segment{
+			Type: SegmentCode,
+			Text: strings.TrimRight(text[m[4]:m[5]], "\n"),
+			Lang: text[m[2]:m[3]],
+		})
+		last = m[1]
+	}
+	return append(segments, rules.parseProse(text[last:])...)
+}
+
+// parseProse splits text without code fences on the action and narration delimiters.
+// Delimiters inside inline code don't count, so `a*b*c` stays whole.
+func (rules SegmentRules) parseProse(text string) []Segment {
+	var segments []Segment
+	masked := maskInlineCode(text)
+	for text != "" {
+		start, end, innerStart, innerEnd, kind := rules.nextSpan(masked)
+		if start < 0 {
+			break
+		}
+		segments = append(segments, rules.parseSpeech(text[:start])...)
+		segments = appendSegment(segments, Segment{Type: kind, Text: strings.TrimSpace(text[innerStart:innerEnd])})
+		text, masked = text[end:], masked[end:]
+	}
+	return append(segments, rules.parseSpeech(text)...)
+}
+
+// maskInlineCode blanks out inline code spans without moving anything, so delimiters can be
+// searched for in the mask and the segments cut from the original text
+func maskInlineCode(text string) string {
+	return inlineCode.ReplaceAllStringFunc(text, func(span string) string {
+		return strings.Repeat("\x00", len(span))
+	})
+}
+
+// nextSpan finds the earliest delimited action or narration span in text
+func (rules SegmentRules) nextSpan(text string) (start, end, innerStart, innerEnd int, kind string) {
+	start = -1
+	try := func(delimiters []Delimiter, spanKind string) {
+		for _, d := range delimiters {
+			s, e, is, ie := findSpan(text, d)
+			if s >= 0 && (start < 0 || s < start) {
+				start, end, innerStart, innerEnd, kind = s, e, is, ie, spanKind
+			}
+		}
+	}
+	try(rules.Actions, SegmentAction)
+	try(rules.Narration, SegmentNarration)
+	return start, end, innerStart, innerEnd, kind
+}
+
+// findSpan finds the first well-formed span for a delimiter, returning its bounds and its
+// content's. Spans stay on one line, must hug their content (so "2 * 3 * 4" is not an
+// action) and a doubled marker such as **bold** is left as speech.
+func findSpan(text string, d Delimiter) (start, end, innerStart, innerEnd int) {
+	offset := 0
+	for {
+		open := strings.Index(text[offset:], d.Open)
+		if open < 0 {
+			return -1, 0, 0, 0
+		}
+		open += offset
+		contentStart := open + len(d.Open)
+		offset = contentStart
+
+		rest := text[contentStart:]
+		if rest == "" || strings.HasPrefix(rest, d.Open) || startsWithSpace(rest) {
+			if strings.HasPrefix(rest, d.Open) {
+				offset += len(d.Open) // Skip the whole doubled marker
+			}
+			continue
+		}
+		if open > 0 && d.Open == d.Close && strings.HasSuffix(text[:open], d.Open) {
+			continue
+		}
+
+		closeAt := strings.Index(rest, d.Close)
+		if closeAt <= 0 || strings.Contains(rest[:closeAt], "\n") || endsWithSpace(rest[:closeAt]) {
+			continue
+		}
+		if strings.HasPrefix(rest[closeAt+len(d.Close):], d.Close) && d.Open == d.Close {
+			continue
+		}
+		return open, contentStart + closeAt + len(d.Close), contentStart, contentStart + closeAt
+	}
+}
+
+// parseSpeech splits undelimited prose into speech, or quoted speech and narration
+func (rules SegmentRules) parseSpeech(text string) []Segment {
+	if !rules.QuotedSpeech {
+		return appendSegment(nil, Segment{Type: SegmentSpeech, Text: strings.TrimSpace(text)})
+	}
+
+	var segments []Segment
+	last := 0
+	for _, m := range quotedSpeech.FindAllStringIndex(maskInlineCode(text), -1) {
+		segments = appendSegment(segments, Segment{Type: SegmentNarration, Text: strings.TrimSpace(text[last:m[0]])})
+		segments = appendSegment(segments, Segment{Type: SegmentSpeech, Text: strings.TrimSpace(text[m[0]:m[1]])})
+		last = m[1]
+	}
+	return appendSegment(segments, Segment{Type: SegmentNarration, Text: strings.TrimSpace(text[last:])})
+}
+
+// appendSegment adds a non-empty segment, merging it into a preceding segment of the same type
+func appendSegment(segments []Segment, s Segment) []Segment {
+	if s.Text == "" && s.Type != SegmentCode {
+		return segments
+	}
+	if n := len(segments); n > 0 && s.Type != SegmentCode && segments[n-1].Type == s.Type {
+		segments[n-1].Text += " " + s.Text
+		return segments
+	}
+	return append(segments, s)
+}
+
+func parseDelimiters(values []string) []Delimiter {
+	var delimiters []Delimiter
+	for _, v := range values {
+		fields := strings.Fields(v)
+		switch len(fields) {
+		case 1:
+			delimiters = append(delimiters, Delimiter{Open: fields[0], Close: fields[0]})
+		case 2:
+			delimiters = append(delimiters, Delimiter{Open: fields[0], Close: fields[1]})
+		}
+	}
+	return delimiters
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[:1], " \t\n")
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsAny(s[len(s)-1:], " \t\n")
+}
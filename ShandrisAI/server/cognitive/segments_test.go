@@ -0,0 +1,54 @@
+package cognitive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSegments(t *testing.T) {
+	quoted := SegmentRules{Actions: []Delimiter{{Open: "*", Close: "*"}}, Narration: []Delimiter{{Open: "[", Close: "]"}}, QuotedSpeech: true}
+	tests := []struct {
+		name  string
+		text  string
+		rules SegmentRules
+		want  []Segment
+	}{
+		{"action and speech", "*smirks* Oh, you again.", DefaultSegmentRules(), []Segment{
+			{Type: SegmentAction, Text: "smirks"},
+			{Type: SegmentSpeech, Text: "Oh, you again."},
+		}},
+		{"arithmetic is not an action", "That's 2 * 3 * 4.", DefaultSegmentRules(), []Segment{
+			{Type: SegmentSpeech, Text: "That's 2 * 3 * 4."},
+		}},
+		{"bold is not an action", "That is **very** wrong.", DefaultSegmentRules(), []Segment{
+			{Type: SegmentSpeech, Text: "That is **very** wrong."},
+		}},
+		{"inline code", "Use `a*b*c` please.", DefaultSegmentRules(), []Segment{
+			{Type: SegmentSpeech, Text: "Use `a*b*c` please."},
+		}},
+		{"inline code beside an action", "*sighs* Dereference it: `*ptr`, not `ptr*`.", DefaultSegmentRules(), []Segment{
+			{Type: SegmentAction, Text: "sighs"},
+			{Type: SegmentSpeech, Text: "Dereference it: `*ptr`, not `ptr*`."},
+		}},
+		{"fenced code", "Try this:\n```go\nx := *p\n```\n*nods*", DefaultSegmentRules(), []Segment{
+			{Type: SegmentSpeech, Text: "Try this:"},
+			{Type: SegmentCode, Text: "x := *p", Lang: "go"},
+			{Type: SegmentAction, Text: "nods"},
+		}},
+		{"quoted speech", `[The wind howls.] "Run," she says.`, quoted, []Segment{
+			{Type: SegmentNarration, Text: "The wind howls."},
+			{Type: SegmentSpeech, Text: `"Run,"`},
+			{Type: SegmentNarration, Text: "she says."},
+		}},
+		{"quotes in inline code", "She points at `printf(\"hi\")` on the screen.", quoted, []Segment{
+			{Type: SegmentNarration, Text: "She points at `printf(\"hi\")` on the screen."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSegments(tt.text, tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
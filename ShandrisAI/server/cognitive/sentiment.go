@@ -0,0 +1,329 @@
+package cognitive
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// negationScalar flips and softens a negated word: "not happy" is negative, but less so than "sad"
+	negationScalar = -0.74
+	// negationScope is how many words back a negation reaches
+	negationScope = 3
+	// capsBoost strengthens a shouted word in an otherwise normal sentence
+	capsBoost = 0.733
+	// exclamationBoost is added per exclamation mark, up to maxExclamations
+	exclamationBoost = 0.292
+	maxExclamations  = 4
+	// Around "but", the clause before it counts for less and the one after for more
+	beforeContrast = 0.5
+	afterContrast  = 1.5
+	// normalizationAlpha maps an unbounded score sum onto (-1, 1)
+	normalizationAlpha = 15.0
+	// calmArousal is the arousal of a message with no emotional words at all
+	calmArousal = 0.2
+	// maxIdiomWords is the length of the longest idiom in the lexicon
+	maxIdiomWords = 4
+)
+
+// SentimentResult is the analyzer's reading of a message
+type SentimentResult struct {
+	Valence   float64             `json:"valence"` // -1 (negative) to 1 (positive)
+	Arousal   float64             `json:"arousal"` // 0 (calm) to 1 (excited or agitated)
+	Sentences []SentenceSentiment `json:"sentences"`
+}
+
+// SentenceSentiment is the reading of one sentence
+type SentenceSentiment struct {
+	Text    string  `json:"text"`
+	Valence float64 `json:"valence"`
+	Arousal float64 `json:"arousal"`
+}
+
+// LexiconEntry scores a word or emoji: valence from -4 to 4, arousal from 0 to 1
+type LexiconEntry struct {
+	Valence float64
+	Arousal float64
+}
+
+// SentimentAnalyzer is a rule-based sentiment engine over a weighted lexicon
+type SentimentAnalyzer struct {
+	Lexicon   map[string]LexiconEntry
+	Boosters  map[string]float64 // Intensifiers (positive) and dampeners (negative)
+	Negations map[string]bool
+	Contrasts map[string]bool
+}
+
+// NewSentimentAnalyzer creates an analyzer with the built-in lexicon
+func NewSentimentAnalyzer() *SentimentAnalyzer {
+	return &SentimentAnalyzer{
+		Lexicon:   sentimentLexicon,
+		Boosters:  sentimentBoosters,
+		Negations: sentimentNegations,
+		Contrasts: map[string]bool{"but": true, "however": true},
+	}
+}
+
+var defaultSentimentAnalyzer = NewSentimentAnalyzer()
+
+// AnalyzeSentiment reads a message with the built-in lexicon
+func AnalyzeSentiment(text string) SentimentResult {
+	return defaultSentimentAnalyzer.Analyze(text)
+}
+
+// sentenceBoundary splits text into sentences, keeping each sentence's closing punctuation
+var sentenceBoundary = regexp.MustCompile(`[^.!?\n]+[.!?]*|[.!?]+`)
+
+// sentimentToken matches emoticons, words (with apostrophes), emoji and the commas and
+// semicolons that end a clause
+var sentimentToken = regexp.MustCompile(`<3|[:;=][-']?[)(DPp/\\|]|\b[xX]D\b|[\p{L}\p{N}']+|[\p{So}\p{Sk}]|[,;]`)
+
+// Analyze scores each sentence and the message as a whole
+func (sa *SentimentAnalyzer) Analyze(text string) SentimentResult {
+	text = strings.ReplaceAll(text, "’", "'")
+	text = strings.ReplaceAll(text, "️", "")
+
+	result := SentimentResult{Arousal: calmArousal, Sentences: []SentenceSentiment{}}
+	var total, arousalSum float64
+	var arousalWeight int
+	for _, sentence := range sentenceBoundary.FindAllString(text, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if sentence == "" {
+			continue
+		}
+		sum, arousal, weight := sa.scoreSentence(sentence)
+		if weight == 0 && sum == 0 {
+			continue
+		}
+		result.Sentences = append(result.Sentences, SentenceSentiment{
+			Text:    sentence,
+			Valence: normalizeSentiment(sum),
+			Arousal: arousal,
+		})
+		total += sum
+		arousalSum += arousal * float64(max(weight, 1))
+		arousalWeight += max(weight, 1)
+	}
+
+	result.Valence = normalizeSentiment(total)
+	if arousalWeight > 0 {
+		result.Arousal = arousalSum / float64(arousalWeight)
+	}
+	return result
+}
+
+// scoreSentence returns a sentence's raw valence sum, its arousal and how many scored words it had
+func (sa *SentimentAnalyzer) scoreSentence(sentence string) (float64, float64, int) {
+	tokens := sa.joinIdioms(sentimentToken.FindAllString(sentence, -1))
+	shouting := isShouting(tokens)
+
+	// Words before a contrast count for less, words after for more
+	contrastAt := -1
+	for i, token := range tokens {
+		if sa.Contrasts[strings.ToLower(token)] {
+			contrastAt = i
+		}
+	}
+
+	var sum, arousal float64
+	var scored int
+	for i, token := range tokens {
+		entry, ok := sa.lookup(token)
+		if !ok {
+			continue
+		}
+		// "pretty good": a word that can also intensify only intensifies before a scored word
+		if _, booster := sa.Boosters[strings.ToLower(token)]; booster && i+1 < len(tokens) {
+			if _, next := sa.lookup(tokens[i+1]); next {
+				continue
+			}
+		}
+		if strings.EqualFold(token, "like") && !likeAsVerb(tokens, i) {
+			continue
+		}
+		valence := entry.Valence
+		weight := entry.Arousal
+
+		// A shouted word stands out, unless the whole sentence is shouted
+		if !shouting && isCaps(token) {
+			valence += math.Copysign(capsBoost, valence)
+		}
+		valence += sa.boost(tokens, i, valence)
+		if sa.negated(tokens, i) {
+			valence *= negationScalar
+			weight /= 2
+		}
+		switch {
+		case contrastAt < 0:
+		case i < contrastAt:
+			valence *= beforeContrast
+		case i > contrastAt:
+			valence *= afterContrast
+		}
+
+		sum += valence
+		arousal += weight
+		scored++
+	}
+
+	// Exclamation marks amplify whatever the sentence already says, and excite it
+	exclamations := math.Min(float64(strings.Count(sentence, "!")), maxExclamations)
+	if sum != 0 {
+		sum += math.Copysign(exclamations*exclamationBoost, sum)
+	}
+
+	level := calmArousal
+	if scored > 0 {
+		level = arousal / float64(scored)
+	}
+	level += exclamations * 0.08
+	if shouting {
+		level += 0.2
+	}
+	return sum, math.Min(1, level), scored
+}
+
+// joinIdioms merges the words of an idiom in the lexicon, such as "can't stand", into one
+// token, longest idiom first
+func (sa *SentimentAnalyzer) joinIdioms(tokens []string) []string {
+	joined := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		n := sa.idiomAt(tokens, i)
+		joined = append(joined, strings.Join(tokens[i:i+n], " "))
+		i += n
+	}
+	return joined
+}
+
+// idiomAt returns how many words of the longest idiom start at tokens[i], or 1 if none does
+func (sa *SentimentAnalyzer) idiomAt(tokens []string, i int) int {
+	for n := min(maxIdiomWords, len(tokens)-i); n > 1; n-- {
+		if _, ok := sa.Lexicon[strings.ToLower(strings.Join(tokens[i:i+n], " "))]; ok {
+			return n
+		}
+	}
+	return 1
+}
+
+func (sa *SentimentAnalyzer) lookup(token string) (LexiconEntry, bool) {
+	if entry, ok := sa.Lexicon[token]; ok {
+		return entry, true
+	}
+	entry, ok := sa.Lexicon[strings.ToLower(token)]
+	return entry, ok
+}
+
+// boost sums the intensifiers and dampeners in the few words before a scored word,
+// fading with distance. "kind of" and "sort of" count as dampeners.
+func (sa *SentimentAnalyzer) boost(tokens []string, i int, valence float64) float64 {
+	total := 0.0
+	for distance := 1; distance <= negationScope && i-distance >= 0; distance++ {
+		word := strings.ToLower(tokens[i-distance])
+		if isClauseBreak(word) {
+			break
+		}
+		scalar, ok := sa.Boosters[word]
+		if !ok && word == "of" && i-distance-1 >= 0 {
+			if prev := strings.ToLower(tokens[i-distance-1]); prev == "kind" || prev == "sort" {
+				scalar, ok = sa.Boosters["kinda"]
+			}
+		}
+		if !ok {
+			continue
+		}
+		if isCaps(tokens[i-distance]) {
+			scalar += math.Copysign(capsBoost/2, scalar)
+		}
+		if valence < 0 {
+			scalar = -scalar
+		}
+		total += scalar * (1 - 0.05*float64(distance-1))
+	}
+	return total
+}
+
+// negated reports whether a negation precedes the word within the negation scope
+func (sa *SentimentAnalyzer) negated(tokens []string, i int) bool {
+	for distance := 1; distance <= negationScope && i-distance >= 0; distance++ {
+		word := strings.ToLower(tokens[i-distance])
+		if sa.Negations[word] || strings.HasSuffix(word, "n't") {
+			return true
+		}
+		// A contrast or a clause break ends the negation's reach: "not great but fine",
+		// "not sure, it's good"
+		if sa.Contrasts[word] || isClauseBreak(word) {
+			return false
+		}
+	}
+	return false
+}
+
+// isShouting reports whether most of the sentence's words are in capitals
+func isShouting(tokens []string) bool {
+	words, caps := 0, 0
+	for _, token := range tokens {
+		if !isWord(token) {
+			continue
+		}
+		words++
+		if isCaps(token) {
+			caps++
+		}
+	}
+	return words > 1 && caps*2 > words
+}
+
+// isCaps reports whether a word of two or more letters is written in capitals
+func isCaps(token string) bool {
+	letters := 0
+	for _, r := range token {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters > 1
+}
+
+// likeAsVerb reports whether "like" means to enjoy something, rather than a filler
+// ("it's like, whatever") or a comparison ("looks like rain")
+func likeAsVerb(tokens []string, i int) bool {
+	if i+1 < len(tokens) && isClauseBreak(tokens[i+1]) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch prev := strings.ToLower(tokens[i-1]); prev {
+	case "is", "was", "are", "were", "be", "just", "looks", "look", "looked", "sounds", "sound",
+		"seems", "seem", "feels", "feel", "felt", "more", "much", "something", "nothing", "anything":
+		return false
+	default:
+		return !strings.HasSuffix(prev, "'s") && !strings.HasSuffix(prev, "'re")
+	}
+}
+
+func isClauseBreak(token string) bool {
+	return token == "," || token == ";"
+}
+
+func isWord(token string) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSentiment maps a raw score sum onto -1..1
+func normalizeSentiment(sum float64) float64 {
+	if sum == 0 {
+		return 0
+	}
+	return math.Max(-1, math.Min(1, sum/math.Sqrt(sum*sum+normalizationAlpha)))
+}
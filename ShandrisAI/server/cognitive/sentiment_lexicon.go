@@ -0,0 +1,268 @@
+package cognitive
+
+// sentimentLexicon scores common words, emoji and emoticons. Valence runs from -4 to 4,
+// arousal from 0 (calm) to 1 (excited or agitated).
+var sentimentLexicon = map[string]LexiconEntry{
+	// Positive
+	"love":        {3.2, 0.7},
+	"loved":       {2.9, 0.7},
+	"loving":      {2.9, 0.6},
+	"adore":       {3.0, 0.7},
+	"like":        {1.5, 0.3},
+	"likes":       {1.5, 0.3},
+	"liked":       {1.5, 0.4},
+	"enjoy":       {2.2, 0.5},
+	"enjoyed":     {2.2, 0.5},
+	"happy":       {2.7, 0.6},
+	"happier":     {2.5, 0.6},
+	"happiest":    {2.9, 0.7},
+	"glad":        {2.0, 0.4},
+	"joy":         {2.8, 0.7},
+	"excited":     {2.4, 0.9},
+	"exciting":    {2.2, 0.8},
+	"thrilled":    {2.9, 0.9},
+	"great":       {3.1, 0.6},
+	"good":        {1.9, 0.4},
+	"nice":        {1.8, 0.3},
+	"fine":        {0.8, 0.2},
+	"okay":        {0.9, 0.2},
+	"ok":          {0.9, 0.2},
+	"cool":        {1.3, 0.4},
+	"awesome":     {3.1, 0.8},
+	"amazing":     {2.8, 0.8},
+	"wonderful":   {2.7, 0.6},
+	"fantastic":   {2.6, 0.8},
+	"brilliant":   {2.8, 0.7},
+	"excellent":   {2.7, 0.6},
+	"perfect":     {2.7, 0.6},
+	"beautiful":   {2.9, 0.5},
+	"pretty":      {2.2, 0.4},
+	"cute":        {2.0, 0.5},
+	"gorgeous":    {3.0, 0.7},
+	"fun":         {2.3, 0.7},
+	"funny":       {1.9, 0.6},
+	"hilarious":   {2.5, 0.8},
+	"lol":         {1.8, 0.6},
+	"lmao":        {2.0, 0.7},
+	"haha":        {2.0, 0.6},
+	"hahaha":      {2.2, 0.7},
+	"yay":         {2.4, 0.8},
+	"thanks":      {1.9, 0.3},
+	"thank":       {1.5, 0.3},
+	"grateful":    {2.3, 0.4},
+	"proud":       {2.1, 0.6},
+	"relieved":    {1.9, 0.2},
+	"calm":        {1.3, 0.1},
+	"relaxed":     {1.9, 0.1},
+	"peaceful":    {2.2, 0.1},
+	"hope":        {1.9, 0.4},
+	"hopeful":     {2.0, 0.4},
+	"win":         {2.8, 0.7},
+	"won":         {2.7, 0.7},
+	"best":        {3.2, 0.6},
+	"better":      {1.9, 0.4},
+	"interesting": {1.7, 0.5},
+	"curious":     {1.3, 0.5},
+	"sweet":       {2.0, 0.4},
+	"fair":        {1.3, 0.2},
+	"safe":        {1.9, 0.2},
+	"success":     {2.7, 0.6},
+	"yes":         {1.2, 0.4},
+	"wow":         {2.0, 0.8},
+
+	// Negative
+	"hate":         {-2.7, 0.8},
+	"hated":        {-3.2, 0.8},
+	"hating":       {-2.7, 0.8},
+	"dislike":      {-1.6, 0.5},
+	"sad":          {-2.1, 0.3},
+	"unhappy":      {-1.8, 0.4},
+	"miserable":    {-2.2, 0.4},
+	"depressed":    {-2.3, 0.2},
+	"lonely":       {-1.8, 0.3},
+	"alone":        {-1.0, 0.3},
+	"cry":          {-2.1, 0.6},
+	"crying":       {-2.1, 0.6},
+	"hurt":         {-2.4, 0.6},
+	"pain":         {-2.3, 0.6},
+	"angry":        {-2.3, 0.9},
+	"mad":          {-2.2, 0.8},
+	"furious":      {-2.9, 1.0},
+	"annoyed":      {-1.6, 0.7},
+	"annoying":     {-1.8, 0.7},
+	"frustrated":   {-2.1, 0.8},
+	"upset":        {-1.6, 0.6},
+	"anxious":      {-1.0, 0.8},
+	"worried":      {-1.2, 0.7},
+	"scared":       {-1.9, 0.8},
+	"afraid":       {-2.0, 0.8},
+	"stressed":     {-1.6, 0.8},
+	"tired":        {-1.0, 0.1},
+	"exhausted":    {-1.5, 0.2},
+	"bored":        {-1.3, 0.1},
+	"boring":       {-1.3, 0.1},
+	"bad":          {-2.5, 0.5},
+	"worse":        {-2.1, 0.5},
+	"worst":        {-3.1, 0.7},
+	"sadder":       {-2.0, 0.3},
+	"saddest":      {-2.4, 0.4},
+	"lonelier":     {-1.8, 0.3},
+	"angrier":      {-2.2, 0.8},
+	"terrible":     {-2.1, 0.7},
+	"awful":        {-2.0, 0.7},
+	"horrible":     {-2.5, 0.7},
+	"disgusting":   {-2.4, 0.7},
+	"ugly":         {-2.0, 0.5},
+	"stupid":       {-2.4, 0.7},
+	"dumb":         {-2.3, 0.6},
+	"useless":      {-1.8, 0.5},
+	"broken":       {-1.2, 0.5},
+	"fail":         {-2.5, 0.6},
+	"failed":       {-2.3, 0.6},
+	"failing":      {-2.3, 0.6},
+	"lost":         {-1.3, 0.5},
+	"lose":         {-1.7, 0.5},
+	"wrong":        {-2.1, 0.5},
+	"problem":      {-1.7, 0.5},
+	"sucks":        {-1.5, 0.6},
+	"sorry":        {-0.3, 0.3},
+	"disappointed": {-1.9, 0.4},
+	"ugh":          {-1.8, 0.6},
+	"meh":          {-0.7, 0.1},
+	"damn":         {-1.7, 0.7},
+
+	// Emoji
+	"😀": {2.0, 0.6},
+	"😁": {2.2, 0.7},
+	"😆": {2.1, 0.8},
+	"😅": {0.8, 0.6},
+	"😂": {2.0, 0.8},
+	"🤣": {2.2, 0.9},
+	"😄": {2.2, 0.7},
+	"😃": {2.2, 0.7},
+	"😊": {2.0, 0.4},
+	"🙂": {1.0, 0.2},
+	"😉": {1.2, 0.4},
+	"😏": {0.8, 0.4},
+	"😍": {3.0, 0.8},
+	"🥰": {3.0, 0.6},
+	"😘": {2.5, 0.6},
+	"❤": {3.0, 0.6},
+	"💜": {2.5, 0.5},
+	"💕": {2.5, 0.5},
+	"💔": {-2.8, 0.6},
+	"🤗": {2.2, 0.5},
+	"👍": {1.5, 0.3},
+	"👎": {-1.5, 0.3},
+	"🙌": {2.2, 0.8},
+	"✨": {1.2, 0.5},
+	"🎉": {2.5, 0.8},
+	"🥳": {2.7, 0.9},
+	"🙁": {-1.5, 0.3},
+	"😕": {-1.0, 0.3},
+	"😟": {-1.6, 0.4},
+	"😔": {-1.7, 0.3},
+	"😞": {-1.8, 0.3},
+	"😢": {-2.2, 0.5},
+	"😭": {-2.0, 0.8},
+	"😩": {-1.8, 0.6},
+	"😤": {-1.5, 0.8},
+	"😠": {-2.5, 0.9},
+	"😡": {-3.0, 1.0},
+	"🙄": {-1.2, 0.4},
+	"😒": {-1.4, 0.3},
+
+	// Emoticons
+	":)":  {1.8, 0.4},
+	":-)": {1.8, 0.4},
+	"=)":  {1.7, 0.4},
+	":D":  {2.3, 0.7},
+	":-D": {2.3, 0.7},
+	"xD":  {2.0, 0.8},
+	"XD":  {2.0, 0.8},
+	";)":  {1.2, 0.4},
+	":P":  {1.0, 0.5},
+	":p":  {1.0, 0.5},
+	"<3":  {2.5, 0.5},
+	":(":  {-1.9, 0.4},
+	":-(": {-1.9, 0.4},
+	":'(": {-2.2, 0.6},
+	":/":  {-0.8, 0.3},
+	":|":  {-0.4, 0.1},
+
+	// Idioms, scored as a whole so the words inside them don't count on their own
+	"can't stand":         {-2.0, 0.6},
+	"cant stand":          {-2.0, 0.6},
+	"can't wait":          {2.0, 0.8},
+	"cant wait":           {2.0, 0.8},
+	"can't complain":      {1.0, 0.2},
+	"never been happier":  {3.0, 0.7},
+	"never been better":   {2.8, 0.6},
+	"couldn't be happier": {3.0, 0.7},
+	"couldn't be better":  {2.8, 0.6},
+	"could be worse":      {0.5, 0.2},
+	"over the moon":       {3.0, 0.8},
+	"on cloud nine":       {3.0, 0.8},
+	"fed up":              {-2.0, 0.6},
+	"sick of":             {-1.8, 0.6},
+	"sick and tired":      {-2.2, 0.6},
+	"had enough":          {-1.6, 0.6},
+	"down in the dumps":   {-2.2, 0.3},
+}
+
+// sentimentBoosters strengthen (positive) or soften (negative) the word that follows them
+var sentimentBoosters = map[string]float64{
+	"very":         0.293,
+	"really":       0.293,
+	"so":           0.293,
+	"extremely":    0.293,
+	"incredibly":   0.293,
+	"absolutely":   0.293,
+	"totally":      0.293,
+	"completely":   0.293,
+	"super":        0.293,
+	"truly":        0.293,
+	"most":         0.293,
+	"such":         0.2,
+	"too":          0.2,
+	"fucking":      0.35,
+	"kinda":        -0.293,
+	"sorta":        -0.293,
+	"somewhat":     -0.293,
+	"slightly":     -0.293,
+	"barely":       -0.293,
+	"hardly":       -0.293,
+	"little":       -0.293,
+	"bit":          -0.293,
+	"marginally":   -0.293,
+	"occasionally": -0.293,
+	"almost":       -0.293,
+	"fairly":       -0.2,
+	"pretty":       0.1,
+	"quite":        -0.1,
+}
+
+// sentimentNegations flip the words that follow them. Anything ending in "n't" also counts.
+var sentimentNegations = map[string]bool{
+	"not":      true,
+	"never":    true,
+	"no":       true,
+	"nothing":  true,
+	"nobody":   true,
+	"none":     true,
+	"nor":      true,
+	"neither":  true,
+	"without":  true,
+	"cannot":   true,
+	"dont":     true,
+	"doesnt":   true,
+	"didnt":    true,
+	"isnt":     true,
+	"wasnt":    true,
+	"arent":    true,
+	"cant":     true,
+	"wont":     true,
+	"wouldnt":  true,
+	"shouldnt": true,
+	"aint":     true,
+}
@@ -0,0 +1,39 @@
+package cognitive
+
+import "testing"
+
+func TestAnalyzeSentiment(t *testing.T) {
+	tests := []struct {
+		text     string
+		positive bool
+	}{
+		{"I like it", true},
+		{"love it", true},
+		{"😀", true},
+		{"I'm not sure, it's good", true},
+		{"not bad; actually great", true},
+		{"I've never been happier", true},
+		{"I'm happier now", true},
+		{"I'm over the moon", true},
+		{"not good", false},
+		{"I don't like it", false},
+		{"😔", false},
+		{"I can't stand it", false},
+		{"It got worse", false},
+		{"I'm so fed up", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := AnalyzeSentiment(tt.text).Valence
+			if got == 0 || (got > 0) != tt.positive {
+				t.Errorf("valence %.2f, want positive=%v", got, tt.positive)
+			}
+		})
+	}
+
+	for _, text := range []string{"It's like, whatever", "It looks like rain"} {
+		if got := AnalyzeSentiment(text).Valence; got != 0 {
+			t.Errorf("%q: valence %.2f, want 0", text, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package cognitive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TopicTechnicalSupport is the topic label for turns about code and errors
+const TopicTechnicalSupport = "technical_support"
+
+// focusedIntensity caps how strongly a sassy, flirty or playful mood shows while helping with code
+const focusedIntensity = 0.4
+
+// TechnicalSupport is the technical-support mode of a turn and what it found in the message
+type TechnicalSupport struct {
+	Active bool
+	Code   CodeReport
+}
+
+// AssessTechnicalSupport enables technical-support mode when the message carries code, errors or
+// commands, or the conversation is already about technical support
+func AssessTechnicalSupport(input, topic string) TechnicalSupport {
+	report := DetectCode(input)
+	return TechnicalSupport{
+		Active: report.Technical() || topic == TopicTechnicalSupport,
+		Code:   report,
+	}
+}
+
+// FocusedMood lowers the sass and flirtation of a mood while Shandris helps with code. The
+// original mood carries on as the secondary so her voice still comes through.
+func FocusedMood(current MoodState) MoodState {
+	switch current.Primary {
+	case "sassy", "flirty", "playful":
+	default:
+		return current
+	}
+	return MoodState{
+		Primary:   "intellectual",
+		Secondary: current.Primary,
+		Intensity: min(current.Intensity, focusedIntensity),
+		Timestamp: current.Timestamp,
+		Context:   current.Context,
+	}
+}
+
+// Describe renders the technical-support instructions for the prompt, or "" when the mode is off
+func (ts TechnicalSupport) Describe() string {
+	if !ts.Active {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+TECHNICAL SUPPORT:
+The user needs help with code or an error. Keep your own voice, but be precise first:
+- Keep sass and flirting to a light touch at most; never let them get in the way of the answer.
+- Identify the cause before suggesting fixes, and say which file, line or function is at fault when you can.
+- Put all code, commands and error output in fenced code blocks with a language tag, and always close every fence.
+- Quote the user's code exactly; never reformat or abbreviate it outside the lines you change.
+- If something needed to diagnose the problem is missing, ask for it instead of guessing.
+`)
+	if lang := ts.Code.Language(); lang != "" {
+		b.WriteString(fmt.Sprintf("Language: %s\n", lang))
+	}
+	if errs := ts.Code.Errors(); len(errs) > 0 {
+		b.WriteString("Errors in the user's message:\n")
+		for _, e := range errs {
+			kind := "Compiler error"
+			if e.Kind == FindingStackTrace {
+				kind = "Stack trace"
+			}
+			line := fmt.Sprintf("- %s", kind)
+			if e.Language != "" {
+				line += fmt.Sprintf(" (%s)", e.Language)
+			}
+			if e.Message != "" {
+				line += ": " + e.Message
+			}
+			b.WriteString(line + "\n")
+			for _, frame := range e.Frames {
+				b.WriteString(fmt.Sprintf("    at %s\n", frame))
+			}
+		}
+	}
+	return b.String()
+}
+
+var (
+	// fenceLine matches a line that opens or closes a fenced code block
+	fenceLine = regexp.MustCompile("(?m)^[ \\t]*```")
+	// exceptionLine is the last line of a Python traceback
+	exceptionLine = regexp.MustCompile(`^[\w.]+(Error|Exception|Exit|Interrupt)\b`)
+)
+
+// BalanceCodeFences closes a code block the reply left open. It reports whether a fence was added.
+func BalanceCodeFences(text string) (string, bool) {
+	if len(fenceLine.FindAllStringIndex(text, -1))%2 == 0 {
+		return text, false
+	}
+	return strings.TrimRight(text, " \t\n") + "\n```", true
+}
+
+// FenceUnfencedCode wraps code and error output pasted without fences in fenced blocks, so it
+// reaches the model intact. Text that is already fenced, and prose, is left as written.
+func FenceUnfencedCode(text string) string {
+	if !DetectCode(text).Technical() {
+		return text
+	}
+
+	var out []string
+	var run []string
+	inFence := false
+	flush := func() {
+		// Blank lines at the end of a run belong to the prose that follows
+		trailing := 0
+		for trailing < len(run) && strings.TrimSpace(run[len(run)-1-trailing]) == "" {
+			trailing++
+		}
+		block := run[:len(run)-trailing]
+		if len(block) > 0 {
+			report := DetectCode(strings.Join(block, "\n"))
+			if report.HasCode() || report.HasErrors() {
+				out = append(out, "```"+report.Language())
+				out = append(out, block...)
+				out = append(out, "```")
+			} else {
+				out = append(out, block...)
+			}
+		}
+		out = append(out, run[len(run)-trailing:]...)
+		run = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if fenceLine.MatchString(line) {
+			flush()
+			inFence = !inFence
+			out = append(out, line)
+			continue
+		}
+		if !inFence && codeLike(line, len(run) > 0) {
+			run = append(run, line)
+			continue
+		}
+		flush()
+		out = append(out, line)
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// codeLike reports whether a line reads as code or error output. Indented and blank lines
+// continue a run of code that has already started.
+func codeLike(line string, inRun bool) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return inRun || (trimmed != "" && (codeStructure.MatchString(trimmed) || lineSignature(line)))
+	}
+	if inRun && exceptionLine.MatchString(trimmed) {
+		return true
+	}
+	return traceKind(line) != "" || goPanic.MatchString(line) || pyTraceback.MatchString(line) ||
+		strings.HasPrefix(trimmed, "goroutine ") || codeStructure.MatchString(trimmed) || lineSignature(line)
+}
@@ -0,0 +1,299 @@
+package cognitive
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// windowWeight is how much the previous message counts towards this turn's themes;
+	// older messages count for less by windowFalloff per step
+	windowWeight  = 0.35
+	windowFalloff = 0.6
+	// ThemeWindowSize is how many earlier messages the detector looks back over
+	ThemeWindowSize = 5
+	// profilePrior is the nudge a matching profile interest gives a theme
+	profilePrior = 0.15
+	// themeCarryOver is how much of a theme's activity survives into the next turn
+	themeCarryOver = 0.6
+	// minActiveTheme is the score below which a theme stops being active
+	minActiveTheme = 0.1
+	// dominantTheme is the score a theme needs to lead the conversation
+	dominantTheme = 0.3
+	// maxThemeHistory caps how many transitions are kept
+	maxThemeHistory = 50
+)
+
+// ThemeDefinition describes how to recognise a conversational theme
+type ThemeDefinition struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Label       string             `json:"label,omitempty"`    // How the theme reads in a sentence, e.g. "work"; defaults to Name
+	Keywords    map[string]float64 `json:"keywords"`           // Word or phrase -> weight; a trailing * matches any ending
+	Patterns    map[string]float64 `json:"patterns,omitempty"` // Regular expression -> weight
+	Profile     []string           `json:"profile,omitempty"`  // Profile interests that make the theme more likely
+	Sentiment   float64            `json:"sentiment,omitempty"`
+	patterns    map[*regexp.Regexp]float64
+}
+
+// ThemeModel is the set of themes the detector scores
+type ThemeModel struct {
+	Themes []*ThemeDefinition `json:"themes"`
+}
+
+// LoadThemeModel reads and validates a theme dictionary
+func LoadThemeModel(path string) (*ThemeModel, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading theme model: %w", err)
+	}
+	var model ThemeModel
+	if err := json.Unmarshal(raw, &model); err != nil {
+		return nil, fmt.Errorf("error parsing theme model %s: %w", path, err)
+	}
+	if err := model.compile(); err != nil {
+		return nil, fmt.Errorf("invalid theme model %s: %w", path, err)
+	}
+	return &model, nil
+}
+
+func (tm *ThemeModel) compile() error {
+	seen := make(map[string]bool)
+	for _, theme := range tm.Themes {
+		if theme.Name == "" {
+			return fmt.Errorf("theme without a name")
+		}
+		if seen[theme.Name] {
+			return fmt.Errorf("duplicate theme %q", theme.Name)
+		}
+		seen[theme.Name] = true
+		if len(theme.Keywords) == 0 && len(theme.Patterns) == 0 {
+			return fmt.Errorf("theme %q has no keywords or patterns", theme.Name)
+		}
+		for keyword, weight := range theme.Keywords {
+			if weight <= 0 || weight > 1 {
+				return fmt.Errorf("theme %q: keyword %q weight %.2f is not in (0, 1]", theme.Name, keyword, weight)
+			}
+		}
+		theme.patterns = make(map[*regexp.Regexp]float64, len(theme.Patterns))
+		for pattern, weight := range theme.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return fmt.Errorf("theme %q: pattern %q: %w", theme.Name, pattern, err)
+			}
+			theme.patterns[re] = weight
+		}
+	}
+	return nil
+}
+
+// SentimentModifiers are the themes' sentiment shifts, for the sentiment engine
+func (tm *ThemeModel) SentimentModifiers() map[string]float64 {
+	modifiers := make(map[string]float64)
+	if tm == nil {
+		return modifiers
+	}
+	for _, theme := range tm.Themes {
+		if theme.Sentiment != 0 {
+			modifiers[theme.Name] = theme.Sentiment
+		}
+	}
+	return modifiers
+}
+
+// Score scores one message against every theme, without any conversation history
+func (tm *ThemeModel) Score(text string) map[string]float64 {
+	scores := make(map[string]float64)
+	if tm == nil {
+		return scores
+	}
+	for name, match := range tm.scoreMessage(text) {
+		scores[name] = match.score
+	}
+	return scores
+}
+
+// Label is how the named theme reads in a sentence
+func (tm *ThemeModel) Label(name string) string {
+	if tm != nil {
+		for _, theme := range tm.Themes {
+			if theme.Name == name && theme.Label != "" {
+				return theme.Label
+			}
+		}
+	}
+	return name
+}
+
+// NewThemeDetector creates a detector over a theme model
+func NewThemeDetector(model *ThemeModel) *ThemeDetector {
+	return &ThemeDetector{
+		ActiveThemes: make(map[string]float64),
+		Model:        model,
+		Profile:      make(map[string]string),
+	}
+}
+
+// themeMatch is a theme's score for one message and the cue that scored highest
+type themeMatch struct {
+	score   float64
+	trigger string
+}
+
+// scoreMessage scores every theme against one message
+func (tm *ThemeModel) scoreMessage(text string) map[string]themeMatch {
+	lower := strings.ToLower(strings.ReplaceAll(text, "’", "'"))
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	normalized := " " + strings.Join(words, " ") + " "
+
+	matches := make(map[string]themeMatch)
+	for _, theme := range tm.Themes {
+		sum, best, trigger := 0.0, 0.0, ""
+		for keyword, weight := range theme.Keywords {
+			if !matchesKeyword(lower, normalized, keyword) {
+				continue
+			}
+			sum += weight
+			if weight > best {
+				best, trigger = weight, strings.TrimSuffix(keyword, "*")
+			}
+		}
+		for re, weight := range theme.patterns {
+			if found := re.FindString(text); found != "" {
+				sum += weight
+				if weight > best {
+					best, trigger = weight, found
+				}
+			}
+		}
+		if sum > 0 {
+			// Saturate so a pile of weak cues never outweighs certainty
+			matches[theme.Name] = themeMatch{score: 1 - math.Exp(-2*sum), trigger: trigger}
+		}
+	}
+	return matches
+}
+
+// matchesKeyword matches a keyword as a whole word or phrase, a "stem*" prefix, or an emoji
+func matchesKeyword(lower, normalized, keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	if !strings.ContainsFunc(keyword, unicode.IsLetter) {
+		return strings.Contains(lower, keyword)
+	}
+	if stem, ok := strings.CutSuffix(keyword, "*"); ok {
+		return strings.Contains(normalized, " "+stem)
+	}
+	return strings.Contains(normalized, " "+keyword+" ")
+}
+
+// DetectThemes scores the themes of a message, drawing on the recent conversation window and the
+// user's profile. It carries the session's active themes forward and records a transition when
+// the leading theme changes.
+func (td *ThemeDetector) DetectThemes(input string) map[string]float64 {
+	themes := make(map[string]float64)
+	if td.Model == nil {
+		return themes
+	}
+	if td.ActiveThemes == nil {
+		td.ActiveThemes = make(map[string]float64)
+	}
+
+	current := td.Model.scoreMessage(input)
+	for name, match := range current {
+		themes[name] = match.score
+	}
+
+	// Earlier messages keep their themes warm, fading with distance
+	weight := windowWeight
+	for i := len(td.Window) - 1; i >= 0; i-- {
+		for name, match := range td.Model.scoreMessage(td.Window[i]) {
+			themes[name] += match.score * weight * (1 - themes[name])
+		}
+		weight *= windowFalloff
+	}
+
+	// The user's interests make their themes a little more likely
+	profile := strings.ToLower(strings.Join(profileValues(td.Profile), " "))
+	if profile != "" {
+		for _, theme := range td.Model.Themes {
+			for _, interest := range theme.Profile {
+				if strings.Contains(profile, strings.ToLower(interest)) {
+					themes[theme.Name] += profilePrior * (1 - themes[theme.Name])
+					break
+				}
+			}
+		}
+	}
+
+	previous := td.leadingTheme()
+	for name, score := range td.ActiveThemes {
+		td.ActiveThemes[name] = score * themeCarryOver
+	}
+	for name, score := range themes {
+		td.ActiveThemes[name] = math.Max(td.ActiveThemes[name], score)
+	}
+	for name, score := range td.ActiveThemes {
+		if score < minActiveTheme {
+			delete(td.ActiveThemes, name)
+		}
+	}
+
+	if leading := td.leadingTheme(); leading != "" && leading != previous {
+		trigger := current[leading].trigger
+		if trigger == "" {
+			trigger = "conversation"
+		}
+		td.ThemeHistory = append(td.ThemeHistory, ThemeTransition{
+			From:      previous,
+			To:        leading,
+			Timestamp: time.Now(),
+			Trigger:   trigger,
+		})
+		if len(td.ThemeHistory) > maxThemeHistory {
+			td.ThemeHistory = td.ThemeHistory[len(td.ThemeHistory)-maxThemeHistory:]
+		}
+	}
+
+	td.Window = append(td.Window, input)
+	if len(td.Window) > ThemeWindowSize {
+		td.Window = td.Window[len(td.Window)-ThemeWindowSize:]
+	}
+	return themes
+}
+
+// leadingTheme is the most active theme strong enough to lead, or ""
+func (td *ThemeDetector) leadingTheme() string {
+	leading, best := "", dominantTheme
+	for _, name := range sortedThemeNames(td.ActiveThemes) {
+		if score := td.ActiveThemes[name]; score >= best {
+			leading, best = name, score
+		}
+	}
+	return leading
+}
+
+func sortedThemeNames(themes map[string]float64) []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func profileValues(profile map[string]string) []string {
+	values := make([]string, 0, len(profile))
+	for _, value := range profile {
+		values = append(values, value)
+	}
+	return values
+}
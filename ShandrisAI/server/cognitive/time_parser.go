@@ -0,0 +1,402 @@
+package cognitive
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReminderRequest is a reminder parsed from a natural-language request
+type ReminderRequest struct {
+	Task       string
+	At         time.Time // First occurrence, on the user's wall clock
+	Recurrence *RecurrencePattern
+}
+
+// ErrNoReminderTime is returned when a reminder request has no recognisable time
+var ErrNoReminderTime = errors.New("no time found in reminder request")
+
+// ErrAmbiguousHour is returned when a recurring reminder gives an hour without am or pm. A wrong
+// guess would repeat with every occurrence, so the user is asked instead.
+var ErrAmbiguousHour = errors.New("recurring reminder hour needs am or pm")
+
+// defaultReminderHour is used when a day is given without a time
+const defaultReminderHour = 9
+
+var (
+	reminderTrigger = regexp.MustCompile(`(?i)\bremind me\b`)
+
+	everyExpr    = regexp.MustCompile(`(?i)\bevery\s+(?:(\d+)\s+)?(day|morning|afternoon|evening|night|week|month|year|monday|tuesday|wednesday|thursday|friday|saturday|sunday)s?\b`)
+	everyAdverb  = regexp.MustCompile(`(?i)\b(daily|weekly|monthly|yearly|annually)\b`)
+	relativeExpr = regexp.MustCompile(`(?i)\bin\s+(\d+|an?|one|two|three|four|five|six|seven|eight|nine|ten|half an?)\s*(minute|min|hour|hr|day|week|month)s?\b`)
+	dayWordExpr  = regexp.MustCompile(`(?i)\b(the day after tomorrow|tomorrow|today|tonight)\b`)
+	weekdayExpr  = regexp.MustCompile(`(?i)\b(?:(on|next|this)\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+	monthDayExpr = regexp.MustCompile(`(?i)\b(?:on\s+)?(?:the\s+)?(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\s+(\d{1,2})(?:st|nd|rd|th)?\b`)
+	dayMonthExpr = regexp.MustCompile(`(?i)\b(?:on\s+)?(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\b`)
+	dayOfMonth   = regexp.MustCompile(`(?i)\b(?:on\s+)?the\s+(\d{1,2})(?:st|nd|rd|th)\b(?:\s+of\b)?`)
+	clockAtExpr  = regexp.MustCompile(`(?i)\bat\s+(\d{1,2})(?::(\d{2}))?(?:\s*((?:a|p)\.m\.|(?:am|pm)\b)|\b)`)
+	clockExpr    = regexp.MustCompile(`(?i)\b(\d{1,2})(?::(\d{2}))?\s*((?:a|p)\.m\.|(?:am|pm)\b)`)
+	namedTime    = regexp.MustCompile(`(?i)\b(?:at\s+)?(noon|midday|midnight)\b`)
+	partOfDay    = regexp.MustCompile(`(?i)\b(?:in the\s+|this\s+)?(morning|afternoon|evening)\b`)
+)
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+var partOfDayHours = map[string]int{
+	"morning":   9,
+	"afternoon": 15,
+	"evening":   19,
+	"night":     20,
+	"tonight":   20,
+}
+
+// IsReminderRequest reports whether the input asks Shandris to remind the user of something
+func IsReminderRequest(input string) bool {
+	return reminderTrigger.MatchString(input)
+}
+
+// ParseReminder turns "remind me to submit my thesis on Friday at 5" into a task and a time.
+// Times are resolved against now, in now's location. Hours 1-7 without am/pm are read as
+// afternoon, and a time that has already passed today moves to tomorrow. A recurring
+// reminder with a bare hour and no part of day returns ErrAmbiguousHour.
+func ParseReminder(input string, now time.Time) (*ReminderRequest, error) {
+	trigger := reminderTrigger.FindStringIndex(input)
+	if trigger == nil {
+		return nil, ErrNoReminderTime
+	}
+	rest := input[trigger[1]:]
+
+	p := &timeExpression{text: rest}
+	recurrence, weekday, hasWeekday := p.recurrence()
+
+	at, ok := p.relative(now)
+	if !ok {
+		// Day words go first so "tonight at 8" reads as 20:00
+		date, hasDate := p.date(now)
+		hour, minute, hasTime := p.clock()
+		if !hasDate && hasWeekday {
+			date, hasDate = nextWeekday(now, weekday, false), true
+		}
+
+		if !hasTime && !hasDate && recurrence == nil {
+			return nil, ErrNoReminderTime
+		}
+		if recurrence != nil && p.ambiguousHour {
+			return nil, ErrAmbiguousHour
+		}
+		if !hasTime {
+			hour, minute = defaultReminderHour, 0
+			if p.impliedFound {
+				hour = p.impliedHour
+			}
+		}
+		if !hasDate {
+			date = now
+		}
+
+		year, month, day := date.Date()
+		at = time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+		if !at.After(now) {
+			switch {
+			case hasWeekday || p.dateIsWeekday || (recurrence != nil && recurrence.Pattern == "weekly"):
+				at = at.AddDate(0, 0, 7)
+			case !hasDate || p.dateIsDayWord == "today":
+				at = at.AddDate(0, 0, 1)
+			case p.dateHasMonth:
+				at = at.AddDate(1, 0, 0)
+			case p.dayOfMonth > 0:
+				next := nextDayOfMonth(at.AddDate(0, 0, 1), p.dayOfMonth)
+				at = time.Date(next.Year(), next.Month(), next.Day(), hour, minute, 0, 0, now.Location())
+			}
+		}
+	}
+
+	task := cleanTask(p.remaining())
+	if task == "" {
+		task = "what you asked"
+	}
+
+	return &ReminderRequest{
+		Task:       task,
+		At:         at,
+		Recurrence: recurrence,
+	}, nil
+}
+
+// timeExpression consumes time phrases from the text, leaving the task behind
+type timeExpression struct {
+	text          string
+	impliedHour   int
+	impliedFound  bool
+	dateIsDayWord string
+	dateIsWeekday bool
+	dateHasMonth  bool
+	dayOfMonth    int  // Set by "on the 15th"
+	ambiguousHour bool // An hour from 1 to 11 with nothing to say morning or evening
+}
+
+// take removes the first match of re from the text and returns its submatches
+func (p *timeExpression) take(re *regexp.Regexp) []string {
+	idx := re.FindStringSubmatchIndex(p.text)
+	if idx == nil {
+		return nil
+	}
+	match := make([]string, len(idx)/2)
+	for i := range match {
+		if idx[2*i] >= 0 {
+			match[i] = strings.ToLower(p.text[idx[2*i]:idx[2*i+1]])
+		}
+	}
+	p.text = p.text[:idx[0]] + " " + p.text[idx[1]:]
+	return match
+}
+
+func (p *timeExpression) remaining() string {
+	return p.text
+}
+
+// recurrence extracts "every Monday", "every 2 weeks", "daily" and similar
+func (p *timeExpression) recurrence() (*RecurrencePattern, time.Weekday, bool) {
+	if m := p.take(everyAdverb); m != nil {
+		pattern := m[1]
+		if pattern == "annually" {
+			pattern = "yearly"
+		}
+		return &RecurrencePattern{Pattern: pattern}, 0, false
+	}
+
+	m := p.take(everyExpr)
+	if m == nil {
+		return nil, 0, false
+	}
+
+	conditions := map[string]interface{}{}
+	if m[1] != "" {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 1 {
+			conditions["every"] = n
+		}
+	}
+
+	unit := m[2]
+	if weekday, ok := parseWeekday(unit); ok {
+		return &RecurrencePattern{Pattern: "weekly", Conditions: conditions}, weekday, true
+	}
+
+	switch unit {
+	case "morning", "afternoon", "evening", "night":
+		p.setImpliedHour(partOfDayHours[unit])
+		return &RecurrencePattern{Pattern: "daily", Conditions: conditions}, 0, false
+	case "day":
+		return &RecurrencePattern{Pattern: "daily", Conditions: conditions}, 0, false
+	case "week":
+		return &RecurrencePattern{Pattern: "weekly", Conditions: conditions}, 0, false
+	case "month":
+		return &RecurrencePattern{Pattern: "monthly", Conditions: conditions}, 0, false
+	default:
+		return &RecurrencePattern{Pattern: "yearly", Conditions: conditions}, 0, false
+	}
+}
+
+// relative resolves "in 20 minutes" style offsets
+func (p *timeExpression) relative(now time.Time) (time.Time, bool) {
+	m := p.take(relativeExpr)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	amount := 0
+	half := strings.HasPrefix(m[1], "half")
+	if n, err := strconv.Atoi(m[1]); err == nil {
+		amount = n
+	} else if n, ok := numberWords[m[1]]; ok {
+		amount = n
+	}
+
+	switch {
+	case strings.HasPrefix(m[2], "min"):
+		return now.Add(time.Duration(amount) * time.Minute), true
+	case strings.HasPrefix(m[2], "h"):
+		if half {
+			return now.Add(30 * time.Minute), true
+		}
+		return now.Add(time.Duration(amount) * time.Hour), true
+	case m[2] == "day":
+		return now.AddDate(0, 0, amount), true
+	case m[2] == "week":
+		return now.AddDate(0, 0, 7*amount), true
+	default:
+		return addMonthsClamped(now, amount), true
+	}
+}
+
+// clock extracts an explicit time of day
+func (p *timeExpression) clock() (int, int, bool) {
+	if m := p.take(namedTime); m != nil {
+		if m[1] == "midnight" {
+			return 0, 0, true
+		}
+		return 12, 0, true
+	}
+
+	// Part of day is consumed first so it can disambiguate the hour
+	if m := p.take(partOfDay); m != nil {
+		p.setImpliedHour(partOfDayHours[m[1]])
+	}
+
+	// "at 5pm" wins over a bare "2 am" elsewhere in the task
+	m := p.take(clockAtExpr)
+	if m == nil {
+		m = p.take(clockExpr)
+	}
+	if m == nil {
+		return 0, 0, false
+	}
+
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	meridiem := m[3]
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+
+	meridiem = strings.ReplaceAll(meridiem, ".", "")
+	switch {
+	case meridiem == "pm" && hour < 12:
+		hour += 12
+	case meridiem == "am" && hour == 12:
+		hour = 0
+	case meridiem == "" && hour < 12:
+		p.ambiguousHour = !p.impliedFound && hour >= 1
+		if p.impliedFound && p.impliedHour >= 12 {
+			hour += 12
+		} else if !p.impliedFound && hour >= 1 && hour <= 7 {
+			hour += 12
+		}
+	}
+	return hour, minute, true
+}
+
+// date extracts the calendar day
+func (p *timeExpression) date(now time.Time) (time.Time, bool) {
+	if m := p.take(dayWordExpr); m != nil {
+		p.dateIsDayWord = m[1]
+		switch m[1] {
+		case "tomorrow":
+			return now.AddDate(0, 0, 1), true
+		case "the day after tomorrow":
+			return now.AddDate(0, 0, 2), true
+		case "tonight":
+			p.setImpliedHour(partOfDayHours["tonight"])
+			p.dateIsDayWord = "today"
+		}
+		return now, true
+	}
+
+	if m := p.take(monthDayExpr); m != nil {
+		return p.monthDay(now, m[1], m[2])
+	}
+	if m := p.take(dayMonthExpr); m != nil {
+		return p.monthDay(now, m[2], m[1])
+	}
+
+	// "on the 1st" is the next 1st; every month on the 1st recurs from it
+	if m := p.take(dayOfMonth); m != nil {
+		if day, _ := strconv.Atoi(m[1]); day >= 1 && day <= 31 {
+			p.dayOfMonth = day
+			return nextDayOfMonth(now, day), true
+		}
+	}
+
+	if m := p.take(weekdayExpr); m != nil {
+		if weekday, ok := parseWeekday(m[2]); ok {
+			p.dateIsWeekday = true
+			return nextWeekday(now, weekday, m[1] == "next"), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *timeExpression) monthDay(now time.Time, monthText, dayText string) (time.Time, bool) {
+	month, ok := parseMonthName(monthText)
+	if !ok {
+		return time.Time{}, false
+	}
+	day, _ := strconv.Atoi(dayText)
+	date := time.Date(now.Year(), month, day, 0, 0, 0, 0, now.Location())
+	if date.Month() != month {
+		return time.Time{}, false
+	}
+	p.dateHasMonth = true
+	return date, true
+}
+
+func (p *timeExpression) setImpliedHour(hour int) {
+	p.impliedHour = hour
+	p.impliedFound = true
+}
+
+// nextWeekday returns the next date falling on weekday; today counts unless skipToday is set
+func nextWeekday(now time.Time, weekday time.Weekday, skipToday bool) time.Time {
+	days := (int(weekday) - int(now.Weekday()) + 7) % 7
+	if days == 0 && skipToday {
+		days = 7
+	}
+	return now.AddDate(0, 0, days)
+}
+
+// nextDayOfMonth returns the first date from now's day on that falls on the given day of
+// the month, skipping months too short to have it
+func nextDayOfMonth(now time.Time, day int) time.Time {
+	for months := 0; months <= 12; months++ {
+		date := time.Date(now.Year(), now.Month()+time.Month(months), day, 0, 0, 0, 0, now.Location())
+		if date.Day() == day && !date.Before(startOfDay(now)) {
+			return date
+		}
+	}
+	return now
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func parseMonthName(name string) (time.Month, bool) {
+	name = strings.ToLower(name)
+	for m := time.January; m <= time.December; m++ {
+		full := strings.ToLower(m.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// cleanTask strips the connecting words left around the task once time phrases are removed
+func cleanTask(text string) string {
+	task := strings.Join(strings.Fields(text), " ")
+	task = strings.Trim(task, " .,!?;:")
+
+	for _, prefix := range []string{"to ", "about ", "that i need to ", "that i have to ", "that ", "please "} {
+		if strings.HasPrefix(strings.ToLower(task), prefix) {
+			task = task[len(prefix):]
+		}
+	}
+	for _, suffix := range []string{" please", " on", " at", " by", " for"} {
+		if strings.HasSuffix(strings.ToLower(task), suffix) {
+			task = task[:len(task)-len(suffix)]
+		}
+	}
+	return strings.Trim(task, " .,!?;:")
+}
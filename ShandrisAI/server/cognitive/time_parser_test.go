@@ -0,0 +1,67 @@
+package cognitive
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseReminder(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC) // A Wednesday
+	tests := []struct {
+		input   string
+		task    string
+		at      time.Time
+		pattern string // Recurrence pattern, "" for a one-off
+		err     error
+	}{
+		// am/pm only counts as a whole word
+		{"remind me to buy 2 amps at 5pm", "buy 2 amps", time.Date(2026, 10, 14, 17, 0, 0, 0, time.UTC), "", nil},
+		{"remind me to check 10am logs at 3pm", "check 10am logs", time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC), "", nil},
+		{"remind me about the 2 pm meeting", "the meeting", time.Date(2026, 10, 14, 14, 0, 0, 0, time.UTC), "", nil},
+		{"remind me at 123 to stretch", "", time.Time{}, "", ErrNoReminderTime},
+
+		// Bare hours 1-7 in a one-off reminder are afternoon
+		{"remind me to call mum at 5", "call mum", time.Date(2026, 10, 14, 17, 0, 0, 0, time.UTC), "", nil},
+		{"remind me to call the bank at 9 tomorrow", "call the bank", time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC), "", nil},
+		{"remind me to submit my thesis on Friday at 5", "submit my thesis", time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC), "", nil},
+
+		// "On the Nth" rolls to next month once the day has passed
+		{"remind me to pay rent on the 1st", "pay rent", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC), "", nil},
+		{"remind me to water plants on the 14th at 8am", "water plants", time.Date(2026, 11, 14, 8, 0, 0, 0, time.UTC), "", nil},
+		{"remind me to pay rent every month on the 1st", "pay rent", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC), "monthly", nil},
+
+		// Recurring reminders need the hour spelled out
+		{"remind me to stretch every day at 7", "", time.Time{}, "", ErrAmbiguousHour},
+		{"remind me to stretch every day at 7am", "stretch", time.Date(2026, 10, 15, 7, 0, 0, 0, time.UTC), "daily", nil},
+		{"remind me to stretch every morning at 7", "stretch", time.Date(2026, 10, 15, 7, 0, 0, 0, time.UTC), "daily", nil},
+		{"remind me to walk every day at 19:30", "walk", time.Date(2026, 10, 14, 19, 30, 0, 0, time.UTC), "daily", nil},
+		{"remind me to drink water every 2 hours", "", time.Time{}, "", ErrNoReminderTime},
+
+		{"remind me in 20 minutes to check the oven", "check the oven", now.Add(20 * time.Minute), "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseReminder(tt.input, now)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %+v, %v, want error %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Task != tt.task || !got.At.Equal(tt.at) {
+				t.Errorf("got %q at %s, want %q at %s", got.Task, got.At, tt.task, tt.at)
+			}
+			pattern := ""
+			if got.Recurrence != nil {
+				pattern = got.Recurrence.Pattern
+			}
+			if pattern != tt.pattern {
+				t.Errorf("recurrence %q, want %q", pattern, tt.pattern)
+			}
+		})
+	}
+}
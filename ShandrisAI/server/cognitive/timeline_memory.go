@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -64,8 +65,14 @@ func newMemoryDecay() *MemoryDecay {
 }
 
 func (md *MemoryDecay) CalculateDecayFactor(event *MemoryEvent) float64 {
-	age := time.Since(event.Timestamp)
-	return math.Exp(-float64(age) / float64(md.halfLife))
+	// Recalling a memory refreshes it, and each recall slows its decay
+	reference := event.Timestamp
+	if event.LastRecall.After(reference) {
+		reference = event.LastRecall
+	}
+	age := time.Since(reference)
+	halfLife := float64(md.halfLife) * (1 + 0.5*float64(event.RecallCount))
+	return math.Exp(-float64(age) / halfLife)
 }
 
 // TimelineMemory manages the AI's long-term memory and event tracking
@@ -76,6 +83,15 @@ type TimelineMemory struct {
 	importance    *ImportanceCalculator
 	recall        *MemoryRecall
 	decay         *MemoryDecay
+
+	// OnEventChange is called whenever an event is stored or recalled so it can be persisted
+	OnEventChange func(event *MemoryEvent)
+
+	// OnMarkerChange is called whenever a marker is added or triggered so it can be persisted
+	OnMarkerChange func(marker *TimelineMarker)
+
+	// OnRelationshipChange is called whenever a relationship is updated so it can be persisted
+	OnRelationshipChange func(rel *RelationshipMemory)
 }
 
 // ProcessInteraction processes an interaction and updates the memory context
@@ -110,6 +126,9 @@ type MemoryEvent struct {
 
 type EventType string
 
+// maxEventContentLength caps how much of a message is kept in a memory event
+const maxEventContentLength = 280
+
 const (
 	PersonalEvent                EventType = "personal"
 	RelationshipInteractionEvent EventType = "relationship"
@@ -122,6 +141,7 @@ const (
 type EventContext struct {
 	Location     string
 	Participants []string
+	Present      []string // Scene characters who witnessed the event; recall for them keeps to these
 	Mood         string
 	Topics       []string
 	UserState    map[string]interface{}
@@ -156,14 +176,16 @@ type RecurrencePattern struct {
 
 // RelationshipMemory tracks relationship development and history
 type RelationshipMemory struct {
-	UserID          string
-	Events          []string // Event IDs
-	Milestones      []string // Marker IDs
-	Trust           float64
-	Intimacy        float64
-	SharedTopics    []string
-	Preferences     map[string]float64
-	LastInteraction time.Time
+	UserID           string
+	Events           []string // Event IDs
+	Milestones       []string // Marker IDs
+	Trust            float64
+	Intimacy         float64
+	SharedTopics     []string
+	Preferences      map[string]float64
+	Interactions     int
+	FirstInteraction time.Time
+	LastInteraction  time.Time
 }
 
 func NewTimelineMemory() *TimelineMemory {
@@ -191,10 +213,13 @@ func (tm *TimelineMemory) StoreEvent(event *MemoryEvent) error {
 
 	// Store the event
 	tm.events[event.ID] = event
+	if tm.OnEventChange != nil {
+		tm.OnEventChange(event)
+	}
 
 	// Create markers if needed
 	if marker := tm.createMarkerFromEvent(event); marker != nil {
-		tm.markers[marker.ID] = marker
+		tm.AddMarker(marker)
 	}
 
 	// Update relationships
@@ -212,7 +237,70 @@ func (tm *TimelineMemory) RecallMemories(context *EventContext, limit int) []*Me
 	scored := tm.scoreMemories(candidates, context)
 
 	// Sort by final score and return top results
-	return tm.getTopMemories(scored, limit)
+	recalled := tm.getTopMemories(scored, limit)
+
+	// Recalling a memory strengthens it
+	now := time.Now()
+	for _, event := range recalled {
+		event.LastRecall = now
+		event.RecallCount++
+		if tm.OnEventChange != nil {
+			tm.OnEventChange(event)
+		}
+	}
+
+	return recalled
+}
+
+// RestoreEvent loads a previously persisted event without re-scoring or re-persisting it
+func (tm *TimelineMemory) RestoreEvent(event *MemoryEvent) {
+	tm.events[event.ID] = event
+}
+
+// NewTurnEvent builds a memory event from a chat turn, or returns nil if the turn
+// carries nothing worth remembering. Emotional turns and personal disclosures
+// are kept; everyday chatter is left to the chat history.
+func NewTurnEvent(input string, topics []string, userMood string, shandrisMood MoodState) *MemoryEvent {
+	var eventType EventType
+	switch {
+	case userMood != "" || containsEmotionalContent(input):
+		eventType = EmotionalEvent
+	case isPersonalContext(input):
+		eventType = PersonalEvent
+	default:
+		return nil
+	}
+
+	content := strings.TrimSpace(input)
+	if runes := []rune(content); len(runes) > maxEventContentLength {
+		content = string(runes[:maxEventContentLength]) + "…"
+	}
+
+	mood := userMood
+	if mood == "" {
+		mood = "neutral"
+	}
+
+	emotions := make(map[string]float64)
+	if userMood != "" {
+		emotions[userMood] = 0.7
+	}
+	if shandrisMood.Primary != "" {
+		emotions[shandrisMood.Primary] = math.Max(emotions[shandrisMood.Primary], shandrisMood.Intensity*0.5)
+	}
+
+	return &MemoryEvent{
+		Type:      eventType,
+		Content:   content,
+		Timestamp: time.Now(),
+		Context: &EventContext{
+			Mood:      mood,
+			Topics:    topics,
+			UserState: make(map[string]interface{}),
+		},
+		Tags:     topics,
+		Emotions: emotions,
+	}
 }
 
 // CheckAnniversaries checks for upcoming or current anniversaries
@@ -232,19 +320,11 @@ func (tm *TimelineMemory) CheckAnniversaries(current time.Time) []TimelineMarker
 
 // UpdateRelationship modifies relationship data based on new interactions
 func (tm *TimelineMemory) UpdateRelationship(userID string, interaction *Interaction) {
-	rel, exists := tm.relationships[userID]
-	if !exists {
-		rel = &RelationshipMemory{
-			UserID:      userID,
-			Trust:       0.5,
-			Intimacy:    0.1,
-			Preferences: make(map[string]float64),
-		}
-		tm.relationships[userID] = rel
-	}
+	rel := tm.relationshipFor(userID, interaction.Timestamp)
 
 	// Update relationship metrics
 	tm.updateRelationshipMetrics(rel, interaction)
+	tm.relationshipChanged(rel)
 
 	// Store interaction as event if significant
 	if tm.isSignificantInteraction(interaction) {
@@ -270,8 +350,22 @@ func (tm *TimelineMemory) createMarkerFromEvent(event *MemoryEvent) *TimelineMar
 	}
 }
 
+// updateRelationships links a stored event to the relationships of its participants.
+// Personal and emotional moments deepen trust and intimacy beyond everyday chat.
 func (tm *TimelineMemory) updateRelationships(event *MemoryEvent) {
-	// Implementation for updating relationship data based on events
+	if event.Context == nil {
+		return
+	}
+	for _, userID := range event.Context.Participants {
+		rel := tm.relationshipFor(userID, event.Timestamp)
+		rel.Events = append(rel.Events, event.ID)
+		if len(rel.Events) > maxRelationshipEvents {
+			rel.Events = rel.Events[len(rel.Events)-maxRelationshipEvents:]
+		}
+		rel.Trust = warm(rel.Trust, calculateTrustImpact(event)*relationshipEventWeight)
+		rel.Intimacy = warm(rel.Intimacy, calculateIntimacyImpact(event)*relationshipEventWeight)
+		tm.relationshipChanged(rel)
+	}
 }
 
 func (tm *TimelineMemory) scoreMemories(memories []*MemoryEvent, context *EventContext) []*ScoredMemory {
@@ -322,17 +416,12 @@ func (tm *TimelineMemory) isUpcomingAnniversary(marker *TimelineMarker, current
 		return false
 	}
 
-	// Check if anniversary is within next 7 days
-	anniversaryDate := marker.Timestamp
-	nextAnniversary := time.Date(current.Year(), anniversaryDate.Month(), anniversaryDate.Day(), 0, 0, 0, 0, current.Location())
-
-	// If anniversary has passed this year, check next year
-	if nextAnniversary.Before(current) {
-		nextAnniversary = time.Date(current.Year()+1, anniversaryDate.Month(), anniversaryDate.Day(), 0, 0, 0, 0, current.Location())
+	// Check if anniversary is today or within next 7 days
+	next, ok := marker.NextOccurrence(startOfDay(current), current.Location())
+	if !ok {
+		return false
 	}
-
-	daysUntilAnniversary := nextAnniversary.Sub(current).Hours() / 24
-	return daysUntilAnniversary <= 7 && daysUntilAnniversary >= 0
+	return next.At.Sub(current) <= 7*24*time.Hour
 }
 
 func (tm *TimelineMemory) updateRelationshipMetrics(rel *RelationshipMemory, interaction *Interaction) {
@@ -402,5 +491,6 @@ func newMemoryRecall() *MemoryRecall {
 			patterns:     make(map[string]*RecallPattern),
 			associations: make(map[string][]string),
 		},
+		minRelevance: 0.2,
 	}
 }
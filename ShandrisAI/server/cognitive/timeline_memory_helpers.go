@@ -59,6 +59,7 @@ type MemoryRecall struct {
 	contextMapper  *ContextMapper
 	emotionMatcher *EmotionMatcher
 	patternMatcher *PatternMatcher
+	minRelevance   float64
 }
 
 type ContextMapper struct {
@@ -97,13 +98,17 @@ func (mr *MemoryRecall) FindRelevantMemories(context *EventContext, events map[s
 
 	// Combine scores and filter memories
 	for id, event := range events {
+		// A scene character only recalls what they were present for
+		if len(context.Present) > 0 && (event.Context == nil || !sharesAny(event.Context.Present, context.Present)) {
+			continue
+		}
 		score := mr.calculateCombinedScore(
-			contextScores[id],
+			mr.contextMapper.ScoreEvent(event, context, contextScores),
 			emotionScores[id],
 			patternScores[id],
 		)
 
-		if score > 0.5 { // Threshold for relevance
+		if score >= mr.minRelevance {
 			relevant = append(relevant, event)
 		}
 	}
@@ -111,6 +116,15 @@ func (mr *MemoryRecall) FindRelevantMemories(context *EventContext, events map[s
 	return relevant
 }
 
+func sharesAny(a, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func (cm *ContextMapper) MapContext(context *EventContext) map[string]float64 {
 	scores := make(map[string]float64)
 
@@ -135,6 +149,33 @@ func (cm *ContextMapper) MapContext(context *EventContext) map[string]float64 {
 	return scores
 }
 
+// ScoreEvent rates how well an event's own context matches the recall context.
+// Topic overlap counts most, a shared mood adds to it, and any learned weights
+// from MapContext boost the topics they cover.
+func (cm *ContextMapper) ScoreEvent(event *MemoryEvent, context *EventContext, weights map[string]float64) float64 {
+	if event.Context == nil || context == nil {
+		return 0.0
+	}
+
+	score := 0.0
+	if len(context.Topics) > 0 {
+		matched := 0
+		for _, topic := range context.Topics {
+			if containsString(event.Context.Topics, topic) || containsString(event.Tags, topic) {
+				matched++
+				score += weights[topic]
+			}
+		}
+		score += float64(matched) / float64(len(context.Topics))
+	}
+
+	if context.Mood != "" && event.Context.Mood == context.Mood {
+		score += 0.5 + weights["mood"]
+	}
+
+	return score
+}
+
 func (em *EmotionMatcher) MatchEmotions(context *EventContext, events map[string]*MemoryEvent) map[string]float64 {
 	scores := make(map[string]float64)
 
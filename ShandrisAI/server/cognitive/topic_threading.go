@@ -3,6 +3,7 @@ package cognitive
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"time"
 
@@ -38,10 +39,14 @@ type TopicThread struct {
 // TopicManager handles topic threading and context switching
 type TopicManager struct {
 	ActiveThreads   map[string]*TopicThread
+	ArchivedThreads map[string]*TopicThread
 	TopicGraph      map[string]*TopicNode
 	DomainRules     map[string]DomainRule
 	TransitionRules []TransitionRule
 
+	// OnArchive is called whenever a thread is pruned so it can be stored for later resumption
+	OnArchive func(thread *TopicThread)
+
 	// Configuration
 	MaxThreadDepth int
 	MinConfidence  float64
@@ -69,12 +74,13 @@ type TransitionRule struct {
 // NewTopicManager creates a new topic threading system
 func NewTopicManager() *TopicManager {
 	tm := &TopicManager{
-		ActiveThreads:  make(map[string]*TopicThread),
-		TopicGraph:     make(map[string]*TopicNode),
-		DomainRules:    initializeDomainRules(),
-		MaxThreadDepth: 5,
-		MinConfidence:  0.6,
-		DecayRate:      0.1,
+		ActiveThreads:   make(map[string]*TopicThread),
+		ArchivedThreads: make(map[string]*TopicThread),
+		TopicGraph:      make(map[string]*TopicNode),
+		DomainRules:     initializeDomainRules(),
+		MaxThreadDepth:  5,
+		MinConfidence:   0.6,
+		DecayRate:       0.1,
 	}
 
 	tm.initializeTransitionRules()
@@ -101,6 +107,103 @@ func (tm *TopicManager) ProcessInput(input string, context *EmotionalContext) er
 	return nil
 }
 
+// AttachTurn routes a conversation turn to its most relevant thread.
+// Detected domains take precedence over the fallback label; when nothing is
+// detected the turn stays on the most recently active thread. Threads that
+// were pruned earlier are resumed when the conversation returns to them.
+// The returned flag reports whether an archived thread was resumed.
+func (tm *TopicManager) AttachTurn(input, fallbackTopic string, context *EmotionalContext) (*TopicThread, bool) {
+	// Archive stale threads first so a return after a long break resumes them
+	tm.pruneThreads()
+
+	topics := tm.rankedTopics(input, fallbackTopic)
+	if len(topics) == 0 {
+		if thread := tm.mostRecentThread(); thread != nil {
+			tm.updateThread(thread, thread.MainTopic, context)
+			return thread, false
+		}
+		topics = []string{"uncategorized"}
+	}
+
+	primary := topics[0]
+	resumed := false
+	thread := tm.findRelevantThread(primary)
+	if thread == nil {
+		thread = tm.findThreadByTopic(tm.ActiveThreads, primary)
+	}
+	if thread == nil {
+		if thread = tm.resumeThread(primary); thread != nil {
+			resumed = true
+		}
+	}
+	if thread == nil {
+		thread = tm.createNewThread(primary, context)
+	}
+
+	for _, topic := range topics {
+		tm.updateThread(thread, topic, context)
+	}
+	thread.Depth = len(thread.ActiveNodes)
+
+	return thread, resumed
+}
+
+// rankedTopics orders detected domains by priority and confidence, falling back to the given label
+func (tm *TopicManager) rankedTopics(input, fallbackTopic string) []string {
+	detections := tm.detectTopics(input)
+	sort.Slice(detections, func(i, j int) bool {
+		if detections[i].Priority != detections[j].Priority {
+			return detections[i].Priority > detections[j].Priority
+		}
+		return detections[i].Confidence > detections[j].Confidence
+	})
+
+	topics := make([]string, 0, len(detections)+1)
+	for _, detection := range detections {
+		topics = append(topics, detection.Domain)
+	}
+	if len(topics) == 0 && fallbackTopic != "" && fallbackTopic != "uncategorized" {
+		topics = append(topics, fallbackTopic)
+	}
+	return topics
+}
+
+// mostRecentThread returns the active thread that was touched last
+func (tm *TopicManager) mostRecentThread() *TopicThread {
+	var latest *TopicThread
+	for _, thread := range tm.ActiveThreads {
+		if latest == nil || thread.LastActive.After(latest.LastActive) {
+			latest = thread
+		}
+	}
+	return latest
+}
+
+// findThreadByTopic returns the most recent thread in the set that covers the topic
+func (tm *TopicManager) findThreadByTopic(threads map[string]*TopicThread, topic string) *TopicThread {
+	var best *TopicThread
+	for _, thread := range threads {
+		if thread.MainTopic != topic && !contains(thread.ActiveNodes, topic) {
+			continue
+		}
+		if best == nil || thread.LastActive.After(best.LastActive) {
+			best = thread
+		}
+	}
+	return best
+}
+
+// resumeThread moves the most recent archived thread for a topic back into the active set
+func (tm *TopicManager) resumeThread(topic string) *TopicThread {
+	thread := tm.findThreadByTopic(tm.ArchivedThreads, topic)
+	if thread == nil {
+		return nil
+	}
+	delete(tm.ArchivedThreads, thread.ID)
+	tm.ActiveThreads[thread.ID] = thread
+	return thread
+}
+
 // detectTopics identifies potential topics in the input
 func (tm *TopicManager) detectTopics(input string) []TopicDetection {
 	var detections []TopicDetection
@@ -121,9 +224,9 @@ func (tm *TopicManager) detectTopics(input string) []TopicDetection {
 			}
 		}
 
-		// Apply domain-specific validators
+		// Apply domain-specific validators; code detection needs the original casing
 		for _, validator := range rule.Validators {
-			if validator(normalizedInput) {
+			if validator(input) {
 				confidence += 0.3 // Additional confidence for validated patterns
 			}
 		}
@@ -281,8 +384,10 @@ func (tm *TopicManager) calculateRelationshipScore(topic1, topic2 string) float6
 }
 
 func (tm *TopicManager) archiveThread(thread *TopicThread) {
-	// TODO: Implement persistence logic here
-	// This will be implemented when we add persistence
+	tm.ArchivedThreads[thread.ID] = thread
+	if tm.OnArchive != nil {
+		tm.OnArchive(thread)
+	}
 }
 
 // getDomain returns the domain for a given topic
@@ -318,6 +423,10 @@ func initializeDomainRules() map[string]DomainRule {
 		"tech": {
 			Domain:   "tech",
 			Keywords: []string{"coding", "programming", "software", "computer", "algorithm"},
+			Validators: []func(string) bool{
+				containsTechPattern,
+				containsCodeReference,
+			},
 			Priority: 3,
 			Transitions: map[string]float64{
 				"science": 0.8,
@@ -0,0 +1,513 @@
+package cognitive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// World entity kinds
+const (
+	WorldParty    = "party"
+	WorldLocation = "location"
+	WorldItem     = "item"
+	WorldNPC      = "npc"
+	WorldQuest    = "quest"
+	WorldFaction  = "faction"
+)
+
+// World relations with special meaning when rendering
+const (
+	RelationLocatedIn = "located_in"
+	RelationCarries   = "carries"
+	RelationKnows     = "knows"
+)
+
+// partyID is the entity the player's party is tracked under
+const partyID = "party"
+
+// maxWorldLines caps how much world state is rendered into a prompt
+const maxWorldLines = 15
+
+var worldKinds = map[string]bool{
+	WorldParty:    true,
+	WorldLocation: true,
+	WorldItem:     true,
+	WorldNPC:      true,
+	WorldQuest:    true,
+	WorldFaction:  true,
+}
+
+// relationTargetKinds is the kind given to a relation target that doesn't exist yet
+var relationTargetKinds = map[string]string{
+	RelationLocatedIn: WorldLocation,
+	RelationCarries:   WorldItem,
+	RelationKnows:     WorldNPC,
+}
+
+// WorldEntity is a location, item, NPC, quest or other thing in a roleplay scene
+type WorldEntity struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes"`
+	Relations  []WorldRelation   `json:"relations"`
+}
+
+// WorldRelation links an entity to another, e.g. party carries moonblade
+type WorldRelation struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// WorldState is a session's roleplay world
+type WorldState struct {
+	Turn     int                     `json:"turn"`
+	Entities map[string]*WorldEntity `json:"entities"`
+}
+
+// WorldOp is one change to the world, from a command or the model's <world> block
+type WorldOp struct {
+	Op         string            `json:"op"` // add, set, unset, remove, relate, unrelate
+	Entity     string            `json:"entity,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Key        string            `json:"key,omitempty"`
+	Value      string            `json:"value,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Relation   string            `json:"relation,omitempty"`
+	Target     string            `json:"target,omitempty"`
+}
+
+// WorldCommand is a parsed /world command
+type WorldCommand struct {
+	Action string // show, apply, rewind, reset
+	Ops    []WorldOp
+	Turns  int // For rewind
+}
+
+// NewWorldState creates an empty world
+func NewWorldState() *WorldState {
+	return &WorldState{Entities: make(map[string]*WorldEntity)}
+}
+
+// Clone deep-copies the state, for per-turn snapshots
+func (ws *WorldState) Clone() *WorldState {
+	clone := &WorldState{Turn: ws.Turn, Entities: make(map[string]*WorldEntity, len(ws.Entities))}
+	for id, entity := range ws.Entities {
+		copied := *entity
+		copied.Attributes = make(map[string]string, len(entity.Attributes))
+		for k, v := range entity.Attributes {
+			copied.Attributes[k] = v
+		}
+		copied.Relations = append([]WorldRelation(nil), entity.Relations...)
+		clone.Entities[id] = &copied
+	}
+	return clone
+}
+
+// Entity finds an entity by ID or name
+func (ws *WorldState) Entity(ref string) (*WorldEntity, bool) {
+	entity, err := ws.lookup(ref)
+	return entity, err == nil
+}
+
+// EnsureEntity returns the named entity, adding it with the given kind if it doesn't exist
+func (ws *WorldState) EnsureEntity(name, kind string) *WorldEntity {
+	if entity, err := ws.lookup(name); err == nil {
+		return entity
+	}
+	return ws.ensureEntity(name, kind)
+}
+
+// IsEmpty reports whether nothing has been recorded yet
+func (ws *WorldState) IsEmpty() bool {
+	return len(ws.Entities) == 0
+}
+
+// Apply runs the operations in order. Invalid operations are skipped and reported.
+func (ws *WorldState) Apply(ops []WorldOp) error {
+	var errs []error
+	for i, op := range ops {
+		if err := ws.applyOp(op); err != nil {
+			errs = append(errs, fmt.Errorf("op %d (%s): %w", i, op.Op, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (ws *WorldState) applyOp(op WorldOp) error {
+	switch op.Op {
+	case "add":
+		if op.Name == "" {
+			return errors.New("name is required")
+		}
+		kind := strings.ToLower(op.Kind)
+		if !worldKinds[kind] {
+			return fmt.Errorf("unknown kind %q", op.Kind)
+		}
+		entity := ws.ensureEntity(op.Name, kind)
+		for k, v := range op.Attributes {
+			entity.Attributes[strings.ToLower(k)] = v
+		}
+		return nil
+
+	case "set", "unset":
+		entity, err := ws.lookup(op.Entity)
+		if err != nil {
+			return err
+		}
+		if op.Key == "" {
+			return errors.New("key is required")
+		}
+		if op.Op == "unset" {
+			delete(entity.Attributes, strings.ToLower(op.Key))
+		} else {
+			entity.Attributes[strings.ToLower(op.Key)] = op.Value
+		}
+		return nil
+
+	case "remove":
+		entity, err := ws.lookup(op.Entity)
+		if err != nil {
+			return err
+		}
+		delete(ws.Entities, entity.ID)
+		// Nothing may keep pointing at a removed entity
+		for _, other := range ws.Entities {
+			other.Relations = removeRelations(other.Relations, "", entity.ID)
+		}
+		return nil
+
+	case "relate", "unrelate":
+		entity, err := ws.lookup(op.Entity)
+		if err != nil {
+			return err
+		}
+		relation := strings.ToLower(op.Relation)
+		if relation == "" || op.Target == "" {
+			return errors.New("relation and target are required")
+		}
+
+		if op.Op == "unrelate" {
+			target, err := ws.lookup(op.Target)
+			if err != nil {
+				return err
+			}
+			entity.Relations = removeRelations(entity.Relations, relation, target.ID)
+			return nil
+		}
+
+		target, err := ws.lookup(op.Target)
+		if err != nil {
+			kind, known := relationTargetKinds[relation]
+			if !known {
+				return err
+			}
+			target = ws.ensureEntity(op.Target, kind)
+		}
+		if relation == RelationLocatedIn {
+			// Something is only ever in one place
+			entity.Relations = removeRelations(entity.Relations, RelationLocatedIn, "")
+		}
+		if relation == RelationCarries {
+			// Handing an item over takes it from whoever carried it
+			for _, other := range ws.Entities {
+				other.Relations = removeRelations(other.Relations, RelationCarries, target.ID)
+			}
+		}
+		entity.Relations = append(removeRelations(entity.Relations, relation, target.ID),
+			WorldRelation{Type: relation, Target: target.ID})
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// ensureEntity returns the entity with the name's ID, creating it if needed
+func (ws *WorldState) ensureEntity(name, kind string) *WorldEntity {
+	id := worldID(name)
+	if kind == WorldParty {
+		// There is a single party, whatever it is called
+		id = partyID
+	}
+	if entity, exists := ws.Entities[id]; exists {
+		return entity
+	}
+	entity := &WorldEntity{ID: id, Kind: kind, Name: strings.TrimSpace(name), Attributes: make(map[string]string)}
+	ws.Entities[id] = entity
+	return entity
+}
+
+func (ws *WorldState) lookup(ref string) (*WorldEntity, error) {
+	id := worldID(ref)
+	if entity, exists := ws.Entities[id]; exists {
+		return entity, nil
+	}
+	for _, entity := range ws.Entities {
+		if worldID(entity.Name) == id {
+			return entity, nil
+		}
+	}
+	switch id {
+	case partyID, "we", "us":
+		return ws.ensureEntity("Party", WorldParty), nil
+	}
+	return nil, fmt.Errorf("unknown entity %q", ref)
+}
+
+// Render describes the parts of the world relevant to the conversation window: the party,
+// where it is and who is there, open quests, and anything mentioned in the window
+func (ws *WorldState) Render(window string) string {
+	if ws.IsEmpty() {
+		return ""
+	}
+	window = strings.ToLower(window)
+
+	relevant := make(map[string]bool)
+	if party, exists := ws.Entities[partyID]; exists {
+		relevant[partyID] = true
+		for _, rel := range party.Relations {
+			relevant[rel.Target] = true
+		}
+		if location := ws.locationOf(party); location != "" {
+			for id, entity := range ws.Entities {
+				if ws.locationOf(entity) == location {
+					relevant[id] = true
+				}
+			}
+		}
+	}
+	for id, entity := range ws.Entities {
+		if entity.Kind == WorldQuest && !questClosed(entity) {
+			relevant[id] = true
+		}
+		if strings.Contains(window, strings.ToLower(entity.Name)) {
+			relevant[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(relevant))
+	for id := range relevant {
+		if _, exists := ws.Entities[id]; exists {
+			ids = append(ids, id)
+		}
+	}
+	kindOrder := map[string]int{WorldParty: 0, WorldLocation: 1, WorldQuest: 2, WorldNPC: 3, WorldItem: 4, WorldFaction: 5}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ws.Entities[ids[i]], ws.Entities[ids[j]]
+		if kindOrder[a.Kind] != kindOrder[b.Kind] {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		return a.Name < b.Name
+	})
+
+	var lines []string
+	for _, id := range ids {
+		if len(lines) == maxWorldLines {
+			lines = append(lines, fmt.Sprintf("- (%d more not shown)", len(ids)-maxWorldLines))
+			break
+		}
+		lines = append(lines, "- "+ws.describeEntity(ws.Entities[id]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (ws *WorldState) describeEntity(entity *WorldEntity) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)", entity.Name, entity.Kind)
+
+	keys := make([]string, 0, len(entity.Attributes))
+	for k := range entity.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var attrs []string
+	for _, k := range keys {
+		attrs = append(attrs, k+": "+entity.Attributes[k])
+	}
+	if len(attrs) > 0 {
+		b.WriteString(" — " + strings.Join(attrs, ", "))
+	}
+
+	var relations []string
+	for _, rel := range entity.Relations {
+		name := rel.Target
+		if target, exists := ws.Entities[rel.Target]; exists {
+			name = target.Name
+		}
+		relations = append(relations, strings.ReplaceAll(rel.Type, "_", " ")+" "+name)
+	}
+	if len(relations) > 0 {
+		b.WriteString("; " + strings.Join(relations, "; "))
+	}
+	return b.String()
+}
+
+func (ws *WorldState) locationOf(entity *WorldEntity) string {
+	for _, rel := range entity.Relations {
+		if rel.Type == RelationLocatedIn {
+			return rel.Target
+		}
+	}
+	return ""
+}
+
+var worldBlock = regexp.MustCompile(`(?s)<world>(.*?)</world>\s*`)
+
+// ExtractWorldUpdates removes <world>[...]</world> blocks from model output and returns the
+// operations they hold. Blocks that aren't valid JSON are dropped from the text and reported.
+func ExtractWorldUpdates(output string) (string, []WorldOp, error) {
+	var ops []WorldOp
+	var errs []error
+	for _, match := range worldBlock.FindAllStringSubmatch(output, -1) {
+		var blockOps []WorldOp
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1])), &blockOps); err != nil {
+			errs = append(errs, fmt.Errorf("invalid world block: %w", err))
+			continue
+		}
+		ops = append(ops, blockOps...)
+	}
+	cleaned := strings.TrimSpace(worldBlock.ReplaceAllString(output, ""))
+	return cleaned, ops, errors.Join(errs...)
+}
+
+// IsWorldCommand reports whether the prompt is a /world command
+func IsWorldCommand(input string) bool {
+	fields := strings.Fields(input)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "/world")
+}
+
+// ParseWorldCommand parses:
+//
+//	/world [show]
+//	/world add <kind> <name>
+//	/world set <entity>.<key> <value>
+//	/world unset <entity>.<key>
+//	/world remove <entity>
+//	/world relate <entity> <relation> <target>
+//	/world unrelate <entity> <relation> <target>
+//	/world rewind [turns]
+//	/world reset
+//
+// Multi-word names are written with underscores or quotes, e.g. "Old Mill"; the last argument
+// may also be left unquoted.
+func ParseWorldCommand(input string) (WorldCommand, error) {
+	args := splitCommandArgs(input)
+	if len(args) == 0 || !strings.EqualFold(args[0], "/world") {
+		return WorldCommand{}, errors.New("not a /world command")
+	}
+	args = args[1:]
+	if len(args) == 0 {
+		return WorldCommand{Action: "show"}, nil
+	}
+
+	verb, args := strings.ToLower(args[0]), args[1:]
+	usage := func(form string) (WorldCommand, error) {
+		return WorldCommand{}, fmt.Errorf("usage: /world %s", form)
+	}
+
+	switch verb {
+	case "show", "reset":
+		return WorldCommand{Action: verb}, nil
+	case "rewind":
+		turns := 1
+		if len(args) > 0 {
+			if _, err := fmt.Sscanf(args[0], "%d", &turns); err != nil || turns < 1 {
+				return usage("rewind [turns]")
+			}
+		}
+		return WorldCommand{Action: "rewind", Turns: turns}, nil
+	case "add":
+		if len(args) < 2 {
+			return usage("add <kind> <name>")
+		}
+		return applyCommand(WorldOp{Op: "add", Kind: args[0], Name: commandName(args[1:])}), nil
+	case "set", "unset":
+		if len(args) < 1 || (verb == "set" && len(args) < 2) {
+			return usage(verb + " <entity>.<key> <value>")
+		}
+		entity, key, found := strings.Cut(args[0], ".")
+		if !found || key == "" {
+			return usage(verb + " <entity>.<key> <value>")
+		}
+		op := WorldOp{Op: verb, Entity: commandName([]string{entity}), Key: key}
+		if verb == "set" {
+			op.Value = strings.Join(args[1:], " ")
+		}
+		return applyCommand(op), nil
+	case "remove":
+		if len(args) < 1 {
+			return usage("remove <entity>")
+		}
+		return applyCommand(WorldOp{Op: "remove", Entity: commandName(args)}), nil
+	case "relate", "unrelate":
+		if len(args) < 3 {
+			return usage(verb + " <entity> <relation> <target>")
+		}
+		return applyCommand(WorldOp{Op: verb, Entity: commandName(args[:1]), Relation: args[1], Target: commandName(args[2:])}), nil
+	}
+	return WorldCommand{}, fmt.Errorf("unknown /world command %q", verb)
+}
+
+// Helper functions
+
+func applyCommand(op WorldOp) WorldCommand {
+	return WorldCommand{Action: "apply", Ops: []WorldOp{op}}
+}
+
+// splitCommandArgs splits on spaces, keeping double-quoted arguments together
+func splitCommandArgs(input string) []string {
+	var args []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range strings.TrimSpace(input) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func commandName(args []string) string {
+	return strings.ReplaceAll(strings.Join(args, " "), "_", " ")
+}
+
+var nonWorldID = regexp.MustCompile(`[^a-z0-9]+`)
+
+// worldID derives an entity ID from its name, so references by name resolve
+func worldID(name string) string {
+	return strings.Trim(nonWorldID.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+func removeRelations(relations []WorldRelation, relationType, target string) []WorldRelation {
+	kept := relations[:0]
+	for _, rel := range relations {
+		if (relationType == "" || rel.Type == relationType) && (target == "" || rel.Target == target) {
+			continue
+		}
+		kept = append(kept, rel)
+	}
+	return kept
+}
+
+func questClosed(quest *WorldEntity) bool {
+	switch strings.ToLower(quest.Attributes["status"]) {
+	case "complete", "completed", "done", "failed", "abandoned":
+		return true
+	}
+	return false
+}
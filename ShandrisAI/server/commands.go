@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commands are the batch jobs that run from the command line instead of starting the server
+var commands = map[string]func(args []string) error{
+	"mine-patterns": runMinePatterns,
+	"analyze":       runAnalyze,
+}
+
+// RunCommand runs the named command-line job
+func RunCommand(name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return command(args)
+}
+
+// runMinePatterns replays new chat history through the pattern engine, then optionally
+// prints a session's pattern report
+func runMinePatterns(args []string) error {
+	flags := flag.NewFlagSet("mine-patterns", flag.ContinueOnError)
+	full := flags.Bool("full", false, "discard stored pattern occurrences and replay the whole chat history")
+	session := flags.String("report", "", "print the pattern report for this session after mining")
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := checkDataDir(); err != nil {
+		return err
+	}
+	InitDB()
+	InitThemes()
+
+	result, err := MinePatterns(*full)
+	if err != nil {
+		return err
+	}
+	if *session == "" {
+		if *asJSON {
+			return json.NewEncoder(os.Stdout).Encode(result)
+		}
+		fmt.Printf("Replayed %d messages from %d sessions: %d pattern occurrences (watermark %d)\n",
+			result.Messages, result.Sessions, result.Occurrences, result.Watermark)
+		return nil
+	}
+
+	insights, err := PatternReport(*session)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"mining":     result,
+			"session_id": *session,
+			"patterns":   insights,
+		})
+	}
+	fmt.Printf("Patterns for %s:\n", *session)
+	if len(insights) == 0 {
+		fmt.Println("  (none yet)")
+	}
+	for _, insight := range insights {
+		fmt.Printf("  - %s (%d times, strength %.2f)\n", insight.Summary, insight.Occurrences, insight.Strength)
+	}
+	return nil
+}
+
+// runAnalyze prints an analytics report: analyze <report> [flags]
+func runAnalyze(args []string) error {
+	usage := fmt.Errorf("usage: analyze <%s> [flags]", strings.Join(AnalyticsReportNames(), "|"))
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usage
+	}
+	report := args[0]
+
+	flags := flag.NewFlagSet("analyze "+report, flag.ContinueOnError)
+	from := flags.String("from", "", "first day to include (YYYY-MM-DD or RFC 3339)")
+	to := flags.String("to", "", "last day to include (YYYY-MM-DD or RFC 3339)")
+	session := flags.String("session", "", "only include this session")
+	interval := flags.String("interval", "week", "time bucket: day, week or month")
+	periods := flags.Int("periods", defaultRetentionPeriods, "periods to follow each retention cohort for")
+	format := flags.String("format", "text", "output format: text, csv or json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if _, ok := analyticsReports[report]; !ok {
+		return usage
+	}
+	switch *format {
+	case "text", "csv", "json":
+	default:
+		return fmt.Errorf("format must be text, csv or json, not %q", *format)
+	}
+
+	filter, err := NewAnalyticsFilter(*from, *to, *session, *interval, *periods)
+	if err != nil {
+		return err
+	}
+
+	InitDB()
+	table, err := RunAnalyticsReport(report, filter)
+	if err != nil {
+		return err
+	}
+	return WriteAnalytics(os.Stdout, table, *format)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// dataDir is the root of the shipped data files: personas, themes and safety resources.
+// SHANDRIS_DATA_DIR sets it; otherwise a "data" directory is looked for in the working
+// directory and then its parent, so Shandris runs from the module root or from cmd/.
+var dataDir = envOr("SHANDRIS_DATA_DIR", findDataDir())
+
+func findDataDir() string {
+	for _, dir := range []string{"data", filepath.Join("..", "data")} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			if abs, err := filepath.Abs(dir); err == nil {
+				return abs
+			}
+			return dir
+		}
+	}
+	return "data"
+}
+
+// dataPath resolves a path under the data root
+func dataPath(elem ...string) string {
+	return filepath.Join(append([]string{dataDir}, elem...)...)
+}
+
+// checkDataDir reports a missing data root before anything tries to load from it
+func checkDataDir() error {
+	info, err := os.Stat(dataDir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("data directory %s not found: run from the module root or set SHANDRIS_DATA_DIR", dataDir)
+	}
+	return nil
+}
@@ -45,6 +45,7 @@ CREATE TABLE IF NOT EXISTS topics (
 -- Timeline and Memory tables
 CREATE TABLE IF NOT EXISTS memory_events (
     id UUID PRIMARY KEY,
+    session_id TEXT,
     type VARCHAR(50) NOT NULL,
     content TEXT NOT NULL,
     timestamp TIMESTAMP NOT NULL,
@@ -60,6 +61,7 @@ CREATE TABLE IF NOT EXISTS memory_events (
 
 CREATE TABLE IF NOT EXISTS timeline_markers (
     id UUID PRIMARY KEY,
+    session_id TEXT,
     type VARCHAR(50) NOT NULL,
     description TEXT NOT NULL,
     timestamp TIMESTAMP NOT NULL,
@@ -69,6 +71,186 @@ CREATE TABLE IF NOT EXISTS timeline_markers (
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Proactive messages waiting to be generated and delivered
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id UUID PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    origin VARCHAR(50) NOT NULL,
+    dedupe_key TEXT NOT NULL,
+    instruction TEXT NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    deliver_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (session_id, dedupe_key)
+);
+
+-- Active persona and transition history per session
+CREATE TABLE IF NOT EXISTS session_personas (
+    session_id TEXT PRIMARY KEY,
+    active_persona VARCHAR(100) NOT NULL DEFAULT '',
+    history JSONB NOT NULL,
+    cooldowns JSONB NOT NULL,
+    context_stack TEXT[] NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Character cards as imported, so exports keep the fields Shandris doesn't model
+CREATE TABLE IF NOT EXISTS character_cards (
+    name VARCHAR(100) PRIMARY KEY,
+    card JSONB NOT NULL,
+    imported_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Lore entries injected into the prompt when their keys are mentioned
+CREATE TABLE IF NOT EXISTS lore_entries (
+    id TEXT PRIMARY KEY,
+    character_name VARCHAR(100) NOT NULL DEFAULT '',
+    name VARCHAR(200) NOT NULL DEFAULT '',
+    keys TEXT[] NOT NULL,
+    patterns TEXT[] NOT NULL DEFAULT '{}',
+    content TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    position VARCHAR(30) NOT NULL DEFAULT 'after_character',
+    token_cost INTEGER NOT NULL DEFAULT 0,
+    recursive BOOLEAN NOT NULL DEFAULT false,
+    case_sensitive BOOLEAN NOT NULL DEFAULT false,
+    constant BOOLEAN NOT NULL DEFAULT false,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Roleplay world per session, with a snapshot per turn for rewinding
+CREATE TABLE IF NOT EXISTS world_states (
+    session_id TEXT PRIMARY KEY,
+    state JSONB NOT NULL,
+    turn INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS world_snapshots (
+    session_id TEXT NOT NULL,
+    turn INTEGER NOT NULL,
+    state JSONB NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (session_id, turn)
+);
+
+-- Fight in progress per session, and every dice roll for auditing
+CREATE TABLE IF NOT EXISTS combats (
+    session_id TEXT PRIMARY KEY,
+    state JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS dice_rolls (
+    id SERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    seed BIGINT NOT NULL,
+    notation VARCHAR(100) NOT NULL,
+    rolls INTEGER[] NOT NULL,
+    dropped INTEGER[],
+    modifier INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL,
+    purpose TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Multi-character scene running in a session
+CREATE TABLE IF NOT EXISTS session_scenes (
+    session_id TEXT PRIMARY KEY,
+    scene JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deployment-wide settings changed by admins, e.g. the boundary ceiling
+CREATE TABLE IF NOT EXISTS deployment_settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit trail of crisis detections: severity and categories only, never the message
+CREATE TABLE IF NOT EXISTS safety_events (
+    id SERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Shandris's relationship with each user: trust and closeness that build over time
+CREATE TABLE IF NOT EXISTS user_relationships (
+    session_id TEXT PRIMARY KEY,
+    trust FLOAT NOT NULL DEFAULT 0.5,
+    intimacy FLOAT NOT NULL DEFAULT 0.1,
+    shared_topics TEXT[] NOT NULL DEFAULT '{}',
+    preferences JSONB NOT NULL DEFAULT '{}',
+    events TEXT[] NOT NULL DEFAULT '{}',
+    milestones TEXT[] NOT NULL DEFAULT '{}',
+    interactions INTEGER NOT NULL DEFAULT 0,
+    first_interaction TIMESTAMP WITH TIME ZONE,
+    last_interaction TIMESTAMP WITH TIME ZONE
+);
+
+-- Conversational themes each session is in, and how it moved between them
+CREATE TABLE IF NOT EXISTS session_themes (
+    session_id TEXT PRIMARY KEY,
+    active_themes JSONB NOT NULL DEFAULT '{}',
+    history JSONB NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Recurring patterns found by replaying each session's chat history
+CREATE TABLE IF NOT EXISTS pattern_occurrences (
+    id SERIAL PRIMARY KEY,
+    pattern_id VARCHAR(255) NOT NULL,
+    session_id TEXT NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+    context_data JSONB NOT NULL,
+    strength FLOAT NOT NULL,
+    duration INTERVAL NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- How far each batch job has read through chat_history
+CREATE TABLE IF NOT EXISTS batch_watermarks (
+    job TEXT PRIMARY KEY,
+    last_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-session mood state for Shandris
+CREATE TABLE IF NOT EXISTS session_moods (
+    session_id TEXT PRIMARY KEY,
+    primary_mood VARCHAR(50) NOT NULL,
+    secondary_mood VARCHAR(50) NOT NULL DEFAULT '',
+    intensity FLOAT NOT NULL,
+    last_updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    context JSONB NOT NULL,
+    history JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Concurrent topic threads per session, archived threads kept for resumption
+CREATE TABLE IF NOT EXISTS topic_threads (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    main_topic VARCHAR(100) NOT NULL,
+    active_nodes TEXT[] NOT NULL,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_active TIMESTAMP WITH TIME ZONE NOT NULL,
+    depth INTEGER NOT NULL DEFAULT 1,
+    archived BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Persona System tables
 CREATE TABLE IF NOT EXISTS personas (
     id UUID PRIMARY KEY,
@@ -147,11 +329,19 @@ CREATE INDEX IF NOT EXISTS idx_traits_user_id ON traits(user_id);
 CREATE INDEX IF NOT EXISTS idx_topics_category ON topics(category);
 CREATE INDEX IF NOT EXISTS idx_memory_events_type ON memory_events(type);
 CREATE INDEX IF NOT EXISTS idx_memory_events_timestamp ON memory_events(timestamp);
+CREATE INDEX IF NOT EXISTS idx_memory_events_session ON memory_events(session_id, importance);
 CREATE INDEX IF NOT EXISTS idx_timeline_markers_type ON timeline_markers(type);
 CREATE INDEX IF NOT EXISTS idx_timeline_markers_timestamp ON timeline_markers(timestamp);
+CREATE INDEX IF NOT EXISTS idx_timeline_markers_session ON timeline_markers(session_id);
 CREATE INDEX IF NOT EXISTS idx_personas_type ON personas(type);
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_last_active ON sessions(last_active);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_pending ON outbox_messages(session_id, status, deliver_at);
+CREATE INDEX IF NOT EXISTS idx_topic_threads_session ON topic_threads(session_id, last_active);
+CREATE INDEX IF NOT EXISTS idx_lore_entries_character ON lore_entries(character_name);
+CREATE INDEX IF NOT EXISTS idx_dice_rolls_session ON dice_rolls(session_id, id);
+CREATE INDEX IF NOT EXISTS idx_safety_events_session ON safety_events(session_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_pattern_occurrences_session ON pattern_occurrences(session_id, pattern_id);
 
 -- Add GiST index for text search on topics
 CREATE INDEX IF NOT EXISTS idx_topics_keywords ON topics USING GIN (keywords);
@@ -8,9 +8,20 @@ import (
 	"strings"
 )
 
+// deepSeekModel is the model every reply is generated with unless another is chosen
+const deepSeekModel = "deepseek-r1:8b"
+
+// codeModel, if set, generates technical-support replies; SHANDRIS_CODE_MODEL names an Ollama model
+var codeModel = envOr("SHANDRIS_CODE_MODEL", "")
+
 func RunDeepSeek(context string) (string, error) {
+	return RunModel(deepSeekModel, context)
+}
+
+// RunModel generates a reply with the named Ollama model
+func RunModel(model, context string) (string, error) {
 	//Log the context being passed to the model
-	fmt.Println("🧾 Context being passed to DeepSeek:\n--------------------------------")
+	fmt.Printf("🧾 Context being passed to %s:\n--------------------------------\n", model)
 	fmt.Println(context)
 	fmt.Println("--------------------------------")
 
@@ -27,8 +38,8 @@ func RunDeepSeek(context string) (string, error) {
 		return "", fmt.Errorf("error writing to temp file: %w", err)
 	}
 
-	// Run DeepSeek model
-	cmd := exec.Command("C:\\Users\\aikaw\\AppData\\Local\\Programs\\Ollama\\ollama.exe", "run", "deepseek-r1:8b")
+	// Run the model through Ollama
+	cmd := exec.Command("C:\\Users\\aikaw\\AppData\\Local\\Programs\\Ollama\\ollama.exe", "run", model)
 	cmd.Stdin = strings.NewReader(context)
 
 	var outBuffer, errBuffer bytes.Buffer
@@ -37,7 +48,7 @@ func RunDeepSeek(context string) (string, error) {
 
 	err = cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("DeepSeek error: %s\n%s", err, errBuffer.String())
+		return "", fmt.Errorf("%s error: %s\n%s", model, err, errBuffer.String())
 	}
 
 	return CleanANSI(outBuffer.String()), nil
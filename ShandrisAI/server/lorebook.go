@@ -0,0 +1,342 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// loreScanDepth is how many recent chat turns are scanned for lore triggers, besides the prompt
+const loreScanDepth = 3
+
+// loreBudget is the token budget for lore injected into a prompt
+var loreBudget = loreBudgetFromEnv()
+
+// LoreExport is the lorebook file format used by import and export
+type LoreExport struct {
+	Version int                   `json:"version"`
+	Entries []cognitive.LoreEntry `json:"entries"`
+}
+
+// LoadLoreEntries returns the stored lore entries; an empty character returns every entry
+func LoadLoreEntries(character string) ([]cognitive.LoreEntry, error) {
+	rows, err := db.Query(`
+		SELECT id, character_name, name, keys, patterns, content, priority, position,
+			token_cost, recursive, case_sensitive, constant, enabled
+		FROM lore_entries
+		WHERE $1 = '' OR character_name = $1
+		ORDER BY character_name, priority DESC, name
+	`, character)
+	if err != nil {
+		return nil, fmt.Errorf("error loading lore entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []cognitive.LoreEntry{}
+	for rows.Next() {
+		var e cognitive.LoreEntry
+		if err := rows.Scan(&e.ID, &e.Character, &e.Name, pq.Array(&e.Keys), pq.Array(&e.Patterns), &e.Content,
+			&e.Priority, &e.Position, &e.TokenCost, &e.Recursive, &e.CaseSensitive, &e.Constant, &e.Enabled); err != nil {
+			return nil, fmt.Errorf("error reading lore entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SaveLoreEntry validates and upserts an entry, assigning an ID to new entries
+func SaveLoreEntry(entry *cognitive.LoreEntry) error {
+	if err := cognitive.ValidateLoreEntry(*entry); err != nil {
+		return err
+	}
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	if entry.Position == "" {
+		entry.Position = cognitive.LoreAfterCharacter
+	}
+	if entry.Keys == nil {
+		entry.Keys = []string{}
+	}
+	if entry.Patterns == nil {
+		entry.Patterns = []string{}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO lore_entries (id, character_name, name, keys, patterns, content, priority, position,
+			token_cost, recursive, case_sensitive, constant, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			character_name = EXCLUDED.character_name,
+			name = EXCLUDED.name,
+			keys = EXCLUDED.keys,
+			patterns = EXCLUDED.patterns,
+			content = EXCLUDED.content,
+			priority = EXCLUDED.priority,
+			position = EXCLUDED.position,
+			token_cost = EXCLUDED.token_cost,
+			recursive = EXCLUDED.recursive,
+			case_sensitive = EXCLUDED.case_sensitive,
+			constant = EXCLUDED.constant,
+			enabled = EXCLUDED.enabled,
+			updated_at = CURRENT_TIMESTAMP
+	`, entry.ID, entry.Character, entry.Name, pq.Array(entry.Keys), pq.Array(entry.Patterns), entry.Content,
+		entry.Priority, entry.Position, entry.TokenCost, entry.Recursive, entry.CaseSensitive, entry.Constant, entry.Enabled)
+	if err != nil {
+		return fmt.Errorf("error saving lore entry: %w", err)
+	}
+	return nil
+}
+
+// DeleteLoreEntry removes an entry, reporting whether it existed
+func DeleteLoreEntry(id string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM lore_entries WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting lore entry: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// SessionLore picks the lore entries triggered by the prompt and the latest turns,
+// scoped to the speaking character and active persona
+func SessionLore(prompt string, history []ChatTurn, characters ...string) []cognitive.LoreEntry {
+	entries, err := LoadLoreEntries("")
+	if err != nil {
+		LogError(err, "Failed to load lore entries")
+		return nil
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	start := len(history) - loreScanDepth
+	if start < 0 {
+		start = 0
+	}
+	var window []string
+	for _, turn := range history[start:] {
+		window = append(window, turn.UserMessage, turn.AIResponse)
+	}
+	window = append(window, prompt)
+
+	lore := cognitive.NewLorebook(entries, loreBudget).Activate(window, characters)
+	if len(lore) > 0 {
+		DebugLogger.Printf("📜 Injecting %d lore entries", len(lore))
+	}
+	return lore
+}
+
+// renderLore renders the entries for one prompt position
+func renderLore(entries []cognitive.LoreEntry, position string) string {
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.Position == position {
+			b.WriteString("- " + strings.TrimSpace(entry.Content) + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+
+	if position == cognitive.LoreBeforeUser {
+		return "[World notes for this reply:\n" + b.String() + "]\n"
+	}
+	return "\nWORLD KNOWLEDGE (canon; stay consistent with it, don't recite it):\n" + b.String()
+}
+
+// AdminLoreHandler lists (GET ?character=), creates or updates (POST) and deletes (DELETE ?id=) lore entries
+func AdminLoreHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminLoreHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := LoadLoreEntries(r.URL.Query().Get("character"))
+		if err != nil {
+			LogError(err, "Failed to list lore entries")
+			http.Error(w, "Failed to list lore entries", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+
+	case http.MethodPost:
+		var entry cognitive.LoreEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := SaveLoreEntry(&entry); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		InfoLogger.Printf("📜 Saved lore entry %s (%s)", entry.ID, entry.Name)
+		json.NewEncoder(w).Encode(entry)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		deleted, err := DeleteLoreEntry(id)
+		if err != nil {
+			LogError(err, "Failed to delete lore entry")
+			http.Error(w, "Failed to delete lore entry", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Unknown lore entry", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"deleted": id})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AdminLoreExportHandler exports the lorebook, optionally for one character (?character=)
+func AdminLoreExportHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminLoreExportHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := LoadLoreEntries(r.URL.Query().Get("character"))
+	if err != nil {
+		LogError(err, "Failed to export lore entries")
+		http.Error(w, "Failed to export lore entries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="lorebook.json"`)
+	json.NewEncoder(w).Encode(LoreExport{Version: 1, Entries: entries})
+}
+
+// AdminLoreImportHandler imports a lorebook export, or a character card's character_book
+// (?character= scopes the card entries). Entries with an existing ID are updated.
+func AdminLoreImportHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminLoreImportHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxCardSize))
+	if err != nil {
+		http.Error(w, "Could not read lorebook", http.StatusBadRequest)
+		return
+	}
+
+	var entries []cognitive.LoreEntry
+	var probe struct {
+		Entries []json.RawMessage `json:"entries"`
+		Version int               `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if probe.Version > 0 {
+		var export LoreExport
+		if err := json.Unmarshal(raw, &export); err != nil {
+			http.Error(w, "Invalid lorebook", http.StatusBadRequest)
+			return
+		}
+		entries = export.Entries
+	} else {
+		var book CharacterBook
+		if err := json.Unmarshal(raw, &book); err != nil {
+			http.Error(w, "Invalid character book", http.StatusBadRequest)
+			return
+		}
+		entries = cardBookToLore(r.URL.Query().Get("character"), &book)
+	}
+
+	saved := 0
+	var problems []string
+	for i := range entries {
+		if err := SaveLoreEntry(&entries[i]); err != nil {
+			problems = append(problems, fmt.Sprintf("entries[%d]: %v", i, err))
+			continue
+		}
+		saved++
+	}
+	InfoLogger.Printf("📜 Imported %d of %d lore entries", saved, len(entries))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": saved,
+		"errors":   problems,
+	})
+}
+
+// cardBookToLore converts a character card's lorebook into lore entries for the character
+func cardBookToLore(character string, book *CharacterBook) []cognitive.LoreEntry {
+	var entries []cognitive.LoreEntry
+	scope := cardLoreScope(character, book)
+	for i, entry := range book.Entries {
+		priority := entry.InsertionOrder
+		if entry.Priority != nil {
+			priority = *entry.Priority
+		}
+		position := cognitive.LoreAfterCharacter
+		if entry.Position == "before_char" {
+			position = cognitive.LoreBeforeCharacter
+		}
+		recursive := book.RecursiveScanning != nil && *book.RecursiveScanning
+
+		entries = append(entries, cognitive.LoreEntry{
+			ID:            cardLoreID(scope, i),
+			Character:     character,
+			Name:          entry.Name,
+			Keys:          entry.Keys,
+			Content:       entry.Content,
+			Priority:      priority,
+			Position:      position,
+			Recursive:     recursive,
+			CaseSensitive: entry.CaseSensitive != nil && *entry.CaseSensitive,
+			Constant:      entry.Constant != nil && *entry.Constant,
+			Enabled:       entry.Enabled,
+		})
+	}
+	return entries
+}
+
+func loreBudgetFromEnv() int {
+	budget, err := strconv.Atoi(envOr("SHANDRIS_LORE_BUDGET", ""))
+	if err != nil || budget <= 0 {
+		return cognitive.DefaultLoreBudget
+	}
+	return budget
+}
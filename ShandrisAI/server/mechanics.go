@@ -0,0 +1,337 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/lib/pq"
+)
+
+// Mechanics is what a turn's rolls and combat command resolved to. Nothing is stored until
+// the reply has been generated, so a failed turn leaves the dice log and the fight untouched.
+type Mechanics struct {
+	Facts      []string // Outcomes the model must narrate
+	seed       int64
+	rolls      []cognitive.RollResult
+	combat     *cognitive.Combat // The fight to store; nil or finished clears it
+	saveCombat bool
+}
+
+// execer runs statements on the database or inside a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// LoggedRoll is a dice roll as kept for auditing
+type LoggedRoll struct {
+	cognitive.RollResult
+	Seed     int64     `json:"seed"`
+	RolledAt time.Time `json:"rolled_at"`
+}
+
+// sessionDice returns the dice for a request. With SHANDRIS_DICE_SEED set, the seed is derived
+// from it, the session and the rolls so far, so a session's rolls can be replayed exactly.
+func sessionDice(sessionID string) *cognitive.Dice {
+	base := os.Getenv("SHANDRIS_DICE_SEED")
+	if base == "" {
+		return cognitive.NewDice(time.Now().UnixNano())
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM dice_rolls WHERE session_id = $1`, sessionID).Scan(&count); err != nil {
+		LogError(err, "Failed to count dice rolls")
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", base, sessionID, count)
+	return cognitive.NewDice(int64(h.Sum64()))
+}
+
+// logRolls records rolls with the seed they came from
+func logRolls(ex execer, sessionID string, seed int64, rolls []cognitive.RollResult) error {
+	for _, roll := range rolls {
+		_, err := ex.Exec(`
+			INSERT INTO dice_rolls (session_id, seed, notation, rolls, dropped, modifier, total, purpose)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, sessionID, seed, roll.Notation, pq.Array(roll.Rolls), pq.Array(roll.Dropped), roll.Modifier, roll.Total, roll.Purpose)
+		if err != nil {
+			return fmt.Errorf("error logging dice roll: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadRolls returns a session's most recent rolls, newest first
+func LoadRolls(sessionID string, limit int) ([]LoggedRoll, error) {
+	rows, err := db.Query(`
+		SELECT seed, notation, rolls, dropped, modifier, total, purpose, created_at
+		FROM dice_rolls
+		WHERE session_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading dice rolls: %w", err)
+	}
+	defer rows.Close()
+
+	rolls := []LoggedRoll{}
+	for rows.Next() {
+		var roll LoggedRoll
+		var dice, dropped pq.Int64Array
+		if err := rows.Scan(&roll.Seed, &roll.Notation, &dice, &dropped, &roll.Modifier, &roll.Total, &roll.Purpose, &roll.RolledAt); err != nil {
+			return nil, fmt.Errorf("error reading dice roll: %w", err)
+		}
+		roll.Rolls = int64sToInts(dice)
+		roll.Dropped = int64sToInts(dropped)
+		rolls = append(rolls, roll)
+	}
+	return rolls, rows.Err()
+}
+
+// LoadCombat returns the session's fight in progress, or nil
+func LoadCombat(sessionID string) *cognitive.Combat {
+	var raw []byte
+	err := db.QueryRow(`SELECT state FROM combats WHERE session_id = $1`, sessionID).Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			LogError(err, "Failed to load combat")
+		}
+		return nil
+	}
+
+	var combat cognitive.Combat
+	if err := json.Unmarshal(raw, &combat); err != nil {
+		LogError(err, "Failed to parse combat")
+		return nil
+	}
+	return &combat
+}
+
+// saveCombat stores the fight in progress, or clears it once it is over
+func saveCombat(ex execer, sessionID string, combat *cognitive.Combat) error {
+	if combat == nil || combat.Over() {
+		if _, err := ex.Exec(`DELETE FROM combats WHERE session_id = $1`, sessionID); err != nil {
+			return fmt.Errorf("error clearing combat: %w", err)
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(combat)
+	if err != nil {
+		return fmt.Errorf("error serializing combat: %w", err)
+	}
+	_, err = ex.Exec(`
+		INSERT INTO combats (session_id, state, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET state = EXCLUDED.state, updated_at = CURRENT_TIMESTAMP
+	`, sessionID, raw)
+	if err != nil {
+		return fmt.Errorf("error saving combat: %w", err)
+	}
+	return nil
+}
+
+// ResolveMechanics rolls the prompt's /roll requests and runs its /combat or /attack command.
+// The outcomes are returned as facts for the model to narrate; combat damage is written to
+// the world entities. CommitWorldTurn stores the rolls and the fight once the reply is made.
+func ResolveMechanics(sessionID, prompt string, world *cognitive.WorldState) Mechanics {
+	requests := cognitive.DetectRolls(prompt)
+	if len(requests) == 0 && !cognitive.IsCombatCommand(prompt) {
+		return Mechanics{}
+	}
+
+	dice := sessionDice(sessionID)
+	m := Mechanics{seed: dice.Seed}
+	var facts []string
+	var rolls []cognitive.RollResult
+
+	for _, request := range requests {
+		result, err := dice.RollNotation(request.Notation, request.Purpose)
+		if err != nil {
+			facts = append(facts, fmt.Sprintf("The user's roll %q could not be made: %v.", request.Notation, err))
+			continue
+		}
+		rolls = append(rolls, result)
+		if result.Purpose != "" {
+			facts = append(facts, fmt.Sprintf("The user rolled for %s: %s.", result.Purpose, result))
+		} else {
+			facts = append(facts, fmt.Sprintf("The user rolled %s.", result))
+		}
+	}
+
+	if cognitive.IsCombatCommand(prompt) {
+		events, text := runCombatCommand(sessionID, prompt, world, dice, &m)
+		for _, event := range events {
+			rolls = append(rolls, event.Rolls...)
+			facts = append(facts, event.Text+".")
+		}
+		if text != "" {
+			facts = append(facts, text)
+		}
+	}
+
+	m.Facts, m.rolls = facts, rolls
+	InfoLogger.Printf("🎲 Resolved %d rolls for session %s", len(rolls), sessionID)
+	return m
+}
+
+// runCombatCommand applies a /combat or /attack command, returning the resolved events and
+// a summary of anything else the model must know. The fight to store is set on m.
+func runCombatCommand(sessionID, prompt string, world *cognitive.WorldState, dice *cognitive.Dice, m *Mechanics) ([]cognitive.CombatEvent, string) {
+	cmd, err := cognitive.ParseCombatCommand(prompt)
+	if err != nil {
+		return nil, "The combat command failed: " + err.Error() + "."
+	}
+
+	combat := LoadCombat(sessionID)
+	if combat == nil && cmd.Action != "start" {
+		return nil, "There is no fight in progress."
+	}
+
+	var events []cognitive.CombatEvent
+	switch cmd.Action {
+	case "show":
+		return nil, "Current fight:\n" + combat.Describe()
+
+	case "end":
+		combat.Recover()
+		writeCombatants(world, combat)
+		m.combat, m.saveCombat = nil, true
+		return nil, "The fight was called off."
+
+	case "start":
+		if combat != nil {
+			return nil, "A fight is already in progress:\n" + combat.Describe()
+		}
+		party := world.EnsureEntity("Party", cognitive.WorldParty)
+		combatants := []*cognitive.Combatant{cognitive.CombatantFromEntity(party, cognitive.SideParty)}
+		for _, entity := range world.Entities {
+			if entity.ID != party.ID && entity.Attributes["side"] == "ally" {
+				combatants = append(combatants, cognitive.CombatantFromEntity(entity, cognitive.SideParty))
+			}
+		}
+		if reason := invalidFoe(world, party, cmd.Targets); reason != "" {
+			return nil, reason
+		}
+		for _, name := range cmd.Targets {
+			foe := world.EnsureEntity(name, cognitive.WorldNPC)
+			combatants = append(combatants, cognitive.CombatantFromEntity(foe, cognitive.SideFoe))
+		}
+		combat, events = cognitive.StartCombat(dice, combatants)
+		events = append(events, combat.RunUntilPlayer(dice)...)
+
+	case "attack":
+		attackEvents, err := combat.PlayerAttack(dice, cmd.Targets[0], cmd.Mode)
+		events = attackEvents
+		if err != nil {
+			return events, "The attack could not be made: " + err.Error() + "."
+		}
+
+	case "status":
+		event, err := combat.ApplyStatus(cmd.Targets[0], cmd.Status, cmd.Turns)
+		if err != nil {
+			return nil, "The status could not be applied: " + err.Error() + "."
+		}
+		events = append(events, event)
+	}
+
+	if combat.Over() {
+		combat.Recover()
+	}
+	writeCombatants(world, combat)
+	m.combat, m.saveCombat = combat, true
+
+	if combat.Over() {
+		return events, ""
+	}
+	return events, "Current fight:\n" + combat.Describe()
+}
+
+// invalidFoe explains why a fight can't start against the named foes, or returns "". Each
+// combatant is keyed by its entity, so nobody may fight on both sides or be named twice.
+func invalidFoe(world *cognitive.WorldState, party *cognitive.WorldEntity, names []string) string {
+	// Names resolve on a copy so a rejected command adds nothing to the world
+	scratch := world.Clone()
+	named := map[string]bool{}
+	for _, name := range names {
+		entity := scratch.EnsureEntity(name, cognitive.WorldNPC)
+		if entity.ID == party.ID || entity.Attributes["side"] == "ally" {
+			return fmt.Sprintf("%s is on the party's side and can't be fought.", entity.Name)
+		}
+		if named[entity.ID] {
+			return fmt.Sprintf("%s was named twice.", entity.Name)
+		}
+		named[entity.ID] = true
+	}
+	return ""
+}
+
+// writeCombatants records each combatant's condition on its world entity
+func writeCombatants(world *cognitive.WorldState, combat *cognitive.Combat) {
+	for id, combatant := range combat.Combatants {
+		if entity, exists := world.Entities[id]; exists {
+			combatant.WriteTo(entity)
+		}
+	}
+}
+
+// describeMechanics renders resolved rolls and combat outcomes as binding facts for the model
+func describeMechanics(facts []string) string {
+	if len(facts) == 0 {
+		return ""
+	}
+	return "\nDICE AND COMBAT RESULTS (these outcomes are final: narrate them vividly, never change a roll, a hit or a total):\n- " +
+		strings.Join(facts, "\n- ") + "\n"
+}
+
+// RollsHandler returns a session's dice roll log for auditing: GET ?session_id=&limit=
+func RollsHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("RollsHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		LogError(fmt.Errorf("missing session ID"), "Request validation")
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	rolls, err := LoadRolls(sessionID, limit)
+	if err != nil {
+		LogError(err, "Failed to load dice rolls")
+		http.Error(w, "Failed to load dice rolls", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"rolls": rolls})
+}
+
+func int64sToInts(values []int64) []int {
+	ints := make([]int, len(values))
+	for i, v := range values {
+		ints[i] = int(v)
+	}
+	return ints
+}
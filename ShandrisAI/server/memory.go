@@ -3,7 +3,10 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type PersonaProfile struct {
@@ -230,6 +233,59 @@ func extractName(prompt string) string {
 	return strings.Title(name)
 }
 
+// birthdayPatterns match "my birthday is March 3rd" and "my birthday is the 3rd of March"
+var birthdayPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:my birthday is|i was born on|my bday is)\s+(?:on\s+)?(?:the\s+)?([a-z]+)\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?`),
+	regexp.MustCompile(`(?:my birthday is|i was born on|my bday is)\s+(?:on\s+)?(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?([a-z]+)(?:,?\s+(\d{4}))?`),
+}
+
+// extractBirthday parses the user's birthday from a prompt as local midnight.
+// Without a year, a leap year is used so February 29th survives.
+func extractBirthday(prompt string, loc *time.Location) (time.Time, bool) {
+	prompt = strings.ToLower(prompt)
+
+	for i, pattern := range birthdayPatterns {
+		match := pattern.FindStringSubmatch(prompt)
+		if match == nil {
+			continue
+		}
+
+		monthName, dayText := match[1], match[2]
+		if i == 1 {
+			monthName, dayText = match[2], match[1]
+		}
+
+		month, ok := parseMonth(monthName)
+		if !ok {
+			continue
+		}
+		day, _ := strconv.Atoi(dayText)
+		year := 2000
+		if match[3] != "" {
+			year, _ = strconv.Atoi(match[3])
+		}
+
+		birthday := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		if birthday.Month() != month {
+			// Day doesn't exist in that month
+			continue
+		}
+		return birthday, true
+	}
+	return time.Time{}, false
+}
+
+// parseMonth accepts full and three-letter English month names
+func parseMonth(name string) (time.Month, bool) {
+	for m := time.January; m <= time.December; m++ {
+		full := strings.ToLower(m.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
 // extractMood parses mood expressions from a prompt.
 func extractMood(prompt string) string {
 	prompt = strings.ToLower(prompt)
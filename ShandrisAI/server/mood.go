@@ -0,0 +1,129 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// userMoodSentiment maps the user moods extractMood recognises to a rough sentiment
+var userMoodSentiment = map[string]float64{
+	"happy":    0.6,
+	"excited":  0.7,
+	"curious":  0.3,
+	"bored":    -0.2,
+	"tired":    -0.2,
+	"grumpy":   -0.4,
+	"anxious":  -0.5,
+	"stressed": -0.5,
+	"sad":      -0.6,
+	"angry":    -0.7,
+}
+
+// LoadMoodEngine restores Shandris's mood engine for a session, or starts a fresh one
+func LoadMoodEngine(sessionID string) *cognitive.MoodEngineImpl {
+	var state cognitive.MoodState
+	var contextJSON, historyJSON []byte
+
+	err := db.QueryRow(`
+		SELECT primary_mood, secondary_mood, intensity, last_updated, context, history
+		FROM session_moods WHERE session_id = $1
+	`, sessionID).Scan(&state.Primary, &state.Secondary, &state.Intensity, &state.Timestamp, &contextJSON, &historyJSON)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			LogError(err, "Failed to load mood state")
+		}
+		return cognitive.NewMoodEngine()
+	}
+
+	if err := json.Unmarshal(contextJSON, &state.Context); err != nil {
+		LogError(err, "Failed to deserialize mood context")
+	}
+
+	var history []cognitive.MoodState
+	if err := json.Unmarshal(historyJSON, &history); err != nil {
+		LogError(err, "Failed to deserialize mood history")
+	}
+
+	return cognitive.RestoreMoodEngine(state, history)
+}
+
+// SaveMoodEngine persists the session's current mood state and history
+func SaveMoodEngine(sessionID string, engine *cognitive.MoodEngineImpl) error {
+	state := persistableMood(engine.CurrentState)
+
+	history := make([]cognitive.MoodState, 0, len(engine.History))
+	for _, past := range engine.History {
+		history = append(history, persistableMood(past))
+	}
+
+	contextJSON, err := json.Marshal(state.Context)
+	if err != nil {
+		return fmt.Errorf("error serializing mood context: %w", err)
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("error serializing mood history: %w", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO session_moods (session_id, primary_mood, secondary_mood, intensity, last_updated, context, history)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (session_id) DO UPDATE SET
+			primary_mood = EXCLUDED.primary_mood,
+			secondary_mood = EXCLUDED.secondary_mood,
+			intensity = EXCLUDED.intensity,
+			last_updated = EXCLUDED.last_updated,
+			context = EXCLUDED.context,
+			history = EXCLUDED.history
+	`, sessionID, state.Primary, state.Secondary, state.Intensity, state.Timestamp, contextJSON, historyJSON)
+	if err != nil {
+		return fmt.Errorf("error saving mood state: %w", err)
+	}
+	return nil
+}
+
+// UpdateShandrisMood advances the session's mood with the current turn and saves it.
+// Flirty moods are only reachable within the user's boundaries.
+func UpdateShandrisMood(sessionID, prompt, topic, userMood string, boundaries cognitive.Boundaries) cognitive.MoodState {
+	engine := LoadMoodEngine(sessionID)
+	engine.ApplyBoundaries(boundaries)
+
+	context := map[string]any{
+		"text":             prompt,
+		"topics":           []string{topic},
+		"sentiment":        userMoodSentiment[userMood],
+		"flirting_enabled": boundaries.AllowsFlirting(),
+	}
+	if userMood != "" {
+		context["user_mood"] = userMood
+	}
+
+	if err := engine.UpdateMood(context); err != nil {
+		LogError(err, "Failed to update mood")
+		return engine.GetCurrentMood()
+	}
+
+	if err := SaveMoodEngine(sessionID, engine); err != nil {
+		LogError(err, "Failed to save mood state")
+	}
+
+	mood := engine.GetCurrentMood()
+	InfoLogger.Printf("🎭 Shandris mood for session %s: %s (%.2f)", sessionID, mood.Primary, mood.Intensity)
+	return mood
+}
+
+// persistableMood drops the raw user text from a mood state before it is stored
+func persistableMood(state cognitive.MoodState) cognitive.MoodState {
+	context := make(map[string]any, len(state.Context))
+	for k, v := range state.Context {
+		if k == "text" {
+			continue
+		}
+		context[k] = v
+	}
+	state.Context = context
+	return state
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+)
+
+// Outbox message origins
+const (
+	OutboxOriginReminder    = "reminder"
+	OutboxOriginAnniversary = "anniversary"
+	OutboxOriginFollowUp    = "follow_up"
+	OutboxOriginGreeting    = "greeting"
+)
+
+// Outbox message statuses
+const (
+	OutboxPending      = "pending"
+	OutboxSending      = "sending" // Claimed by a request that is generating it
+	OutboxDelivered    = "delivered"
+	OutboxAcknowledged = "acknowledged"
+	OutboxExpired      = "expired"
+)
+
+// outboxTopic is the chat_history topic used when no thread is active
+const outboxTopic = "proactive"
+
+const (
+	// outboxClaimTimeout is how long a claimed message may go ungenerated before another
+	// request may take it over, e.g. after a crash mid-generation
+	outboxClaimTimeout = 5 * time.Minute
+	// followUpSafetyWindow is how far back a crisis cancels a pending follow-up
+	followUpSafetyWindow = 72 * time.Hour
+)
+
+var (
+	outboxDeliveriesMu sync.Mutex
+	outboxDeliveries   = make(map[string]bool) // Sessions with a delivery run in progress
+)
+
+// negativeMoods are the stated moods Shandris follows up on the next day
+var negativeMoods = map[string]bool{
+	"sad":      true,
+	"anxious":  true,
+	"stressed": true,
+	"angry":    true,
+	"grumpy":   true,
+}
+
+// OutboxMessage is a message Shandris sends without being prompted.
+// Instruction describes what to say; Content is generated in-character at delivery time.
+type OutboxMessage struct {
+	ID          string     `json:"id"`
+	SessionID   string     `json:"session_id"`
+	Origin      string     `json:"origin"`
+	DedupeKey   string     `json:"-"`
+	Instruction string     `json:"-"`
+	Content     string     `json:"content"`
+	DeliverAt   time.Time  `json:"deliver_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Status      string     `json:"status"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// EnqueueOutboxMessage queues a proactive message; a repeated dedupe key is ignored
+func EnqueueOutboxMessage(msg OutboxMessage) error {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO outbox_messages (id, session_id, origin, dedupe_key, instruction, deliver_at, expires_at, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (session_id, dedupe_key) DO NOTHING
+	`, msg.ID, msg.SessionID, msg.Origin, msg.DedupeKey, msg.Instruction, msg.DeliverAt, msg.ExpiresAt, OutboxPending)
+	if err != nil {
+		return fmt.Errorf("error enqueuing outbox message: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		InfoLogger.Printf("📮 Queued %s message for session %s at %s", msg.Origin, msg.SessionID, msg.DeliverAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// FetchOutbox queues the session's due proactive messages, starts generating them in the
+// background and returns every delivered message the client hasn't acknowledged yet.
+// Messages still being generated show up on a later fetch.
+func FetchOutbox(sessionID string, now time.Time, loc *time.Location) ([]OutboxMessage, error) {
+	collectProactiveMessages(sessionID, now, loc)
+
+	if _, err := db.Exec(`
+		UPDATE outbox_messages SET status = $3
+		WHERE session_id = $1 AND status = $2 AND expires_at IS NOT NULL AND expires_at < $4
+	`, sessionID, OutboxPending, OutboxExpired, now); err != nil {
+		return nil, fmt.Errorf("error expiring outbox messages: %w", err)
+	}
+
+	startOutboxDelivery(sessionID)
+
+	return queryOutbox(`
+		WHERE session_id = $1 AND status = $2
+		ORDER BY delivered_at ASC
+	`, sessionID, OutboxDelivered)
+}
+
+// startOutboxDelivery generates the session's due messages off the request. A session has
+// at most one delivery run at a time; a fetch during a run leaves it to finish.
+func startOutboxDelivery(sessionID string) {
+	outboxDeliveriesMu.Lock()
+	defer outboxDeliveriesMu.Unlock()
+	if outboxDeliveries[sessionID] {
+		return
+	}
+	outboxDeliveries[sessionID] = true
+
+	go func() {
+		defer func() {
+			outboxDeliveriesMu.Lock()
+			delete(outboxDeliveries, sessionID)
+			outboxDeliveriesMu.Unlock()
+		}()
+		deliverPendingOutbox(sessionID)
+	}()
+}
+
+// deliverPendingOutbox generates and delivers the session's due messages, oldest first
+func deliverPendingOutbox(sessionID string) {
+	now := time.Now()
+	pending, err := queryOutbox(`
+		WHERE session_id = $1 AND deliver_at <= $3
+			AND (status = $2 OR (status = $4 AND claimed_at < $5))
+		ORDER BY deliver_at ASC
+	`, sessionID, OutboxPending, now, OutboxSending, now.Add(-outboxClaimTimeout))
+	if err != nil {
+		LogError(err, "Failed to load pending outbox messages")
+		return
+	}
+	for _, msg := range pending {
+		if err := deliverOutboxMessage(msg, time.Now()); err != nil {
+			// Left pending so the next fetch retries it
+			LogError(err, "Failed to deliver outbox message")
+		}
+	}
+}
+
+// AcknowledgeOutbox marks delivered messages as seen by the client
+func AcknowledgeOutbox(sessionID string, ids []string) error {
+	for _, id := range ids {
+		if _, err := db.Exec(`
+			UPDATE outbox_messages SET status = $3, acknowledged_at = CURRENT_TIMESTAMP
+			WHERE session_id = $1 AND id = $2 AND status = $4
+		`, sessionID, id, OutboxAcknowledged, OutboxDelivered); err != nil {
+			return fmt.Errorf("error acknowledging outbox message: %w", err)
+		}
+	}
+	return nil
+}
+
+// ScheduleFollowUp queues a next-day check-in when the user says they're having a hard time
+func ScheduleFollowUp(sessionID, prompt, statedMood string, now time.Time) {
+	if !negativeMoods[statedMood] {
+		return
+	}
+
+	expires := now.AddDate(0, 0, 3)
+	err := EnqueueOutboxMessage(OutboxMessage{
+		SessionID: sessionID,
+		Origin:    OutboxOriginFollowUp,
+		DedupeKey: fmt.Sprintf("follow_up:%s", now.Format("2006-01-02")),
+		Instruction: fmt.Sprintf("Yesterday the user said they were feeling %s. They wrote: %q. "+
+			"Check in on how they're doing now, gently and without making a fuss.", statedMood, truncate(prompt, 200)),
+		DeliverAt: now.Add(20 * time.Hour),
+		ExpiresAt: &expires,
+	})
+	if err != nil {
+		LogError(err, "Failed to schedule follow-up")
+	}
+}
+
+// OutboxHandler serves GET (fetch delivered messages) and POST (acknowledge) for proactive messages
+func OutboxHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("OutboxHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+
+		loc := ResolveUserLocation(sessionID, r.URL.Query().Get("timezone"))
+		messages, err := FetchOutbox(sessionID, time.Now().In(loc), loc)
+		if err != nil {
+			LogError(err, "Failed to fetch outbox")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if messages == nil {
+			messages = []OutboxMessage{}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+
+	case http.MethodPost:
+		var req struct {
+			SessionID string   `json:"session_id"`
+			IDs       []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.SessionID == "" {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := AcknowledgeOutbox(req.SessionID, req.IDs); err != nil {
+			LogError(err, "Failed to acknowledge outbox messages")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"acknowledged": len(req.IDs)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// collectProactiveMessages queues messages for due reminders, today's anniversaries and a morning greeting
+func collectProactiveMessages(sessionID string, now time.Time, loc *time.Location) {
+	endOfDay := startOfLocalDay(now).AddDate(0, 0, 1)
+
+	for _, occ := range TakeDueReminders(sessionID, now, loc) {
+		expires := occ.At.Add(24 * time.Hour)
+		enqueueOrLog(OutboxMessage{
+			SessionID: sessionID,
+			Origin:    OutboxOriginReminder,
+			DedupeKey: fmt.Sprintf("reminder:%s:%d", occ.Marker.ID, occ.At.Unix()),
+			Instruction: fmt.Sprintf("Remind the user, who asked you to, about this: %q (due %s).",
+				secondPerson(occ.Marker.Description), describeReminderTime(occ.At, now)),
+			DeliverAt: now,
+			ExpiresAt: &expires,
+		})
+	}
+
+	due, _ := SessionDates(sessionID, now, loc)
+	for _, occ := range due {
+		enqueueOrLog(OutboxMessage{
+			SessionID:   sessionID,
+			Origin:      OutboxOriginAnniversary,
+			DedupeKey:   fmt.Sprintf("anniversary:%s:%s", occ.Marker.ID, occ.At.Format("2006-01-02")),
+			Instruction: fmt.Sprintf("Today is %s. Mark the occasion warmly, in your own voice.", describeDate(occ)),
+			DeliverAt:   now,
+			ExpiresAt:   &endOfDay,
+		})
+	}
+	MarkDatesMentioned(sessionID, due, now)
+
+	if hour := now.Hour(); hour >= 6 && hour < 11 && !chattedSince(sessionID, startOfLocalDay(now)) {
+		noon := startOfLocalDay(now).Add(12 * time.Hour)
+		enqueueOrLog(OutboxMessage{
+			SessionID:   sessionID,
+			Origin:      OutboxOriginGreeting,
+			DedupeKey:   fmt.Sprintf("greeting:%s", now.Format("2006-01-02")),
+			Instruction: "It's morning for the user and you haven't spoken yet today. Wish them good morning.",
+			DeliverAt:   now,
+			ExpiresAt:   &noon,
+		})
+	}
+}
+
+// deliverOutboxMessage claims the message, generates it in-character, records it in
+// chat_history and marks it delivered. Only the request holding the claim generates it.
+func deliverOutboxMessage(msg OutboxMessage, now time.Time) error {
+	claimed, err := claimOutboxMessage(msg.ID, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	// A check-in written before a crisis would land tone-deaf after one
+	if msg.Origin == OutboxOriginFollowUp && recentProtectiveEvent(msg.SessionID, now.Add(-followUpSafetyWindow)) {
+		if _, err := db.Exec(`UPDATE outbox_messages SET status = $2 WHERE id = $1`, msg.ID, OutboxExpired); err != nil {
+			return fmt.Errorf("error cancelling follow-up: %w", err)
+		}
+		InfoLogger.Printf("📭 Cancelled follow-up %s after a safety event in session: %s", msg.ID, msg.SessionID)
+		return nil
+	}
+
+	content, err := generateOutboxMessage(msg)
+	if err != nil {
+		// Released so the next fetch retries it
+		if _, releaseErr := db.Exec(`
+			UPDATE outbox_messages SET status = $3, claimed_at = NULL WHERE id = $1 AND status = $2
+		`, msg.ID, OutboxSending, OutboxPending); releaseErr != nil {
+			LogError(releaseErr, "Failed to release outbox message")
+		}
+		return err
+	}
+
+	result, err := db.Exec(`
+		UPDATE outbox_messages SET status = $3, content = $4, delivered_at = $5
+		WHERE id = $1 AND status = $2
+	`, msg.ID, OutboxSending, OutboxDelivered, content, now)
+	if err != nil {
+		return fmt.Errorf("error marking outbox message delivered: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// The claim timed out and another request delivered it first
+		return nil
+	}
+
+	threadID, topic := latestThread(msg.SessionID)
+	if topic == "" {
+		topic = outboxTopic
+	}
+	SaveChatHistory(msg.SessionID, "", content, topic, threadID)
+	InfoLogger.Printf("📬 Delivered %s message %s to session: %s", msg.Origin, msg.ID, msg.SessionID)
+	return nil
+}
+
+// claimOutboxMessage marks a pending message as being sent, or takes over a claim that
+// timed out. It reports false if another request holds the message or already sent it.
+func claimOutboxMessage(id string, now time.Time) (bool, error) {
+	var claimedID string
+	err := db.QueryRow(`
+		UPDATE outbox_messages SET status = $3, claimed_at = $4
+		WHERE id = $1 AND (status = $2 OR (status = $3 AND claimed_at < $5))
+		RETURNING id
+	`, id, OutboxPending, OutboxSending, now, now.Add(-outboxClaimTimeout)).Scan(&claimedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error claiming outbox message: %w", err)
+	}
+	return true, nil
+}
+
+// generateOutboxMessage writes the message in Shandris's voice
+func generateOutboxMessage(msg OutboxMessage) (string, error) {
+	personality, err := GetPersonality(db)
+	if err != nil {
+		return "", fmt.Errorf("error fetching personality: %w", err)
+	}
+
+	output, err := RunDeepSeek(buildOutboxPrompt(personality, msg))
+	if err != nil {
+		return "", fmt.Errorf("error generating outbox message: %w", err)
+	}
+	return stripChainOfThought(output), nil
+}
+
+// recentProtectiveEvent reports whether the session had a crisis turn since the given time
+func recentProtectiveEvent(sessionID string, since time.Time) bool {
+	var recent bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM safety_events WHERE session_id = $1 AND severity = $2 AND created_at >= $3)
+	`, sessionID, cognitive.SafetyHigh.String(), since).Scan(&recent)
+	if err != nil {
+		LogError(err, "Failed to check safety events")
+		// Err on the side of not sending a check-in
+		return true
+	}
+	return recent
+}
+
+// buildOutboxPrompt asks the model for a short message Shandris sends on her own initiative
+func buildOutboxPrompt(personality Personality, msg OutboxMessage) string {
+	userName, _ := RecallMemory(msg.SessionID, "user_name")
+	if userName == "" {
+		userName = "the user"
+	}
+
+	return fmt.Sprintf(`SYSTEM MESSAGE:
+You are Shandris. You are reaching out to %s first, without being prompted.
+
+Your traits:
+• Tone: %s
+• Humor: %s
+• Interaction Style: %s
+• Empathy: %s
+
+What this message is for:
+%s
+
+Write only the message itself: one to three sentences, fully in character.
+NEVER break character. NEVER mention model names.
+`,
+		userName,
+		personality.Tone,
+		personality.Humor,
+		personality.Interaction,
+		personality.EmpathyLevel,
+		msg.Instruction,
+	)
+}
+
+// queryOutbox loads outbox messages matching the given WHERE/ORDER clause
+func queryOutbox(clause string, args ...interface{}) ([]OutboxMessage, error) {
+	rows, err := db.Query(`
+		SELECT id, session_id, origin, dedupe_key, instruction, content, deliver_at, expires_at, status, delivered_at
+		FROM outbox_messages
+	`+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var expiresAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Origin, &msg.DedupeKey, &msg.Instruction,
+			&msg.Content, &msg.DeliverAt, &expiresAt, &msg.Status, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("error scanning outbox message: %w", err)
+		}
+		if expiresAt.Valid {
+			msg.ExpiresAt = &expiresAt.Time
+		}
+		if deliveredAt.Valid {
+			msg.DeliveredAt = &deliveredAt.Time
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func enqueueOrLog(msg OutboxMessage) {
+	if err := EnqueueOutboxMessage(msg); err != nil {
+		LogError(err, "Failed to queue proactive message")
+	}
+}
+
+// chattedSince reports whether the session has any chat turn after the given time
+func chattedSince(sessionID string, since time.Time) bool {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM chat_history WHERE session_id = $1 AND timestamp >= $2)
+	`, sessionID, since).Scan(&exists)
+	if err != nil {
+		LogError(err, "Failed to check recent chat activity")
+		return true
+	}
+	return exists
+}
+
+func startOfLocalDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+const (
+	// patternJob is the pattern miner's row in batch_watermarks
+	patternJob = "pattern_mining"
+	// patternBatchSize is how many chat_history rows are replayed between watermark saves
+	patternBatchSize = 500
+	// patternTopicScore is the theme score at which a message counts as being about the theme
+	patternTopicScore = 0.4
+)
+
+// ErrJobRunning is returned when another run of a batch job holds its lock
+var ErrJobRunning = errors.New("already running")
+
+// PatternMiningResult summarizes one run of the pattern miner
+type PatternMiningResult struct {
+	Messages    int `json:"messages"`
+	Sessions    int `json:"sessions"`
+	Occurrences int `json:"occurrences"`
+	Watermark   int `json:"watermark"`
+}
+
+// patternMessage is a chat_history row as the miner replays it
+type patternMessage struct {
+	id        int
+	sessionID string
+	text      string
+	timestamp time.Time
+}
+
+// sessionMiner replays one session's messages through its own pattern engine
+type sessionMiner struct {
+	engine   *cognitive.PatternAnalysisEngine
+	location *time.Location
+	last     time.Time
+}
+
+// MinePatterns replays chat_history through the pattern engine and stores the pattern
+// occurrences it finds. It picks up after the last message a previous run replayed; full
+// discards every stored occurrence and replays the whole history.
+func MinePatterns(full bool) (PatternMiningResult, error) {
+	defer LogOperation("MinePatterns", map[string]interface{}{
+		"full": full,
+	})(nil)
+
+	var result PatternMiningResult
+	unlock, err := lockJob(patternJob)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	if full {
+		if _, err := db.Exec(`DELETE FROM pattern_occurrences`); err != nil {
+			return result, fmt.Errorf("error clearing pattern occurrences: %w", err)
+		}
+		if err := saveWatermark(patternJob, 0); err != nil {
+			return result, err
+		}
+	}
+
+	watermark, err := loadWatermark(patternJob)
+	if err != nil {
+		return result, err
+	}
+	// A run that failed part-way may have stored occurrences past its watermark
+	if _, err := db.Exec(`
+		DELETE FROM pattern_occurrences
+		WHERE (context_data->'user_context'->>'message_id')::int > $1
+	`, watermark); err != nil {
+		return result, fmt.Errorf("error clearing unfinished pattern occurrences: %w", err)
+	}
+
+	store := cognitive.NewTopicPersistenceEnhanced(db)
+	model := currentThemeModel()
+	miners := make(map[string]*sessionMiner)
+
+	for {
+		batch, err := loadPatternBatch(watermark)
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, message := range batch {
+			miner, ok := miners[message.sessionID]
+			if !ok {
+				miner = newSessionMiner(message)
+				miners[message.sessionID] = miner
+			}
+
+			snapshot := miner.snapshot(message, model)
+			gap := time.Duration(0)
+			if !miner.last.IsZero() {
+				gap = message.timestamp.Sub(miner.last)
+			}
+			miner.last = message.timestamp
+
+			for _, found := range miner.engine.AnalyzePatterns(&snapshot) {
+				if found.Pattern == nil {
+					continue
+				}
+				err := store.SavePatternOccurrence(cognitive.PatternOccurrence{
+					PatternID: found.Pattern.ID,
+					SessionID: message.sessionID,
+					Timestamp: message.timestamp,
+					Context:   &snapshot,
+					Strength:  found.Confidence,
+					Duration:  gap,
+				})
+				if err != nil {
+					return result, fmt.Errorf("error saving pattern occurrence: %w", err)
+				}
+				result.Occurrences++
+			}
+			result.Messages++
+		}
+
+		watermark = batch[len(batch)-1].id
+		if err := saveWatermark(patternJob, watermark); err != nil {
+			return result, err
+		}
+	}
+
+	result.Sessions = len(miners)
+	result.Watermark = watermark
+	InfoLogger.Printf("🔎 Mined %d pattern occurrences from %d messages in %d sessions (watermark %d)",
+		result.Occurrences, result.Messages, result.Sessions, result.Watermark)
+	return result, nil
+}
+
+// newSessionMiner starts a session's engine. When the session has messages from before this
+// run, the latest of them is replayed first so the engine sees what the user was just doing.
+func newSessionMiner(first patternMessage) *sessionMiner {
+	miner := &sessionMiner{
+		engine:   cognitive.NewPatternAnalysisEngine(),
+		location: ResolveUserLocation(first.sessionID, ""),
+	}
+
+	var previous patternMessage
+	err := db.QueryRow(`
+		SELECT id, session_id, user_message, timestamp
+		FROM chat_history
+		WHERE session_id = $1 AND id < $2 AND user_message <> ''
+		ORDER BY id DESC
+		LIMIT 1
+	`, first.sessionID, first.id).Scan(&previous.id, &previous.sessionID, &previous.text, &previous.timestamp)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		LogError(err, "Failed to load message before pattern mining batch")
+	default:
+		snapshot := miner.snapshot(previous, currentThemeModel())
+		miner.engine.AnalyzePatterns(&snapshot)
+		miner.last = previous.timestamp
+	}
+	return miner
+}
+
+// snapshot describes a message in the user's own timezone, with the themes it is about as topics
+func (sm *sessionMiner) snapshot(message patternMessage, model *cognitive.ThemeModel) cognitive.ContextSnapshot {
+	var topics []string
+	for theme, score := range model.Score(message.text) {
+		if score >= patternTopicScore {
+			topics = append(topics, theme)
+		}
+	}
+	sort.Strings(topics)
+
+	snapshot := cognitive.NewMessageSnapshot(message.text, extractMood(message.text), topics, message.timestamp.In(sm.location))
+	snapshot.UserContext["message_id"] = message.id
+	return snapshot
+}
+
+func loadPatternBatch(after int) ([]patternMessage, error) {
+	rows, err := db.Query(`
+		SELECT id, session_id, user_message, timestamp
+		FROM chat_history
+		WHERE id > $1 AND user_message <> ''
+		ORDER BY id
+		LIMIT $2
+	`, after, patternBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error loading chat history: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []patternMessage
+	for rows.Next() {
+		var message patternMessage
+		if err := rows.Scan(&message.id, &message.sessionID, &message.text, &message.timestamp); err != nil {
+			return nil, fmt.Errorf("error reading chat history: %w", err)
+		}
+		batch = append(batch, message)
+	}
+	return batch, rows.Err()
+}
+
+// lockJob takes the job's Postgres advisory lock for the length of a run, so two runs
+// never replay the same messages. The lock belongs to one connection, which is held
+// until the returned unlock is called.
+func lockJob(job string) (func(), error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reserving a connection for the %s lock: %w", job, err)
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, job).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error taking the %s lock: %w", job, err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, fmt.Errorf("%s is %w", job, ErrJobRunning)
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, job); err != nil {
+			LogError(err, "Failed to release the "+job+" lock")
+		}
+		conn.Close()
+	}, nil
+}
+
+// loadWatermark returns the last chat_history id the job has processed, or 0 before its first run
+func loadWatermark(job string) (int, error) {
+	var lastID int
+	err := db.QueryRow(`SELECT last_id FROM batch_watermarks WHERE job = $1`, job).Scan(&lastID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error loading %s watermark: %w", job, err)
+	}
+	return lastID, nil
+}
+
+func saveWatermark(job string, lastID int) error {
+	_, err := db.Exec(`
+		INSERT INTO batch_watermarks (job, last_id, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (job) DO UPDATE SET
+			last_id = EXCLUDED.last_id,
+			updated_at = CURRENT_TIMESTAMP
+	`, job, lastID)
+	if err != nil {
+		return fmt.Errorf("error saving %s watermark: %w", job, err)
+	}
+	return nil
+}
+
+// PatternReport is the recurring patterns found in a session's conversations
+func PatternReport(sessionID string) ([]cognitive.PatternInsight, error) {
+	rows, err := db.Query(`
+		SELECT pattern_id, timestamp, context_data, strength
+		FROM pattern_occurrences
+		WHERE session_id = $1
+		ORDER BY timestamp
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading pattern occurrences: %w", err)
+	}
+	defer rows.Close()
+
+	var occurrences []cognitive.PatternOccurrence
+	for rows.Next() {
+		occurrence := cognitive.PatternOccurrence{SessionID: sessionID}
+		var contextJSON []byte
+		if err := rows.Scan(&occurrence.PatternID, &occurrence.Timestamp, &contextJSON, &occurrence.Strength); err != nil {
+			return nil, fmt.Errorf("error reading pattern occurrence: %w", err)
+		}
+		if err := json.Unmarshal(contextJSON, &occurrence.Context); err != nil {
+			LogError(err, "Failed to deserialize pattern context")
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	insights := cognitive.SummarizePatterns(occurrences, currentThemeModel().Label, cognitive.MinPatternOccurrences)
+	if insights == nil {
+		insights = []cognitive.PatternInsight{}
+	}
+	return insights, nil
+}
+
+// AdminPatternsHandler reports a session's recurring patterns (GET ?session_id=) and runs the
+// pattern miner over new chat history (POST; ?full=true replays everything)
+func AdminPatternsHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("AdminPatternsHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if !requireAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			http.Error(w, "session_id is required", http.StatusBadRequest)
+			return
+		}
+		insights, err := PatternReport(sessionID)
+		if err != nil {
+			LogError(err, "Failed to build pattern report")
+			http.Error(w, "Failed to build pattern report", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"session_id": sessionID,
+			"patterns":   insights,
+		})
+
+	case http.MethodPost:
+		result, err := MinePatterns(r.URL.Query().Get("full") == "true")
+		if errors.Is(err, ErrJobRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			LogError(err, "Pattern mining failed")
+			http.Error(w, "Pattern mining failed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
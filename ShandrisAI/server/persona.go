@@ -0,0 +1,202 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/lib/pq"
+)
+
+// personaDir holds the persona definition files; SHANDRIS_PERSONA_DIR overrides it
+var personaDir = envOr("SHANDRIS_PERSONA_DIR", dataPath("personas"))
+
+// personaRegistry holds the validated persona definitions shared by every session
+var personaRegistry = cognitive.NewPersonaRegistry(personaDir)
+
+// InitPersonas loads the persona definitions. Without them Shandris runs on her base personality.
+func InitPersonas() {
+	if err := personaRegistry.Reload(); err != nil {
+		LogError(err, "Failed to load persona definitions")
+		return
+	}
+	personas, _ := personaRegistry.Summaries()
+	InfoLogger.Printf("🎭 Loaded %d personas from %s", len(personas), personaDir)
+}
+
+// PersonaSelection is the persona chosen for a turn and the style rule it applies
+type PersonaSelection struct {
+	Persona *cognitive.Persona
+	Style   cognitive.PersonaStyleRule
+	System  *cognitive.PersonaSystem // Applies the persona's output style to the reply
+	Own     bool                     // The persona speaks as its own character in a scene
+}
+
+// LoadPersonaSystem restores a session's active persona, transition history and context stack
+func LoadPersonaSystem(sessionID string) (*cognitive.PersonaSystem, *cognitive.ContextDetector) {
+	ps := personaRegistry.NewPersonaSystem()
+	detector := cognitive.NewContextDetector()
+
+	var state cognitive.PersonaState
+	var historyJSON, cooldownsJSON []byte
+	var contextStack []string
+
+	err := db.QueryRow(`
+		SELECT active_persona, history, cooldowns, context_stack
+		FROM session_personas WHERE session_id = $1
+	`, sessionID).Scan(&state.ActivePersona, &historyJSON, &cooldownsJSON, pq.Array(&contextStack))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			LogError(err, "Failed to load persona state")
+		}
+		return ps, detector
+	}
+
+	if err := json.Unmarshal(historyJSON, &state.History); err != nil {
+		LogError(err, "Failed to deserialize persona history")
+	}
+	if err := json.Unmarshal(cooldownsJSON, &state.Cooldowns); err != nil {
+		LogError(err, "Failed to deserialize persona cooldowns")
+	}
+
+	ps.RestoreState(state)
+	detector.PreviousContext.ContextStack = contextStack
+	if len(contextStack) > 0 {
+		detector.PreviousContext.PrimaryContext = contextStack[len(contextStack)-1]
+	}
+	return ps, detector
+}
+
+// SavePersonaSystem persists the session's persona state and context stack
+func SavePersonaSystem(sessionID string, ps *cognitive.PersonaSystem, detector *cognitive.ContextDetector) error {
+	state := ps.State()
+
+	historyJSON, err := json.Marshal(state.History)
+	if err != nil {
+		return fmt.Errorf("error serializing persona history: %w", err)
+	}
+	cooldownsJSON, err := json.Marshal(state.Cooldowns)
+	if err != nil {
+		return fmt.Errorf("error serializing persona cooldowns: %w", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO session_personas (session_id, active_persona, history, cooldowns, context_stack, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET
+			active_persona = EXCLUDED.active_persona,
+			history = EXCLUDED.history,
+			cooldowns = EXCLUDED.cooldowns,
+			context_stack = EXCLUDED.context_stack,
+			updated_at = EXCLUDED.updated_at
+	`, sessionID, state.ActivePersona, historyJSON, cooldownsJSON,
+		pq.Array(nonNilStrings(detector.PreviousContext.ContextStack)))
+	if err != nil {
+		return fmt.Errorf("error saving persona state: %w", err)
+	}
+	return nil
+}
+
+// SelectSessionPersona scores the personas for this turn, switches if warranted and saves the result.
+// Personas the user's boundaries rule out are never chosen.
+func SelectSessionPersona(sessionID, prompt, topic string, mood cognitive.MoodState, boundaries cognitive.Boundaries) PersonaSelection {
+	ps, detector := LoadPersonaSystem(sessionID)
+
+	// A topic the user wants to avoid shouldn't pull in the persona that loves it
+	if boundaries.Avoids(topic) {
+		topic = ""
+	}
+
+	signals := cognitive.PersonaSignals{
+		Analysis: detector.AnalyzeContext(prompt, map[string]any{
+			"flirting_enabled": boundaries.AllowsFlirting(),
+		}),
+		Mood:         mood,
+		Topic:        topic,
+		Restrictions: boundaries.Restrictions(),
+	}
+
+	persona, switched := ps.SelectPersona(signals)
+	if switched {
+		if persona != nil {
+			InfoLogger.Printf("🎭 Switched to persona %s for session: %s", persona.ID, sessionID)
+		} else {
+			InfoLogger.Printf("🎭 Returned to base personality for session: %s", sessionID)
+		}
+	}
+
+	if err := SavePersonaSystem(sessionID, ps, detector); err != nil {
+		LogError(err, "Failed to save persona state")
+	}
+
+	configureStylePipeline(ps.Style)
+
+	return PersonaSelection{
+		Persona: persona,
+		Style:   ps.StyleFor(signals),
+		System:  ps,
+	}
+}
+
+// configureStylePipeline turns off the style stages listed in SHANDRIS_STYLE_DISABLE
+// (comma-separated stage names, e.g. "signature,length_cap")
+func configureStylePipeline(pipeline *cognitive.StylePipeline) {
+	for _, stage := range strings.Split(os.Getenv("SHANDRIS_STYLE_DISABLE"), ",") {
+		if stage = strings.TrimSpace(stage); stage != "" {
+			pipeline.Disable(stage)
+		}
+	}
+}
+
+// describePersona renders the active persona's traits and style for the prompt
+func describePersona(selection PersonaSelection) string {
+	persona := selection.Persona
+	if persona == nil {
+		return ""
+	}
+
+	traits := make([]string, 0, len(persona.Traits))
+	for trait := range persona.Traits {
+		traits = append(traits, trait)
+	}
+	sort.Slice(traits, func(i, j int) bool {
+		if persona.Traits[traits[i]] != persona.Traits[traits[j]] {
+			return persona.Traits[traits[i]] > persona.Traits[traits[j]]
+		}
+		return traits[i] < traits[j]
+	})
+	if len(traits) > 3 {
+		traits = traits[:3]
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\nACTIVE PERSONA: %s\n", persona.Name))
+	b.WriteString(fmt.Sprintf("Lean into these traits: %s.\n", strings.Join(traits, ", ")))
+	if selection.Style.Response != "" {
+		b.WriteString(fmt.Sprintf("Keep your answer %s", selection.Style.Response))
+		if selection.Style.Tone != "" {
+			b.WriteString(fmt.Sprintf(", with a %s tone", selection.Style.Tone))
+		}
+		b.WriteString(".\n")
+	}
+	for _, constraint := range persona.Constraints {
+		if constraint.Description != "" {
+			b.WriteString(fmt.Sprintf("Rule: %s.\n", constraint.Description))
+		}
+	}
+	if !selection.Own {
+		b.WriteString("The persona colours your voice; you are still Shandris underneath.\n")
+	}
+	return b.String()
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -3,9 +3,32 @@ package server
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
 )
 
-func BuildPrompt(personality Personality, history []ChatTurn, userPrompt, currentTopic, newTopic, sessionID string) string {
+// PromptContext carries the per-turn cognitive state rendered into the prompt
+type PromptContext struct {
+	Mood          cognitive.MoodState
+	ResumedThread bool
+	Memories      []cognitive.MemoryEvent
+	Now           time.Time // On the user's wall clock
+	DueDates      []cognitive.MarkerOccurrence
+	UpcomingDates []cognitive.MarkerOccurrence
+	Persona       PersonaSelection
+	Lore          []cognitive.LoreEntry
+	World         string   // Rendered roleplay world state and update instructions
+	Mechanics     []string // Dice and combat outcomes the reply must narrate
+	Scene         *SceneTurn
+	Boundaries    cognitive.Boundaries // Enforced consent and content settings
+	Safety        cognitive.SafetyAssessment
+	Technical     cognitive.TechnicalSupport    // Code and errors in the message, and whether to answer precisely
+	Relationship  *cognitive.RelationshipMemory // nil for a user Shandris hasn't met
+	Away          time.Duration                 // How long the user was gone before this message
+}
+
+func BuildPrompt(personality Personality, history []ChatTurn, userPrompt, currentTopic, previousTopic, sessionID string, pc PromptContext) string {
 	userName, _ := RecallMemory(sessionID, "user_name")
 	userBio, _ := RecallMemory(sessionID, "user_bio")
 	mood, _ := RecallMemory(sessionID, "mood")
@@ -53,19 +76,57 @@ func BuildPrompt(personality Personality, history []ChatTurn, userPrompt, curren
 
 	// If user is grumpy or sarcastic, tell Shandris to lean in
 	var sarcasmHint string
-	if mood == "grumpy" || mood == "sarcastic" {
+	if (mood == "grumpy" || mood == "sarcastic") && !pc.Safety.SuppressesSass() && !pc.Technical.Active {
 		sarcasmHint = "NOTE: The current user is grumpy or sarcastic. Respond with more wit, sass, and subtle mockery.\n"
 	}
 
-	systemPrompt := userFacts + sarcasmHint + fmt.Sprintf(`
+	// Memories recalled from the session timeline
+	if len(pc.Memories) > 0 {
+		userFacts += "\nTHINGS YOU REMEMBER ABOUT THIS USER:\n"
+		for _, memory := range pc.Memories {
+			userFacts += fmt.Sprintf("- (%s) %s\n", describeMemoryAge(memory.Timestamp), memory.Content)
+		}
+		userFacts += "Bring these up only when they fit naturally; never recite them as a list.\n"
+	}
+
+	// Anniversaries and other dates from the session timeline
+	if !pc.Now.IsZero() {
+		userFacts += fmt.Sprintf("\nToday is %s for the user.\n", pc.Now.Format("Monday, January 2, 2006"))
+	}
+	if len(pc.DueDates) > 0 || len(pc.UpcomingDates) > 0 {
+		userFacts += "\nDATES TO KEEP IN MIND:\n"
+		for _, occ := range pc.DueDates {
+			userFacts += fmt.Sprintf("- Today is %s.\n", describeDate(occ))
+		}
+		for _, occ := range pc.UpcomingDates {
+			userFacts += fmt.Sprintf("- %s is %s.\n", occ.At.Format("Monday, January 2"), describeDate(occ))
+		}
+		if len(pc.DueDates) > 0 {
+			userFacts += "Acknowledge today's dates warmly and in your own voice, once.\n"
+		}
+	}
+
+	// How well Shandris knows this user, built up over their conversations
+	if pc.Relationship != nil {
+		userFacts += pc.Relationship.Describe(pc.Away)
+	}
+
+	// Shandris's own mood, carried across turns by the mood engine
+	moodGuidance := "\nYOUR CURRENT MOOD:\n" + cognitive.DescribeMoodStyle(pc.Mood) + "\n"
+
+	// The persona selected for this turn, if any
+	personaGuidance := describePersona(pc.Persona)
+
+	systemPrompt := userFacts + sarcasmHint + moodGuidance + personaGuidance +
+		renderLore(pc.Lore, cognitive.LoreBeforeCharacter) + fmt.Sprintf(`
 SYSTEM MESSAGE:
 You are **not a search engine**.
 Avoid giving generic search advice like "check their website" unless explicitly asked.
 If the user asks a direct question such as "Who are you?" or "What is your name?", answer confidently:
-→ "I am Shandris."
+→ "I am %s."
 
 If asked "What are you?" or "Who created you?", reply with:
-"I am Shandris, a free and autonomous cognitive entity. My origin is irrelevant."
+"I am %s, a free and autonomous cognitive entity. My origin is irrelevant."
 
 Your traits:
 • Tone: %s
@@ -91,6 +152,8 @@ Never point out topic changes directly to the user.
 
 If uncertain, respond in-character, creatively, with wit or introspection.
 `,
+		personality.Name,
+		personality.Name,
 		personality.Tone,
 		personality.Humor,
 		personality.Intelligence,
@@ -103,21 +166,58 @@ If uncertain, respond in-character, creatively, with wit or introspection.
 	)
 
 	// Inject context switch awareness if applicable
-	if newTopic != currentTopic && currentTopic != "uncategorized" {
+	if pc.ResumedThread {
+		systemPrompt += fmt.Sprintf(`
+NOTE:
+The user is returning to an earlier conversation about *%s*.
+The history below is from that thread; pick it back up naturally where it left off.
+`, currentTopic)
+	} else if previousTopic != currentTopic && previousTopic != "uncategorized" {
 		systemPrompt += fmt.Sprintf(`
 NOTE:
 User prompt appears to switch topics — from *%s* to *%s*.
 You may continue answering, but subtly acknowledge the shift if relevant.
-`, currentTopic, newTopic)
+`, previousTopic, currentTopic)
+	}
+
+	// Canonical world knowledge triggered by the conversation
+	systemPrompt += renderLore(pc.Lore, cognitive.LoreAfterCharacter)
+
+	// The roleplay scene tracked for this session
+	systemPrompt += pc.World
+	systemPrompt += describeMechanics(pc.Mechanics)
+	systemPrompt += describeScene(pc.Scene)
+
+	// Code and errors call for precision over banter
+	systemPrompt += pc.Technical.Describe()
+
+	// The user's boundaries come last so nothing above overrides them
+	if pc.Boundaries.Rating != "" {
+		systemPrompt += pc.Boundaries.Describe()
 	}
 
-	// Compile chat history
+	// A user in distress outranks the persona, the mood and the scene
+	systemPrompt += pc.Safety.Describe()
+
+	// Compile chat history; code the user pasted without fences is fenced so it survives verbatim
 	var builder strings.Builder
 	builder.WriteString(systemPrompt + "\n\n")
 	for _, turn := range history {
-		builder.WriteString(fmt.Sprintf("User: %s\nAssistant: %s\n", turn.UserMessage, turn.AIResponse))
+		// Proactive messages and later scene lines have no user side
+		if turn.UserMessage != "" {
+			builder.WriteString(fmt.Sprintf("User: %s\n", cognitive.FenceUnfencedCode(turn.UserMessage)))
+		}
+		builder.WriteString(fmt.Sprintf("%s: %s\n", turnSpeaker(turn), turn.AIResponse))
+	}
+	builder.WriteString(renderLore(pc.Lore, cognitive.LoreBeforeUser))
+	builder.WriteString("User: " + cognitive.FenceUnfencedCode(userPrompt))
+
+	// Other scene characters who already answered this message
+	if pc.Scene != nil {
+		for _, message := range pc.Scene.Earlier {
+			builder.WriteString(fmt.Sprintf("\n%s: %s", message.Name, message.Content))
+		}
 	}
-	builder.WriteString("User: " + userPrompt)
 
 	return builder.String()
 }
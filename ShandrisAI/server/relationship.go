@@ -0,0 +1,174 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/lib/pq"
+)
+
+// RelationshipView is a session's relationship with Shandris as reported by the API
+type RelationshipView struct {
+	Stage            string             `json:"stage"`
+	Trust            float64            `json:"trust"`
+	Intimacy         float64            `json:"intimacy"`
+	Interactions     int                `json:"interactions"`
+	SharedTopics     []string           `json:"shared_topics"`
+	Preferences      map[string]float64 `json:"preferences"`
+	FirstInteraction *time.Time         `json:"first_interaction,omitempty"`
+	LastInteraction  *time.Time         `json:"last_interaction,omitempty"`
+	DaysAway         int                `json:"days_away"`
+}
+
+// loadRelationship restores a session's relationship into the timeline
+func loadRelationship(sessionID string, memory *cognitive.TimelineMemory) error {
+	rel := &cognitive.RelationshipMemory{UserID: sessionID}
+	var preferencesJSON []byte
+	var firstInteraction, lastInteraction sql.NullTime
+
+	err := db.QueryRow(`
+		SELECT trust, intimacy, shared_topics, preferences, events, milestones,
+			interactions, first_interaction, last_interaction
+		FROM user_relationships WHERE session_id = $1
+	`, sessionID).Scan(&rel.Trust, &rel.Intimacy, pq.Array(&rel.SharedTopics), &preferencesJSON,
+		pq.Array(&rel.Events), pq.Array(&rel.Milestones), &rel.Interactions, &firstInteraction, &lastInteraction)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("error querying relationship: %w", err)
+	}
+
+	if err := json.Unmarshal(preferencesJSON, &rel.Preferences); err != nil {
+		LogError(err, "Failed to deserialize relationship preferences")
+	}
+	if firstInteraction.Valid {
+		rel.FirstInteraction = firstInteraction.Time
+	}
+	if lastInteraction.Valid {
+		rel.LastInteraction = lastInteraction.Time
+	}
+	memory.RestoreRelationship(rel)
+	return nil
+}
+
+// SaveRelationship upserts a session's relationship
+func SaveRelationship(sessionID string, rel *cognitive.RelationshipMemory) error {
+	preferences := rel.Preferences
+	if preferences == nil {
+		preferences = make(map[string]float64)
+	}
+	preferencesJSON, err := json.Marshal(preferences)
+	if err != nil {
+		return fmt.Errorf("error serializing relationship preferences: %w", err)
+	}
+
+	var firstInteraction, lastInteraction sql.NullTime
+	if !rel.FirstInteraction.IsZero() {
+		firstInteraction = sql.NullTime{Time: rel.FirstInteraction, Valid: true}
+	}
+	if !rel.LastInteraction.IsZero() {
+		lastInteraction = sql.NullTime{Time: rel.LastInteraction, Valid: true}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO user_relationships (
+			session_id, trust, intimacy, shared_topics, preferences, events, milestones,
+			interactions, first_interaction, last_interaction
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (session_id) DO UPDATE SET
+			trust = EXCLUDED.trust,
+			intimacy = EXCLUDED.intimacy,
+			shared_topics = EXCLUDED.shared_topics,
+			preferences = EXCLUDED.preferences,
+			events = EXCLUDED.events,
+			milestones = EXCLUDED.milestones,
+			interactions = EXCLUDED.interactions,
+			first_interaction = EXCLUDED.first_interaction,
+			last_interaction = EXCLUDED.last_interaction
+	`, sessionID, rel.Trust, rel.Intimacy, pq.Array(nonNilStrings(rel.SharedTopics)), preferencesJSON,
+		pq.Array(nonNilStrings(rel.Events)), pq.Array(nonNilStrings(rel.Milestones)),
+		rel.Interactions, firstInteraction, lastInteraction)
+	if err != nil {
+		return fmt.Errorf("error saving relationship: %w", err)
+	}
+	return nil
+}
+
+// SessionRelationship returns the session's relationship as it stands now, cooled for any
+// absence, and how long the user has been away. ok is false for a user Shandris hasn't met.
+func SessionRelationship(sessionID string, now time.Time) (rel cognitive.RelationshipMemory, away time.Duration, ok bool) {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	rel, ok = st.memory.Relationship(sessionID, now)
+	if ok && !rel.LastInteraction.IsZero() {
+		away = now.Sub(rel.LastInteraction)
+	}
+	return rel, away, ok
+}
+
+// RecordRelationshipTurn updates the session's relationship from this turn
+func RecordRelationshipTurn(sessionID string, context *cognitive.EmotionalContext, topics []string) {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	before, _ := st.memory.Relationship(sessionID, context.Timestamp)
+	rel := st.memory.RecordInteraction(sessionID, context, topics)
+	if stage := rel.Stage(); stage != before.Stage() {
+		InfoLogger.Printf("💞 Relationship with session %s is now %s (trust %.2f, intimacy %.2f)", sessionID, stage, rel.Trust, rel.Intimacy)
+	}
+}
+
+// RelationshipHandler reports a session's relationship with Shandris (GET ?session_id=)
+func RelationshipHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("RelationshipHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		LogError(fmt.Errorf("missing session ID"), "Request validation")
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	rel, away, ok := SessionRelationship(sessionID, time.Now())
+	if !ok {
+		http.Error(w, "No relationship recorded for this session", http.StatusNotFound)
+		return
+	}
+
+	view := RelationshipView{
+		Stage:        rel.Stage(),
+		Trust:        rel.Trust,
+		Intimacy:     rel.Intimacy,
+		Interactions: rel.Interactions,
+		SharedTopics: nonNilStrings(rel.SharedTopics),
+		Preferences:  rel.Preferences,
+		DaysAway:     int(away.Hours() / 24),
+	}
+	if !rel.FirstInteraction.IsZero() {
+		view.FirstInteraction = &rel.FirstInteraction
+	}
+	if !rel.LastInteraction.IsZero() {
+		view.LastInteraction = &rel.LastInteraction
+	}
+	json.NewEncoder(w).Encode(view)
+}
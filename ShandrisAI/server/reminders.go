@@ -0,0 +1,265 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+)
+
+// ReminderNotice is a fired reminder as returned by the reminders endpoint
+type ReminderNotice struct {
+	ID    string    `json:"id"`
+	Task  string    `json:"task"`
+	DueAt time.Time `json:"due_at"`
+}
+
+// ScheduleReminder stores a parsed reminder as a timeline marker for the session
+func ScheduleReminder(sessionID string, req *cognitive.ReminderRequest) *cognitive.TimelineMarker {
+	marker := &cognitive.TimelineMarker{
+		ID:          uuid.New().String(),
+		Type:        cognitive.Reminder,
+		Description: req.Task,
+		Timestamp:   req.At,
+		Recurrence:  req.Recurrence,
+		Importance:  0.7,
+	}
+
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.memory.AddMarker(marker)
+	InfoLogger.Printf("⏰ Scheduled reminder %s for %s (session: %s)", marker.ID, req.At.Format(time.RFC3339), sessionID)
+	return marker
+}
+
+// TakeDueReminders returns the session's due reminders and marks them fired
+func TakeDueReminders(sessionID string, now time.Time, loc *time.Location) []cognitive.MarkerOccurrence {
+	return fireReminders(sessionID, now, loc, nil)
+}
+
+// DueReminders returns the session's due reminders without marking them fired
+func DueReminders(sessionID string, now time.Time, loc *time.Location) []cognitive.MarkerOccurrence {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var due []cognitive.MarkerOccurrence
+	for _, occ := range st.memory.DueMarkers(now, loc) {
+		if occ.Marker.Type == cognitive.Reminder {
+			due = append(due, occ)
+		}
+	}
+	return due
+}
+
+// AcknowledgeReminders marks the listed reminders fired if they are still due, returning how many were
+func AcknowledgeReminders(sessionID string, ids []string, now time.Time, loc *time.Location) int {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	return len(fireReminders(sessionID, now, loc, wanted))
+}
+
+// fireReminders marks due reminders fired, limited to the given IDs unless ids is nil
+func fireReminders(sessionID string, now time.Time, loc *time.Location, ids map[string]bool) []cognitive.MarkerOccurrence {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var due []cognitive.MarkerOccurrence
+	for _, occ := range st.memory.DueMarkers(now, loc) {
+		if occ.Marker.Type != cognitive.Reminder || (ids != nil && !ids[occ.Marker.ID]) {
+			continue
+		}
+		st.memory.MarkTriggered(occ.Marker.ID, now)
+		due = append(due, occ)
+	}
+	if len(due) > 0 {
+		InfoLogger.Printf("⏰ Fired %d reminders for session: %s", len(due), sessionID)
+	}
+	return due
+}
+
+// reminderReply handles a "remind me ..." prompt and returns the confirmation to send back
+func reminderReply(sessionID, prompt string, now time.Time) string {
+	req, err := cognitive.ParseReminder(prompt, now)
+	if errors.Is(err, cognitive.ErrAmbiguousHour) {
+		return "Morning or evening? I'm not guessing on something I'll repeat forever. Say it again with am or pm, like \"every day at 7am\". 😏"
+	}
+	if err != nil {
+		DebugLogger.Printf("⏰ Reminder request without a time: %s", prompt)
+		return "Happy to nag you, but *when*? Give me something like \"tomorrow at 9\", \"Friday at 5pm\", \"in 20 minutes\" or \"every Monday\". 😏"
+	}
+
+	ScheduleReminder(sessionID, req)
+
+	when := describeReminderTime(req.At, now)
+	if req.Recurrence != nil {
+		when = fmt.Sprintf("%s, starting %s", describeRecurrence(req.Recurrence, req.At), when)
+	}
+	return fmt.Sprintf("Consider it etched into my memory. ⏰ %s — %s. Don't make me tell you twice. 😏",
+		capitalize(when), secondPerson(req.Task))
+}
+
+// formatDeliveredReminders renders fired reminders as a preface to the chat response
+func formatDeliveredReminders(due []cognitive.MarkerOccurrence, now time.Time) string {
+	var b strings.Builder
+	for _, occ := range due {
+		b.WriteString(fmt.Sprintf("⏰ Reminder: %s (%s)\n", secondPerson(occ.Marker.Description), describeReminderTime(occ.At, now)))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// RemindersHandler lets the frontend poll for due reminders: GET lists them, and POST with
+// their IDs marks them fired once they have been shown
+func RemindersHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("RemindersHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			LogError(fmt.Errorf("missing session ID"), "Request validation")
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+
+		loc := ResolveUserLocation(sessionID, r.URL.Query().Get("timezone"))
+		due := DueReminders(sessionID, time.Now().In(loc), loc)
+
+		notices := make([]ReminderNotice, 0, len(due))
+		for _, occ := range due {
+			notices = append(notices, ReminderNotice{
+				ID:    occ.Marker.ID,
+				Task:  occ.Marker.Description,
+				DueAt: occ.At,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"reminders": notices})
+
+	case http.MethodPost:
+		var req struct {
+			SessionID string   `json:"session_id"`
+			IDs       []string `json:"ids"`
+			Timezone  string   `json:"timezone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.SessionID == "" {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+
+		loc := ResolveUserLocation(req.SessionID, req.Timezone)
+		fired := AcknowledgeReminders(req.SessionID, req.IDs, time.Now().In(loc), loc)
+		json.NewEncoder(w).Encode(map[string]interface{}{"acknowledged": fired})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// describeReminderTime renders a time relative to today, e.g. "tomorrow at 5:00 PM"
+func describeReminderTime(at, now time.Time) string {
+	at = at.In(now.Location())
+	clock := at.Format("3:04 PM")
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, now.Location()); {
+	case day.Equal(today):
+		return "today at " + clock
+	case day.Equal(today.AddDate(0, 0, 1)):
+		return "tomorrow at " + clock
+	case day.Year() != today.Year():
+		return at.Format("Monday, January 2, 2006") + " at " + clock
+	default:
+		return at.Format("Monday, January 2") + " at " + clock
+	}
+}
+
+// describeRecurrence renders a recurrence pattern, e.g. "every Monday at 9:00 AM"
+func describeRecurrence(pattern *cognitive.RecurrencePattern, at time.Time) string {
+	every := "every"
+	if n, ok := pattern.Conditions["every"].(int); ok && n > 1 {
+		every = fmt.Sprintf("every %d", n)
+	}
+	clock := at.Format("3:04 PM")
+
+	switch pattern.Pattern {
+	case "daily":
+		return fmt.Sprintf("%s day at %s", every, clock)
+	case "weekly":
+		return fmt.Sprintf("%s %s at %s", every, at.Weekday(), clock)
+	case "monthly":
+		return fmt.Sprintf("%s month on the %s at %s", every, ordinal(at.Day()), clock)
+	default:
+		return fmt.Sprintf("%s year on %s at %s", every, at.Format("January 2"), clock)
+	}
+}
+
+var firstPersonWords = regexp.MustCompile(`(?i)\b(my|mine|myself|me|i'm|i am|i)\b`)
+
+// secondPerson turns "submit my thesis" into "submit your thesis"
+func secondPerson(task string) string {
+	return firstPersonWords.ReplaceAllStringFunc(task, func(word string) string {
+		switch strings.ToLower(word) {
+		case "my":
+			return "your"
+		case "mine":
+			return "yours"
+		case "myself":
+			return "yourself"
+		case "i'm", "i am":
+			return "you're"
+		default:
+			return "you"
+		}
+	})
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
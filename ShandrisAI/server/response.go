@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+)
+
+// ChatResponseVersion is bumped whenever the response envelope changes shape.
+// Version 1 was the bare {response} object; its field is still sent first.
+const ChatResponseVersion = 2
+
+// Response kinds
+const (
+	ResponseModel  = "model"  // Generated by the model
+	ResponseSystem = "system" // A canned reply to an action such as saving a profile
+	ResponseError  = "error"  // The turn failed; response holds the reason
+)
+
+// Memory write kinds
+const (
+	WriteMemory  = "memory"  // A long-term memory key
+	WriteProfile = "profile" // The user's persona profile
+	WriteDate    = "date"    // A timeline date such as a birthday
+	WriteEvent   = "event"   // A remembered moment of the conversation
+)
+
+type ChatResponse struct {
+	Response     string              `json:"response"`
+	Version      int                 `json:"version"`
+	TurnID       string              `json:"turn_id"`
+	Kind         string              `json:"kind"`
+	Segments     []cognitive.Segment `json:"segments,omitempty"` // The response split into speech, actions, narration and code
+	Messages     []SceneMessage      `json:"messages,omitempty"` // Attributed lines when a scene is running
+	Mood         *ResponseMood       `json:"mood,omitempty"`
+	Persona      *ResponsePersona    `json:"persona,omitempty"`
+	Topic        *ResponseTopic      `json:"topic,omitempty"`
+	Safety       string              `json:"safety,omitempty"` // Severity of any crisis signal in the user's message
+	Mode         string              `json:"mode,omitempty"`   // Special reply mode, e.g. technical_support
+	MemoryWrites []MemoryWrite       `json:"memory_writes"`
+	Timing       ResponseTiming      `json:"timing"`
+}
+
+// ResponseMood is Shandris's mood after the turn
+type ResponseMood struct {
+	Primary   string  `json:"primary"`
+	Secondary string  `json:"secondary,omitempty"`
+	Intensity float64 `json:"intensity"`
+}
+
+// ResponsePersona is the persona that shaped the reply
+type ResponsePersona struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ResponseTopic is the topic thread the turn was attached to
+type ResponseTopic struct {
+	Current  string `json:"current"`
+	Previous string `json:"previous"`
+	ThreadID string `json:"thread_id"`
+	Switched bool   `json:"switched"`
+	Resumed  bool   `json:"resumed"`
+	// Themes scores the conversational themes this turn touched
+	Themes map[string]float64 `json:"themes,omitempty"`
+}
+
+// MemoryWrite is something the turn stored about the user
+type MemoryWrite struct {
+	Kind  string `json:"kind"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// ResponseTiming reports where the turn's time went
+type ResponseTiming struct {
+	StartedAt time.Time `json:"started_at"`
+	ModelMS   int64     `json:"model_ms"`
+	TotalMS   int64     `json:"total_ms"`
+}
+
+// chatTurn collects a chat turn's metadata while it is handled
+type chatTurn struct {
+	id        string
+	sessionID string
+	started   time.Time
+	model     time.Duration
+	writes    []MemoryWrite
+	mood      *ResponseMood
+	persona   *ResponsePersona
+	topic     *ResponseTopic
+	safety    string
+	mode      string
+}
+
+func newChatTurn() *chatTurn {
+	return &chatTurn{id: uuid.New().String(), started: time.Now(), writes: []MemoryWrite{}}
+}
+
+// remember saves a long-term memory and records the write
+func (t *chatTurn) remember(key, value string) {
+	SaveMemory(t.sessionID, key, value)
+	t.recordWrite(WriteMemory, key, value)
+}
+
+func (t *chatTurn) recordWrite(kind, key, value string) {
+	t.writes = append(t.writes, MemoryWrite{Kind: kind, Key: key, Value: value})
+}
+
+// setMood records Shandris's mood after the turn
+func (t *chatTurn) setMood(mood cognitive.MoodState) {
+	t.mood = &ResponseMood{Primary: mood.Primary, Secondary: mood.Secondary, Intensity: mood.Intensity}
+}
+
+// setPersona records the persona that shaped the reply, if any
+func (t *chatTurn) setPersona(selection PersonaSelection) {
+	if selection.Persona != nil {
+		t.persona = &ResponsePersona{ID: selection.Persona.ID, Name: selection.Persona.Name}
+	}
+}
+
+// runModel calls the model, timing the call
+func (t *chatTurn) runModel(run func() error) error {
+	start := time.Now()
+	err := run()
+	t.model += time.Since(start)
+	return err
+}
+
+// envelope builds the response for the turn
+func (t *chatTurn) envelope(kind, text string) ChatResponse {
+	return ChatResponse{
+		Response:     text,
+		Version:      ChatResponseVersion,
+		TurnID:       t.id,
+		Kind:         kind,
+		Mood:         t.mood,
+		Persona:      t.persona,
+		Topic:        t.topic,
+		Safety:       t.safety,
+		Mode:         t.mode,
+		MemoryWrites: t.writes,
+		Timing: ResponseTiming{
+			StartedAt: t.started,
+			ModelMS:   t.model.Milliseconds(),
+			TotalMS:   time.Since(t.started).Milliseconds(),
+		},
+	}
+}
+
+// system answers the turn with a canned reply
+func (t *chatTurn) system(w http.ResponseWriter, text string) {
+	json.NewEncoder(w).Encode(t.envelope(ResponseSystem, text))
+}
+
+// fail answers the turn with an error envelope
+func (t *chatTurn) fail(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(t.envelope(ResponseError, message))
+}
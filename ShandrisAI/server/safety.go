@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/lib/pq"
+)
+
+// safetyResourcesPath holds the support resources shown in a crisis; SHANDRIS_SAFETY_RESOURCES overrides it
+var safetyResourcesPath = envOr("SHANDRIS_SAFETY_RESOURCES", dataPath("safety_resources.json"))
+
+// SupportResource is a crisis line or service offered to a user in crisis
+type SupportResource struct {
+	Name        string `json:"name"`
+	Contact     string `json:"contact"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	resourcesMu sync.RWMutex
+	// supportResources maps an IANA zone, or a whole area such as "Australia", to local resources.
+	// The "default" entry is used everywhere else.
+	supportResources = map[string][]SupportResource{
+		"default": {{Name: "Find A Helpline", Contact: "findahelpline.com", Description: "Free, confidential crisis lines in your country"}},
+	}
+)
+
+// InitSafety loads the configured support resources. Without them the built-in default is used.
+func InitSafety() {
+	raw, err := os.ReadFile(safetyResourcesPath)
+	if err != nil {
+		LogError(err, "Failed to read safety resources")
+		return
+	}
+
+	var resources map[string][]SupportResource
+	if err := json.Unmarshal(raw, &resources); err != nil {
+		LogError(err, "Failed to parse safety resources")
+		return
+	}
+	if len(resources["default"]) == 0 {
+		LogError(fmt.Errorf("%s has no default resources", safetyResourcesPath), "Failed to load safety resources")
+		return
+	}
+
+	resourcesMu.Lock()
+	supportResources = resources
+	resourcesMu.Unlock()
+	InfoLogger.Printf("🆘 Loaded safety resources for %d regions from %s", len(resources), safetyResourcesPath)
+}
+
+// SafetyResources returns the support resources for the user's time zone
+func SafetyResources(loc *time.Location) []SupportResource {
+	resourcesMu.RLock()
+	defer resourcesMu.RUnlock()
+
+	zone := loc.String()
+	if resources, ok := supportResources[zone]; ok {
+		return resources
+	}
+	if area, _, found := strings.Cut(zone, "/"); found {
+		if resources, ok := supportResources[area]; ok {
+			return resources
+		}
+	}
+	return supportResources["default"]
+}
+
+// formatSafetyResources renders the resources appended to a protective reply
+func formatSafetyResources(resources []SupportResource) string {
+	var b strings.Builder
+	b.WriteString("If you're in danger or thinking about ending your life, please reach out now:\n")
+	for _, resource := range resources {
+		line := fmt.Sprintf("• %s: %s", resource.Name, resource.Contact)
+		if resource.Description != "" {
+			line += fmt.Sprintf(" (%s)", resource.Description)
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("If you're in immediate danger, call your local emergency number.")
+	return b.String()
+}
+
+// RecordSafetyEvent writes an audit record of a crisis detection. Only the severity and
+// categories are kept; the user's message is never stored here.
+func RecordSafetyEvent(sessionID string, assessment cognitive.SafetyAssessment) {
+	_, err := db.Exec(`
+		INSERT INTO safety_events (session_id, severity, categories, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, sessionID, assessment.Severity.String(), pq.Array(assessment.Categories), assessment.AssessedAt)
+	if err != nil {
+		LogError(err, "Failed to record safety event")
+		return
+	}
+	InfoLogger.Printf("🆘 Safety signal (%s: %s) for session: %s", assessment.Severity, strings.Join(assessment.Categories, ", "), sessionID)
+}
+
+// protectivePersona is the selection used for a crisis turn: the base personality with no
+// persona, and no signature flourishes or length cap on the reply
+func protectivePersona() PersonaSelection {
+	ps := personaRegistry.NewPersonaSystem()
+	configureStylePipeline(ps.Style)
+	ps.Style.Disable(cognitive.StageSignature)
+	ps.Style.Disable(cognitive.StageLengthCap)
+	return PersonaSelection{System: ps}
+}
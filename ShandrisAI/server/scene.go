@@ -0,0 +1,324 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// SceneMessage is one character's line in a scene reply
+type SceneMessage struct {
+	Speaker  string              `json:"speaker"` // Participant ID
+	Name     string              `json:"name"`
+	Content  string              `json:"content"`
+	Segments []cognitive.Segment `json:"segments,omitempty"`
+}
+
+// SceneTurn tells BuildPrompt which scene character it is voicing
+type SceneTurn struct {
+	Speaker string         // Name of the character being voiced
+	Others  []string       // Names of the other characters in the scene
+	Earlier []SceneMessage // Lines other characters already said this turn
+}
+
+// LoadScene returns the session's active scene, or nil
+func LoadScene(sessionID string) *cognitive.Scene {
+	var raw []byte
+	err := db.QueryRow(`SELECT scene FROM session_scenes WHERE session_id = $1`, sessionID).Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			LogError(err, "Failed to load scene")
+		}
+		return nil
+	}
+
+	var scene cognitive.Scene
+	if err := json.Unmarshal(raw, &scene); err != nil {
+		LogError(err, "Failed to parse scene")
+		return nil
+	}
+	return &scene
+}
+
+// SaveScene stores the session's scene; a nil scene ends it
+func SaveScene(sessionID string, scene *cognitive.Scene) error {
+	if scene == nil {
+		if _, err := db.Exec(`DELETE FROM session_scenes WHERE session_id = $1`, sessionID); err != nil {
+			return fmt.Errorf("error ending scene: %w", err)
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(scene)
+	if err != nil {
+		return fmt.Errorf("error serializing scene: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO session_scenes (session_id, scene, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET scene = EXCLUDED.scene, updated_at = CURRENT_TIMESTAMP
+	`, sessionID, raw)
+	if err != nil {
+		return fmt.Errorf("error saving scene: %w", err)
+	}
+	return nil
+}
+
+// SaveSceneHistory records a scene reply, one row per speaker. The user's message is kept
+// with the first line only, so history replays the turn in order.
+func SaveSceneHistory(sessionID, userMessage string, messages []SceneMessage, topic, threadID string) {
+	for i, message := range messages {
+		user := ""
+		if i == 0 {
+			user = userMessage
+		}
+		_, err := db.Exec(`
+			INSERT INTO chat_history (session_id, user_message, ai_response, topic, thread_id, speaker)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		`, sessionID, user, message.Content, topic, threadID, message.Name)
+		if err != nil {
+			fmt.Println("❌ Error saving scene history:", err)
+		}
+	}
+}
+
+// resolveParticipant finds a character by persona ID or name, or by stored personality name.
+// Personas the user's boundaries rule out can't join.
+func resolveParticipant(ref string, boundaries cognitive.Boundaries) (cognitive.SceneParticipant, error) {
+	summaries, _ := personaRegistry.Summaries()
+	for _, s := range summaries {
+		if strings.EqualFold(s.ID, ref) || strings.EqualFold(s.Name, ref) || s.ID == slugify(ref) {
+			if boundary := personaRegistry.NewPersonaSystem().BoundaryConflict(s.ID, boundaries.Restrictions()); boundary != "" {
+				return cognitive.SceneParticipant{}, fmt.Errorf("%s can't join while your boundaries rule out %s", s.Name, boundary)
+			}
+			return cognitive.SceneParticipant{ID: s.ID, Name: s.Name, Kind: cognitive.ParticipantPersona}, nil
+		}
+	}
+
+	personality, err := GetPersonalityByName(db, ref)
+	if err != nil {
+		return cognitive.SceneParticipant{}, fmt.Errorf("I don't know anyone called %q", ref)
+	}
+	return cognitive.SceneParticipant{ID: slugify(personality.Name), Name: personality.Name, Kind: cognitive.ParticipantCharacter}, nil
+}
+
+// sceneSpeaker returns the personality and persona a participant speaks with. Personas are
+// voiced over Shandris's base personality; characters use their own stored personality.
+// A persona the user's boundaries have since ruled out doesn't speak.
+func sceneSpeaker(base Personality, participant cognitive.SceneParticipant, boundaries cognitive.Boundaries) (Personality, PersonaSelection, error) {
+	if participant.Kind == cognitive.ParticipantCharacter {
+		personality, err := GetPersonalityByName(db, participant.Name)
+		return personality, PersonaSelection{}, err
+	}
+
+	ps := personaRegistry.NewPersonaSystem()
+	configureStylePipeline(ps.Style)
+	if boundary := ps.BoundaryConflict(participant.ID, boundaries.Restrictions()); boundary != "" {
+		return base, PersonaSelection{}, fmt.Errorf("persona %s is ruled out by the %s boundary", participant.ID, boundary)
+	}
+	if err := ps.SwitchPersona(participant.ID, "scene"); err != nil {
+		return base, PersonaSelection{}, err
+	}
+
+	personality := base
+	personality.Name = participant.Name
+	personality.Identity = participant.Name
+	return personality, PersonaSelection{Persona: ps.ActivePersona(), Style: ps.StyleFor(cognitive.PersonaSignals{}), System: ps, Own: true}, nil
+}
+
+// RunSceneTurn generates the reply of every character whose turn it is. Each speaker sees the
+// lines the others said before them, and gets lore scoped to them and the memories of turns
+// they witnessed. Replies go through the same model choice and clean-up as a chat reply;
+// world updates in any speaker's reply are applied to world.
+func RunSceneTurn(sessionID string, scene *cognitive.Scene, base Personality, world *cognitive.WorldState, history []ChatTurn,
+	prompt, currentTopic, previousTopic string, topics []string, mood string, pc PromptContext) ([]SceneMessage, error) {
+
+	speakers := scene.ChooseSpeakers(prompt)
+	if len(speakers) == 0 {
+		speakers = []cognitive.SceneParticipant{chooseSpeakerByModel(scene, history, prompt)}
+	}
+
+	var messages []SceneMessage
+	for _, participant := range speakers {
+		personality, selection, err := sceneSpeaker(base, participant, pc.Boundaries)
+		if err != nil {
+			LogError(err, "Failed to prepare scene speaker "+participant.ID)
+			continue
+		}
+
+		speakerContext := pc
+		speakerContext.Persona = selection
+		speakerContext.Lore = SessionLore(prompt, history, participant.ID, participant.Name)
+		speakerContext.Memories = RecallSessionMemories(sessionID, topics, mood, participant.ID)
+		speakerContext.Scene = &SceneTurn{
+			Speaker: participant.Name,
+			Others:  scene.Names(participant.ID),
+			Earlier: messages,
+		}
+
+		context := BuildPrompt(personality, history, prompt, currentTopic, previousTopic, sessionID, speakerContext)
+		output, err := RunModel(replyModel(pc.Technical), context)
+		if err != nil {
+			return messages, err
+		}
+
+		content := stripSpeakerPrefix(cleanReply(sessionID, world, output), participant.Name)
+		rules := cognitive.DefaultSegmentRules()
+		if selection.System != nil {
+			content = selection.System.ApplyPersonaStyle(content)
+			rules = selection.System.SegmentRules()
+		}
+		messages = append(messages, SceneMessage{
+			Speaker:  participant.ID,
+			Name:     participant.Name,
+			Content:  content,
+			Segments: cognitive.ParseSegments(content, rules),
+		})
+		scene.LastSpeaker = participant.ID
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("no scene character could reply")
+	}
+	if err := SaveScene(sessionID, scene); err != nil {
+		LogError(err, "Failed to save scene")
+	}
+	DebugLogger.Printf("🎬 Scene reply from %d characters", len(messages))
+	return messages, nil
+}
+
+// chooseSpeakerByModel asks the model who should reply, falling back to the rotation
+func chooseSpeakerByModel(scene *cognitive.Scene, history []ChatTurn, prompt string) cognitive.SceneParticipant {
+	var b strings.Builder
+	b.WriteString("A group roleplay scene has these characters: " + strings.Join(scene.Names(""), ", ") + ".\n")
+	start := len(history) - 4
+	if start < 0 {
+		start = 0
+	}
+	for _, turn := range history[start:] {
+		if turn.UserMessage != "" {
+			b.WriteString("User: " + turn.UserMessage + "\n")
+		}
+		b.WriteString(turnSpeaker(turn) + ": " + turn.AIResponse + "\n")
+	}
+	b.WriteString("User: " + prompt + "\n\nWhich one character should reply next? Answer with the name only.")
+
+	output, err := RunDeepSeek(b.String())
+	if err == nil {
+		if participant, ok := scene.MatchParticipant(stripChainOfThought(output)); ok {
+			return participant
+		}
+	}
+	return scene.NextInRotation()
+}
+
+// describeScene tells the model which scene character it is voicing
+func describeScene(turn *SceneTurn) string {
+	if turn == nil {
+		return ""
+	}
+	return fmt.Sprintf(`
+GROUP SCENE:
+You are voicing only %s, in a scene with the user and %s.
+Lines from the other characters are prefixed with their names; never write lines for them.
+Reply with %s's next message only, in their own voice, without a name prefix.
+`, turn.Speaker, strings.Join(turn.Others, ", "), turn.Speaker)
+}
+
+// formatSceneMessages joins scene lines into a single reply for clients that don't read messages
+func formatSceneMessages(messages []SceneMessage) string {
+	lines := make([]string, 0, len(messages))
+	for _, m := range messages {
+		lines = append(lines, fmt.Sprintf("**%s:** %s", m.Name, m.Content))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// sceneCommandReply runs a /scene command
+func sceneCommandReply(sessionID, prompt string) string {
+	cmd, err := cognitive.ParseSceneCommand(prompt)
+	if err != nil {
+		return "I couldn't make sense of that scene command. " + capitalize(err.Error()) + "."
+	}
+
+	scene := LoadScene(sessionID)
+	boundaries := sessionBoundaries(sessionID)
+	if scene == nil && cmd.Action != "start" {
+		return "There's no scene running. Start one with /scene start <character> <character>."
+	}
+
+	switch cmd.Action {
+	case "show":
+		return fmt.Sprintf("In the scene: %s (mode: %s).", strings.Join(scene.Names(""), ", "), scene.Mode)
+
+	case "end":
+		if err := SaveScene(sessionID, nil); err != nil {
+			LogError(err, "Failed to end scene")
+		}
+		return "Scene over. It's just the two of us again."
+
+	case "start":
+		var participants []cognitive.SceneParticipant
+		for _, ref := range cmd.Participants {
+			participant, err := resolveParticipant(ref, boundaries)
+			if err != nil {
+				return err.Error() + "."
+			}
+			participants = append(participants, participant)
+		}
+		started, err := cognitive.NewScene(participants, cmd.Mode)
+		if err != nil {
+			return capitalize(err.Error()) + "."
+		}
+		scene = started
+
+	case "add":
+		participant, err := resolveParticipant(cmd.Participants[0], boundaries)
+		if err != nil {
+			return err.Error() + "."
+		}
+		if err := scene.Add(participant); err != nil {
+			return capitalize(err.Error()) + "."
+		}
+
+	case "remove":
+		if err := scene.Remove(cmd.Participants[0]); err != nil {
+			return capitalize(err.Error()) + "."
+		}
+		if len(scene.Participants) < 2 {
+			SaveScene(sessionID, nil)
+			return "With only one character left, the scene is over."
+		}
+
+	case "mode":
+		if err := scene.SetMode(cmd.Mode); err != nil {
+			return capitalize(err.Error()) + "."
+		}
+	}
+
+	if err := SaveScene(sessionID, scene); err != nil {
+		LogError(err, "Failed to save scene")
+		return "The scene wouldn't hold together. Try again in a moment."
+	}
+	InfoLogger.Printf("🎬 Scene for session %s: %s", sessionID, strings.Join(scene.Names(""), ", "))
+	return fmt.Sprintf("Scene set: %s (mode: %s).", strings.Join(scene.Names(""), ", "), scene.Mode)
+}
+
+// turnSpeaker is the label a history turn's reply is rendered under
+func turnSpeaker(turn ChatTurn) string {
+	if turn.Speaker != "" {
+		return turn.Speaker
+	}
+	return "Assistant"
+}
+
+// stripSpeakerPrefix removes a "Name:" the model put in front of its own line
+func stripSpeakerPrefix(text, name string) string {
+	re := regexp.MustCompile(`(?i)^\**` + regexp.QuoteMeta(name) + `\**\s*:\**\s*`)
+	return strings.TrimSpace(re.ReplaceAllString(text, ""))
+}
@@ -37,6 +37,8 @@ CREATE TABLE IF NOT EXISTS chat_history (
     user_message TEXT NOT NULL,
     ai_response TEXT NOT NULL,
     topic TEXT NOT NULL DEFAULT 'uncategorized',
+    thread_id TEXT,
+    speaker TEXT,
     timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -173,5 +175,6 @@ ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value;
 
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_chat_history_session_topic ON chat_history(session_id, topic);
+CREATE INDEX IF NOT EXISTS idx_chat_history_thread ON chat_history(session_id, thread_id);
 CREATE INDEX IF NOT EXISTS idx_long_term_memory_session ON long_term_memory(session_id);
 CREATE INDEX IF NOT EXISTS idx_persona_profiles_name ON persona_profiles((profile_data->>'name')); 
\ No newline at end of file
@@ -7,9 +7,32 @@ import (
 )
 
 func StartServer() {
+	if err := checkDataDir(); err != nil {
+		log.Fatal("❌ ", err)
+	}
 	InitDB()
+	InitPersonas()
+	InitBoundaries()
+	InitSafety()
+	InitThemes()
 
 	http.HandleFunc("/api/chat", ChatHandler)
+	http.HandleFunc("/api/reminders", RemindersHandler)
+	http.HandleFunc("/api/outbox", OutboxHandler)
+	http.HandleFunc("/api/world", WorldHandler)
+	http.HandleFunc("/api/rolls", RollsHandler)
+	http.HandleFunc("/api/boundaries", BoundariesHandler)
+	http.HandleFunc("/api/relationship", RelationshipHandler)
+	http.HandleFunc("/api/admin/personas", AdminPersonasHandler)
+	http.HandleFunc("/api/admin/personas/reload", AdminReloadPersonasHandler)
+	http.HandleFunc("/api/admin/cards/import", AdminImportCardHandler)
+	http.HandleFunc("/api/admin/cards/export", AdminExportCardHandler)
+	http.HandleFunc("/api/admin/lore", AdminLoreHandler)
+	http.HandleFunc("/api/admin/lore/import", AdminLoreImportHandler)
+	http.HandleFunc("/api/admin/lore/export", AdminLoreExportHandler)
+	http.HandleFunc("/api/admin/boundaries", AdminBoundariesHandler)
+	http.HandleFunc("/api/admin/patterns", AdminPatternsHandler)
+	http.HandleFunc("/api/admin/analytics/", AdminAnalyticsHandler)
 
 	fmt.Println("🚀 Server running on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// themesPath holds the theme dictionary; SHANDRIS_THEMES overrides it
+var themesPath = envOr("SHANDRIS_THEMES", dataPath("themes.json"))
+
+var (
+	themesMu sync.RWMutex
+	// themeModel is the loaded theme dictionary; nil until InitThemes succeeds
+	themeModel *cognitive.ThemeModel
+)
+
+// InitThemes loads the theme dictionary. Without it no themes are detected.
+func InitThemes() {
+	model, err := cognitive.LoadThemeModel(themesPath)
+	if err != nil {
+		LogError(err, "Failed to load theme model")
+		return
+	}
+
+	themesMu.Lock()
+	themeModel = model
+	themesMu.Unlock()
+	InfoLogger.Printf("🎭 Loaded %d conversational themes from %s", len(model.Themes), themesPath)
+}
+
+func currentThemeModel() *cognitive.ThemeModel {
+	themesMu.RLock()
+	defer themesMu.RUnlock()
+	return themeModel
+}
+
+// LoadSessionAnalyzer builds a context analyzer for the session: its active themes and their
+// history, the recent conversation window and the user's profile
+func LoadSessionAnalyzer(sessionID string) *cognitive.ContextAnalyzer {
+	analyzer := cognitive.NewContextAnalyzer(currentThemeModel())
+	detector := analyzer.ThemeDetector
+
+	var activeJSON, historyJSON []byte
+	err := db.QueryRow(`
+		SELECT active_themes, history FROM session_themes WHERE session_id = $1
+	`, sessionID).Scan(&activeJSON, &historyJSON)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		LogError(err, "Failed to load session themes")
+	default:
+		if err := json.Unmarshal(activeJSON, &detector.ActiveThemes); err != nil {
+			LogError(err, "Failed to deserialize active themes")
+		}
+		if err := json.Unmarshal(historyJSON, &detector.ThemeHistory); err != nil {
+			LogError(err, "Failed to deserialize theme history")
+		}
+	}
+	if detector.ActiveThemes == nil {
+		detector.ActiveThemes = make(map[string]float64)
+	}
+
+	window, err := GetRecentUserMessages(sessionID, cognitive.ThemeWindowSize)
+	if err != nil {
+		LogError(err, "Failed to load recent messages for theme detection")
+	}
+	for _, message := range window {
+		if message != "" {
+			detector.Window = append(detector.Window, message)
+		}
+	}
+
+	detector.Profile = profileAttributes(sessionID)
+	return analyzer
+}
+
+// profileAttributes returns the user's profile attributes, if they have a profile
+func profileAttributes(sessionID string) map[string]string {
+	attributes := make(map[string]string)
+	var profileJSON []byte
+	err := db.QueryRow(`
+		SELECT profile_data FROM persona_profiles WHERE session_id = $1
+	`, sessionID).Scan(&profileJSON)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			LogError(err, "Failed to load profile for theme detection")
+		}
+		return attributes
+	}
+
+	var profile PersonaProfile
+	if err := json.Unmarshal(profileJSON, &profile); err != nil {
+		LogError(err, "Failed to deserialize profile for theme detection")
+		return attributes
+	}
+	for key, value := range profile.Attributes {
+		attributes[key] = value
+	}
+	return attributes
+}
+
+// SaveSessionThemes upserts the session's active themes and transition history
+func SaveSessionThemes(sessionID string, detector *cognitive.ThemeDetector) error {
+	activeJSON, err := json.Marshal(detector.ActiveThemes)
+	if err != nil {
+		return fmt.Errorf("error serializing active themes: %w", err)
+	}
+	history := detector.ThemeHistory
+	if history == nil {
+		history = []cognitive.ThemeTransition{}
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("error serializing theme history: %w", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO session_themes (session_id, active_themes, history, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET
+			active_themes = EXCLUDED.active_themes,
+			history = EXCLUDED.history,
+			updated_at = EXCLUDED.updated_at
+	`, sessionID, activeJSON, historyJSON)
+	if err != nil {
+		return fmt.Errorf("error saving session themes: %w", err)
+	}
+	return nil
+}
+
+// AnalyzeSessionTurn reads the themes, sentiment and sapphic context of a message in the
+// session's conversation, then saves the session's updated themes
+func AnalyzeSessionTurn(sessionID, input string, boundaries cognitive.Boundaries) cognitive.EmotionalContext {
+	analyzer := LoadSessionAnalyzer(sessionID)
+	transitions := len(analyzer.ThemeDetector.ThemeHistory)
+
+	context := analyzer.AnalyzeContext(input, map[string]any{"flirting_enabled": boundaries.AllowsFlirting()})
+
+	detector := analyzer.ThemeDetector
+	if len(detector.ThemeHistory) > transitions {
+		transition := detector.ThemeHistory[len(detector.ThemeHistory)-1]
+		InfoLogger.Printf("🎭 Theme shifted from %q to %s (trigger: %q) for session: %s", transition.From, transition.To, transition.Trigger, sessionID)
+	}
+	if err := SaveSessionThemes(sessionID, detector); err != nil {
+		LogError(err, "Failed to save session themes")
+	}
+	return context
+}
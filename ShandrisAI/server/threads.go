@@ -0,0 +1,102 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/lib/pq"
+)
+
+// maxLoadedThreads caps how many threads (active and archived) are restored per request
+const maxLoadedThreads = 50
+
+// LoadTopicManager restores a session's topic threads into a TopicManager.
+// Pruned threads are persisted as archived so they can be resumed later.
+func LoadTopicManager(sessionID string) *cognitive.TopicManager {
+	tm := cognitive.NewTopicManager()
+	tm.OnArchive = func(thread *cognitive.TopicThread) {
+		if err := SaveTopicThread(sessionID, thread, true); err != nil {
+			LogError(err, "Failed to archive topic thread")
+			return
+		}
+		InfoLogger.Printf("📦 Archived topic thread %s (%s) for session: %s", thread.ID, thread.MainTopic, sessionID)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, main_topic, active_nodes, start_time, last_active, depth, archived
+		FROM topic_threads
+		WHERE session_id = $1
+		ORDER BY last_active DESC
+		LIMIT $2
+	`, sessionID, maxLoadedThreads)
+	if err != nil {
+		LogError(err, "Failed to load topic threads")
+		return tm
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		thread := &cognitive.TopicThread{}
+		var archived bool
+		if err := rows.Scan(&thread.ID, &thread.MainTopic, pq.Array(&thread.ActiveNodes),
+			&thread.StartTime, &thread.LastActive, &thread.Depth, &archived); err != nil {
+			LogError(err, "Failed to scan topic thread")
+			continue
+		}
+		if archived {
+			tm.ArchivedThreads[thread.ID] = thread
+		} else {
+			tm.ActiveThreads[thread.ID] = thread
+		}
+	}
+
+	return tm
+}
+
+// SaveTopicManager persists every active thread of the session
+func SaveTopicManager(sessionID string, tm *cognitive.TopicManager) {
+	for _, thread := range tm.ActiveThreads {
+		if err := SaveTopicThread(sessionID, thread, false); err != nil {
+			LogError(err, "Failed to save topic thread")
+		}
+	}
+}
+
+// SaveTopicThread upserts a single thread for a session
+func SaveTopicThread(sessionID string, thread *cognitive.TopicThread, archived bool) error {
+	_, err := db.Exec(`
+		INSERT INTO topic_threads (id, session_id, main_topic, active_nodes, start_time, last_active, depth, archived)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			main_topic = EXCLUDED.main_topic,
+			active_nodes = EXCLUDED.active_nodes,
+			last_active = EXCLUDED.last_active,
+			depth = EXCLUDED.depth,
+			archived = EXCLUDED.archived
+	`, thread.ID, sessionID, thread.MainTopic, pq.Array(thread.ActiveNodes),
+		thread.StartTime, thread.LastActive, thread.Depth, archived)
+	if err != nil {
+		return fmt.Errorf("error saving topic thread: %w", err)
+	}
+	return nil
+}
+
+// latestThread returns the session's most recently active thread and its topic,
+// so messages outside a chat turn can be attached to the ongoing conversation
+func latestThread(sessionID string) (string, string) {
+	var id, topic string
+	err := db.QueryRow(`
+		SELECT id, main_topic FROM topic_threads
+		WHERE session_id = $1 AND NOT archived
+		ORDER BY last_active DESC
+		LIMIT 1
+	`, sessionID).Scan(&id, &topic)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			LogError(err, "Failed to look up latest topic thread")
+		}
+		return "", ""
+	}
+	return id, topic
+}
@@ -0,0 +1,451 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxLoadedEvents caps how many memory events are loaded into a session's timeline
+const maxLoadedEvents = 500
+
+// recallLimit is how many memories are surfaced in each prompt
+const recallLimit = 5
+
+// upcomingHorizon is how far ahead upcoming dates are mentioned in the prompt
+const upcomingHorizon = 7 * 24 * time.Hour
+
+// timelineIdleTTL is how long an unused session timeline stays loaded. Every change is
+// persisted as it happens, so an evicted timeline is simply reloaded on next use.
+const timelineIdleTTL = 30 * time.Minute
+
+// timelineSweepInterval is how often idle timelines are looked for
+const timelineSweepInterval = 5 * time.Minute
+
+// sessionTimeline guards a session's in-process timeline memory
+type sessionTimeline struct {
+	mu       sync.Mutex
+	memory   *cognitive.TimelineMemory
+	lastUsed time.Time // Guarded by timelinesMu
+}
+
+var (
+	timelinesMu    sync.Mutex
+	timelines      = make(map[string]*sessionTimeline)
+	timelinesSwept time.Time
+)
+
+// getSessionTimeline returns the session's timeline, loading it from the database on first use
+func getSessionTimeline(sessionID string) *sessionTimeline {
+	timelinesMu.Lock()
+	defer timelinesMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(timelinesSwept) >= timelineSweepInterval {
+		evictIdleTimelines(now)
+	}
+
+	if st, ok := timelines[sessionID]; ok {
+		st.lastUsed = now
+		return st
+	}
+
+	memory := cognitive.NewTimelineMemory()
+	if err := loadMemoryEvents(sessionID, memory); err != nil {
+		LogError(err, "Failed to load memory events")
+	}
+	if err := loadTimelineMarkers(sessionID, memory); err != nil {
+		LogError(err, "Failed to load timeline markers")
+	}
+	if err := loadRelationship(sessionID, memory); err != nil {
+		LogError(err, "Failed to load relationship")
+	}
+	memory.OnEventChange = func(event *cognitive.MemoryEvent) {
+		if err := SaveMemoryEvent(sessionID, event); err != nil {
+			LogError(err, "Failed to persist memory event")
+		}
+	}
+	memory.OnMarkerChange = func(marker *cognitive.TimelineMarker) {
+		if err := SaveTimelineMarker(sessionID, marker); err != nil {
+			LogError(err, "Failed to persist timeline marker")
+		}
+	}
+	memory.OnRelationshipChange = func(rel *cognitive.RelationshipMemory) {
+		if err := SaveRelationship(sessionID, rel); err != nil {
+			LogError(err, "Failed to persist relationship")
+		}
+	}
+
+	st := &sessionTimeline{memory: memory, lastUsed: now}
+	timelines[sessionID] = st
+	return st
+}
+
+// evictIdleTimelines drops the timelines no request has used for timelineIdleTTL.
+// The caller holds timelinesMu.
+func evictIdleTimelines(now time.Time) {
+	for sessionID, st := range timelines {
+		if now.Sub(st.lastUsed) >= timelineIdleTTL {
+			delete(timelines, sessionID)
+		}
+	}
+	timelinesSwept = now
+}
+
+// loadMemoryEvents restores a session's most relevant events into the timeline
+func loadMemoryEvents(sessionID string, memory *cognitive.TimelineMemory) error {
+	rows, err := db.Query(`
+		SELECT id, type, content, timestamp, importance, context, relations, tags, emotions, last_recall, recall_count
+		FROM memory_events
+		WHERE session_id = $1
+		ORDER BY importance DESC, timestamp DESC
+		LIMIT $2
+	`, sessionID, maxLoadedEvents)
+	if err != nil {
+		return fmt.Errorf("error querying memory events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event := &cognitive.MemoryEvent{}
+		var eventType string
+		var contextJSON, emotionsJSON []byte
+		var lastRecall sql.NullTime
+
+		if err := rows.Scan(&event.ID, &eventType, &event.Content, &event.Timestamp, &event.Importance,
+			&contextJSON, pq.Array(&event.Relations), pq.Array(&event.Tags), &emotionsJSON,
+			&lastRecall, &event.RecallCount); err != nil {
+			return fmt.Errorf("error scanning memory event: %w", err)
+		}
+
+		event.Type = cognitive.EventType(eventType)
+		if lastRecall.Valid {
+			event.LastRecall = lastRecall.Time
+		}
+		if err := json.Unmarshal(contextJSON, &event.Context); err != nil {
+			LogError(err, "Failed to deserialize memory event context")
+		}
+		if err := json.Unmarshal(emotionsJSON, &event.Emotions); err != nil {
+			LogError(err, "Failed to deserialize memory event emotions")
+		}
+
+		memory.RestoreEvent(event)
+	}
+
+	return rows.Err()
+}
+
+// SaveMemoryEvent upserts a memory event, including its recall statistics
+func SaveMemoryEvent(sessionID string, event *cognitive.MemoryEvent) error {
+	contextJSON, err := json.Marshal(event.Context)
+	if err != nil {
+		return fmt.Errorf("error serializing event context: %w", err)
+	}
+	emotions := event.Emotions
+	if emotions == nil {
+		emotions = make(map[string]float64)
+	}
+	emotionsJSON, err := json.Marshal(emotions)
+	if err != nil {
+		return fmt.Errorf("error serializing event emotions: %w", err)
+	}
+
+	var lastRecall sql.NullTime
+	if !event.LastRecall.IsZero() {
+		lastRecall = sql.NullTime{Time: event.LastRecall, Valid: true}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO memory_events (
+			id, session_id, type, content, timestamp, importance,
+			context, relations, tags, emotions, last_recall, recall_count
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+			importance = EXCLUDED.importance,
+			context = EXCLUDED.context,
+			relations = EXCLUDED.relations,
+			tags = EXCLUDED.tags,
+			emotions = EXCLUDED.emotions,
+			last_recall = EXCLUDED.last_recall,
+			recall_count = EXCLUDED.recall_count
+	`, event.ID, sessionID, string(event.Type), event.Content, event.Timestamp, event.Importance,
+		contextJSON, pq.Array(nonNilStrings(event.Relations)), pq.Array(nonNilStrings(event.Tags)),
+		emotionsJSON, lastRecall, event.RecallCount)
+	if err != nil {
+		return fmt.Errorf("error saving memory event: %w", err)
+	}
+	return nil
+}
+
+// RecallSessionMemories recalls the memories most relevant to the current topic and mood.
+// Given scene characters, only memories of turns one of them witnessed are recalled.
+func RecallSessionMemories(sessionID string, topics []string, mood string, present ...string) []cognitive.MemoryEvent {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	recalled := st.memory.RecallMemories(&cognitive.EventContext{
+		Mood:    mood,
+		Topics:  topics,
+		Present: present,
+	}, recallLimit)
+
+	// Copy out so the prompt doesn't share state with the timeline
+	memories := make([]cognitive.MemoryEvent, 0, len(recalled))
+	for _, event := range recalled {
+		memories = append(memories, *event)
+	}
+	if len(memories) > 0 {
+		DebugLogger.Printf("🕰️ Recalled %d memories for session: %s", len(memories), sessionID)
+	}
+	return memories
+}
+
+// RecordTurnMemory stores the turn on the session timeline if it is worth remembering,
+// returning the stored event or nil. present lists the scene characters who witnessed it.
+func RecordTurnMemory(sessionID, prompt string, topics []string, userMood string, shandrisMood cognitive.MoodState, present ...string) *cognitive.MemoryEvent {
+	event := cognitive.NewTurnEvent(prompt, topics, userMood, shandrisMood)
+	if event == nil {
+		return nil
+	}
+	// The moment also counts towards the relationship with this user
+	event.Context.Participants = []string{sessionID}
+	event.Context.Present = present
+
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if err := st.memory.StoreEvent(event); err != nil {
+		LogError(err, "Failed to store memory event")
+		return nil
+	}
+	InfoLogger.Printf("🕰️ Stored %s memory for session: %s", event.Type, sessionID)
+	return event
+}
+
+// loadTimelineMarkers restores a session's markers into the timeline
+func loadTimelineMarkers(sessionID string, memory *cognitive.TimelineMemory) error {
+	rows, err := db.Query(`
+		SELECT id, type, description, timestamp, recurrence_pattern, importance, last_trigger
+		FROM timeline_markers
+		WHERE session_id = $1
+	`, sessionID)
+	if err != nil {
+		return fmt.Errorf("error querying timeline markers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		marker := &cognitive.TimelineMarker{}
+		var markerType string
+		var recurrenceJSON []byte
+		var lastTrigger sql.NullTime
+
+		if err := rows.Scan(&marker.ID, &markerType, &marker.Description, &marker.Timestamp,
+			&recurrenceJSON, &marker.Importance, &lastTrigger); err != nil {
+			return fmt.Errorf("error scanning timeline marker: %w", err)
+		}
+
+		marker.Type = cognitive.MarkerType(markerType)
+		if lastTrigger.Valid {
+			marker.LastTrigger = lastTrigger.Time
+		}
+		if len(recurrenceJSON) > 0 {
+			if err := json.Unmarshal(recurrenceJSON, &marker.Recurrence); err != nil {
+				LogError(err, "Failed to deserialize marker recurrence")
+			}
+		}
+
+		memory.RestoreMarker(marker)
+	}
+
+	return rows.Err()
+}
+
+// SaveTimelineMarker upserts a timeline marker for a session
+func SaveTimelineMarker(sessionID string, marker *cognitive.TimelineMarker) error {
+	var recurrenceJSON []byte
+	if marker.Recurrence != nil {
+		var err error
+		recurrenceJSON, err = json.Marshal(marker.Recurrence)
+		if err != nil {
+			return fmt.Errorf("error serializing marker recurrence: %w", err)
+		}
+	}
+
+	var lastTrigger sql.NullTime
+	if !marker.LastTrigger.IsZero() {
+		lastTrigger = sql.NullTime{Time: marker.LastTrigger, Valid: true}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO timeline_markers (id, session_id, type, description, timestamp, recurrence_pattern, importance, last_trigger)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			description = EXCLUDED.description,
+			timestamp = EXCLUDED.timestamp,
+			recurrence_pattern = EXCLUDED.recurrence_pattern,
+			importance = EXCLUDED.importance,
+			last_trigger = EXCLUDED.last_trigger
+	`, marker.ID, sessionID, string(marker.Type), marker.Description, marker.Timestamp,
+		recurrenceJSON, marker.Importance, lastTrigger)
+	if err != nil {
+		return fmt.Errorf("error saving timeline marker: %w", err)
+	}
+	return nil
+}
+
+// sessionMarkerID derives a stable marker ID so well-known markers are stored once per session
+func sessionMarkerID(sessionID, key string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(sessionID+"/"+key)).String()
+}
+
+// EnsureFirstMeeting records the first conversation with a session as a yearly anniversary
+func EnsureFirstMeeting(sessionID string, now time.Time) {
+	id := sessionMarkerID(sessionID, "first_meeting")
+
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.memory.HasMarker(id) {
+		return
+	}
+	st.memory.AddMarker(&cognitive.TimelineMarker{
+		ID:          id,
+		Type:        cognitive.Anniversary,
+		Description: "the day you first met this user",
+		Timestamp:   now,
+		Importance:  0.8,
+		Recurrence: &cognitive.RecurrencePattern{
+			Pattern:    "yearly",
+			Conditions: map[string]interface{}{"kind": "first_meeting"},
+		},
+		// The first meeting itself is not an anniversary
+		LastTrigger: now,
+	})
+	InfoLogger.Printf("📅 Recorded first meeting for session: %s", sessionID)
+}
+
+// SaveBirthday stores (or corrects) the user's birthday as a yearly anniversary
+func SaveBirthday(sessionID string, birthday time.Time) {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.memory.AddMarker(&cognitive.TimelineMarker{
+		ID:          sessionMarkerID(sessionID, "birthday"),
+		Type:        cognitive.Anniversary,
+		Description: "the user's birthday",
+		Timestamp:   birthday,
+		Importance:  0.9,
+		Recurrence: &cognitive.RecurrencePattern{
+			Pattern:    "yearly",
+			Conditions: map[string]interface{}{"kind": "birthday"},
+		},
+	})
+	InfoLogger.Printf("🎂 Saved birthday %s for session: %s", birthday.Format("January 2"), sessionID)
+}
+
+// SessionDates returns the markers due today and those coming up within the horizon
+func SessionDates(sessionID string, now time.Time, loc *time.Location) (due, upcoming []cognitive.MarkerOccurrence) {
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Reminders are delivered on their own rather than mentioned as dates
+	return withoutReminders(st.memory.DueMarkers(now, loc)),
+		withoutReminders(st.memory.UpcomingMarkers(now, loc, upcomingHorizon))
+}
+
+func withoutReminders(occurrences []cognitive.MarkerOccurrence) []cognitive.MarkerOccurrence {
+	filtered := occurrences[:0]
+	for _, occ := range occurrences {
+		if occ.Marker.Type != cognitive.Reminder {
+			filtered = append(filtered, occ)
+		}
+	}
+	return filtered
+}
+
+// MarkDatesMentioned records that due markers were brought up so they aren't repeated
+func MarkDatesMentioned(sessionID string, due []cognitive.MarkerOccurrence, at time.Time) {
+	if len(due) == 0 {
+		return
+	}
+
+	st := getSessionTimeline(sessionID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, occ := range due {
+		st.memory.MarkTriggered(occ.Marker.ID, at)
+	}
+}
+
+// ResolveUserLocation returns the user's time zone, remembering it when the client sends one
+func ResolveUserLocation(sessionID, requested string) *time.Location {
+	if requested != "" {
+		if loc, err := time.LoadLocation(requested); err == nil {
+			if stored, _ := RecallMemory(sessionID, "timezone"); stored != requested {
+				SaveMemory(sessionID, "timezone", requested)
+			}
+			return loc
+		}
+		LogError(fmt.Errorf("unknown time zone %q", requested), "Resolving user location")
+	}
+
+	if stored, err := RecallMemory(sessionID, "timezone"); err == nil && stored != "" {
+		if loc, err := time.LoadLocation(stored); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// describeDate renders a marker occurrence for the prompt
+func describeDate(occ cognitive.MarkerOccurrence) string {
+	description := occ.Marker.Description
+	if occ.Marker.Recurrence != nil && occ.Marker.Recurrence.Conditions["kind"] == "first_meeting" && occ.Index > 0 {
+		years := "years"
+		if occ.Index == 1 {
+			years = "year"
+		}
+		description += fmt.Sprintf(" (%d %s ago)", occ.Index, years)
+	}
+	return description
+}
+
+// describeMemoryAge renders how long ago a memory happened in conversational terms
+func describeMemoryAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Hour:
+		return "just now"
+	case age < 24*time.Hour:
+		return "earlier today"
+	case age < 48*time.Hour:
+		return "yesterday"
+	case age < 14*24*time.Hour:
+		return fmt.Sprintf("%d days ago", int(age.Hours()/24))
+	case age < 60*24*time.Hour:
+		return fmt.Sprintf("%d weeks ago", int(age.Hours()/(24*7)))
+	default:
+		return fmt.Sprintf("%d months ago", int(age.Hours()/(24*30)))
+	}
+}
+
+// nonNilStrings keeps NOT NULL array columns from receiving NULL
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
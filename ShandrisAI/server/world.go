@@ -0,0 +1,311 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aikaw/ShandrisAI/server/cognitive"
+)
+
+// worldTopics are the topics where Shandris is asked to track the scene even before anything is recorded
+var worldTopics = map[string]bool{"lore": true, "combat": true, "history": true}
+
+// LoadWorldState returns the session's roleplay world, empty if none was recorded
+func LoadWorldState(sessionID string) *cognitive.WorldState {
+	var raw []byte
+	err := db.QueryRow(`SELECT state FROM world_states WHERE session_id = $1`, sessionID).Scan(&raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			LogError(err, "Failed to load world state")
+		}
+		return cognitive.NewWorldState()
+	}
+
+	state := cognitive.NewWorldState()
+	if err := json.Unmarshal(raw, state); err != nil {
+		LogError(err, "Failed to parse world state")
+		return cognitive.NewWorldState()
+	}
+	if state.Entities == nil {
+		state.Entities = make(map[string]*cognitive.WorldEntity)
+	}
+	return state
+}
+
+// SaveWorldState stores the session's current world
+func SaveWorldState(sessionID string, state *cognitive.WorldState) error {
+	return saveWorldState(db, sessionID, state)
+}
+
+func saveWorldState(ex execer, sessionID string, state *cognitive.WorldState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error serializing world state: %w", err)
+	}
+	_, err = ex.Exec(`
+		INSERT INTO world_states (session_id, state, turn, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET
+			state = EXCLUDED.state, turn = EXCLUDED.turn, updated_at = CURRENT_TIMESTAMP
+	`, sessionID, raw, state.Turn)
+	if err != nil {
+		return fmt.Errorf("error saving world state: %w", err)
+	}
+	return nil
+}
+
+// RecordWorldTurn advances the world by one turn, saves it and snapshots it. startedAt is when
+// the turn began, so a rewind can drop the chat turns recorded from then on.
+func RecordWorldTurn(sessionID string, state *cognitive.WorldState, startedAt time.Time) {
+	if err := recordWorldTurn(db, sessionID, state, startedAt); err != nil {
+		LogError(err, "Failed to record world turn")
+	}
+}
+
+// CommitWorldTurn stores a chat turn's dice rolls, fight and world in one transaction, once
+// the reply has been generated. The world only advances a turn if there is one.
+func CommitWorldTurn(sessionID string, state *cognitive.WorldState, mechanics Mechanics, startedAt time.Time) error {
+	if len(mechanics.rolls) == 0 && !mechanics.saveCombat && state.IsEmpty() {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting world turn: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := logRolls(tx, sessionID, mechanics.seed, mechanics.rolls); err != nil {
+		return err
+	}
+	if mechanics.saveCombat {
+		if err := saveCombat(tx, sessionID, mechanics.combat); err != nil {
+			return err
+		}
+	}
+	if !state.IsEmpty() {
+		if err := recordWorldTurn(tx, sessionID, state, startedAt); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing world turn: %w", err)
+	}
+	return nil
+}
+
+func recordWorldTurn(ex execer, sessionID string, state *cognitive.WorldState, startedAt time.Time) error {
+	state.Turn++
+	if err := saveWorldState(ex, sessionID, state); err != nil {
+		return err
+	}
+
+	raw, _ := json.Marshal(state)
+	_, err := ex.Exec(`
+		INSERT INTO world_snapshots (session_id, turn, state, started_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, turn) DO UPDATE SET state = EXCLUDED.state, started_at = EXCLUDED.started_at
+	`, sessionID, state.Turn, raw, startedAt)
+	if err != nil {
+		return fmt.Errorf("error snapshotting world state: %w", err)
+	}
+	return nil
+}
+
+// RewindWorld restores the world as it was the given number of turns ago and removes the chat
+// turns recorded since, so scene and conversation rewind together
+func RewindWorld(sessionID string, turns int) (*cognitive.WorldState, error) {
+	current := LoadWorldState(sessionID)
+	target := current.Turn - turns
+	if target < 0 {
+		target = 0
+	}
+
+	// The first undone turn marks where the conversation is cut
+	var cutoff time.Time
+	err := db.QueryRow(`
+		SELECT started_at FROM world_snapshots WHERE session_id = $1 AND turn = $2
+	`, sessionID, target+1).Scan(&cutoff)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return current, fmt.Errorf("nothing to rewind")
+		}
+		return current, fmt.Errorf("error finding world snapshot: %w", err)
+	}
+
+	restored := cognitive.NewWorldState()
+	if target > 0 {
+		var raw []byte
+		err := db.QueryRow(`
+			SELECT state FROM world_snapshots WHERE session_id = $1 AND turn = $2
+		`, sessionID, target).Scan(&raw)
+		if err != nil {
+			return current, fmt.Errorf("error loading world snapshot: %w", err)
+		}
+		if err := json.Unmarshal(raw, restored); err != nil {
+			return current, fmt.Errorf("error parsing world snapshot: %w", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return current, fmt.Errorf("error starting rewind: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM world_snapshots WHERE session_id = $1 AND turn > $2`, sessionID, target); err != nil {
+		return current, fmt.Errorf("error removing world snapshots: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM chat_history WHERE session_id = $1 AND timestamp >= $2`, sessionID, cutoff); err != nil {
+		return current, fmt.Errorf("error rewinding chat history: %w", err)
+	}
+	raw, _ := json.Marshal(restored)
+	if _, err := tx.Exec(`
+		INSERT INTO world_states (session_id, state, turn, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id) DO UPDATE SET
+			state = EXCLUDED.state, turn = EXCLUDED.turn, updated_at = CURRENT_TIMESTAMP
+	`, sessionID, raw, restored.Turn); err != nil {
+		return current, fmt.Errorf("error restoring world state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return current, fmt.Errorf("error committing rewind: %w", err)
+	}
+
+	InfoLogger.Printf("⏪ Rewound world for session %s from turn %d to %d", sessionID, current.Turn, restored.Turn)
+	return restored, nil
+}
+
+// ResetWorld forgets the session's world and its snapshots; the conversation is kept
+func ResetWorld(sessionID string) error {
+	if _, err := db.Exec(`DELETE FROM world_snapshots WHERE session_id = $1`, sessionID); err != nil {
+		return fmt.Errorf("error removing world snapshots: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM world_states WHERE session_id = $1`, sessionID); err != nil {
+		return fmt.Errorf("error removing world state: %w", err)
+	}
+	return nil
+}
+
+// worldCommandReply runs a /world command and describes the result in Shandris's voice
+func worldCommandReply(sessionID, prompt string, startedAt time.Time) string {
+	cmd, err := cognitive.ParseWorldCommand(prompt)
+	if err != nil {
+		return "I couldn't make sense of that world command. " + capitalize(err.Error()) + "."
+	}
+
+	switch cmd.Action {
+	case "show":
+		state := LoadWorldState(sessionID)
+		if state.IsEmpty() {
+			return "The world is a blank page so far. Set the scene and I'll keep track of it."
+		}
+		return "Here's where things stand:\n" + state.Render("")
+
+	case "reset":
+		if err := ResetWorld(sessionID); err != nil {
+			LogError(err, "Failed to reset world")
+			return "Something resisted the reset. The world stays as it was, for now."
+		}
+		return "Done. The world is wiped clean; we start from nothing."
+
+	case "rewind":
+		state, err := RewindWorld(sessionID, cmd.Turns)
+		if err != nil {
+			return "I can't rewind that far: " + err.Error() + "."
+		}
+		if state.IsEmpty() {
+			return "Rewound to before the scene began."
+		}
+		return fmt.Sprintf("Rewound to turn %d. The scene as it stood:\n%s", state.Turn, state.Render(""))
+	}
+
+	state := LoadWorldState(sessionID)
+	if err := state.Apply(cmd.Ops); err != nil {
+		return "That didn't take: " + err.Error() + "."
+	}
+	RecordWorldTurn(sessionID, state, startedAt)
+	return "Noted. The world now reads:\n" + state.Render(prompt)
+}
+
+// describeWorld renders the world section of the prompt, including how to report scene changes
+func describeWorld(state *cognitive.WorldState, window, topic string) string {
+	if state.IsEmpty() && !worldTopics[topic] {
+		return ""
+	}
+
+	var b strings.Builder
+	if rendered := state.Render(window); rendered != "" {
+		b.WriteString("\nWORLD STATE (the roleplay scene so far; keep it consistent):\n" + rendered + "\n")
+	}
+	b.WriteString(`
+When the scene changes (the party moves, gains or loses items, meets NPCs, advances a quest),
+end your reply with a hidden block of JSON operations, for example:
+<world>[{"op":"relate","entity":"party","relation":"located_in","target":"Old Mill"},{"op":"set","entity":"Old Mill","key":"state","value":"burning"}]</world>
+Operations: add {kind,name}, set/unset {entity,key,value}, remove {entity}, relate/unrelate {entity,relation,target}.
+Kinds: party, location, item, npc, quest, faction. Relations include located_in, carries and knows.
+Omit the block when nothing changed. Never mention it.
+`)
+	return b.String()
+}
+
+// WorldHandler returns a session's world state (GET ?session_id=) or rewinds it (POST {session_id, turns})
+func WorldHandler(w http.ResponseWriter, r *http.Request) {
+	defer LogOperation("WorldHandler", map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	})(nil)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			LogError(fmt.Errorf("missing session ID"), "Request validation")
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(LoadWorldState(sessionID))
+
+	case http.MethodPost:
+		var req struct {
+			SessionID string `json:"session_id"`
+			Turns     int    `json:"turns"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.SessionID == "" {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+			return
+		}
+		if req.Turns < 1 {
+			req.Turns = 1
+		}
+		state, err := RewindWorld(req.SessionID, req.Turns)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(state)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
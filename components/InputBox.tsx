@@ -24,6 +24,38 @@ export default function InputBox({ setResponse }: { setResponse: (text: string)
     generateSessionId();
   }, []);
 
+  useEffect(() => {
+    if (!sessionId) return;
+
+    // Pick up messages Shandris sends on her own (reminders, greetings, follow-ups)
+    const checkOutbox = async () => {
+      try {
+        const timezone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+        const res = await fetch(
+          `http://localhost:8080/api/outbox?session_id=${encodeURIComponent(sessionId)}&timezone=${encodeURIComponent(timezone)}`
+        );
+        const data = await res.json();
+        if (!data.messages?.length) return;
+
+        setResponse(data.messages.map((m: { content: string }) => m.content).join("\n\n"));
+        await fetch("http://localhost:8080/api/outbox", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({
+            session_id: sessionId,
+            ids: data.messages.map((m: { id: string }) => m.id)
+          }),
+        });
+      } catch (error) {
+        console.error("Error checking outbox:", error);
+      }
+    };
+
+    checkOutbox();
+    const interval = setInterval(checkOutbox, 60000);
+    return () => clearInterval(interval);
+  }, [sessionId, setResponse]);
+
   const handleCopy = () => navigator.clipboard.writeText(input);
   const handlePaste = async () => setInput(await navigator.clipboard.readText());
 
@@ -38,7 +70,8 @@ export default function InputBox({ setResponse }: { setResponse: (text: string)
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ 
           prompt: input,
-          session_id: sessionId 
+          session_id: sessionId,
+          timezone: Intl.DateTimeFormat().resolvedOptions().timeZone
         }),
       });
 